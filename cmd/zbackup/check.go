@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"zbackup/pkg/core"
+	"zbackup/pkg/endpoint"
+)
+
+func newCheckCmd(sshFlags func() endpoint.SSHOptions) *cobra.Command {
+	var (
+		destPath string
+		readData bool
+	)
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "检查仓库中所有快照引用的数据是否存在，--read-data 时重新读取并校验哈希",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := sshFlags()
+			repo, err := endpoint.ParseEndpoint(destPath, opts.Port, opts)
+			if err != nil {
+				return err
+			}
+			report, err := core.Check(cmd.Context(), repo, core.CheckOptions{ReadData: readData})
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			for _, problem := range report.Problems {
+				fmt.Fprintln(out, problem)
+			}
+			fmt.Fprintf(out, "快照 %d，被引用的数据块 %d，未被引用的数据块 %d，镜像文件 %d\n",
+				report.Snapshots, report.Chunks, report.Unreferenced, report.Files)
+			if len(report.Problems) > 0 {
+				return fmt.Errorf("发现 %d 个问题", len(report.Problems))
+			}
+			fmt.Fprintln(out, "未发现问题")
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&destPath, "dest", "d", "", "目标路径 (本地路径、user@host:/path、s3://bucket/prefix 或 webdav[s]://host/path)")
+	cmd.Flags().BoolVar(&readData, "read-data", false, "读取全部被引用的数据块与镜像文件并校验哈希")
+	_ = cmd.MarkFlagRequired("dest")
+	return cmd
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"zbackup/pkg/core"
+	"zbackup/pkg/endpoint"
+)
+
+func newGCCmd(sshFlags func() endpoint.SSHOptions) *cobra.Command {
+	var (
+		destPath string
+		grace    time.Duration
+		dryRun   bool
+	)
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "删除不再被任何快照引用的数据块与残留的临时块文件",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := sshFlags()
+			repo, err := endpoint.ParseEndpoint(destPath, opts.Port, opts)
+			if err != nil {
+				return err
+			}
+			report, err := core.GC(cmd.Context(), repo, core.GCOptions{Grace: grace, DryRun: dryRun})
+			out := cmd.OutOrStdout()
+			prefix := ""
+			if dryRun {
+				prefix = "[dry-run] 将"
+			}
+			for _, rel := range report.Removed {
+				fmt.Fprintf(out, "%s删除 %s\n", prefix, rel)
+			}
+			fmt.Fprintf(out, "被引用 %d，宽限期内保留 %d，%s删除 %d 个（%d 字节）\n",
+				report.Referenced, report.InGrace, prefix, len(report.Removed), report.RemovedBytes)
+			return err
+		},
+	}
+	cmd.Flags().StringVarP(&destPath, "dest", "d", "", "目标路径 (本地路径、user@host:/path、s3://bucket/prefix 或 webdav[s]://host/path)")
+	cmd.Flags().DurationVar(&grace, "grace", 24*time.Hour, "宽限期：修改时间在此之内的未引用块可能属于进行中的运行，予以保留")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "只列出将被删除的文件，不加锁也不删除")
+	_ = cmd.MarkFlagRequired("dest")
+	return cmd
+}
@@ -5,11 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"zbackup/pkg/core"
 	"zbackup/pkg/endpoint"
+	"zbackup/pkg/fssnap"
+	"zbackup/pkg/review"
+	"zbackup/pkg/transfer"
 )
 
 func main() {
@@ -22,10 +26,12 @@ func main() {
 func newRootCmd() *cobra.Command {
 	var (
 		sourcePath   string
-		destPath     string
+		destPaths    []string
+		set          string
 		port         int
 		identity     string
 		sshOptions   []string
+		remoteAgent  string
 		mode         string
 		checksum     string
 		noProgress   bool
@@ -34,39 +40,96 @@ func newRootCmd() *cobra.Command {
 		excludes     []string
 		dryRun       bool
 		snapshotName string
+		lockWait     time.Duration
+		metricsFile  string
+		notifyFlags  notifyOptions
+		retries      int
+		retryBackoff time.Duration
+		retryChanged bool
+		archiveBase  string
+		chunked      bool
+		tree         bool
+		interactive  bool
+		confirmDels  int
+		guard        core.Guard
+		backupDir    string
+		backupDays   int
+		fsSnapshot   string
+		fsSnapCreate string
+		fsSnapRemove string
 	)
 
 	cmd := &cobra.Command{
 		Use:   "zbackup",
 		Short: "基于 SSH 的增量备份工具",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if sourcePath == "" || destPath == "" {
+			if sourcePath == "" || len(destPaths) == 0 {
 				return errors.New("必须同时指定 --source 与 --dest")
 			}
 			sshOpts := endpoint.SSHOptions{
 				Port:      port,
 				Identity:  identity,
 				ExtraOpts: sshOptions,
+				Agent:     remoteAgent,
 			}
 			srcEndpoint, err := endpoint.ParseEndpoint(sourcePath, port, sshOpts)
 			if err != nil {
 				return err
 			}
-			destEndpoint, err := endpoint.ParseEndpoint(destPath, port, sshOpts)
+			var destEndpoints []endpoint.Endpoint
+			for _, destPath := range destPaths {
+				destEndpoint, err := endpoint.ParseEndpoint(destPath, port, sshOpts)
+				if err != nil {
+					return err
+				}
+				destEndpoints = append(destEndpoints, destEndpoint)
+			}
+			notifyCfg, err := notifyFlags.config()
 			if err != nil {
 				return err
 			}
 			cfg := &core.BackupConfig{
-				Source:       srcEndpoint,
-				Dest:         destEndpoint,
-				Mode:         parseMode(mode),
-				Checksum:     parseChecksum(checksum),
-				Excludes:     excludes,
-				DryRun:       dryRun,
-				SnapshotName: snapshotName,
-				LogFile:      logFile,
-				LogLevel:     logLevel,
-				NoProgress:   noProgress,
+				Source:         srcEndpoint,
+				Dest:           destEndpoints[0],
+				Set:            set,
+				Mode:           parseMode(mode),
+				Checksum:       parseChecksum(checksum),
+				Excludes:       excludes,
+				DryRun:         dryRun,
+				SnapshotName:   snapshotName,
+				LogFile:        logFile,
+				LogLevel:       logLevel,
+				NoProgress:     noProgress,
+				LockWait:       lockWait,
+				MetricsFile:    metricsFile,
+				Notify:         notifyCfg,
+				Retries:        retries,
+				RetryBackoff:   retryBackoff,
+				RetryChanged:   retryChanged,
+				ArchiveBase:    archiveBase,
+				Chunked:        chunked,
+				Tree:           tree,
+				Guard:          guard,
+				BackupDir:      backupDir,
+				BackupKeepDays: backupDays,
+			}
+			if len(destEndpoints) > 1 {
+				cfg.Dests = destEndpoints
+			}
+			if cfg.FSSnapshot, err = parseFSSnapshot(fsSnapshot, fsSnapCreate, fsSnapRemove); err != nil {
+				return err
+			}
+			if interactive {
+				if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+					return errors.New("--interactive 需要在终端中运行")
+				}
+				cfg.Review = func(plan transfer.Plan) (bool, error) {
+					err := review.Run(os.Stdin, cmd.OutOrStdout(), plan, review.Options{DeleteThreshold: confirmDels})
+					if errors.Is(err, review.ErrRejected) {
+						return false, nil
+					}
+					return err == nil, err
+				}
 			}
 			ctx := cmd.Context()
 			if ctx == nil {
@@ -76,29 +139,83 @@ func newRootCmd() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVarP(&sourcePath, "source", "s", "", "源路径 (本地路径或 user@host:/path)")
-	cmd.Flags().StringVarP(&destPath, "dest", "d", "", "目标路径 (本地路径或 user@host:/path)")
-	cmd.Flags().IntVarP(&port, "port", "p", 22, "SSH 端口")
-	cmd.Flags().StringVarP(&identity, "identity", "i", "", "SSH 私钥路径")
-	cmd.Flags().StringArrayVarP(&sshOptions, "ssh-option", "o", nil, "透传 ssh 参数，可多次指定")
-	cmd.Flags().StringVarP(&mode, "mode", "m", string(endpoint.ModeIncr), "备份模式：full / incr")
+	cmd.Flags().StringVarP(&sourcePath, "source", "s", "", "源路径 (本地路径、user@host:/path、s3://bucket/prefix 或 webdav[s]://host/path)")
+	cmd.Flags().StringArrayVarP(&destPaths, "dest", "d", nil, "目标路径 (本地路径、user@host:/path、s3://bucket/prefix、webdav[s]://host/path 或 tar://out.tar.gz)；可重复指定，一次扫描同时备份到多个目标端")
+	cmd.Flags().StringVar(&set, "set", "", "备份集名称；同一目标仓库可容纳多个备份集，数据写入 <dest>/<set>/，各自独立维护快照与进度")
+	cmd.PersistentFlags().IntVarP(&port, "port", "p", 22, "SSH 端口")
+	cmd.PersistentFlags().StringVarP(&identity, "identity", "i", "", "SSH 私钥路径")
+	cmd.PersistentFlags().StringArrayVarP(&sshOptions, "ssh-option", "o", nil, "透传 ssh 参数，可多次指定")
+	cmd.PersistentFlags().StringVar(&remoteAgent, "remote-agent", "zbackup", "远端 zbackup 命令，存在时通过 serve --stdio 单会话访问远端；置空则只用 shell 命令")
+	cmd.Flags().StringVarP(&mode, "mode", "m", string(endpoint.ModeIncr), "备份模式：full / incr / sync（双向同步）")
 	cmd.Flags().StringVar(&checksum, "checksum", string(endpoint.ChecksumSHA256), "校验算法：none / md5 / sha1 / sha256")
 	cmd.Flags().BoolVar(&noProgress, "no-progress", false, "禁用进度条显示")
 	cmd.Flags().StringVar(&logFile, "log-file", "", "指定日志文件，不填则写入目标端 .zbackup/logs/")
 	cmd.Flags().StringVar(&logLevel, "log-level", "info", "日志级别：debug / info / warn / error")
 	cmd.Flags().StringArrayVar(&excludes, "exclude", nil, "排除模式，可多次指定")
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "演示模式，不执行真正传输")
+	cmd.Flags().BoolVar(&interactive, "interactive", false, "扫描后先按动作与目录分组展示计划，可逐级展开目录，确认后才执行；与 --dry-run 同用时只浏览计划")
+	cmd.Flags().IntVar(&confirmDels, "confirm-deletes", 100, "交互确认时删除条目超过此数量需输入删除数量确认；-1 表示有删除就需要")
 	cmd.Flags().StringVar(&snapshotName, "snapshot-name", "", "自定义快照名，默认为当前 UTC 时间戳")
+	cmd.Flags().StringVar(&metricsFile, "metrics-file", "", "运行结束后写入 Prometheus 指标的本地文件（node_exporter textfile，如 /var/lib/node_exporter/zbackup.prom）")
+	cmd.Flags().IntVar(&retries, "retries", 2, "单个文件遇到连接中断、校验失败等暂时性错误时的重试次数")
+	cmd.Flags().DurationVar(&retryBackoff, "retry-backoff", 2*time.Second, "首次重试前的等待时间，之后每次翻倍（最长 1 分钟）")
+	cmd.Flags().BoolVar(&retryChanged, "retry-changed", false, "运行结束前把复制期间源端发生变化的文件再传输一次")
+	cmd.Flags().BoolVar(&chunked, "chunked", false, "分块存储：文件按内容切块后去重存入目标端 .zbackup/chunks/，只上传目标端没有的块")
+	cmd.Flags().StringVar(&archiveBase, "incremental-from", "", "目标为 tar:// 归档时，只写入相对该归档内嵌快照有变化的文件，生成增量归档")
+	cmd.Flags().BoolVar(&tree, "tree", false, "每个快照写入目标端 snapshots-tree/<快照名>/，未变化的文件从上一快照目录硬链接，各版本都可直接浏览")
+	cmd.Flags().StringVar(&fsSnapshot, "fs-snapshot", "", "扫描前为源端创建文件系统快照并从中读取：btrfs[:<子卷>]、zfs:<数据集>、lvm:<卷组>/<逻辑卷>[:<大小>]")
+	cmd.Flags().StringVar(&fsSnapCreate, "fs-snapshot-create", "", "自定义快照创建命令（在源端主机执行），标准输出最后一行为冻结视图路径")
+	cmd.Flags().StringVar(&fsSnapRemove, "fs-snapshot-remove", "", "自定义快照删除命令，运行结束后总会执行")
+	cmd.Flags().StringVar(&backupDir, "backup-dir", "", "目标端被覆盖或删除的文件先移到该目录下的 <快照名>/ 保存，路径相对数据目录（同 rsync --backup-dir）")
+	cmd.Flags().IntVar(&backupDays, "backup-keep-days", 30, "使用 --backup-dir 时每次运行旧文件的保留天数，每次成功运行后清理更早的；0 表示不清理")
+	cmd.Flags().IntVar(&guard.MaxDeletes, "max-delete", 0, "全量模式单次最多删除的条目数，超过则中止；0 表示不限制")
+	cmd.Flags().Float64Var(&guard.MaxDeletePercent, "max-delete-percent", 50, "全量模式删除条目占上一快照的百分比上限，超过则中止；0 表示不限制")
+	cmd.Flags().BoolVar(&guard.RequireMount, "require-mount", false, "要求源端根目录是挂载点，防止磁盘未挂载时备份空目录")
+	cmd.Flags().StringVar(&guard.Marker, "require-marker", "", "要求源端存在该相对路径的标记文件，否则中止")
+	cmd.Flags().BoolVar(&guard.Force, "force", false, "跳过源端为空、删除过多、挂载点与标记文件检查")
+	notifyFlags.register(cmd)
+	cmd.Flags().DurationVar(&lockWait, "wait", 0, "目标端被其他进程锁定时的最长等待时间，如 10m；默认立即失败")
 
 	_ = cmd.MarkFlagRequired("source")
 	_ = cmd.MarkFlagRequired("dest")
+
+	sshFlags := func() endpoint.SSHOptions {
+		return endpoint.SSHOptions{Port: port, Identity: identity, ExtraOpts: sshOptions, Agent: remoteAgent}
+	}
+	cmd.AddCommand(newUnlockCmd(sshFlags))
+	cmd.AddCommand(newMigrateCmd(sshFlags))
+	cmd.AddCommand(newSnapshotsCmd(sshFlags))
+	cmd.AddCommand(newPruneCmd(sshFlags))
+	cmd.AddCommand(newGCCmd(sshFlags))
+	cmd.AddCommand(newCheckCmd(sshFlags))
+	cmd.AddCommand(newServeCmd())
+	cmd.AddCommand(newRestoreCmd(sshFlags))
+	cmd.AddCommand(newMountCmd(sshFlags))
+	cmd.AddCommand(newWebCmd(sshFlags))
 	return cmd
 }
 
+// parseFSSnapshot 根据 --fs-snapshot 或自定义命令构造文件系统快照提供者，均未指定时返回 nil
+func parseFSSnapshot(spec, create, remove string) (fssnap.Provider, error) {
+	switch {
+	case spec != "" && (create != "" || remove != ""):
+		return nil, errors.New("--fs-snapshot 不能与 --fs-snapshot-create/--fs-snapshot-remove 同时使用")
+	case spec != "":
+		return fssnap.Parse(spec)
+	case create != "":
+		return &fssnap.Command{CreateCmd: create, RemoveCmd: remove}, nil
+	case remove != "":
+		return nil, errors.New("--fs-snapshot-remove 需要与 --fs-snapshot-create 一起使用")
+	}
+	return nil, nil
+}
+
 func parseMode(val string) endpoint.BackupMode {
 	switch endpoint.BackupMode(val) {
 	case endpoint.ModeFull:
 		return endpoint.ModeFull
+	case endpoint.ModeSync:
+		return endpoint.ModeSync
 	default:
 		return endpoint.ModeIncr
 	}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"zbackup/pkg/endpoint"
+)
+
+func newMigrateCmd(sshFlags func() endpoint.SSHOptions) *cobra.Command {
+	var destPath, set string
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "把目标端旧版 JSON 快照转换为压缩索引格式",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, closeFS, err := openDestStore(destPath, set, sshFlags())
+			if err != nil {
+				return err
+			}
+			defer closeFS()
+			n, err := store.Migrate()
+			if err != nil {
+				return fmt.Errorf("迁移快照失败: %w", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "已转换 %d 个快照文件\n", n)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&destPath, "dest", "d", "", "目标路径 (本地路径、user@host:/path、s3://bucket/prefix 或 webdav[s]://host/path)")
+	cmd.Flags().StringVar(&set, "set", "", "备份集名称，不填为默认备份集")
+	_ = cmd.MarkFlagRequired("dest")
+	return cmd
+}
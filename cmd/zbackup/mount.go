@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"zbackup/pkg/core"
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/fuse"
+)
+
+func newMountCmd(sshFlags func() endpoint.SSHOptions) *cobra.Command {
+	var (
+		set        string
+		allowOther bool
+	)
+	cmd := &cobra.Command{
+		Use:   "mount <dest> <mountpoint>",
+		Short: "以只读 FUSE 文件系统挂载仓库快照，在 <mountpoint>/snapshots/<快照名>/ 下浏览与复制旧版本；Ctrl-C 卸载",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := sshFlags()
+			repo, err := endpoint.ParseEndpoint(args[0], opts.Port, opts)
+			if err != nil {
+				return err
+			}
+			r, err := core.OpenRepository(repo)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			fsys, err := r.SnapshotFS(set)
+			if err != nil {
+				return err
+			}
+			stderr := cmd.ErrOrStderr()
+			srv, err := fuse.Mount(args[1], fsys, fuse.Options{
+				FSName:     repo.DisplayName(),
+				AllowOther: allowOther,
+				ErrorLog: func(op, path string, err error) {
+					var pathErr *fs.PathError
+					if errors.As(err, &pathErr) {
+						err = pathErr.Err
+					}
+					fmt.Fprintf(stderr, "%s %s 失败: %v\n", op, path, err)
+				},
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "已挂载 %s 到 %s，按 Ctrl-C 卸载\n", repo.DisplayName(), args[1])
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			go func() {
+				<-ctx.Done()
+				if err := srv.Unmount(); err != nil {
+					fmt.Fprintf(stderr, "%v（挂载点仍在使用中？关闭相关进程后可手动 umount）\n", err)
+				}
+			}()
+			return srv.Serve()
+		},
+	}
+	cmd.Flags().StringVar(&set, "set", "", "备份集名称，不填为默认备份集")
+	cmd.Flags().BoolVar(&allowOther, "allow-other", false, "允许其他用户访问挂载点（非 root 需在 /etc/fuse.conf 启用 user_allow_other）")
+	return cmd
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"zbackup/pkg/notify"
+)
+
+// smtpPasswordEnv 指定 SMTP 密码的环境变量，避免密码出现在进程列表中
+const smtpPasswordEnv = "ZBACKUP_SMTP_PASSWORD"
+
+type notifyOptions struct {
+	on           string
+	webhook      string
+	command      string
+	smtpAddr     string
+	smtpUser     string
+	from         string
+	to           []string
+	subject      string
+	templateFile string
+}
+
+func (o *notifyOptions) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.on, "notify-on", string(notify.RuleFailure), "通知时机：failure / always / change")
+	cmd.Flags().StringVar(&o.webhook, "notify-webhook", "", "运行结束后向该 URL POST JSON 摘要")
+	cmd.Flags().StringVar(&o.command, "notify-command", "", "运行结束后执行的命令，正文经 stdin 传入，摘要字段见 ZBACKUP_* 环境变量")
+	cmd.Flags().StringVar(&o.smtpAddr, "notify-smtp", "", "SMTP 服务器地址 host:port，密码通过 "+smtpPasswordEnv+" 环境变量提供")
+	cmd.Flags().StringVar(&o.smtpUser, "notify-smtp-user", "", "SMTP 登录用户名")
+	cmd.Flags().StringVar(&o.from, "notify-from", "", "通知邮件发件人")
+	cmd.Flags().StringArrayVar(&o.to, "notify-to", nil, "通知邮件收件人，可多次指定")
+	cmd.Flags().StringVar(&o.subject, "notify-subject", "", "通知标题模板（text/template 语法）")
+	cmd.Flags().StringVar(&o.templateFile, "notify-template", "", "通知正文模板文件（text/template 语法）")
+}
+
+func (o *notifyOptions) config() (notify.Config, error) {
+	on, err := parseNotifyRule(o.on)
+	if err != nil {
+		return notify.Config{}, err
+	}
+	cfg := notify.Config{
+		On:              on,
+		Webhook:         o.webhook,
+		Command:         o.command,
+		SubjectTemplate: o.subject,
+		SMTP: notify.SMTPConfig{
+			Addr:     o.smtpAddr,
+			Username: o.smtpUser,
+			Password: os.Getenv(smtpPasswordEnv),
+			From:     o.from,
+			To:       o.to,
+		},
+	}
+	if o.templateFile != "" {
+		data, err := os.ReadFile(o.templateFile)
+		if err != nil {
+			return notify.Config{}, fmt.Errorf("读取通知模板失败: %w", err)
+		}
+		cfg.BodyTemplate = string(data)
+	}
+	return cfg, nil
+}
+
+func parseNotifyRule(val string) (notify.Rule, error) {
+	switch rule := notify.Rule(val); rule {
+	case notify.RuleFailure, notify.RuleAlways, notify.RuleChange:
+		return rule, nil
+	default:
+		return "", fmt.Errorf("未知的 --notify-on 取值 %q，可选 failure、always、change", val)
+	}
+}
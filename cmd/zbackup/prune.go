@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"zbackup/pkg/core"
+	"zbackup/pkg/endpoint"
+)
+
+func newPruneCmd(sshFlags func() endpoint.SSHOptions) *cobra.Command {
+	var (
+		destPath  string
+		set       string
+		allSets   bool
+		keepLast  int
+		trashDays int
+		backupDir string
+		dryRun    bool
+	)
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "按保留数量清理旧快照，latest 与未完成进度引用的快照始终保留；--trash-days 清理过期的回收目录",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if allSets && cmd.Flags().Changed("set") {
+				return errors.New("--set 与 --all-sets 不能同时使用")
+			}
+			if keepLast == 0 && trashDays == 0 {
+				return errors.New("至少需要指定 --keep-last 或 --trash-days")
+			}
+			if trashDays > 0 {
+				if backupDir == "" {
+					return errors.New("--trash-days 需要用 --backup-dir 指定备份时使用的目录")
+				}
+				dir, err := core.CleanBackupDir(backupDir)
+				if err != nil {
+					return err
+				}
+				backupDir = dir
+			}
+			repo, closeFS, err := openDestStore(destPath, "", sshFlags())
+			if err != nil {
+				return err
+			}
+			defer closeFS()
+			stores, err := selectSets(repo, set, !allSets)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			trashBefore := time.Now().AddDate(0, 0, -trashDays)
+			for _, store := range stores {
+				label := setLabel(store.Set())
+				if dryRun {
+					if keepLast > 0 {
+						names, err := store.PruneCandidates(keepLast)
+						if err != nil {
+							return fmt.Errorf("备份集 %s: %w", label, err)
+						}
+						for _, name := range names {
+							fmt.Fprintf(out, "[dry-run] %s: 将删除快照 %s\n", label, name)
+						}
+					}
+					if trashDays > 0 {
+						names, err := store.TrashCandidates(backupDir, trashBefore)
+						if err != nil {
+							return fmt.Errorf("备份集 %s: %w", label, err)
+						}
+						for _, name := range names {
+							fmt.Fprintf(out, "[dry-run] %s: 将删除回收目录 %s\n", label, name)
+						}
+					}
+					continue
+				}
+				lock, err := store.AcquireLock(cmd.Context(), 0)
+				if err != nil {
+					return fmt.Errorf("备份集 %s: 获取锁失败: %w", label, err)
+				}
+				var removed, purged []string
+				if keepLast > 0 {
+					removed, err = store.Prune(keepLast)
+				}
+				if err == nil && trashDays > 0 {
+					purged, err = store.PurgeTrash(backupDir, trashBefore)
+				}
+				lock.Release()
+				for _, name := range removed {
+					fmt.Fprintf(out, "%s: 已删除快照 %s\n", label, name)
+				}
+				for _, name := range purged {
+					fmt.Fprintf(out, "%s: 已删除回收目录 %s\n", label, name)
+				}
+				if err != nil {
+					return fmt.Errorf("备份集 %s: 清理失败: %w", label, err)
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&destPath, "dest", "d", "", "目标路径 (本地路径、user@host:/path、s3://bucket/prefix 或 webdav[s]://host/path)")
+	cmd.Flags().StringVar(&set, "set", "", "备份集名称，不填为默认备份集")
+	cmd.Flags().BoolVar(&allSets, "all-sets", false, "对默认备份集与所有命名备份集执行清理")
+	cmd.Flags().IntVar(&keepLast, "keep-last", 0, "每个备份集保留的最新快照数量")
+	cmd.Flags().IntVar(&trashDays, "trash-days", 0, "删除早于该天数的回收目录（--backup-dir 保存的旧版本）")
+	cmd.Flags().StringVar(&backupDir, "backup-dir", "", "备份时 --backup-dir 指定的目录，与 --trash-days 一起使用")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "只列出将被删除的快照与回收目录")
+	_ = cmd.MarkFlagRequired("dest")
+	return cmd
+}
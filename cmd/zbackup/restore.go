@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"zbackup/pkg/archive"
+	"zbackup/pkg/core"
+	"zbackup/pkg/endpoint"
+)
+
+func newRestoreCmd(sshFlags func() endpoint.SSHOptions) *cobra.Command {
+	var target, repoPath, set, snapshot string
+	cmd := &cobra.Command{
+		Use:   "restore [<archive>...]",
+		Short: "恢复到本地目录：从 tar 归档链（先全量、再按顺序给出增量），或用 --repo 从备份仓库的快照恢复",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if target == "" {
+				return errors.New("必须指定 --target")
+			}
+			if repoPath != "" {
+				if len(args) > 0 {
+					return errors.New("--repo 与归档文件不能同时指定")
+				}
+				opts := sshFlags()
+				repo, err := endpoint.ParseEndpoint(repoPath, opts.Port, opts)
+				if err != nil {
+					return err
+				}
+				snap, err := core.RestoreSnapshot(repo, set, snapshot, target)
+				if err != nil {
+					return fmt.Errorf("恢复失败: %w", err)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "已恢复快照 %s（%d 个条目）到 %s\n", snap.Name, len(snap.Files), target)
+				return nil
+			}
+			if len(args) == 0 {
+				return errors.New("请指定归档文件或 --repo")
+			}
+			archives := make([]string, len(args))
+			for i, arg := range args {
+				archives[i] = strings.TrimPrefix(arg, "tar://")
+			}
+			snap, err := archive.Restore(archives, target)
+			if err != nil {
+				return fmt.Errorf("恢复失败: %w", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "已恢复快照 %s（%d 个条目）到 %s\n", snap.Name, len(snap.Files), target)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&target, "target", "t", "", "恢复到的本地目录")
+	cmd.Flags().StringVar(&repoPath, "repo", "", "备份仓库（即备份时的 --dest）")
+	cmd.Flags().StringVar(&set, "set", "", "配合 --repo：备份集名称，不填为默认备份集")
+	cmd.Flags().StringVar(&snapshot, "snapshot", "", "配合 --repo：快照名，默认为最新快照")
+	_ = cmd.MarkFlagRequired("target")
+	return cmd
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"zbackup/pkg/endpoint"
+)
+
+func newServeCmd() *cobra.Command {
+	var stdio bool
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "在远端以 agent 模式运行，由本地 zbackup 通过 ssh 调用",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !stdio {
+				return errors.New("目前仅支持 --stdio 模式")
+			}
+			// stdout 专用于协议帧，错误只写 stderr
+			cmd.SilenceUsage = true
+			return endpoint.ServeAgent(os.Stdin, os.Stdout)
+		},
+	}
+	cmd.Flags().BoolVar(&stdio, "stdio", false, "通过 stdin/stdout 提供服务")
+	return cmd
+}
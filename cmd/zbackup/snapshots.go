@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/meta"
+)
+
+func newSnapshotsCmd(sshFlags func() endpoint.SSHOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshots",
+		Short: "查看目标仓库中的快照",
+	}
+	cmd.AddCommand(newSnapshotsListCmd(sshFlags))
+	return cmd
+}
+
+func newSnapshotsListCmd(sshFlags func() endpoint.SSHOptions) *cobra.Command {
+	var destPath, set string
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "列出快照；不指定 --set 时列出所有备份集",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, closeFS, err := openDestStore(destPath, "", sshFlags())
+			if err != nil {
+				return err
+			}
+			defer closeFS()
+			stores, err := selectSets(repo, set, cmd.Flags().Changed("set"))
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SET\tSNAPSHOT\tCREATED\tFILES\tSTATUS")
+			for _, store := range stores {
+				infos, err := store.SnapshotInfos()
+				if err != nil {
+					return fmt.Errorf("读取备份集 %s 失败: %w", setLabel(store.Set()), err)
+				}
+				for _, info := range infos {
+					status := "完成"
+					if !info.Completed {
+						status = "未完成"
+					}
+					if info.Latest {
+						status += " (latest)"
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", setLabel(store.Set()), info.Name,
+						info.CreatedAt.Local().Format(time.DateTime), info.Files, status)
+				}
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().StringVarP(&destPath, "dest", "d", "", "目标路径 (本地路径、user@host:/path、s3://bucket/prefix 或 webdav[s]://host/path)")
+	cmd.Flags().StringVar(&set, "set", "", "只列出指定备份集，空串表示默认备份集")
+	_ = cmd.MarkFlagRequired("dest")
+	return cmd
+}
+
+// selectSets 返回要处理的备份集：指定了 --set 时只返回该集，否则返回默认集与全部命名集
+func selectSets(repo *meta.Store, set string, only bool) ([]*meta.Store, error) {
+	if only {
+		store, err := repo.WithSet(set)
+		if err != nil {
+			return nil, err
+		}
+		return []*meta.Store{store}, nil
+	}
+	names, err := repo.ListSets()
+	if err != nil {
+		return nil, fmt.Errorf("读取备份集列表失败: %w", err)
+	}
+	stores := []*meta.Store{repo}
+	for _, name := range names {
+		store, err := repo.WithSet(name)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, store)
+	}
+	return stores, nil
+}
+
+func setLabel(set string) string {
+	if set == "" {
+		return "(default)"
+	}
+	return set
+}
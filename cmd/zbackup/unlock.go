@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"zbackup/pkg/core"
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/meta"
+)
+
+func newUnlockCmd(sshFlags func() endpoint.SSHOptions) *cobra.Command {
+	var destPath, set string
+	cmd := &cobra.Command{
+		Use:   "unlock",
+		Short: "强制删除目标端 .zbackup/lock，用于异常退出后的手动恢复",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, closeFS, err := openDestStore(destPath, set, sshFlags())
+			if err != nil {
+				return err
+			}
+			defer closeFS()
+			info, err := store.BreakLock()
+			if err != nil {
+				return fmt.Errorf("删除锁文件失败: %w", err)
+			}
+			if info == nil {
+				fmt.Fprintln(cmd.OutOrStdout(), "目标端未被锁定")
+				return nil
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "已删除锁：%s\n", info)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&destPath, "dest", "d", "", "目标路径 (本地路径、user@host:/path、s3://bucket/prefix 或 webdav[s]://host/path)")
+	cmd.Flags().StringVar(&set, "set", "", "备份集名称，不填为默认备份集")
+	_ = cmd.MarkFlagRequired("dest")
+	return cmd
+}
+
+// openDestStore 打开目标端并返回指定备份集的 meta.Store
+func openDestStore(destPath, set string, sshOpts endpoint.SSHOptions) (*meta.Store, func() error, error) {
+	ep, err := endpoint.ParseEndpoint(destPath, sshOpts.Port, sshOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	fs, err := core.OpenFS(ep)
+	if err != nil {
+		return nil, nil, err
+	}
+	store, err := meta.NewStore(fs).WithSet(set)
+	if err != nil {
+		fs.Close()
+		return nil, nil, err
+	}
+	return store, fs.Close, nil
+}
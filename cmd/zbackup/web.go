@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"zbackup/pkg/core"
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/web"
+)
+
+func newWebCmd(sshFlags func() endpoint.SSHOptions) *cobra.Command {
+	var (
+		destPath string
+		listen   string
+	)
+	cmd := &cobra.Command{
+		Use:   "web",
+		Short: "启动只读 Web 界面：查看快照、运行报告与日志，浏览与对比快照，下载文件或目录 zip；Ctrl-C 退出",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := sshFlags()
+			repo, err := endpoint.ParseEndpoint(destPath, opts.Port, opts)
+			if err != nil {
+				return err
+			}
+			r, err := core.OpenRepository(repo)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+
+			logger := slog.New(slog.NewTextHandler(cmd.ErrOrStderr(), nil))
+			srv := &http.Server{
+				Addr:              listen,
+				Handler:           web.New(r, logger),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			go func() {
+				<-ctx.Done()
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				srv.Shutdown(shutdownCtx)
+			}()
+			fmt.Fprintf(cmd.OutOrStdout(), "Web 界面已启动: http://%s/ （%s），按 Ctrl-C 退出\n", listen, repo.DisplayName())
+			if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&destPath, "dest", "d", "", "目标路径 (本地路径、user@host:/path、s3://bucket/prefix 或 webdav[s]://host/path)")
+	cmd.Flags().StringVar(&listen, "listen", "127.0.0.1:8080", "监听地址；界面没有身份验证，监听非本机地址前请确认网络可信")
+	_ = cmd.MarkFlagRequired("dest")
+	return cmd
+}
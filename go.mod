@@ -3,8 +3,10 @@ module zbackup
 go 1.24.5
 
 require (
+	github.com/klauspost/compress v1.19.2
 	github.com/schollz/progressbar/v3 v3.18.0
 	github.com/spf13/cobra v1.10.1
+	golang.org/x/net v0.34.0
 )
 
 require (
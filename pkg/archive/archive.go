@@ -0,0 +1,389 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/meta"
+)
+
+const (
+	// SnapshotEntry 为归档末尾内嵌的快照 JSON
+	SnapshotEntry = ".zbackup/snapshot.json"
+	// BaseEntry 记录增量归档所基于的快照名，全量归档没有该条目
+	BaseEntry = ".zbackup/base"
+
+	metaPrefix    = ".zbackup/"
+	partialSuffix = ".partial"
+)
+
+// Compression 为归档的压缩方式
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// CompressionFor 根据文件扩展名确定压缩方式
+func CompressionFor(name string) (Compression, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar"):
+		return CompressionNone, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return CompressionGzip, nil
+	case strings.HasSuffix(lower, ".tar.zst"), strings.HasSuffix(lower, ".tzst"):
+		return CompressionZstd, nil
+	default:
+		return "", fmt.Errorf("无法识别的归档扩展名: %s（支持 .tar、.tar.gz、.tgz、.tar.zst、.tzst）", name)
+	}
+}
+
+// Writer 把条目顺序写入 tar 流；内容先写到 <path>.partial，Commit 时才替换目标文件
+type Writer struct {
+	path string
+	file *os.File
+	// zw 为压缩层，不压缩时为 nil
+	zw io.WriteCloser
+	tw *tar.Writer
+}
+
+// Create 创建归档写入器
+func Create(name string) (*Writer, error) {
+	compression, err := CompressionFor(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(name + partialSuffix)
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{path: name, file: file}
+	var out io.Writer = file
+	switch compression {
+	case CompressionGzip:
+		w.zw = gzip.NewWriter(file)
+	case CompressionZstd:
+		if w.zw, err = zstd.NewWriter(file); err != nil {
+			w.Abort()
+			return nil, err
+		}
+	}
+	if w.zw != nil {
+		out = w.zw
+	}
+	w.tw = tar.NewWriter(out)
+	return w, nil
+}
+
+// AddDir 写入目录条目
+func (w *Writer) AddDir(m endpoint.FileMeta) error {
+	return w.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     m.RelPath + "/",
+		Mode:     int64(fs.FileMode(m.Mode).Perm()),
+		ModTime:  m.ModTime,
+		Format:   tar.FormatPAX,
+	})
+}
+
+// AddFile 写入文件条目，从 r 中读取恰好 m.Size 字节。
+// 源文件变短时用零补齐以保持归档结构完整，并返回 io.ErrUnexpectedEOF；
+// 调用方应把该条目视为失败，恢复时会按内嵌快照跳过它
+func (w *Writer) AddFile(m endpoint.FileMeta, r io.Reader) error {
+	err := w.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     m.RelPath,
+		Size:     m.Size,
+		Mode:     int64(fs.FileMode(m.Mode).Perm()),
+		ModTime:  m.ModTime,
+		Format:   tar.FormatPAX,
+	})
+	if err != nil {
+		return err
+	}
+	n, err := io.CopyN(w.tw, r, m.Size)
+	if err == nil {
+		return nil
+	}
+	if _, padErr := io.CopyN(w.tw, zeroReader{}, m.Size-n); padErr != nil {
+		return padErr
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return &EntryError{Path: m.RelPath, Err: err}
+}
+
+// Commit 写入内嵌快照并落盘，成功后原子替换目标文件
+func (w *Writer) Commit(snap meta.Snapshot, base string) error {
+	if base != "" {
+		if err := w.addMeta(BaseEntry, []byte(base+"\n")); err != nil {
+			w.Abort()
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		w.Abort()
+		return err
+	}
+	if err := w.addMeta(SnapshotEntry, data); err != nil {
+		w.Abort()
+		return err
+	}
+	if err := w.tw.Close(); err != nil {
+		w.Abort()
+		return err
+	}
+	if w.zw != nil {
+		if err := w.zw.Close(); err != nil {
+			w.Abort()
+			return err
+		}
+	}
+	if err := w.file.Sync(); err != nil {
+		w.Abort()
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+	return os.Rename(w.file.Name(), w.path)
+}
+
+// Abort 放弃写入并删除临时文件
+func (w *Writer) Abort() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+func (w *Writer) addMeta(name string, data []byte) error {
+	if err := w.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     0o644,
+		Format:   tar.FormatPAX,
+	}); err != nil {
+		return err
+	}
+	_, err := w.tw.Write(data)
+	return err
+}
+
+// EntryError 表示单个条目写入不完整，归档本身仍然有效
+type EntryError struct {
+	Path string
+	Err  error
+}
+
+func (e *EntryError) Error() string {
+	return fmt.Sprintf("写入归档条目 %s 失败: %v", e.Path, e.Err)
+}
+
+func (e *EntryError) Unwrap() error {
+	return e.Err
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// Info 描述从归档中读出的内嵌元数据
+type Info struct {
+	Snapshot *meta.Snapshot
+	// Base 为增量归档的基准快照名，全量归档为空
+	Base string
+}
+
+// ReadInfo 读取归档内嵌的快照与基准快照名
+func ReadInfo(name string) (Info, error) {
+	var info Info
+	err := walk(name, func(hdr *tar.Header, r io.Reader) error {
+		switch hdr.Name {
+		case SnapshotEntry:
+			var snap meta.Snapshot
+			if err := json.NewDecoder(r).Decode(&snap); err != nil {
+				return fmt.Errorf("解析内嵌快照失败: %w", err)
+			}
+			info.Snapshot = &snap
+		case BaseEntry:
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			info.Base = strings.TrimSpace(string(data))
+		}
+		return nil
+	})
+	if err != nil {
+		return Info{}, err
+	}
+	if info.Snapshot == nil {
+		return Info{}, fmt.Errorf("%s 中没有内嵌快照，可能不是 zbackup 归档或写入未完成", name)
+	}
+	return info, nil
+}
+
+// walk 顺序遍历归档条目
+func walk(name string, fn func(*tar.Header, io.Reader) error) error {
+	compression, err := CompressionFor(name)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var in io.Reader = file
+	switch compression {
+	case CompressionGzip:
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败: %w", name, err)
+		}
+		defer gz.Close()
+		in = gz
+	case CompressionZstd:
+		zr, err := zstd.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败: %w", name, err)
+		}
+		defer zr.Close()
+		in = zr
+	}
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败: %w", name, err)
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// Extract 把归档中记录在内嵌快照里的条目解压到 target；
+// 大小或修改时间与快照不符（即写入不完整、快照沿用了旧版本）以及快照外的条目会被跳过
+func Extract(name, target string) (Info, error) {
+	info, err := ReadInfo(name)
+	if err != nil {
+		return Info{}, err
+	}
+	files := info.Snapshot.Files
+	type dirTime struct {
+		full string
+		meta endpoint.FileMeta
+	}
+	var dirs []dirTime
+	err = walk(name, func(hdr *tar.Header, r io.Reader) error {
+		rel := strings.TrimSuffix(hdr.Name, "/")
+		if strings.HasPrefix(hdr.Name, metaPrefix) {
+			return nil
+		}
+		m, ok := files[rel]
+		if !ok {
+			return nil
+		}
+		full, err := safeJoin(target, rel)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(full, 0o755); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirTime{full, m})
+			return nil
+		case tar.TypeReg:
+			if m.IsDir || m.Size != hdr.Size || !m.ModTime.Equal(hdr.ModTime) {
+				return nil
+			}
+			return extractFile(full, hdr, r)
+		default:
+			return nil
+		}
+	})
+	if err != nil {
+		return Info{}, err
+	}
+	// 目录的权限与时间在其内容写完后再设置，避免被子条目的写入覆盖
+	for i := len(dirs) - 1; i >= 0; i-- {
+		d := dirs[i]
+		if perm := fs.FileMode(d.meta.Mode).Perm(); perm != 0 {
+			_ = os.Chmod(d.full, perm)
+		}
+		_ = os.Chtimes(d.full, d.meta.ModTime, d.meta.ModTime)
+	}
+	return info, nil
+}
+
+func extractFile(full string, hdr *tar.Header, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return err
+	}
+	perm := fs.FileMode(hdr.Mode).Perm()
+	if perm == 0 {
+		perm = 0o644
+	}
+	tmp := full + partialSuffix
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chtimes(tmp, hdr.ModTime, hdr.ModTime); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, full)
+}
+
+// safeJoin 拒绝绝对路径与跳出 target 的条目
+func safeJoin(target, rel string) (string, error) {
+	clean := path.Clean(rel)
+	if rel == "" || path.IsAbs(rel) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("归档条目路径非法: %s", rel)
+	}
+	return filepath.Join(target, filepath.FromSlash(clean)), nil
+}
@@ -0,0 +1,172 @@
+package archive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/meta"
+)
+
+func TestCompressionFor(t *testing.T) {
+	cases := map[string]Compression{
+		"a.tar": CompressionNone, "a.tar.gz": CompressionGzip, "A.TGZ": CompressionGzip,
+		"a.tar.zst": CompressionZstd, "a.tzst": CompressionZstd,
+	}
+	for name, want := range cases {
+		if got, err := CompressionFor(name); err != nil || got != want {
+			t.Fatalf("%s: got %q, %v", name, got, err)
+		}
+	}
+	if _, err := CompressionFor("a.zip"); err == nil {
+		t.Fatalf("unknown extension should fail")
+	}
+}
+
+func TestZstdRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "out.tar.zst")
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	w, err := Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := strings.Repeat("zstd ", 1000)
+	file := fileMeta("a.txt", content, mtime)
+	if err := w.AddFile(file, strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Commit(meta.Snapshot{Name: "z1", Files: map[string]endpoint.FileMeta{"a.txt": file}}, ""); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(name)
+	if len(raw) < 4 || string(raw[:4]) != "\x28\xb5\x2f\xfd" {
+		t.Fatalf("archive should be zstd compressed")
+	}
+	target := filepath.Join(dir, "restore")
+	info, err := Extract(name, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(target, "a.txt")); info.Snapshot.Name != "z1" || string(data) != content {
+		t.Fatalf("unexpected restore %+v %d bytes", info.Snapshot.Name, len(data))
+	}
+}
+
+func fileMeta(rel, content string, mtime time.Time) endpoint.FileMeta {
+	return endpoint.FileMeta{RelPath: rel, Size: int64(len(content)), Mode: 0o640, ModTime: mtime}
+}
+
+func TestWriterShortSourceIsSkippedOnExtract(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "out.tar.gz")
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC)
+	w, err := Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := fileMeta("d/good.txt", "hello", mtime)
+	if err := w.AddDir(endpoint.FileMeta{RelPath: "d", IsDir: true, Mode: 0o755, ModTime: mtime}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddFile(good, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	short := fileMeta("d/short.txt", "0123456789", mtime)
+	var entryErr *EntryError
+	if err := w.AddFile(short, strings.NewReader("012")); !errors.As(err, &entryErr) {
+		t.Fatalf("expected entry error, got %v", err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("archive should not exist before commit")
+	}
+	snap := meta.Snapshot{Name: "s1", Files: map[string]endpoint.FileMeta{
+		"d":          {RelPath: "d", IsDir: true, Mode: 0o755, ModTime: mtime},
+		"d/good.txt": good,
+	}}
+	if err := w.Commit(snap, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(dir, "restore")
+	info, err := Extract(name, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Snapshot.Name != "s1" || info.Base != "" {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	data, err := os.ReadFile(filepath.Join(target, "d", "good.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("unexpected content %q: %v", data, err)
+	}
+	st, _ := os.Stat(filepath.Join(target, "d", "good.txt"))
+	if !st.ModTime().Equal(mtime) || st.Mode().Perm() != 0o640 {
+		t.Fatalf("metadata not restored: %v %v", st.ModTime(), st.Mode())
+	}
+	if _, err := os.Stat(filepath.Join(target, "d", "short.txt")); !os.IsNotExist(err) {
+		t.Fatalf("incomplete entry should be skipped")
+	}
+}
+
+func writeArchive(t *testing.T, name, base string, snap meta.Snapshot, contents map[string]string) {
+	t.Helper()
+	w, err := Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rel, content := range contents {
+		if err := w.AddFile(snap.Files[rel], strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Commit(snap, base); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestoreChain(t *testing.T) {
+	dir := t.TempDir()
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	full := filepath.Join(dir, "full.tar")
+	incr := filepath.Join(dir, "incr.tar")
+	writeArchive(t, full, "", meta.Snapshot{Name: "s1", Files: map[string]endpoint.FileMeta{
+		"keep.txt": fileMeta("keep.txt", "keep", t1),
+		"old.txt":  fileMeta("old.txt", "old", t1),
+		"edit.txt": fileMeta("edit.txt", "v1", t1),
+	}}, map[string]string{"keep.txt": "keep", "old.txt": "old", "edit.txt": "v1"})
+	writeArchive(t, incr, "s1", meta.Snapshot{Name: "s2", Files: map[string]endpoint.FileMeta{
+		"keep.txt": fileMeta("keep.txt", "keep", t1),
+		"edit.txt": fileMeta("edit.txt", "v2!", t2),
+	}}, map[string]string{"edit.txt": "v2!"})
+
+	if _, err := Restore([]string{incr}, filepath.Join(dir, "bad")); err == nil {
+		t.Fatalf("incremental archive without base should fail")
+	}
+	if _, err := Restore([]string{incr, full}, filepath.Join(dir, "bad")); err == nil {
+		t.Fatalf("out-of-order chain should fail")
+	}
+
+	target := filepath.Join(dir, "restore")
+	snap, err := Restore([]string{full, incr}, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Name != "s2" {
+		t.Fatalf("unexpected final snapshot %s", snap.Name)
+	}
+	for rel, want := range map[string]string{"keep.txt": "keep", "edit.txt": "v2!"} {
+		data, err := os.ReadFile(filepath.Join(target, rel))
+		if err != nil || string(data) != want {
+			t.Fatalf("%s: got %q, %v", rel, data, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(target, "old.txt")); !os.IsNotExist(err) {
+		t.Fatalf("file removed in later snapshot should be deleted")
+	}
+}
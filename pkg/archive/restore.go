@@ -0,0 +1,93 @@
+package archive
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"zbackup/pkg/meta"
+)
+
+// Restore 依次解压一条归档链：第一个必须是全量归档，之后每个增量归档的基准
+// 必须是前一个归档的快照。全部解压后删除较早快照中存在、最终快照中已不存在的条目，
+// 并按最终快照恢复目录时间，返回最终快照
+func Restore(archives []string, target string) (*meta.Snapshot, error) {
+	if len(archives) == 0 {
+		return nil, fmt.Errorf("至少需要指定一个归档")
+	}
+	infos := make([]Info, len(archives))
+	for i, name := range archives {
+		info, err := ReadInfo(name)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case i == 0 && info.Base != "":
+			return nil, fmt.Errorf("%s 是基于快照 %s 的增量归档，请先指定其基准归档", name, info.Base)
+		case i > 0 && info.Base != infos[i-1].Snapshot.Name:
+			return nil, fmt.Errorf("%s 的基准快照为 %q，与前一个归档的快照 %q 不一致", name, info.Base, infos[i-1].Snapshot.Name)
+		}
+		infos[i] = info
+	}
+	if err := os.MkdirAll(target, 0o755); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for i, name := range archives {
+		if _, err := Extract(name, target); err != nil {
+			return nil, err
+		}
+		for rel, m := range infos[i].Snapshot.Files {
+			seen[rel] = m.IsDir
+		}
+	}
+	final := infos[len(infos)-1].Snapshot
+
+	var stale []string
+	for rel := range seen {
+		if _, ok := final.Files[rel]; !ok {
+			stale = append(stale, rel)
+		}
+	}
+	// 由深到浅删除，目录只在已清空时删除，不动恢复目录中的其它文件
+	sort.Slice(stale, func(i, j int) bool { return depth(stale[i]) > depth(stale[j]) })
+	for _, rel := range stale {
+		full, err := safeJoin(target, rel)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Remove(full); err != nil && !os.IsNotExist(err) && !seen[rel] {
+			return nil, err
+		}
+	}
+
+	var dirs []string
+	for rel, m := range final.Files {
+		if m.IsDir {
+			dirs = append(dirs, rel)
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool { return depth(dirs[i]) > depth(dirs[j]) })
+	for _, rel := range dirs {
+		m := final.Files[rel]
+		full, err := safeJoin(target, rel)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(full, 0o755); err != nil {
+			return nil, err
+		}
+		if perm := fs.FileMode(m.Mode).Perm(); perm != 0 {
+			_ = os.Chmod(full, perm)
+		}
+		_ = os.Chtimes(full, m.ModTime, m.ModTime)
+	}
+	return final, nil
+}
+
+func depth(rel string) int {
+	return strings.Count(filepath.ToSlash(rel), "/")
+}
@@ -0,0 +1,120 @@
+package chunk
+
+import (
+	"errors"
+	"io"
+)
+
+// 分块大小参数：块长度落在 [MinSize, MaxSize]，平均约 AvgSize。
+// 修改这些参数或 gear 表会改变切分点，使新旧快照之间无法去重
+const (
+	MinSize = 256 << 10
+	AvgSize = 1 << 20
+	MaxSize = 4 << 20
+)
+
+// FastCDC 的归一化掩码：未到平均长度前用更多位（更难命中），之后用更少位，使块长更集中
+const (
+	maskSmall uint64 = 0xfffffc0000000000 // 高 22 位，平均 4 MiB 命中一次
+	maskLarge uint64 = 0xffffc00000000000 // 高 18 位，平均 256 KiB 命中一次
+)
+
+// gear 为滚动哈希使用的随机表，由固定种子的 splitmix64 生成，必须保持不变
+var gear = func() [256]uint64 {
+	var table [256]uint64
+	state := uint64(0x7a6261636b7570) // "zbackup"
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// Chunker 用 FastCDC 按内容把数据流切分为变长块，插入或删除少量字节只会影响附近的块
+type Chunker struct {
+	r     io.Reader
+	buf   []byte
+	start int
+	end   int
+	eof   bool
+}
+
+// NewChunker 创建读取 r 的分块器。size 为数据流的预计长度（未知时传负数），
+// 缓冲区按它分配，小文件不必占用 MaxSize；数据流比预计的长时缓冲区按需增长到 MaxSize
+func NewChunker(r io.Reader, size int64) *Chunker {
+	n := MaxSize
+	if size >= 0 && size < MaxSize {
+		// 多留一个字节，读满预计长度后的下一次读取即可确认数据流结束
+		n = int(size) + 1
+	}
+	return &Chunker{r: r, buf: make([]byte, n)}
+}
+
+// Next 返回下一个块，数据流结束时返回 io.EOF。返回的切片在下次调用前有效
+func (c *Chunker) Next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+	n := cutPoint(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+n]
+	c.start += n
+	return chunk, nil
+}
+
+// fill 把缓冲区补满到 MaxSize 字节或数据流结尾
+func (c *Chunker) fill() error {
+	if c.eof || c.end-c.start >= MaxSize {
+		return nil
+	}
+	copy(c.buf, c.buf[c.start:c.end])
+	c.end -= c.start
+	c.start = 0
+	for c.end < MaxSize {
+		if c.end == len(c.buf) {
+			buf := make([]byte, min(max(2*len(c.buf), MinSize), MaxSize))
+			copy(buf, c.buf[:c.end])
+			c.buf = buf
+		}
+		n, err := c.r.Read(c.buf[c.end:])
+		c.end += n
+		if errors.Is(err, io.EOF) {
+			c.eof = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cutPoint 返回 data 中第一个块的长度
+func cutPoint(data []byte) int {
+	n := len(data)
+	if n <= MinSize {
+		return n
+	}
+	normal := min(AvgSize, n)
+	limit := min(MaxSize, n)
+	var fp uint64
+	i := MinSize
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&maskSmall == 0 {
+			return i + 1
+		}
+	}
+	for ; i < limit; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&maskLarge == 0 {
+			return i + 1
+		}
+	}
+	return limit
+}
@@ -0,0 +1,100 @@
+package chunk
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"testing"
+)
+
+func randomData(seed uint64, n int) []byte {
+	r := rand.New(rand.NewPCG(seed, seed))
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(r.Uint32())
+	}
+	return data
+}
+
+func split(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	return splitWithSize(t, data, int64(len(data)))
+}
+
+func splitWithSize(t *testing.T, data []byte, size int64) [][]byte {
+	t.Helper()
+	c := NewChunker(bytes.NewReader(data), size)
+	var chunks [][]byte
+	for {
+		chunk, err := c.Next()
+		if errors.Is(err, io.EOF) {
+			return chunks
+		}
+		if err != nil {
+			t.Fatalf("next: %v", err)
+		}
+		chunks = append(chunks, append([]byte(nil), chunk...))
+	}
+}
+
+func TestChunkerBoundsAndReassembly(t *testing.T) {
+	data := randomData(1, 24<<20)
+	chunks := split(t, data)
+	if got := bytes.Join(chunks, nil); !bytes.Equal(got, data) {
+		t.Fatalf("chunks do not reassemble the input")
+	}
+	for i, chunk := range chunks {
+		if len(chunk) > MaxSize || (i < len(chunks)-1 && len(chunk) < MinSize) {
+			t.Fatalf("chunk %d has size %d out of bounds", i, len(chunk))
+		}
+	}
+	if len(chunks) < 8 || len(chunks) > 60 {
+		t.Fatalf("unexpected chunk count %d for 24 MiB", len(chunks))
+	}
+	if chunks := split(t, nil); len(chunks) != 0 {
+		t.Fatalf("empty input should yield no chunks")
+	}
+}
+
+func TestChunkerLocalEditKeepsOtherChunks(t *testing.T) {
+	data := randomData(2, 24<<20)
+	edited := append([]byte{}, data[:5<<20]...)
+	edited = append(edited, []byte("inserted bytes")...)
+	edited = append(edited, data[5<<20:]...)
+
+	before := make(map[string]bool)
+	for _, chunk := range split(t, data) {
+		before[Hash(chunk)] = true
+	}
+	after := split(t, edited)
+	changed := 0
+	for _, chunk := range after {
+		if !before[Hash(chunk)] {
+			changed++
+		}
+	}
+	if changed == 0 || changed > 2 {
+		t.Fatalf("expected 1-2 changed chunks after a small insertion, got %d of %d", changed, len(after))
+	}
+}
+
+func TestChunkerSizeHint(t *testing.T) {
+	if c := NewChunker(bytes.NewReader(nil), 10); len(c.buf) != 11 {
+		t.Fatalf("small file should get a small buffer, got %d", len(c.buf))
+	}
+	// 预计长度不准确（文件在扫描后变长）或未知时，切分结果不变
+	data := randomData(3, 12<<20)
+	want := split(t, data)
+	for _, size := range []int64{100, 1 << 20, -1} {
+		got := splitWithSize(t, data, size)
+		if len(got) != len(want) {
+			t.Fatalf("size %d: got %d chunks, want %d", size, len(got), len(want))
+		}
+		for i := range got {
+			if !bytes.Equal(got[i], want[i]) {
+				t.Fatalf("size %d: chunk %d differs", size, i)
+			}
+		}
+	}
+}
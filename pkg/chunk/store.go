@@ -0,0 +1,273 @@
+package chunk
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+
+	"zbackup/pkg/endpoint"
+)
+
+// Dir 为仓库中存放数据块的目录，所有备份集共用以便跨备份集去重
+const Dir = ".zbackup/chunks"
+
+// TempMarker 出现在上传中的临时块文件名中，写完后重命名为正式块名
+const TempMarker = ".tmp-"
+
+// ErrCorrupt 表示读取到的数据块内容与其哈希不符
+var ErrCorrupt = errors.New("数据块损坏")
+
+// Hash 返回数据块的引用名（内容的 SHA-256 十六进制串）
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Path 返回数据块在仓库中的相对路径，按哈希前两位分目录
+func Path(ref string) string {
+	return path.Join(Dir, ref[:2], ref)
+}
+
+// ValidRef 判断名称是否为合法的数据块引用
+func ValidRef(name string) bool {
+	if len(name) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil && strings.ToLower(name) == name
+}
+
+// Stats 统计一次运行中的块写入情况
+type Stats struct {
+	Written      int
+	Reused       int
+	BytesWritten int64
+	BytesReused  int64
+}
+
+// Store 读写仓库中的数据块，并记住已存在的块以避免重复上传
+type Store struct {
+	fs endpoint.FileSystem
+
+	mu    sync.Mutex
+	known map[string]struct{}
+	stats Stats
+}
+
+// NewStore 创建数据块存储
+func NewStore(fs endpoint.FileSystem) *Store {
+	return &Store{fs: fs, known: make(map[string]struct{})}
+}
+
+// Load 列出仓库中已有的数据块，之后 Put 遇到这些块时不再上传
+func (s *Store) Load() error {
+	refs, err := s.List()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ref := range refs {
+		s.known[ref] = struct{}{}
+	}
+	return nil
+}
+
+// List 返回仓库中所有正式数据块的引用，忽略临时文件
+func (s *Store) List() ([]string, error) {
+	var refs []string
+	err := s.Each(func(meta endpoint.FileMeta, ref string) error {
+		if ref != "" {
+			refs = append(refs, ref)
+		}
+		return nil
+	})
+	return refs, err
+}
+
+// Each 遍历数据块目录下的所有文件；ref 为空表示该文件不是正式数据块（如残留的临时文件），
+// 此时 meta.RelPath 为相对仓库根的路径
+func (s *Store) Each(fn func(meta endpoint.FileMeta, ref string) error) error {
+	prefixes, err := s.readDir(Dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, prefix := range prefixes {
+		if !prefix.IsDir {
+			continue
+		}
+		entries, err := s.readDir(path.Join(Dir, prefix.RelPath))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		for _, entry := range entries {
+			if entry.IsDir {
+				continue
+			}
+			ref := entry.RelPath
+			entry.RelPath = path.Join(Dir, prefix.RelPath, entry.RelPath)
+			if !ValidRef(ref) || ref[:2] != prefix.RelPath {
+				ref = ""
+			}
+			if err := fn(entry, ref); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Has 判断数据块是否已知存在
+func (s *Store) Has(ref string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.known[ref]
+	return ok
+}
+
+// Put 写入数据块，已存在时直接返回 false。
+// 支持重命名的文件系统先写临时文件再改名，中断不会留下内容不完整的正式块
+func (s *Store) Put(ref string, data []byte) (bool, error) {
+	if s.Has(ref) {
+		s.mu.Lock()
+		s.stats.Reused++
+		s.stats.BytesReused += int64(len(data))
+		s.mu.Unlock()
+		return false, nil
+	}
+	target := Path(ref)
+	if renamer, ok := s.fs.(endpoint.Renamer); ok {
+		suffix := make([]byte, 6)
+		_, _ = rand.Read(suffix)
+		tmp := target + TempMarker + hex.EncodeToString(suffix)
+		if err := s.write(tmp, data); err != nil {
+			_ = s.fs.Remove(tmp)
+			return false, err
+		}
+		if err := renamer.Rename(tmp, target); err != nil {
+			_ = s.fs.Remove(tmp)
+			return false, err
+		}
+	} else if err := s.write(target, data); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.known[ref] = struct{}{}
+	s.stats.Written++
+	s.stats.BytesWritten += int64(len(data))
+	return true, nil
+}
+
+// Stats 返回本次运行的写入统计
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Read 读取数据块并校验内容哈希
+func (s *Store) Read(ref string) ([]byte, error) {
+	reader, err := s.fs.Open(Path(ref))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if Hash(data) != ref {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupt, ref)
+	}
+	return data, nil
+}
+
+// Open 返回按顺序拼接数据块的 reader，每个块读取时都会校验
+func (s *Store) Open(refs []string) io.ReadCloser {
+	return &chunkReader{store: s, refs: refs}
+}
+
+// Remove 删除数据块文件（可以是正式块或临时文件的相对路径）
+func (s *Store) Remove(rel string) error {
+	if err := s.fs.Remove(rel); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	delete(s.known, path.Base(rel))
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Store) write(rel string, data []byte) error {
+	writer, err := s.fs.Create(rel, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+func (s *Store) readDir(rel string) ([]endpoint.FileMeta, error) {
+	if lister, ok := s.fs.(endpoint.DirLister); ok {
+		return lister.ReadDir(rel)
+	}
+	all, err := s.fs.List(nil)
+	if err != nil {
+		return nil, err
+	}
+	prefix := rel + "/"
+	var entries []endpoint.FileMeta
+	for _, meta := range all {
+		if strings.HasPrefix(meta.RelPath, prefix) && !strings.Contains(meta.RelPath[len(prefix):], "/") {
+			meta.RelPath = meta.RelPath[len(prefix):]
+			entries = append(entries, meta)
+		}
+	}
+	if entries == nil {
+		return nil, fs.ErrNotExist
+	}
+	return entries, nil
+}
+
+type chunkReader struct {
+	store *Store
+	refs  []string
+	cur   *bytes.Reader
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for r.cur == nil || r.cur.Len() == 0 {
+		if len(r.refs) == 0 {
+			return 0, io.EOF
+		}
+		data, err := r.store.Read(r.refs[0])
+		if err != nil {
+			return 0, err
+		}
+		r.refs = r.refs[1:]
+		r.cur = bytes.NewReader(data)
+	}
+	return r.cur.Read(p)
+}
+
+func (r *chunkReader) Close() error {
+	return nil
+}
@@ -0,0 +1,58 @@
+package chunk
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"zbackup/pkg/endpoint"
+)
+
+func TestStorePutReadAndReload(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(endpoint.NewLocalFS(dir))
+	a, b := []byte("alpha"), []byte("bravo")
+	refA, refB := Hash(a), Hash(b)
+	for _, tc := range []struct {
+		ref     string
+		data    []byte
+		written bool
+	}{{refA, a, true}, {refB, b, true}, {refA, a, false}} {
+		written, err := store.Put(tc.ref, tc.data)
+		if err != nil || written != tc.written {
+			t.Fatalf("put %s: written=%v err=%v", tc.ref[:8], written, err)
+		}
+	}
+	if stats := store.Stats(); stats.Written != 2 || stats.Reused != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".zbackup", "chunks", refA[:2], refA)); err != nil {
+		t.Fatalf("chunk not stored at expected path: %v", err)
+	}
+
+	// 残留的临时文件不应被当作数据块
+	junk := filepath.Join(dir, ".zbackup", "chunks", refA[:2], refA+TempMarker+"abc")
+	os.WriteFile(junk, []byte("partial"), 0o644)
+	reloaded := NewStore(endpoint.NewLocalFS(dir))
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !reloaded.Has(refA) || !reloaded.Has(refB) {
+		t.Fatalf("reloaded store should know existing chunks")
+	}
+	refs, _ := reloaded.List()
+	if len(refs) != 2 {
+		t.Fatalf("temp files should be ignored, got %v", refs)
+	}
+
+	data, err := io.ReadAll(reloaded.Open([]string{refB, refA, refB}))
+	if err != nil || string(data) != "bravoalphabravo" {
+		t.Fatalf("unexpected reassembly %q: %v", data, err)
+	}
+	os.WriteFile(filepath.Join(dir, Path(refB)), []byte("tampered"), 0o644)
+	if _, err := reloaded.Read(refB); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected corruption error, got %v", err)
+	}
+}
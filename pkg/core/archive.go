@@ -0,0 +1,196 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"zbackup/pkg/archive"
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/meta"
+	"zbackup/pkg/notify"
+	"zbackup/pkg/transfer"
+)
+
+// runArchive 把计划中的条目写入 tar 归档而不是镜像目录。
+// 指定 ArchiveBase 时只写入相对基准归档快照有变化的条目，内嵌快照仍描述源端完整状态
+func runArchive(ctx context.Context, cfg *BackupConfig, summary *notify.Summary) (err error) {
+	startedAt := summary.StartedAt
+	var stats runStats
+	defer func() { stats.writeMetrics(cfg, startedAt, err) }()
+	srcFS, err := buildFS(ctx, &cfg.Source)
+	if err != nil {
+		return err
+	}
+	defer srcFS.Close()
+
+	var baseSnap *meta.Snapshot
+	if cfg.ArchiveBase != "" {
+		info, err := archive.ReadInfo(cfg.ArchiveBase)
+		if err != nil {
+			return fmt.Errorf("读取基准归档失败: %w", err)
+		}
+		baseSnap = info.Snapshot
+		// 归档目标没有快照仓库，以完整写入的基准归档作为最后一次成功
+		if baseSnap.Completed {
+			stats.lastSuccess = baseSnap.CreatedAt
+		}
+	}
+
+	var logWriter io.WriteCloser
+	if cfg.LogFile != "" {
+		if logWriter, err = os.Create(cfg.LogFile); err != nil {
+			return err
+		}
+	}
+	progress, logger, err := newOutput(cfg, logWriter)
+	if err != nil {
+		return err
+	}
+	defer logger.Close()
+
+	srcFiles, err := srcFS.List(cfg.Excludes)
+	if err != nil {
+		return fmt.Errorf("扫描源目录失败: %w", err)
+	}
+	var baseIdx *meta.Index
+	if baseSnap != nil {
+		if baseIdx, err = baseSnap.Index(); err != nil {
+			return fmt.Errorf("读取基准归档失败: %w", err)
+		}
+	}
+	plan, err := BuildPlan(srcFiles, baseIdx, *cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.DryRun {
+		logger.Info("Dry-run 模式，只展示计划", "files", plan.TotalFiles, "bytes", plan.TotalBytes)
+		for _, item := range plan.Items {
+			if item.Action != transfer.ActionSkip {
+				logger.Info("计划条目", "action", item.Action, "path", item.RelPath, "size", item.Meta.Size)
+			}
+		}
+		return nil
+	}
+
+	writer, err := archive.Create(cfg.Dest.Path)
+	if err != nil {
+		return fmt.Errorf("创建归档失败: %w", err)
+	}
+	result := transfer.Result{
+		Success: make(map[string]endpoint.FileMeta),
+		Failed:  make(map[string]error),
+	}
+	progress.Start(plan.TotalFiles, plan.TotalBytes)
+	for _, item := range plan.Items {
+		if err := ctx.Err(); err != nil {
+			writer.Abort()
+			progress.Finish()
+			return err
+		}
+		switch item.Action {
+		case transfer.ActionMkdir:
+			err = writer.AddDir(item.Meta)
+			if err == nil {
+				result.Success[item.RelPath] = item.Meta
+			}
+		case transfer.ActionUpload, transfer.ActionDownload:
+			progress.NextFile(item.RelPath, item.Meta.Size)
+			reader, openErr := srcFS.Open(item.RelPath)
+			if openErr != nil {
+				logger.Error("读取源文件失败", "path", item.RelPath, "err", openErr)
+				result.Failed[item.RelPath] = openErr
+				continue
+			}
+			var m endpoint.FileMeta
+			m, err = archiveFile(writer, reader, item.Meta, cfg.Checksum, progress.AddBytes)
+			reader.Close()
+			var entryErr *archive.EntryError
+			if errors.As(err, &entryErr) {
+				logger.Error("写入归档条目失败", "path", item.RelPath, "err", err)
+				result.Failed[item.RelPath] = err
+				err = nil
+			} else if err == nil {
+				result.Success[item.RelPath] = m
+				result.Transferred++
+				result.BytesTransferred += item.Meta.Size
+			}
+		}
+		if err != nil {
+			writer.Abort()
+			progress.Finish()
+			return fmt.Errorf("写入归档失败: %w", err)
+		}
+	}
+	progress.Finish()
+
+	// 未变化与写入失败的文件沿用基准快照中的版本，失败的文件下次增量归档会再次尝试
+	files := make(map[string]endpoint.FileMeta, len(srcFiles))
+	for _, m := range srcFiles {
+		rel := normRel(m.RelPath)
+		if done, ok := result.Success[rel]; ok {
+			files[rel] = done
+		} else if m.IsDir {
+			m.RelPath = rel
+			files[rel] = m
+		} else if baseSnap != nil {
+			if old, ok := baseSnap.Files[rel]; ok {
+				files[rel] = old
+			}
+		}
+	}
+	var execErr error
+	if len(result.Failed) > 0 {
+		execErr = fmt.Errorf("%d 个文件未能写入归档", len(result.Failed))
+	}
+	snapshot := meta.Snapshot{
+		Name:       cfg.SnapshotName,
+		CreatedAt:  time.Now().UTC(),
+		SourceRoot: cfg.Source.Path,
+		DestRoot:   cfg.Dest.Path,
+		Files:      files,
+		Completed:  execErr == nil,
+	}
+	base := ""
+	if baseSnap != nil {
+		base = baseSnap.Name
+	}
+	summarize(summary, plan, result)
+	stats.plan, stats.result, stats.snapshotFiles = plan, result, len(snapshot.Files)
+	if err := writer.Commit(snapshot, base); err != nil {
+		logger.Error("写入归档失败", "err", err)
+		return err
+	}
+	if execErr != nil {
+		return execErr
+	}
+	logger.Info("归档完成", "archive", cfg.Dest.Path, "snapshot", snapshot.Name, "base", base, "entries", len(result.Success))
+	return nil
+}
+
+// archiveFile 把单个源文件写入归档并计算校验和；中途读取失败时返回 *archive.EntryError，
+// 归档中留下的是补齐后的条目，恢复时会被跳过
+func archiveFile(writer *archive.Writer, reader io.Reader, m endpoint.FileMeta, algo endpoint.ChecksumAlgo, addBytes func(int64)) (endpoint.FileMeta, error) {
+	counted := io.TeeReader(reader, progressFunc(addBytes))
+	h := endpoint.NewChecksumHash(algo)
+	if h != nil {
+		counted = io.TeeReader(counted, h)
+	}
+	if err := writer.AddFile(m, counted); err != nil {
+		return endpoint.FileMeta{}, err
+	}
+	if h != nil {
+		m.Checksum = fmt.Sprintf("%x", h.Sum(nil))
+	}
+	return m, nil
+}
+
+type progressFunc func(int64)
+
+func (f progressFunc) Write(p []byte) (int, error) {
+	f(int64(len(p)))
+	return len(p), nil
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"zbackup/pkg/archive"
+	"zbackup/pkg/endpoint"
+)
+
+func TestRunToIncrementalArchives(t *testing.T) {
+	srcDir := t.TempDir()
+	outDir := t.TempDir()
+	write := func(rel, content string) {
+		t.Helper()
+		full := filepath.Join(srcDir, rel)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("sub/a.txt", "hello")
+	write("b.txt", "bee")
+	run := func(name, base string) {
+		t.Helper()
+		cfg := &BackupConfig{
+			Source:       endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: srcDir},
+			Dest:         endpoint.Endpoint{Type: endpoint.EndpointTar, Path: filepath.Join(outDir, name+".tar.gz")},
+			Mode:         endpoint.ModeIncr,
+			Checksum:     endpoint.ChecksumSHA256,
+			SnapshotName: name,
+			LogLevel:     "error",
+			NoProgress:   true,
+			ArchiveBase:  base,
+		}
+		if err := Run(context.Background(), cfg); err != nil {
+			t.Fatalf("run %s failed: %v", name, err)
+		}
+	}
+	run("full", "")
+
+	write("sub/a.txt", "hello, world")
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(srcDir, "sub", "a.txt"), later, later)
+	write("c.txt", "sea")
+	os.Remove(filepath.Join(srcDir, "b.txt"))
+	run("incr", filepath.Join(outDir, "full.tar.gz"))
+
+	info, err := archive.ReadInfo(filepath.Join(outDir, "incr.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Base != "full" || !info.Snapshot.Completed || len(info.Snapshot.Files) != 3 {
+		t.Fatalf("unexpected incremental info: base=%s files=%v", info.Base, info.Snapshot.Files)
+	}
+	if info.Snapshot.Files["sub/a.txt"].Checksum == "" {
+		t.Fatalf("checksum should be recorded")
+	}
+
+	target := filepath.Join(outDir, "restore")
+	if _, err := archive.Restore([]string{filepath.Join(outDir, "full.tar.gz"), filepath.Join(outDir, "incr.tar.gz")}, target); err != nil {
+		t.Fatal(err)
+	}
+	for rel, want := range map[string]string{"sub/a.txt": "hello, world", "c.txt": "sea"} {
+		data, err := os.ReadFile(filepath.Join(target, rel))
+		if err != nil || string(data) != want {
+			t.Fatalf("%s: got %q, %v", rel, data, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(target, "b.txt")); !os.IsNotExist(err) {
+		t.Fatalf("deleted file should not be restored")
+	}
+}
+
+func TestArchiveDestValidation(t *testing.T) {
+	cfg := BackupConfig{
+		Source: endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: "/src"},
+		Dest:   endpoint.Endpoint{Type: endpoint.EndpointTar, Path: "/out/a.zip"},
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("unknown archive extension should be rejected")
+	}
+	cfg.Dest.Path = "/out/a.tar.zst"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("zstd archive should be accepted: %v", err)
+	}
+	cfg.Dest.Path = "/out/a.tar"
+	cfg.Set = "etc"
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("named set should be rejected for archives")
+	}
+}
@@ -0,0 +1,204 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"zbackup/pkg/chunk"
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/meta"
+)
+
+// CheckOptions 控制仓库检查
+type CheckOptions struct {
+	// ReadData 为 true 时重新读取数据并校验哈希，否则只检查引用的对象是否存在
+	ReadData bool
+}
+
+// CheckReport 汇总仓库检查的结果
+type CheckReport struct {
+	Snapshots    int
+	Chunks       int
+	Files        int
+	Unreferenced int
+	Problems     []string
+}
+
+// Check 校验每个备份集的全部快照：分块快照引用的数据块必须存在，镜像存储的最新快照
+// 中的文件必须存在且大小一致；ReadData 时还会读取数据块与镜像文件核对哈希
+func Check(ctx context.Context, repo endpoint.Endpoint, opts CheckOptions) (CheckReport, error) {
+	var report CheckReport
+	repoFS, err := buildFS(ctx, &repo)
+	if err != nil {
+		return report, err
+	}
+	defer repoFS.Close()
+	stores, err := allSets(meta.NewStore(repoFS))
+	if err != nil {
+		return report, err
+	}
+	chunks := chunk.NewStore(repoFS)
+	existing := make(map[string]bool)
+	list, err := chunks.List()
+	if err != nil {
+		return report, fmt.Errorf("列出数据块失败: %w", err)
+	}
+	for _, ref := range list {
+		existing[ref] = false
+	}
+	problem := func(format string, args ...any) {
+		report.Problems = append(report.Problems, fmt.Sprintf(format, args...))
+	}
+
+	for _, store := range stores {
+		names, err := store.ListSnapshots()
+		if err != nil {
+			return report, fmt.Errorf("备份集 %s: 列出快照失败: %w", setName(store), err)
+		}
+		latest, err := store.LoadLatest()
+		if err != nil {
+			problem("备份集 %s: 读取 latest 失败: %v", setName(store), err)
+		}
+		for _, name := range names {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+			snap, err := store.Load(name)
+			if err != nil || snap == nil {
+				problem("备份集 %s: 快照 %s 无法读取: %v", setName(store), name, err)
+				continue
+			}
+			report.Snapshots++
+			if !snap.Chunked {
+				continue
+			}
+			for rel, m := range snap.Files {
+				for _, ref := range m.Chunks {
+					if _, ok := existing[ref]; !ok {
+						problem("备份集 %s: 快照 %s 的文件 %s 缺少数据块 %s", setName(store), name, rel, ref)
+						break
+					}
+					existing[ref] = true
+				}
+			}
+		}
+		if latest != nil && !latest.Chunked {
+			dataFS := repoFS
+			if latest.Tree != "" {
+				dataEp := treeEndpoint(repo, latest.Tree)
+				if dataFS, err = buildFS(ctx, &dataEp); err != nil {
+					return report, err
+				}
+				defer dataFS.Close()
+			} else if store.Set() != "" {
+				dataEp := setEndpoint(repo, store.Set())
+				if dataFS, err = buildFS(ctx, &dataEp); err != nil {
+					return report, err
+				}
+				defer dataFS.Close()
+			}
+			if err := checkMirror(ctx, dataFS, latest, opts.ReadData, &report, func(msg string) {
+				problem("备份集 %s: 快照 %s: %s", setName(store), latest.Name, msg)
+			}); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	// 未完成进度引用的块同样视为被引用
+	if err := eachPending(stores, func(snap *meta.Snapshot) {
+		for _, m := range snap.Files {
+			for _, ref := range m.Chunks {
+				if _, ok := existing[ref]; ok {
+					existing[ref] = true
+				}
+			}
+		}
+	}); err != nil {
+		problem("%v", err)
+	}
+	for ref, used := range existing {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if !used {
+			report.Unreferenced++
+			continue
+		}
+		report.Chunks++
+		if opts.ReadData {
+			if _, err := chunks.Read(ref); err != nil {
+				problem("数据块 %s 校验失败: %v", ref, err)
+			}
+		}
+	}
+	return report, nil
+}
+
+// checkMirror 检查镜像数据目录中的文件与快照是否一致
+func checkMirror(ctx context.Context, dataFS endpoint.FileSystem, snap *meta.Snapshot, readData bool, report *CheckReport, problem func(string)) error {
+	for rel, m := range snap.Files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		report.Files++
+		actual, err := dataFS.Stat(rel)
+		if err != nil {
+			problem(fmt.Sprintf("%s 无法访问: %v", rel, err))
+			continue
+		}
+		if actual.IsDir != m.IsDir || (!m.IsDir && actual.Size != m.Size) {
+			problem(fmt.Sprintf("%s 与快照不一致（大小 %d，快照记录 %d）", rel, actual.Size, m.Size))
+			continue
+		}
+		if !readData || m.IsDir || m.Checksum == "" {
+			continue
+		}
+		algo := checksumAlgoFor(m.Checksum)
+		h := endpoint.NewChecksumHash(algo)
+		if h == nil {
+			continue
+		}
+		reader, err := dataFS.Open(rel)
+		if err != nil {
+			problem(fmt.Sprintf("%s 无法读取: %v", rel, err))
+			continue
+		}
+		_, err = io.Copy(h, reader)
+		reader.Close()
+		if err != nil {
+			problem(fmt.Sprintf("%s 读取失败: %v", rel, err))
+		} else if sum := fmt.Sprintf("%x", h.Sum(nil)); sum != m.Checksum {
+			problem(fmt.Sprintf("%s 校验和不一致（%s）", rel, algo))
+		}
+	}
+	return nil
+}
+
+// checksumAlgoFor 根据十六进制摘要的长度推断校验算法
+func checksumAlgoFor(sum string) endpoint.ChecksumAlgo {
+	switch len(sum) {
+	case 32:
+		return endpoint.ChecksumMD5
+	case 40:
+		return endpoint.ChecksumSHA1
+	case 64:
+		return endpoint.ChecksumSHA256
+	default:
+		return endpoint.ChecksumNone
+	}
+}
+
+func eachPending(stores []*meta.Store, fn func(*meta.Snapshot)) error {
+	for _, store := range stores {
+		pending, err := store.LoadPending()
+		if err != nil {
+			return fmt.Errorf("备份集 %s: 读取未完成进度失败: %w", setName(store), err)
+		}
+		if pending != nil {
+			fn(pending)
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"errors"
 	"sync"
 	"time"
 
@@ -8,67 +9,51 @@ import (
 	"zbackup/pkg/meta"
 )
 
+// errCheckpoint 表示进度日志无法写入，运行被中止
+var errCheckpoint = errors.New("写入进度日志失败")
+
+// checkpoint 把每个成功的条目追加到 .zbackup/pending.log，并定期落盘
 type checkpoint struct {
-	store         *meta.Store
-	snapshot      meta.Snapshot
-	files         map[string]endpoint.FileMeta
-	mu            sync.Mutex
-	lastFlush     time.Time
-	flushInterval time.Duration
-	dirty         bool
+	journal      *meta.Journal
+	mu           sync.Mutex
+	lastSync     time.Time
+	syncInterval time.Duration
 }
 
-func newCheckpoint(store *meta.Store, base *meta.Snapshot, name string, src endpoint.Endpoint, dst endpoint.Endpoint) *checkpoint {
-	files := make(map[string]endpoint.FileMeta)
-	if base != nil {
-		for k, v := range base.Files {
-			files[k] = v
-		}
-	}
-	snap := meta.Snapshot{
+func newCheckpoint(store *meta.Store, base string, name string, src endpoint.Endpoint, dst endpoint.Endpoint, chunked bool, tree string) (*checkpoint, error) {
+	header := meta.JournalHeader{
 		Name:       name,
 		CreatedAt:  time.Now().UTC(),
 		SourceRoot: src.Path,
 		DestRoot:   dst.Path,
-		Files:      files,
-		Completed:  false,
+		Chunked:    chunked,
+		Tree:       tree,
+		Base:       base,
 	}
-	return &checkpoint{
-		store:         store,
-		snapshot:      snap,
-		files:         files,
-		lastFlush:     time.Now(),
-		flushInterval: 3 * time.Second,
+	journal, err := store.OpenJournal(header)
+	if err != nil {
+		return nil, err
 	}
+	return &checkpoint{
+		journal:      journal,
+		lastSync:     time.Now(),
+		syncInterval: 3 * time.Second,
+	}, nil
 }
 
 func (c *checkpoint) Record(meta endpoint.FileMeta) error {
+	if err := c.journal.Append(meta); err != nil {
+		return err
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.files[meta.RelPath] = meta
-	c.dirty = true
-	if time.Since(c.lastFlush) >= c.flushInterval {
-		return c.flushLocked()
+	if time.Since(c.lastSync) >= c.syncInterval {
+		c.lastSync = time.Now()
+		return c.journal.Sync()
 	}
 	return nil
 }
 
 func (c *checkpoint) Flush() error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	return c.flushLocked()
-}
-
-func (c *checkpoint) flushLocked() error {
-	if !c.dirty {
-		return nil
-	}
-	c.snapshot.Files = c.files
-	c.snapshot.Completed = false
-	if err := c.store.SavePending(c.snapshot); err != nil {
-		return err
-	}
-	c.lastFlush = time.Now()
-	c.dirty = false
-	return nil
+	return c.journal.Close()
 }
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"zbackup/pkg/endpoint"
@@ -10,7 +12,10 @@ import (
 func TestCheckpointRecordsAndFlushes(t *testing.T) {
 	fs := endpoint.NewLocalFS(t.TempDir())
 	store := meta.NewStore(fs)
-	cp := newCheckpoint(store, nil, "snap", endpoint.Endpoint{Path: "/src"}, endpoint.Endpoint{Path: "/dst"})
+	cp, err := newCheckpoint(store, "", "snap", endpoint.Endpoint{Path: "/src"}, endpoint.Endpoint{Path: "/dst"}, false, "")
+	if err != nil {
+		t.Fatalf("new checkpoint failed: %v", err)
+	}
 	meta := endpoint.FileMeta{RelPath: "dir/file.txt", Size: 10}
 	if err := cp.Record(meta); err != nil {
 		t.Fatalf("record failed: %v", err)
@@ -22,7 +27,58 @@ func TestCheckpointRecordsAndFlushes(t *testing.T) {
 	if err != nil {
 		t.Fatalf("load pending failed: %v", err)
 	}
-	if pending == nil || pending.Files["dir/file.txt"].RelPath != "dir/file.txt" {
+	if pending == nil || pending.Name != "snap" || pending.Files["dir/file.txt"].RelPath != "dir/file.txt" {
 		t.Fatalf("pending snapshot missing entry: %+v", pending)
 	}
 }
+
+func TestCheckpointReplaysOnBaseAndToleratesTornTail(t *testing.T) {
+	dir := t.TempDir()
+	store := meta.NewStore(endpoint.NewLocalFS(dir))
+	base := meta.Snapshot{
+		Name:      "base",
+		Files:     map[string]endpoint.FileMeta{"old.txt": {RelPath: "old.txt", Size: 1}},
+		Completed: true,
+	}
+	if err := store.Save(base); err != nil {
+		t.Fatalf("save base: %v", err)
+	}
+	cp, err := newCheckpoint(store, base.Name, "next", endpoint.Endpoint{Path: "/src"}, endpoint.Endpoint{Path: "/dst"}, false, "")
+	if err != nil {
+		t.Fatalf("new checkpoint failed: %v", err)
+	}
+	for _, rel := range []string{"a.txt", "b.txt"} {
+		if err := cp.Record(endpoint.FileMeta{RelPath: rel, Size: 2}); err != nil {
+			t.Fatalf("record failed: %v", err)
+		}
+	}
+	if err := cp.Flush(); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+	// 模拟崩溃时写了一半的帧
+	logPath := filepath.Join(dir, ".zbackup", "pending.log")
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open log: %v", err)
+	}
+	f.Write([]byte{0x40, 0x01, 0x02})
+	f.Close()
+
+	pending, err := store.LoadPending()
+	if err != nil {
+		t.Fatalf("load pending failed: %v", err)
+	}
+	if pending == nil || pending.Name != "next" || len(pending.Files) != 3 {
+		t.Fatalf("unexpected replay result: %+v", pending)
+	}
+	if err := store.CompactPending(*pending); err != nil {
+		t.Fatalf("compact failed: %v", err)
+	}
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Fatalf("journal should be removed after compaction")
+	}
+	again, err := store.LoadPending()
+	if err != nil || again == nil || len(again.Files) != 3 {
+		t.Fatalf("compacted pending mismatch: %+v %v", again, err)
+	}
+}
@@ -2,15 +2,23 @@ package core
 
 import (
 	"fmt"
+	"path/filepath"
 	"time"
 
+	"zbackup/pkg/archive"
 	"zbackup/pkg/endpoint"
+	"zbackup/pkg/fssnap"
+	"zbackup/pkg/meta"
+	"zbackup/pkg/metrics"
+	"zbackup/pkg/notify"
+	"zbackup/pkg/transfer"
 )
 
 // BackupConfig 表示一次备份任务的配置
 type BackupConfig struct {
 	Source       endpoint.Endpoint
 	Dest         endpoint.Endpoint
+	Set          string
 	Mode         endpoint.BackupMode
 	Checksum     endpoint.ChecksumAlgo
 	Excludes     []string
@@ -19,6 +27,37 @@ type BackupConfig struct {
 	LogFile      string
 	LogLevel     string
 	NoProgress   bool
+	LockWait     time.Duration
+	MetricsFile  string
+	Notify       notify.Config
+	Retries      int
+	RetryBackoff time.Duration
+	// RetryChanged 表示运行结束前把复制期间发生变化的文件再传输一次
+	RetryChanged bool
+	// Dests 含多个目标端时，一次扫描同时备份到每个目标端，每个源文件只读取一次；Dest 被忽略
+	Dests []endpoint.Endpoint
+	// Chunked 表示以内容定义分块的方式把文件存入仓库的 .zbackup/chunks，而不是镜像目录
+	Chunked bool
+	// ArchiveBase 为增量归档所基于的上一个归档文件，仅用于 tar:// 目标
+	ArchiveBase string
+	// BackupDir 非空时，目标端被覆盖或删除的文件先移到 <BackupDir>/<快照名>/ 保存；
+	// 与 rsync 的 --backup-dir 相同，为相对数据目录的路径
+	BackupDir string
+	// BackupKeepDays 为回收目录的保留天数，每次成功运行后清理更早的目录；0 表示不清理
+	BackupKeepDays int
+	// Tree 表示每个快照写入独立的 snapshots-tree/<快照名>/ 目录，未变化的文件从上一快照目录硬链接
+	Tree bool
+	// FSSnapshot 非空时在扫描前为源端创建文件系统快照，本次运行从冻结视图读取，结束后删除
+	FSSnapshot fssnap.Provider
+	// Guard 为防止误删目标端数据的保护条件
+	Guard Guard
+	// Review 非空时先完整扫描源端生成计划，交给它确认后再执行；返回 false 时放弃本次运行
+	Review func(plan transfer.Plan) (bool, error)
+
+	// source 非空时本次运行是多目标备份的一部分，源端已由 runFanout 检查、冻结与扫描
+	source *fanoutClient
+	// collectMetrics 非空时运行指标交给它汇总，由 runFanout 把各目标端写入同一个指标文件
+	collectMetrics func(metrics.RunMetrics)
 }
 
 // Validate 进行基础校验
@@ -29,8 +68,85 @@ func (c *BackupConfig) Validate() error {
 	if c.Source.Path == "" || c.Dest.Path == "" {
 		return fmt.Errorf("源和目标路径均不能为空")
 	}
+	if c.Source.Type == endpoint.EndpointTar {
+		return fmt.Errorf("tar 归档只能作为目标，读取归档请使用 restore 子命令")
+	}
+	if c.Dest.Type == endpoint.EndpointTar {
+		if _, err := archive.CompressionFor(c.Dest.Path); err != nil {
+			return err
+		}
+		if c.Set != "" {
+			return fmt.Errorf("tar 归档目标不支持 --set")
+		}
+		if c.Chunked {
+			return fmt.Errorf("tar 归档目标不支持分块存储")
+		}
+		if c.Review != nil {
+			return fmt.Errorf("tar 归档目标不支持交互确认")
+		}
+		if c.BackupDir != "" {
+			return fmt.Errorf("tar 归档目标不支持 --backup-dir")
+		}
+		if c.ArchiveBase != "" && c.Mode == endpoint.ModeFull {
+			return fmt.Errorf("增量归档不能与全量模式同时使用")
+		}
+	} else if c.ArchiveBase != "" {
+		return fmt.Errorf("--incremental-from 仅适用于 tar:// 目标")
+	}
+	if c.Mode == endpoint.ModeSync {
+		switch {
+		case c.Dest.Type == endpoint.EndpointTar:
+			return fmt.Errorf("同步模式不支持 tar 归档目标")
+		case c.Chunked || c.Tree:
+			return fmt.Errorf("同步模式的目标端必须是镜像存储，不能使用 --chunked 或 --tree")
+		case c.BackupDir != "":
+			return fmt.Errorf("同步模式不支持 --backup-dir")
+		case c.FSSnapshot != nil:
+			return fmt.Errorf("同步模式需要写入源端，不能使用文件系统快照")
+		case c.Review != nil:
+			return fmt.Errorf("同步模式不支持交互确认")
+		}
+	}
+	if c.BackupDir != "" {
+		if c.Chunked {
+			return fmt.Errorf("分块存储的旧版本保留在快照中，不需要 --backup-dir")
+		}
+		dir, err := CleanBackupDir(c.BackupDir)
+		if err != nil {
+			return err
+		}
+		c.BackupDir = dir
+	}
+	if c.FSSnapshot != nil && c.Source.Type != endpoint.EndpointLocal && c.Source.Type != endpoint.EndpointRemote {
+		return fmt.Errorf("文件系统快照仅支持本地或 SSH 源端")
+	}
+	if c.Tree && c.Chunked {
+		return fmt.Errorf("--tree 不能与分块存储同时使用")
+	}
+	if c.Tree && c.BackupDir != "" {
+		return fmt.Errorf("硬链接快照目录已保留每个版本，不需要 --backup-dir")
+	}
+	if c.Set != "" {
+		if err := meta.ValidateSetName(c.Set); err != nil {
+			return err
+		}
+	}
+	if c.Notify.Enabled() {
+		if err := c.Notify.ValidateTemplates(); err != nil {
+			return err
+		}
+	}
 	if c.SnapshotName == "" {
 		c.SnapshotName = time.Now().UTC().Format("20060102T150405Z")
 	}
 	return nil
 }
+
+// CleanBackupDir 规范化 --backup-dir 的取值：旧文件通过重命名移入，必须是数据目录下的相对路径
+func CleanBackupDir(dir string) (string, error) {
+	clean := filepath.Clean(dir)
+	if !filepath.IsLocal(clean) || clean == "." || clean == meta.MetaDir {
+		return "", fmt.Errorf("--backup-dir 必须是数据目录下的相对路径: %q", dir)
+	}
+	return clean, nil
+}
@@ -2,37 +2,152 @@ package core
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
+	"zbackup/pkg/chunk"
 	"zbackup/pkg/endpoint"
 	"zbackup/pkg/logging"
 	"zbackup/pkg/meta"
+	"zbackup/pkg/metrics"
+	"zbackup/pkg/notify"
 	"zbackup/pkg/transfer"
 	"zbackup/pkg/ui"
 )
 
-// Run 执行一次备份
+// streamBuffer 为扫描与执行之间的缓冲条目数，扫描领先执行最多这么多条
+const streamBuffer = 256
+
+// ErrPlanRejected 表示计划未被 Review 确认，本次运行没有做任何改动
+var ErrPlanRejected = errors.New("计划未获确认，已取消本次运行")
+
+// Run 执行一次备份，结束后按配置发送通知；指定了多个目标端时同时备份到每个目标端
 func Run(ctx context.Context, cfg *BackupConfig) error {
-	if err := cfg.Validate(); err != nil {
+	if len(cfg.Dests) > 1 {
+		return runFanout(ctx, cfg)
+	}
+	return runDest(ctx, cfg)
+}
+
+// runDest 备份到 cfg.Dest 并发送该目标端的通知
+func runDest(ctx context.Context, cfg *BackupConfig) error {
+	host, _ := os.Hostname()
+	summary := notify.Summary{
+		Host:      host,
+		Source:    cfg.Source.DisplayName(),
+		Dest:      cfg.Dest.DisplayName(),
+		Set:       cfg.Set,
+		Mode:      string(cfg.Mode),
+		StartedAt: time.Now().UTC(),
+	}
+	err := runBackup(ctx, cfg, &summary)
+	if cfg.DryRun || errors.Is(err, ErrPlanRejected) {
 		return err
 	}
-	srcFS, err := buildFS(&cfg.Source)
+	if summary.FinishedAt.IsZero() {
+		finishSummary(&summary, cfg.SnapshotName, err)
+	}
+	if nerr := notify.Send(context.WithoutCancel(ctx), cfg.Notify, summary); nerr != nil {
+		fmt.Fprintf(os.Stderr, "发送通知失败: %v\n", nerr)
+	}
+	return err
+}
+
+// finishSummary 填写运行摘要的快照名、结束时间与结果
+func finishSummary(summary *notify.Summary, snapshot string, err error) {
+	summary.Snapshot = snapshot
+	summary.FinishedAt = time.Now().UTC()
+	summary.DurationSeconds = summary.FinishedAt.Sub(summary.StartedAt).Seconds()
+	summary.Status = notify.StatusSuccess
 	if err != nil {
+		summary.Status = notify.StatusFailure
+		summary.Error = err.Error()
+	}
+}
+
+func runBackup(ctx context.Context, cfg *BackupConfig, summary *notify.Summary) (err error) {
+	startedAt := summary.StartedAt
+	if cfg.source != nil {
+		defer cfg.source.finish()
+	}
+	if err := cfg.Validate(); err != nil {
 		return err
 	}
+	if cfg.Dest.Type == endpoint.EndpointTar {
+		return runArchive(ctx, cfg, summary)
+	}
+	if cfg.Mode == endpoint.ModeSync {
+		return runSync(ctx, cfg, summary)
+	}
+	var stats runStats
+	defer func() { stats.writeMetrics(cfg, startedAt, err) }()
+	var srcFS endpoint.FileSystem = cfg.source
+	if cfg.source == nil {
+		if srcFS, err = buildFS(ctx, &cfg.Source); err != nil {
+			return err
+		}
+	}
 	defer srcFS.Close()
-	destFS, err := buildFS(&cfg.Dest)
+	repoFS, err := buildFS(ctx, &cfg.Dest)
 	if err != nil {
 		return err
 	}
-	defer destFS.Close()
+	defer repoFS.Close()
+	store, err := meta.NewStore(repoFS).WithSet(cfg.Set)
+	if err != nil {
+		return err
+	}
+	defer func() { stats.loadLastSuccess(cfg, store, err) }()
+	// 命名备份集的数据写入仓库下的同名子目录，元数据仍集中在仓库根的 .zbackup 中
+	destFS, dataDest := repoFS, cfg.Dest
+	if cfg.Set != "" {
+		dataDest = setEndpoint(cfg.Dest, cfg.Set)
+		if destFS, err = buildFS(ctx, &dataDest); err != nil {
+			return err
+		}
+		defer destFS.Close()
+	}
 
-	store := meta.NewStore(destFS)
-	lastSnap, err := store.LoadLatest()
+	// 在加锁之前检查：加锁会创建命名备份集的元数据目录
+	if err := checkSetMixing(meta.NewStore(repoFS), cfg.Set); err != nil {
+		return err
+	}
+	lock, err := store.AcquireLock(ctx, cfg.LockWait)
+	if err != nil {
+		return fmt.Errorf("获取目标端锁失败: %w", err)
+	}
+	defer lock.Release()
+	if !cfg.DryRun {
+		// 运行报告与日志放在一起，在释放锁之前写入；结果以 runBackup 的返回值为准
+		defer func() {
+			if errors.Is(err, ErrPlanRejected) {
+				return
+			}
+			finishSummary(summary, cfg.SnapshotName, err)
+			if rerr := saveReport(repoFS, store.Dir(), *summary); rerr != nil {
+				fmt.Fprintf(os.Stderr, "写入运行报告失败: %v\n", rerr)
+			}
+		}()
+	}
+	// 锁被他人接管时取消本次运行，返回丢失原因
+	ctx, stopWatch := lock.Watch(ctx)
+	defer stopWatch()
+	defer func() {
+		if cause := context.Cause(ctx); err != nil && errors.Is(cause, meta.ErrLockLost) {
+			err = cause
+		}
+	}()
+
+	// 规划时只按路径查找上一快照，以索引形式读取，不展开全部条目
+	lastSnap, err := store.LoadLatestIndex()
 	if err != nil {
 		return fmt.Errorf("读取历史快照失败: %w", err)
 	}
@@ -40,130 +155,468 @@ func Run(ctx context.Context, cfg *BackupConfig) error {
 	if err != nil {
 		return fmt.Errorf("读取未完成快照失败: %w", err)
 	}
+	var pendingIdx *meta.Index
+	if pendingSnap != nil {
+		if pendingIdx, err = pendingSnap.Index(); err != nil {
+			return fmt.Errorf("读取未完成快照失败: %w", err)
+		}
+		if !sameStorage(pendingIdx.Info(), cfg) {
+			return fmt.Errorf("未完成的快照 %s 使用%s，请以相同的存储方式继续", pendingSnap.Name, storageLabel(pendingIdx.Info()))
+		}
+	}
+	if lastSnap != nil && !sameStorage(lastSnap.Info(), cfg) {
+		// 上一快照的文件内容不在本次的存储方式中，不能沿用，只能全部重新存储
+		lastSnap = nil
+	}
 	baseSnap := lastSnap
 	if pendingSnap != nil {
 		cfg.SnapshotName = pendingSnap.Name
-		baseSnap = pendingSnap
+		baseSnap = pendingIdx
 	}
 
-	srcFiles, err := srcFS.List(cfg.Excludes)
-	if err != nil {
-		return fmt.Errorf("扫描源目录失败: %w", err)
-	}
-
-	plan := BuildPlan(srcFiles, baseSnap, *cfg)
-
-	logWriter, logPath, err := prepareLogWriter(cfg, destFS)
+	logWriter, logPath, err := prepareLogWriter(cfg, repoFS, store.Dir())
 	if err != nil {
 		return err
 	}
-	var progress ui.Progress
-	stdWriter := io.Writer(os.Stdout)
-	if cfg.NoProgress {
-		progress = ui.NoopProgress{}
-	} else {
-		bar := ui.NewBarProgress(os.Stdout)
-		progress = bar
-		stdWriter = bar.WrapWriter(os.Stdout)
-	}
-	var logWriters []io.Writer
-	logWriters = append(logWriters, stdWriter)
-	if logWriter != nil {
-		logWriters = append(logWriters, logWriter)
-	}
-	logger, err := logging.New(cfg.LogLevel, logWriters...)
+	progress, logger, err := newOutput(cfg, logWriter)
 	if err != nil {
 		return err
 	}
 	defer logger.Close()
+	if cfg.source != nil {
+		logger.Logger = logger.With("dest", cfg.Dest.DisplayName())
+	}
 
 	if logPath != "" {
 		logger.Info("日志写入路径", "dest", logPath)
 	}
-	if cfg.DryRun {
-		logger.Info("Dry-run 模式，只展示计划", "files", plan.TotalFiles, "bytes", plan.TotalBytes)
-		for _, item := range plan.Items {
-			logger.Info("计划条目", "action", item.Action, "path", item.RelPath, "size", item.Meta.Size, "reason", item.Reason)
+	if err := cfg.Guard.checkSource(srcFS); err != nil {
+		logger.Error("源端检查未通过", "err", err)
+		return err
+	}
+	if cfg.FSSnapshot != nil && !cfg.DryRun {
+		viewFS, release, err := freezeSource(ctx, cfg.FSSnapshot, cfg.Source, srcFS, cfg.SnapshotName)
+		if err != nil {
+			logger.Error("创建文件系统快照失败", "err", err)
+			return err
 		}
-		return nil
+		logger.Info("已创建文件系统快照", "provider", cfg.FSSnapshot.Name(), "view", viewFS.Root())
+		defer func() {
+			if rerr := release(); rerr != nil {
+				logger.Error("清理文件系统快照失败", "err", rerr)
+				err = errors.Join(err, rerr)
+			}
+		}()
+		srcFS = viewFS
+	}
+	// 交互确认需要先看到完整计划，因此不与扫描并行，确认后按计划执行。
+	// 删除保护不需要完整计划，由 StreamPlan 在扫描结束、产出删除之前检查
+	var reviewed *transfer.Plan
+	if cfg.DryRun || cfg.Review != nil {
+		srcFiles, err := srcFS.List(cfg.Excludes)
+		if err != nil {
+			return fmt.Errorf("扫描源目录失败: %w", err)
+		}
+		plan, err := BuildPlan(srcFiles, baseSnap, *cfg)
+		if err != nil {
+			return err
+		}
+		if err := cfg.Guard.checkPlan(plan, baseSnap.Len(), len(srcFiles)); err != nil {
+			if !cfg.DryRun {
+				logger.Error("删除检查未通过", "err", err)
+				return err
+			}
+			logger.Warn("实际运行时将中止", "err", err)
+		}
+		if cfg.Review != nil {
+			ok, err := cfg.Review(plan)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				logger.Info("计划未获确认，取消本次运行")
+				return ErrPlanRejected
+			}
+		}
+		if cfg.DryRun {
+			logger.Info("Dry-run 模式，只展示计划", "files", plan.TotalFiles, "bytes", plan.TotalBytes)
+			if cfg.Review == nil {
+				for _, item := range plan.Items {
+					logger.Info("计划条目", "action", item.Action, "path", item.RelPath, "size", item.Meta.Size, "reason", item.Reason)
+				}
+			}
+			return nil
+		}
+		reviewed = &plan
 	}
 
-	checkpoint := newCheckpoint(store, baseSnap, cfg.SnapshotName, cfg.Source, cfg.Dest)
+	if pendingSnap != nil {
+		// 先把上次遗留的进度日志合并进 pending.idx，新日志只记录本次运行的条目
+		if err := store.CompactPending(*pendingSnap); err != nil {
+			return fmt.Errorf("合并未完成进度失败: %w", err)
+		}
+	}
+	var chunks *chunk.Store
+	if cfg.Chunked {
+		chunks = chunk.NewStore(repoFS)
+		if err := chunks.Load(); err != nil {
+			return fmt.Errorf("读取数据块列表失败: %w", err)
+		}
+	}
+	// 硬链接快照目录：本次快照写入独立目录，未变化的文件从上一快照目录链接
+	var tree *treeLinker
+	var treeDir string
+	if cfg.Tree {
+		treeDir = treePath(cfg.Set, cfg.SnapshotName)
+		var prev string
+		if lastSnap != nil {
+			prev = lastSnap.Info().Tree
+		}
+		if tree, err = newTreeLinker(repoFS, prev, treeDir); err != nil {
+			return err
+		}
+		treeDest := treeEndpoint(cfg.Dest, treeDir)
+		if destFS, err = buildFS(ctx, &treeDest); err != nil {
+			return err
+		}
+		defer destFS.Close()
+	}
+	var baseName string
+	if baseSnap != nil {
+		baseName = baseSnap.Info().Name
+	}
+	checkpoint, err := newCheckpoint(store, baseName, cfg.SnapshotName, cfg.Source, dataDest, cfg.Chunked, treeDir)
+	if err != nil {
+		return fmt.Errorf("创建进度日志失败: %w", err)
+	}
 
+	var trash *trashMover
+	if cfg.BackupDir != "" {
+		if trash, err = newTrashMover(repoFS, cfg.Set, store.TrashDir(cfg.BackupDir, cfg.SnapshotName)); err != nil {
+			return err
+		}
+	}
+
+	// 进度日志无法写入时中止运行：继续复制的条目在中断后没有断点保护
+	runCtx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
 	executor := transfer.Executor{
-		SourceFS: srcFS,
-		DestFS:   destFS,
-		Src:      cfg.Source,
-		Dst:      cfg.Dest,
-		Checksum: cfg.Checksum,
-		Logger:   logger.Logger,
-		Progress: progress,
+		SourceFS:     srcFS,
+		DestFS:       destFS,
+		Src:          cfg.Source,
+		Dst:          dataDest,
+		Checksum:     cfg.Checksum,
+		Logger:       logger.Logger,
+		Progress:     progress,
+		Retries:      cfg.Retries,
+		RetryBackoff: cfg.RetryBackoff,
+		RetryChanged: cfg.RetryChanged,
+		Chunks:       chunks,
 		OnSuccess: func(item transfer.TransferItem, meta endpoint.FileMeta) {
 			if err := checkpoint.Record(meta); err != nil {
-				logger.Warn("写入增量进度失败", "path", meta.RelPath, "err", err)
+				logger.Error("写入增量进度失败，中止本次运行", "path", meta.RelPath, "err", err)
+				abort(fmt.Errorf("%w: %v", errCheckpoint, err))
 			}
 		},
 	}
+	if trash != nil {
+		executor.Backup = trash.move
+	}
+	if tree != nil {
+		executor.Link = tree.link
+	}
+
+	// 扫描与执行并行：生产者边遍历源目录边规划，执行器按到达顺序处理。
+	// plan 只由生产者写入，scanDone 收到结果后才允许读取
+	var plan transfer.Plan
+	scanCtx, cancelScan := context.WithCancel(runCtx)
+	defer cancelScan()
+	items := make(chan transfer.TransferItem, streamBuffer)
+	scanDone := make(chan error, 1)
+	progress.Start(0, 0)
+	go func() {
+		defer close(items)
+		if cfg.source != nil {
+			defer cfg.source.planDone()
+		}
+		scanDone <- producePlan(srcFS, baseSnap, *cfg, reviewed, func(item transfer.TransferItem) error {
+			if cfg.source != nil {
+				cfg.source.plan(item)
+			}
+			// 只计数不保留条目，内存不随源目录规模增长
+			plan.Count(item)
+			if item.Action == transfer.ActionSkip {
+				logger.Debug("跳过未变化文件", "path", item.RelPath, "reason", item.Reason)
+				return nil
+			}
+			if item.Action == transfer.ActionUpload || item.Action == transfer.ActionDownload {
+				progress.Grow(1, item.Meta.Size)
+			}
+			select {
+			case items <- item:
+				return nil
+			case <-scanCtx.Done():
+				return scanCtx.Err()
+			}
+		})
+	}()
 
-	result, execErr := executor.Execute(ctx, plan)
+	result, execErr := executor.ExecuteStream(runCtx, items)
+	cancelScan()
+	scanErr := <-scanDone
+	switch {
+	case errors.Is(scanErr, ErrGuardTripped):
+		logger.Error("删除检查未通过", "err", scanErr)
+		execErr = errors.Join(execErr, scanErr)
+	case scanErr != nil && !errors.Is(scanErr, context.Canceled):
+		execErr = errors.Join(execErr, fmt.Errorf("扫描源目录失败: %w", scanErr))
+	}
+	stats.plan, stats.result = plan, result
+	if cause := context.Cause(runCtx); errors.Is(cause, errCheckpoint) {
+		execErr = cause
+	}
 	if err := checkpoint.Flush(); err != nil {
 		logger.Warn("刷新进度失败", "err", err)
 	}
 	if execErr != nil {
 		logger.Error("备份过程中出现错误", "err", execErr)
 	}
+	if cause := context.Cause(ctx); errors.Is(cause, meta.ErrLockLost) {
+		// 仓库已归其他进程所有，不再写入快照与进度
+		logger.Error("目标端锁已丢失，不保存快照", "err", cause)
+		return cause
+	}
+	if errors.Is(scanErr, ErrGuardTripped) && len(result.Success) == 0 && len(result.Failed) == 0 {
+		// 目标端没有任何改动，不保存快照；本次新建的进度日志为空，一并清理
+		if pendingSnap == nil {
+			if err := store.ClearPending(); err != nil {
+				logger.Warn("清理进度日志失败", "err", err)
+			}
+		}
+		return execErr
+	}
 
-	finalFiles := mergeSnapshot(baseSnap, plan, result)
+	finalFiles, err := mergeSnapshot(baseSnap, result)
+	if err != nil {
+		return err
+	}
 	snapshot := meta.Snapshot{
 		Name:       cfg.SnapshotName,
 		CreatedAt:  time.Now().UTC(),
 		SourceRoot: cfg.Source.Path,
-		DestRoot:   cfg.Dest.Path,
+		DestRoot:   dataDest.Path,
 		Files:      finalFiles,
 		Completed:  execErr == nil,
+		Chunked:    cfg.Chunked,
+		Tree:       treeDir,
+	}
+	if chunks != nil {
+		stats := chunks.Stats()
+		logger.Info("数据块统计", "written", stats.Written, "written_bytes", stats.BytesWritten, "reused", stats.Reused, "reused_bytes", stats.BytesReused)
 	}
+	summarize(summary, plan, result)
+	stats.snapshotFiles = len(snapshot.Files)
 	if err := store.Save(snapshot); err != nil {
 		logger.Error("保存快照失败", "err", err)
 		return err
 	}
 	if execErr != nil {
+		if err := store.CompactPending(snapshot); err != nil {
+			logger.Warn("合并进度日志失败", "err", err)
+		}
 		logger.Warn("备份未完成，保留进度以供继续", "snapshot", snapshot.Name)
 		return execErr
 	}
 	if err := store.ClearPending(); err != nil {
 		logger.Warn("清理未完成快照失败", "err", err)
 	}
-	logger.Info("备份完成", "snapshot", snapshot.Name, "files", len(snapshot.Files))
+	if cfg.BackupDir != "" && cfg.BackupKeepDays > 0 {
+		purged, err := store.PurgeTrash(cfg.BackupDir, time.Now().AddDate(0, 0, -cfg.BackupKeepDays))
+		for _, name := range purged {
+			logger.Info("已清理过期回收目录", "snapshot", name)
+		}
+		if err != nil {
+			logger.Warn("清理回收目录失败", "err", err)
+		}
+	}
+	logger.Info("备份完成", "snapshot", snapshot.Name, "files", len(snapshot.Files), "retried", len(result.Attempts))
+	return nil
+}
+
+// runStats 记录运行的计划与执行结果，用于运行结束时写入指标文件
+type runStats struct {
+	plan          transfer.Plan
+	result        transfer.Result
+	snapshotFiles int
+	// lastSuccess 为仓库中最近一次完成的快照的创建时间，只在运行失败时读取
+	lastSuccess time.Time
+}
+
+// loadLastSuccess 在运行失败时从 store 中找出最近一次完成的快照，作为导出的最后成功时间。
+// 需在仓库连接关闭之前以 defer 调用
+func (s *runStats) loadLastSuccess(cfg *BackupConfig, store *meta.Store, err error) {
+	if cfg.MetricsFile == "" || cfg.DryRun || err == nil {
+		return
+	}
+	s.lastSuccess = lastCompleted(store)
+}
+
+// lastCompleted 返回 store 中最近一次完成的快照的创建时间，没有或读取失败时为零值
+func lastCompleted(store *meta.Store) time.Time {
+	infos, err := store.SnapshotInfos()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取最后成功的快照失败: %v\n", err)
+		return time.Time{}
+	}
+	for _, info := range infos {
+		if info.Completed {
+			return info.CreatedAt
+		}
+	}
+	return time.Time{}
+}
+
+// writeMetrics 按运行的最终结果写入指标文件。运行开始时以 defer 调用，
+// 加锁、保护检查、扫描等提前失败的运行同样会导出 zbackup_last_run_success 0
+func (s *runStats) writeMetrics(cfg *BackupConfig, startedAt time.Time, err error) {
+	if cfg.MetricsFile == "" || cfg.DryRun || errors.Is(err, ErrPlanRejected) {
+		return
+	}
+	m := metrics.Collect(s.plan, s.result, err == nil)
+	m.Dest = cfg.Dest.DisplayName()
+	m.StartedAt = startedAt
+	m.FinishedAt = time.Now()
+	m.SnapshotFiles = s.snapshotFiles
+	m.LastSuccess = s.lastSuccess
+	if cfg.collectMetrics != nil {
+		cfg.collectMetrics(m)
+		return
+	}
+	if werr := m.WriteTextfile(cfg.MetricsFile); werr != nil {
+		fmt.Fprintf(os.Stderr, "写入指标文件 %s 失败: %v\n", cfg.MetricsFile, werr)
+	}
+}
+
+// producePlan 逐条产出计划条目：已确认的计划直接回放，否则边扫描边规划
+func producePlan(fs endpoint.FileSystem, last *meta.Index, cfg BackupConfig, reviewed *transfer.Plan, emit func(transfer.TransferItem) error) error {
+	if reviewed == nil {
+		return StreamPlan(fs, last, cfg, emit)
+	}
+	for _, item := range reviewed.Items {
+		if err := emit(item); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func mergeSnapshot(last *meta.Snapshot, plan transfer.Plan, result transfer.Result) map[string]endpoint.FileMeta {
-	final := make(map[string]endpoint.FileMeta)
+// sameStorage 判断快照与本次配置的存储方式是否一致；同步快照记录的是目标端的文件状态，不作为备份的基准
+func sameStorage(snap meta.SnapshotInfo, cfg *BackupConfig) bool {
+	return snap.Chunked == cfg.Chunked && (snap.Tree != "") == cfg.Tree && !snap.Sync
+}
+
+func storageLabel(snap meta.SnapshotInfo) string {
+	switch {
+	case snap.Chunked:
+		return "分块存储"
+	case snap.Tree != "":
+		return "硬链接快照目录"
+	case snap.Sync:
+		return "双向同步"
+	}
+	return "镜像存储"
+}
+
+// summarize 把计划与执行结果汇总进通知摘要
+func summarize(summary *notify.Summary, plan transfer.Plan, result transfer.Result) {
+	summary.FilesTransferred += result.Transferred
+	summary.BytesTransferred += result.BytesTransferred
+	summary.FilesDeleted += plan.Counts[transfer.ActionDelete]
+	failed := make([]string, 0, len(result.Failed))
+	for rel := range result.Failed {
+		failed = append(failed, rel)
+	}
+	sort.Strings(failed)
+	for _, rel := range failed {
+		summary.AddFailed(rel)
+	}
+	if len(result.Attempts) > 0 {
+		summary.Attempts = result.Attempts
+	}
+	changed := make([]string, 0, len(result.Changed))
+	for rel := range result.Changed {
+		changed = append(changed, rel)
+	}
+	sort.Strings(changed)
+	for _, rel := range changed {
+		summary.AddChanged(rel)
+	}
+}
+
+// mergeSnapshot 以上一快照为基础，加入成功的条目并移除已删除的条目；
+// 未变化与失败的条目沿用上一快照中的记录
+func mergeSnapshot(last *meta.Index, result transfer.Result) (map[string]endpoint.FileMeta, error) {
+	final := make(map[string]endpoint.FileMeta, last.Len()+len(result.Success))
 	if last != nil {
-		for rel, meta := range last.Files {
-			final[rel] = meta
+		err := last.Each(func(meta endpoint.FileMeta) error {
+			final[meta.RelPath] = meta
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("读取上一快照失败: %w", err)
 		}
 	}
 	for rel, meta := range result.Success {
 		meta.RelPath = rel
 		final[rel] = meta
 	}
-	for _, item := range plan.Items {
-		switch item.Action {
-		case transfer.ActionDelete:
-			delete(final, item.RelPath)
-		case transfer.ActionSkip:
-			if last != nil {
-				if meta, ok := last.Files[item.RelPath]; ok {
-					final[item.RelPath] = meta
-				}
-			}
+	for _, rel := range result.Deleted {
+		delete(final, rel)
+	}
+	return final, nil
+}
+
+// checkSetMixing 拒绝在同一仓库中混用默认备份集与命名备份集。默认备份集的数据镜像在仓库根，
+// 命名备份集的数据在 <仓库>/<名称>/，默认备份集源端的同名顶层目录会与之共用文件，
+// 两者的锁互不相干，任一方的全量模式都会删掉对方的数据
+func checkSetMixing(repo *meta.Store, set string) error {
+	if set == "" {
+		sets, err := repo.ListSets()
+		if err != nil {
+			return fmt.Errorf("读取备份集列表失败: %w", err)
+		}
+		if len(sets) > 0 {
+			return fmt.Errorf("仓库中已有命名备份集（%s），默认备份集的数据目录与其重叠，请使用 --set 或单独的仓库", strings.Join(sets, ", "))
 		}
+		return nil
+	}
+	used, err := repo.InUse()
+	if err != nil {
+		return fmt.Errorf("读取默认备份集失败: %w", err)
 	}
-	return final
+	if used {
+		return fmt.Errorf("仓库中已有默认备份集的快照，其数据目录与备份集 %s 重叠，请为命名备份集使用单独的仓库", set)
+	}
+	return nil
 }
 
-func buildFS(ep *endpoint.Endpoint) (endpoint.FileSystem, error) {
+// setEndpoint 返回备份集数据目录对应的端点
+func setEndpoint(repo endpoint.Endpoint, set string) endpoint.Endpoint {
+	ep := repo
+	if ep.Type != endpoint.EndpointLocal {
+		ep.Path = path.Join(ep.Path, set)
+	} else {
+		ep.Path = filepath.Join(ep.Path, set)
+	}
+	return ep
+}
+
+// OpenFS 根据端点构造文件系统，供子命令直接访问目标端
+func OpenFS(ep endpoint.Endpoint) (endpoint.FileSystem, error) {
+	return buildFS(context.Background(), &ep)
+}
+
+func buildFS(ctx context.Context, ep *endpoint.Endpoint) (endpoint.FileSystem, error) {
 	switch ep.Type {
 	case endpoint.EndpointLocal:
 		abs, err := filepath.Abs(ep.Path)
@@ -174,12 +627,66 @@ func buildFS(ep *endpoint.Endpoint) (endpoint.FileSystem, error) {
 		return endpoint.NewLocalFS(abs), nil
 	case endpoint.EndpointRemote:
 		return endpoint.NewRemoteFS(*ep), nil
+	case endpoint.EndpointS3:
+		return endpoint.NewS3FS(ctx, *ep, endpoint.S3ConfigFromEnv())
+	case endpoint.EndpointTar:
+		return nil, fmt.Errorf("tar 归档 %s 不能作为文件系统访问", ep.Path)
+	case endpoint.EndpointWebDAV:
+		user := ep.User
+		if user == "" {
+			user = os.Getenv("ZBACKUP_WEBDAV_USER")
+		}
+		return endpoint.NewWebDAVFS(ctx, *ep, user, os.Getenv("ZBACKUP_WEBDAV_PASSWORD")), nil
 	default:
 		return nil, fmt.Errorf("未知端点类型")
 	}
 }
 
-func prepareLogWriter(cfg *BackupConfig, destFS endpoint.FileSystem) (io.WriteCloser, string, error) {
+// newOutput 创建进度条与日志，日志同时写到终端与 logWriter（可为 nil）
+func newOutput(cfg *BackupConfig, logWriter io.Writer) (ui.Progress, *logging.Logger, error) {
+	var progress ui.Progress
+	stdWriter := io.Writer(os.Stdout)
+	if cfg.NoProgress {
+		progress = ui.NoopProgress{}
+	} else {
+		bar := ui.NewBarProgress(os.Stdout)
+		progress = bar
+		stdWriter = bar.WrapWriter(os.Stdout)
+	}
+	var logWriters []io.Writer
+	logWriters = append(logWriters, stdWriter)
+	if logWriter != nil {
+		logWriters = append(logWriters, logWriter)
+	}
+	logger, err := logging.New(cfg.LogLevel, logWriters...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return progress, logger, nil
+}
+
+// reportPath 返回运行报告在仓库中的路径，与同名快照的日志放在一起
+func reportPath(metaDir, snapshot string) string {
+	return filepath.Join(metaDir, "logs", fmt.Sprintf("backup-%s.json", snapshot))
+}
+
+func saveReport(destFS endpoint.FileSystem, metaDir string, summary notify.Summary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	writer, err := destFS.Create(reportPath(metaDir, summary.Snapshot), 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(append(data, '\n')); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+func prepareLogWriter(cfg *BackupConfig, destFS endpoint.FileSystem, metaDir string) (io.WriteCloser, string, error) {
 	if cfg.LogFile != "" {
 		file, err := os.Create(cfg.LogFile)
 		if err != nil {
@@ -187,7 +694,7 @@ func prepareLogWriter(cfg *BackupConfig, destFS endpoint.FileSystem) (io.WriteCl
 		}
 		return file, cfg.LogFile, nil
 	}
-	logRel := filepath.Join(".zbackup", "logs", fmt.Sprintf("backup-%s.log", cfg.SnapshotName))
+	logRel := filepath.Join(metaDir, "logs", fmt.Sprintf("backup-%s.log", cfg.SnapshotName))
 	writer, err := destFS.Create(logRel, 0o644)
 	if err != nil {
 		return nil, "", err
@@ -1,9 +1,15 @@
 package core
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"zbackup/pkg/chunk"
 	"zbackup/pkg/endpoint"
 	"zbackup/pkg/meta"
 	"zbackup/pkg/transfer"
@@ -16,18 +22,16 @@ func TestMergeSnapshot(t *testing.T) {
 			"keep.txt": {RelPath: "keep.txt", Size: 2},
 		},
 	}
-	plan := transfer.Plan{
-		Items: []transfer.TransferItem{
-			{RelPath: "old.txt", Action: transfer.ActionDelete},
-			{RelPath: "keep.txt", Action: transfer.ActionSkip},
-		},
-	}
 	result := transfer.Result{
 		Success: map[string]endpoint.FileMeta{
 			"new.txt": {RelPath: "new.txt", Size: 3, ModTime: time.Now()},
 		},
+		Deleted: []string{"old.txt"},
+	}
+	final, err := mergeSnapshot(indexOf(t, last), result)
+	if err != nil {
+		t.Fatalf("merge snapshot: %v", err)
 	}
-	final := mergeSnapshot(last, plan, result)
 	if _, ok := final["old.txt"]; ok {
 		t.Fatalf("deleted file should not remain")
 	}
@@ -38,3 +42,266 @@ func TestMergeSnapshot(t *testing.T) {
 		t.Fatalf("skip file should persist")
 	}
 }
+
+func TestRunLocalToLocal(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(srcDir, "sub"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "sub", "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	cfg := &BackupConfig{
+		Source:       endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: srcDir},
+		Dest:         endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir},
+		Mode:         endpoint.ModeIncr,
+		Checksum:     endpoint.ChecksumSHA256,
+		SnapshotName: "first",
+		LogFile:      filepath.Join(t.TempDir(), "run.log"),
+		LogLevel:     "error",
+		NoProgress:   true,
+	}
+	if err := Run(context.Background(), cfg); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dstDir, "sub", "a.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("file not copied: %q %v", data, err)
+	}
+	store := meta.NewStore(endpoint.NewLocalFS(dstDir))
+	latest, err := store.LoadLatest()
+	if err != nil || latest == nil || latest.Name != "first" || !latest.Completed {
+		t.Fatalf("unexpected latest snapshot: %+v %v", latest, err)
+	}
+	if _, ok := latest.Files["sub/a.txt"]; !ok {
+		t.Fatalf("snapshot missing file: %+v", latest.Files)
+	}
+	pending, err := store.LoadPending()
+	if err != nil || pending != nil {
+		t.Fatalf("pending should be cleared: %+v %v", pending, err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, ".zbackup", "lock")); !os.IsNotExist(err) {
+		t.Fatalf("lock should be released")
+	}
+}
+
+func TestRunReview(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0o644)
+	var reviewed transfer.Plan
+	accept := false
+	cfg := func(name string) *BackupConfig {
+		return &BackupConfig{
+			Source:       endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: srcDir},
+			Dest:         endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir},
+			Mode:         endpoint.ModeIncr,
+			Checksum:     endpoint.ChecksumSHA256,
+			SnapshotName: name,
+			LogLevel:     "error",
+			NoProgress:   true,
+			Review: func(plan transfer.Plan) (bool, error) {
+				reviewed = plan
+				return accept, nil
+			},
+		}
+	}
+	if err := Run(context.Background(), cfg("first")); !errors.Is(err, ErrPlanRejected) {
+		t.Fatalf("expected rejection, got %v", err)
+	}
+	if reviewed.Counts[transfer.ActionUpload] != 1 {
+		t.Fatalf("review should see the full plan: %+v", reviewed)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("rejected plan must not transfer files")
+	}
+	// 取消的运行既不留下快照，也不写运行报告
+	entries, _ := os.ReadDir(filepath.Join(dstDir, ".zbackup", "logs"))
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) == ".json" {
+			t.Fatalf("rejected run should not write a report: %s", e.Name())
+		}
+	}
+	if latest, _ := meta.NewStore(endpoint.NewLocalFS(dstDir)).LoadLatest(); latest != nil {
+		t.Fatalf("rejected run should not save a snapshot")
+	}
+
+	accept = true
+	if err := Run(context.Background(), cfg("second")); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dstDir, "a.txt")); err != nil || string(data) != "a" {
+		t.Fatalf("file not copied: %q %v", data, err)
+	}
+	latest, err := meta.NewStore(endpoint.NewLocalFS(dstDir)).LoadLatest()
+	if err != nil || latest == nil || latest.Name != "second" || !latest.Completed {
+		t.Fatalf("unexpected latest snapshot: %+v %v", latest, err)
+	}
+}
+
+func TestRunIntoNamedSet(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "hosts"), []byte("127.0.0.1"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	cfg := &BackupConfig{
+		Source:       endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: srcDir},
+		Dest:         endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir},
+		Set:          "etc",
+		Mode:         endpoint.ModeIncr,
+		Checksum:     endpoint.ChecksumSHA256,
+		SnapshotName: "first",
+		LogLevel:     "error",
+		NoProgress:   true,
+	}
+	if err := Run(context.Background(), cfg); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "etc", "hosts")); err != nil {
+		t.Fatalf("file should be stored under set dir: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, ".zbackup", "sets", "etc", "logs", "backup-first.log")); err != nil {
+		t.Fatalf("log should be stored with set metadata: %v", err)
+	}
+	store, _ := meta.NewStore(endpoint.NewLocalFS(dstDir)).WithSet("etc")
+	latest, err := store.LoadLatest()
+	if err != nil || latest == nil || latest.Name != "first" {
+		t.Fatalf("unexpected set latest: %+v %v", latest, err)
+	}
+	if root, _ := meta.NewStore(endpoint.NewLocalFS(dstDir)).LoadLatest(); root != nil {
+		t.Fatalf("default set should stay empty")
+	}
+
+	// 默认备份集镜像在仓库根，会与命名备份集的数据目录重叠，不能混用
+	def := *cfg
+	def.Set, def.SnapshotName = "", "root"
+	if err := Run(context.Background(), &def); err == nil {
+		t.Fatalf("default set should be rejected in a repo with named sets")
+	}
+	other := t.TempDir()
+	def.Dest.Path = other
+	if err := Run(context.Background(), &def); err != nil {
+		t.Fatalf("default set run failed: %v", err)
+	}
+	named := *cfg
+	named.Dest.Path = other
+	if err := Run(context.Background(), &named); err == nil {
+		t.Fatalf("named set should be rejected in a repo used by the default set")
+	}
+	if sets, _ := meta.NewStore(endpoint.NewLocalFS(other)).ListSets(); len(sets) != 0 {
+		t.Fatalf("rejected run should not create set metadata: %v", sets)
+	}
+}
+
+func TestRunChunkedDedupAndRestore(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	big := make([]byte, 6<<20)
+	for i := range big {
+		big[i] = byte(i*7 + i/4099)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "disk.img"), big, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	os.WriteFile(filepath.Join(srcDir, "empty"), nil, 0o600)
+	cfg := func(name string) *BackupConfig {
+		return &BackupConfig{
+			Source:       endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: srcDir},
+			Dest:         endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir},
+			Mode:         endpoint.ModeIncr,
+			Checksum:     endpoint.ChecksumSHA256,
+			Chunked:      true,
+			SnapshotName: name,
+			LogLevel:     "error",
+			NoProgress:   true,
+		}
+	}
+	countChunks := func() int {
+		refs, err := chunk.NewStore(endpoint.NewLocalFS(dstDir)).List()
+		if err != nil {
+			t.Fatalf("list chunks: %v", err)
+		}
+		return len(refs)
+	}
+	if err := Run(context.Background(), cfg("first")); err != nil {
+		t.Fatalf("first run failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "disk.img")); !os.IsNotExist(err) {
+		t.Fatalf("chunked mode should not mirror files")
+	}
+	initial := countChunks()
+
+	copy(big[3<<20:], "a small edit in the middle")
+	os.WriteFile(filepath.Join(srcDir, "disk.img"), big, 0o644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(srcDir, "disk.img"), later, later)
+	if err := Run(context.Background(), cfg("second")); err != nil {
+		t.Fatalf("second run failed: %v", err)
+	}
+	if added := countChunks() - initial; added < 1 || added > 2 {
+		t.Fatalf("expected 1-2 new chunks after a small edit, got %d", added)
+	}
+
+	target := t.TempDir()
+	snap, err := RestoreSnapshot(endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir}, "", "", target)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if snap.Name != "second" || !snap.Chunked {
+		t.Fatalf("unexpected restored snapshot %s chunked=%v", snap.Name, snap.Chunked)
+	}
+	data, err := os.ReadFile(filepath.Join(target, "disk.img"))
+	if err != nil || !bytes.Equal(data, big) {
+		t.Fatalf("restored content differs: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(target, "empty")); err != nil || info.Size() != 0 {
+		t.Fatalf("empty file not restored: %v", err)
+	}
+}
+
+func TestRunChunkedRestoresSparseFile(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	const size = 4 << 20
+	file, err := os.Create(filepath.Join(srcDir, "vm.img"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	file.WriteAt([]byte("header"), 0)
+	file.WriteAt([]byte("tail"), 3<<20)
+	file.Truncate(size)
+	file.Close()
+	if meta, err := endpoint.NewLocalFS(srcDir).Stat("vm.img"); err != nil || !meta.Sparse {
+		t.Skip("temp filesystem does not keep holes")
+	}
+	err = Run(context.Background(), &BackupConfig{
+		Source:       endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: srcDir},
+		Dest:         endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir},
+		Mode:         endpoint.ModeIncr,
+		Checksum:     endpoint.ChecksumSHA256,
+		Chunked:      true,
+		SnapshotName: "first",
+		LogLevel:     "error",
+		NoProgress:   true,
+	})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	target := t.TempDir()
+	snap, err := RestoreSnapshot(endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir}, "", "", target)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if !snap.Files["vm.img"].Sparse {
+		t.Fatalf("chunked snapshot should keep the sparse flag")
+	}
+	restored, err := endpoint.NewLocalFS(target).Stat("vm.img")
+	if err != nil || restored.Size != size || !restored.Sparse {
+		t.Fatalf("restored file should be sparse with full size: %+v %v", restored, err)
+	}
+	want, _ := os.ReadFile(filepath.Join(srcDir, "vm.img"))
+	if got, _ := os.ReadFile(filepath.Join(target, "vm.img")); !bytes.Equal(got, want) {
+		t.Fatalf("restored content differs")
+	}
+}
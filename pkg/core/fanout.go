@@ -0,0 +1,411 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/logging"
+	"zbackup/pkg/meta"
+	"zbackup/pkg/metrics"
+	"zbackup/pkg/transfer"
+)
+
+// fanoutBuffer 为多目标共享读取时每次从源文件读取的字节数
+const fanoutBuffer = 256 << 10
+
+// runFanout 把同一源端备份到多个目标端：源端只检查、冻结与扫描一次，
+// 每个目标端仍是一次独立的备份运行（各自的锁、计划、快照、报告与通知），
+// 通过 fanoutSource 共享扫描结果，并且同一文件只从源端读取一次
+func runFanout(ctx context.Context, cfg *BackupConfig) (err error) {
+	runs := make([]BackupConfig, 0, len(cfg.Dests))
+	seen := make(map[string]bool)
+	for _, dest := range cfg.Dests {
+		run := *cfg
+		run.Dest, run.Dests = dest, nil
+		if err := run.Validate(); err != nil {
+			return fmt.Errorf("目标端 %s: %w", dest.DisplayName(), err)
+		}
+		// 各目标端使用同一个快照名，由第一个目标端的校验生成
+		cfg.SnapshotName = run.SnapshotName
+		if dest.Type == endpoint.EndpointTar {
+			return fmt.Errorf("多目标备份不支持 tar 归档目标 %s", dest.DisplayName())
+		}
+		if seen[dest.DisplayName()] {
+			return fmt.Errorf("目标端 %s 重复指定", dest.DisplayName())
+		}
+		seen[dest.DisplayName()] = true
+		runs = append(runs, run)
+	}
+	switch {
+	case cfg.Mode == endpoint.ModeSync:
+		return fmt.Errorf("同步模式只能指定一个目标端")
+	case cfg.Review != nil:
+		return fmt.Errorf("多目标备份不支持交互确认")
+	case cfg.LogFile != "":
+		return fmt.Errorf("多目标备份不支持 --log-file，日志分别写入各目标端")
+	}
+	if cfg.MetricsFile != "" && !cfg.DryRun {
+		// 各目标端的指标以 dest 标签区分，全部结束后写入同一个指标文件
+		collected := make([]metrics.RunMetrics, len(runs))
+		for i := range runs {
+			runs[i].collectMetrics = func(m metrics.RunMetrics) { collected[i] = m }
+		}
+		startedAt := time.Now()
+		defer func() { writeFanoutMetrics(ctx, cfg.MetricsFile, runs, collected, startedAt) }()
+	}
+
+	srcFS, err := buildFS(ctx, &cfg.Source)
+	if err != nil {
+		return err
+	}
+	defer srcFS.Close()
+	logger, err := logging.New(cfg.LogLevel, os.Stdout)
+	if err != nil {
+		return err
+	}
+	defer logger.Close()
+	if err := cfg.Guard.checkSource(srcFS); err != nil {
+		logger.Error("源端检查未通过", "err", err)
+		return err
+	}
+	if cfg.FSSnapshot != nil && !cfg.DryRun {
+		viewFS, release, err := freezeSource(ctx, cfg.FSSnapshot, cfg.Source, srcFS, cfg.SnapshotName)
+		if err != nil {
+			logger.Error("创建文件系统快照失败", "err", err)
+			return err
+		}
+		logger.Info("已创建文件系统快照", "provider", cfg.FSSnapshot.Name(), "view", viewFS.Root())
+		defer func() {
+			if rerr := release(); rerr != nil {
+				logger.Error("清理文件系统快照失败", "err", rerr)
+				err = errors.Join(err, rerr)
+			}
+		}()
+		srcFS = viewFS
+	}
+	files, err := srcFS.List(cfg.Excludes)
+	if err != nil {
+		return fmt.Errorf("扫描源目录失败: %w", err)
+	}
+	logger.Info("源端扫描完成", "entries", len(files), "dests", len(runs))
+
+	// 源端已在上面检查并冻结；多个进度条会互相覆盖，各目标端只输出日志
+	shared := newFanoutSource(srcFS, files)
+	for i := range runs {
+		runs[i].source = shared.client()
+		runs[i].FSSnapshot = nil
+		runs[i].Guard.Marker, runs[i].Guard.RequireMount = "", false
+		runs[i].NoProgress = true
+	}
+	errs := make([]error, len(runs))
+	run := func(i int) {
+		if rerr := runDest(ctx, &runs[i]); rerr != nil {
+			errs[i] = fmt.Errorf("目标端 %s: %w", runs[i].Dest.DisplayName(), rerr)
+		}
+	}
+	if cfg.DryRun {
+		// dry-run 不读取文件内容，逐个目标端输出计划便于阅读
+		for i := range runs {
+			run(i)
+		}
+	} else {
+		var wg sync.WaitGroup
+		for i := range runs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				run(i)
+			}()
+		}
+		wg.Wait()
+	}
+	return errors.Join(errs...)
+}
+
+// fanoutSource 让多个目标端的备份运行共用一次源端扫描与读取。
+// 各运行按扫描顺序规划与执行；读取某个文件时，先等待其余运行确定是否需要它，
+// 需要的运行全部到达后只打开一次源文件，内容同时流向这些运行
+type fanoutSource struct {
+	fs    endpoint.FileSystem
+	files []endpoint.FileMeta
+	index map[string]int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	clients []*fanoutClient
+	groups  map[int]*fanoutGroup
+}
+
+// fanoutGroup 为等待同时读取同一文件的运行
+type fanoutGroup struct {
+	members []*fanoutClient
+	readers map[*fanoutClient]io.ReadCloser
+	err     error
+}
+
+func newFanoutSource(fs endpoint.FileSystem, files []endpoint.FileMeta) *fanoutSource {
+	s := &fanoutSource{
+		fs:     fs,
+		files:  files,
+		index:  make(map[string]int, len(files)),
+		groups: make(map[int]*fanoutGroup),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	for i, meta := range files {
+		s.index[normRel(meta.RelPath)] = i
+	}
+	return s
+}
+
+// client 为一个目标端的运行创建源端视图，必须在任何运行开始前创建完毕
+func (s *fanoutSource) client() *fanoutClient {
+	c := &fanoutClient{FileSystem: s.fs, src: s, opened: -1, wants: make(map[int]bool)}
+	s.clients = append(s.clients, c)
+	return c
+}
+
+// fanoutClient 为单个目标端看到的源端：扫描回放共享结果，读取经 fanoutSource 协调。
+// 只嵌入 FileSystem 接口，源端的稀疏文件与远端校验等可选能力在多目标时不使用，批量 stat 除外
+type fanoutClient struct {
+	endpoint.FileSystem
+	src *fanoutSource
+	// planned 为已完成规划的扫描条目数，此前的条目是否需要读取已经确定
+	planned int
+	// opened 为最近读取的扫描条目序号，执行器按扫描顺序前进，不会再读取更早的条目
+	opened int
+	// wants 为已规划传输、尚未读取的条目
+	wants map[int]bool
+	done  bool
+}
+
+func (c *fanoutClient) List(excludes []string) ([]endpoint.FileMeta, error) {
+	return append([]endpoint.FileMeta(nil), c.src.files...), nil
+}
+
+func (c *fanoutClient) Walk(excludes []string, fn func(endpoint.FileMeta) error) error {
+	for _, meta := range c.src.files {
+		if err := fn(meta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close 不关闭共享的源端，由 runFanout 统一关闭
+func (c *fanoutClient) Close() error {
+	return nil
+}
+
+// StatBatch 供执行器核对复制期间源文件是否变化，源端不支持批量查询时逐个 stat
+func (c *fanoutClient) StatBatch(relPaths []string) (map[string]endpoint.FileMeta, error) {
+	if b, ok := c.src.fs.(endpoint.BatchStater); ok {
+		return b.StatBatch(relPaths)
+	}
+	metas := make(map[string]endpoint.FileMeta, len(relPaths))
+	for _, rel := range relPaths {
+		meta, err := c.src.fs.Stat(rel)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		metas[rel] = meta
+	}
+	return metas, nil
+}
+
+func (c *fanoutClient) Reconnect() error {
+	if rc, ok := c.src.fs.(endpoint.Reconnector); ok {
+		return rc.Reconnect()
+	}
+	return nil
+}
+
+// plan 记录运行产出的计划条目；计划按扫描顺序产出，条目之前的扫描条目均已确定
+func (c *fanoutClient) plan(item transfer.TransferItem) {
+	s := c.src
+	x, ok := s.index[item.RelPath]
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.planned = max(c.planned, x+1)
+	if item.Action == transfer.ActionUpload || item.Action == transfer.ActionDownload {
+		c.wants[x] = true
+	}
+	s.cond.Broadcast()
+}
+
+// planDone 表示运行的计划已全部产出
+func (c *fanoutClient) planDone() {
+	s := c.src
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.planned = len(s.files)
+	s.cond.Broadcast()
+}
+
+// finish 表示运行已结束，其余运行不再等待它
+func (c *fanoutClient) finish() {
+	s := c.src
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.done = true
+	s.cond.Broadcast()
+}
+
+// pending 判断运行是否可能还会读取第 x 个条目
+func (c *fanoutClient) pending(x int) bool {
+	if c.done || c.opened >= x {
+		return false
+	}
+	return c.planned <= x || c.wants[x]
+}
+
+// Open 读取源文件。其余运行也需要该文件时等待它们到达后共享一次读取；
+// 重试等再次读取同一条目时直接打开源文件
+func (c *fanoutClient) Open(relPath string) (io.ReadCloser, error) {
+	s := c.src
+	x, ok := s.index[relPath]
+	s.mu.Lock()
+	if !ok || x <= c.opened {
+		s.mu.Unlock()
+		return s.fs.Open(relPath)
+	}
+	c.opened = x
+	delete(c.wants, x)
+	g := s.groups[x]
+	if g == nil {
+		g = &fanoutGroup{}
+		s.groups[x] = g
+	}
+	g.members = append(g.members, c)
+	s.cond.Broadcast()
+	defer s.mu.Unlock()
+	for {
+		if g.readers != nil {
+			return g.readers[c], nil
+		}
+		if g.err != nil {
+			return nil, g.err
+		}
+		if !s.waiting(x, g) {
+			break
+		}
+		s.cond.Wait()
+	}
+	delete(s.groups, x)
+	if len(g.members) == 1 {
+		return s.fs.Open(relPath)
+	}
+	reader, err := s.fs.Open(relPath)
+	if err != nil {
+		g.err = err
+		s.cond.Broadcast()
+		return nil, err
+	}
+	g.readers = make(map[*fanoutClient]io.ReadCloser, len(g.members))
+	writers := make([]*io.PipeWriter, 0, len(g.members))
+	for _, m := range g.members {
+		pr, pw := io.Pipe()
+		g.readers[m] = pr
+		writers = append(writers, pw)
+	}
+	go broadcast(reader, writers)
+	s.cond.Broadcast()
+	return g.readers[c], nil
+}
+
+// waiting 判断是否还有未到达的运行可能需要第 x 个条目
+func (s *fanoutSource) waiting(x int, g *fanoutGroup) bool {
+	for _, c := range s.clients {
+		if !g.member(c) && c.pending(x) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *fanoutGroup) member(c *fanoutClient) bool {
+	for _, m := range g.members {
+		if m == c {
+			return true
+		}
+	}
+	return false
+}
+
+// broadcast 把源文件内容依次写入每个运行的管道；读端已关闭的运行不再接收。
+// 读取或关闭源文件出错时（例如 ssh 连接中断只体现在 Close 的退出码上）各运行都收到该错误
+func broadcast(src io.ReadCloser, pipes []*io.PipeWriter) {
+	buf := make([]byte, fanoutBuffer)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			live := pipes[:0]
+			for _, pw := range pipes {
+				if _, werr := pw.Write(buf[:n]); werr == nil {
+					live = append(live, pw)
+				}
+			}
+			pipes = live
+			if len(pipes) == 0 {
+				src.Close()
+				return
+			}
+		}
+		if err != nil {
+			cerr := src.Close()
+			if errors.Is(err, io.EOF) {
+				err = cerr
+			}
+			for _, pw := range pipes {
+				pw.CloseWithError(err)
+			}
+			return
+		}
+	}
+}
+
+// writeFanoutMetrics 把各目标端的指标写入同一个指标文件。
+// 源端检查、冻结或扫描失败时目标端运行没有开始，这些目标端导出失败指标，
+// 最后成功时间取自各自仓库中最近一次完成的快照
+func writeFanoutMetrics(ctx context.Context, path string, runs []BackupConfig, collected []metrics.RunMetrics, startedAt time.Time) {
+	for i := range runs {
+		if collected[i].Dest != "" {
+			continue
+		}
+		collected[i] = metrics.RunMetrics{
+			Dest:        runs[i].Dest.DisplayName(),
+			StartedAt:   startedAt,
+			FinishedAt:  time.Now(),
+			LastSuccess: repoLastCompleted(ctx, &runs[i]),
+		}
+	}
+	if err := metrics.WriteTextfile(path, collected...); err != nil {
+		fmt.Fprintf(os.Stderr, "写入指标文件 %s 失败: %v\n", path, err)
+	}
+}
+
+// repoLastCompleted 连接目标端仓库读取最近一次完成的快照时间，连接失败时为零值
+func repoLastCompleted(ctx context.Context, cfg *BackupConfig) time.Time {
+	repoFS, err := buildFS(context.WithoutCancel(ctx), &cfg.Dest)
+	if err != nil {
+		return time.Time{}
+	}
+	defer repoFS.Close()
+	store, err := meta.NewStore(repoFS).WithSet(cfg.Set)
+	if err != nil {
+		return time.Time{}
+	}
+	return lastCompleted(store)
+}
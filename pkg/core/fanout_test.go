@@ -0,0 +1,176 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/meta"
+	"zbackup/pkg/transfer"
+)
+
+// countingFS 统计源文件被打开的次数
+type countingFS struct {
+	endpoint.FileSystem
+	opens atomic.Int32
+}
+
+func (c *countingFS) Open(relPath string) (io.ReadCloser, error) {
+	c.opens.Add(1)
+	return c.FileSystem.Open(relPath)
+}
+
+func TestFanoutSourceReadsOnce(t *testing.T) {
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("shared content"), 0o644)
+	os.WriteFile(filepath.Join(srcDir, "b.txt"), []byte("only one"), 0o644)
+	src := &countingFS{FileSystem: endpoint.NewLocalFS(srcDir)}
+	files, err := src.List(nil)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	shared := newFanoutSource(src, files)
+	one, two, idle := shared.client(), shared.client(), shared.client()
+	for _, c := range []*fanoutClient{one, two} {
+		c.plan(transfer.TransferItem{RelPath: "a.txt", Action: transfer.ActionUpload})
+		c.planDone()
+	}
+	// 不需要任何文件的运行与提前结束的运行都不应阻塞其余运行
+	idle.plan(transfer.TransferItem{RelPath: "a.txt", Action: transfer.ActionSkip})
+	idle.finish()
+
+	var wg sync.WaitGroup
+	got := make([]string, 2)
+	for i, c := range []*fanoutClient{one, two} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reader, err := c.Open("a.txt")
+			if err != nil {
+				t.Errorf("open: %v", err)
+				return
+			}
+			defer reader.Close()
+			data, _ := io.ReadAll(reader)
+			got[i] = string(data)
+		}()
+	}
+	wg.Wait()
+	if got[0] != "shared content" || got[1] != "shared content" {
+		t.Fatalf("unexpected content: %q", got)
+	}
+	if n := src.opens.Load(); n != 1 {
+		t.Fatalf("shared file opened %d times, want 1", n)
+	}
+
+	// 只有一个运行需要的文件，以及重试时的再次读取，都直接打开源文件
+	reader, err := one.Open("b.txt")
+	if err != nil {
+		t.Fatalf("open b.txt: %v", err)
+	}
+	reader.Close()
+	reader, err = two.Open("a.txt")
+	if err != nil {
+		t.Fatalf("reopen a.txt: %v", err)
+	}
+	if data, _ := io.ReadAll(reader); string(data) != "shared content" {
+		t.Fatalf("reopen content: %q", data)
+	}
+	reader.Close()
+	if n := src.opens.Load(); n != 3 {
+		t.Fatalf("source opened %d times, want 3", n)
+	}
+}
+
+// closeErrReader 读完内容后正常 EOF，Close 时才返回错误，与 ssh cat 断线时一致
+type closeErrReader struct {
+	io.Reader
+	err error
+}
+
+func (c closeErrReader) Close() error { return c.err }
+
+func TestBroadcastPassesCloseError(t *testing.T) {
+	closeErr := errors.New("exit status 255")
+	pr, pw := io.Pipe()
+	go broadcast(closeErrReader{Reader: strings.NewReader("partial"), err: closeErr}, []*io.PipeWriter{pw})
+	data, err := io.ReadAll(pr)
+	if string(data) != "partial" || !errors.Is(err, closeErr) {
+		t.Fatalf("close error should reach the pipe, got %q %v", data, err)
+	}
+}
+
+func TestRunFanout(t *testing.T) {
+	srcDir := t.TempDir()
+	first, second := t.TempDir(), t.TempDir()
+	local := func(dir string) endpoint.Endpoint {
+		return endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dir}
+	}
+	cfg := func(name string, dests ...string) *BackupConfig {
+		c := &BackupConfig{
+			Source:       local(srcDir),
+			Mode:         endpoint.ModeIncr,
+			Checksum:     endpoint.ChecksumSHA256,
+			SnapshotName: name,
+			LogLevel:     "error",
+			NoProgress:   true,
+		}
+		for _, dir := range dests {
+			c.Dests = append(c.Dests, local(dir))
+		}
+		c.Dest = c.Dests[0]
+		return c
+	}
+	os.MkdirAll(filepath.Join(srcDir, "sub"), 0o755)
+	os.WriteFile(filepath.Join(srcDir, "sub", "old.txt"), []byte("old"), 0o644)
+	if err := Run(context.Background(), cfg("one", first)); err != nil {
+		t.Fatalf("single run failed: %v", err)
+	}
+	os.WriteFile(filepath.Join(srcDir, "sub", "new.txt"), []byte("new"), 0o644)
+	os.WriteFile(filepath.Join(srcDir, "big.bin"), make([]byte, 3*fanoutBuffer+7), 0o644)
+	metricsFile := filepath.Join(t.TempDir(), "zbackup.prom")
+	fanout := cfg("two", first, second)
+	fanout.MetricsFile = metricsFile
+	if err := Run(context.Background(), fanout); err != nil {
+		t.Fatalf("fanout run failed: %v", err)
+	}
+	data, err := os.ReadFile(metricsFile)
+	if err != nil {
+		t.Fatalf("metrics file not written: %v", err)
+	}
+	for _, dir := range []string{first, second} {
+		if want := "zbackup_last_run_success{dest=\"" + dir + "\"} 1"; !strings.Contains(string(data), want) {
+			t.Fatalf("missing %q in:\n%s", want, data)
+		}
+	}
+	if n := strings.Count(string(data), "# TYPE zbackup_last_run_success gauge"); n != 1 {
+		t.Fatalf("header written %d times:\n%s", n, data)
+	}
+
+	for _, dir := range []string{first, second} {
+		for _, rel := range []string{"sub/old.txt", "sub/new.txt", "big.bin"} {
+			want, _ := os.ReadFile(filepath.Join(srcDir, rel))
+			if data, err := os.ReadFile(filepath.Join(dir, rel)); err != nil || string(data) != string(want) {
+				t.Fatalf("%s: %s not copied: %v", dir, rel, err)
+			}
+		}
+		latest, err := meta.NewStore(endpoint.NewLocalFS(dir)).LoadLatest()
+		if err != nil || latest == nil || latest.Name != "two" || !latest.Completed || len(latest.Files) != 4 {
+			t.Fatalf("%s: unexpected snapshot %+v %v", dir, latest, err)
+		}
+		if _, err := os.Stat(reportPath(filepath.Join(dir, ".zbackup"), "two")); err != nil {
+			t.Fatalf("%s: report missing: %v", dir, err)
+		}
+	}
+
+	if err := Run(context.Background(), cfg("three", first, first)); err == nil {
+		t.Fatalf("duplicate dests should be rejected")
+	}
+}
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/fssnap"
+)
+
+// freezeSource 用 provider 为源端创建冻结视图，返回读取视图的文件系统与清理函数。
+// 创建失败时已创建的部分当场清理；清理函数关闭视图并删除快照
+func freezeSource(ctx context.Context, provider fssnap.Provider, src endpoint.Endpoint, srcFS endpoint.FileSystem, name string) (endpoint.FileSystem, func() error, error) {
+	runner, ok := srcFS.(endpoint.CommandRunner)
+	if !ok {
+		return nil, nil, fmt.Errorf("源端不支持执行命令，无法创建文件系统快照")
+	}
+	view, err := provider.Create(runner, srcFS.Root(), name)
+	if err == nil {
+		ep := src
+		ep.Path = view
+		var viewFS endpoint.FileSystem
+		if viewFS, err = buildFS(ctx, &ep); err == nil {
+			release := func() error {
+				return errors.Join(viewFS.Close(), provider.Remove(runner))
+			}
+			return viewFS, release, nil
+		}
+	}
+	if rerr := provider.Remove(runner); rerr != nil {
+		err = errors.Join(err, fmt.Errorf("清理文件系统快照失败: %w", rerr))
+	}
+	return nil, nil, err
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/fssnap"
+	"zbackup/pkg/meta"
+)
+
+func TestRunFSSnapshot(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	viewDir := t.TempDir()
+	os.MkdirAll(filepath.Join(srcDir, "db"), 0o755)
+	os.WriteFile(filepath.Join(srcDir, "db", "data"), []byte("rows"), 0o644)
+	run := func(name string, provider fssnap.Provider) error {
+		return Run(context.Background(), &BackupConfig{
+			Source:       endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: srcDir},
+			Dest:         endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir},
+			Mode:         endpoint.ModeIncr,
+			Checksum:     endpoint.ChecksumSHA256,
+			SnapshotName: name,
+			LogLevel:     "error",
+			NoProgress:   true,
+			FSSnapshot:   provider,
+		})
+	}
+
+	fake := &fssnap.Fake{Dir: viewDir}
+	if err := run("one", fake); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if fake.Created != 1 || fake.Removed != 1 {
+		t.Fatalf("created %d removed %d", fake.Created, fake.Removed)
+	}
+	if _, err := os.Stat(filepath.Join(viewDir, "one")); !os.IsNotExist(err) {
+		t.Fatalf("view should be cleaned up: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dstDir, "db", "data")); err != nil || string(data) != "rows" {
+		t.Fatalf("backup = %q %v", data, err)
+	}
+	// 快照记录的仍是原始源路径，而不是临时视图
+	snap, err := meta.NewStore(endpoint.NewLocalFS(dstDir)).Load("one")
+	if err != nil || snap.SourceRoot != srcDir {
+		t.Fatalf("source root = %+v %v", snap, err)
+	}
+
+	// 创建失败时同样清理，且不开始备份
+	boom := errors.New("boom")
+	failing := &fssnap.Fake{Dir: viewDir, Err: boom}
+	if err := run("two", failing); !errors.Is(err, boom) {
+		t.Fatalf("expected create error, got %v", err)
+	}
+	if failing.Removed != 1 {
+		t.Fatalf("failed create should be cleaned up, removed %d", failing.Removed)
+	}
+	if latest, _ := meta.NewStore(endpoint.NewLocalFS(dstDir)).LoadLatest(); latest == nil || latest.Name != "one" {
+		t.Fatalf("failed run should not produce a snapshot: %+v", latest)
+	}
+}
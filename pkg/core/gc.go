@@ -0,0 +1,162 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"zbackup/pkg/chunk"
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/meta"
+)
+
+// GCOptions 控制数据块垃圾回收
+type GCOptions struct {
+	// Grace 为宽限期：未被引用、但修改时间在宽限期内的块可能属于进行中的运行，不会被删除
+	Grace  time.Duration
+	DryRun bool
+}
+
+// GCReport 汇总一次垃圾回收的结果
+type GCReport struct {
+	Referenced int
+	// InGrace 为未被引用但仍在宽限期内而保留的文件数
+	InGrace      int
+	Removed      []string
+	RemovedBytes int64
+}
+
+// GC 标记所有备份集的全部快照（含未完成进度）引用的数据块，删除其余超过宽限期的块与残留临时文件。
+// 非 dry-run 时会先获取全部备份集的锁，有备份正在运行时直接失败
+func GC(ctx context.Context, repo endpoint.Endpoint, opts GCOptions) (GCReport, error) {
+	var report GCReport
+	repoFS, err := buildFS(ctx, &repo)
+	if err != nil {
+		return report, err
+	}
+	defer repoFS.Close()
+	stores, err := allSets(meta.NewStore(repoFS))
+	if err != nil {
+		return report, err
+	}
+	if !opts.DryRun {
+		for _, store := range stores {
+			lock, err := store.AcquireLock(ctx, 0)
+			if err != nil {
+				return report, fmt.Errorf("备份集 %s: 获取锁失败: %w", setName(store), err)
+			}
+			defer lock.Release()
+		}
+	}
+	refs, err := referencedChunks(ctx, stores)
+	if err != nil {
+		return report, err
+	}
+
+	chunks := chunk.NewStore(repoFS)
+	cutoff := time.Now().Add(-opts.Grace)
+	err = chunks.Each(func(m endpoint.FileMeta, ref string) error {
+		if ref != "" && refs[ref] {
+			report.Referenced++
+			return nil
+		}
+		if m.ModTime.After(cutoff) {
+			report.InGrace++
+			return nil
+		}
+		report.Removed = append(report.Removed, m.RelPath)
+		report.RemovedBytes += m.Size
+		return ctx.Err()
+	})
+	if err != nil {
+		return report, fmt.Errorf("列出数据块失败: %w", err)
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+	var errs []error
+	for _, rel := range report.Removed {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if err := chunks.Remove(rel); err != nil {
+			errs = append(errs, fmt.Errorf("删除 %s 失败: %w", rel, err))
+		}
+	}
+	return report, errors.Join(errs...)
+}
+
+// referencedChunks 收集全部快照与未完成进度引用的数据块
+func referencedChunks(ctx context.Context, stores []*meta.Store) (map[string]bool, error) {
+	refs := make(map[string]bool)
+	err := eachSnapshot(ctx, stores, func(store *meta.Store, snap *meta.Snapshot) error {
+		for _, m := range snap.Files {
+			for _, ref := range m.Chunks {
+				refs[ref] = true
+			}
+		}
+		return nil
+	})
+	return refs, err
+}
+
+// eachSnapshot 依次读取每个备份集的全部快照与未完成进度；任何快照读取失败都会中止，
+// 避免在引用不完整时误删数据
+func eachSnapshot(ctx context.Context, stores []*meta.Store, fn func(*meta.Store, *meta.Snapshot) error) error {
+	for _, store := range stores {
+		names, err := store.ListSnapshots()
+		if err != nil {
+			return fmt.Errorf("备份集 %s: 列出快照失败: %w", setName(store), err)
+		}
+		for _, name := range names {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			snap, err := store.Load(name)
+			if err != nil {
+				return fmt.Errorf("备份集 %s: 读取快照 %s 失败: %w", setName(store), name, err)
+			}
+			if snap == nil {
+				continue
+			}
+			if err := fn(store, snap); err != nil {
+				return err
+			}
+		}
+		pending, err := store.LoadPending()
+		if err != nil {
+			return fmt.Errorf("备份集 %s: 读取未完成进度失败: %w", setName(store), err)
+		}
+		if pending != nil {
+			if err := fn(store, pending); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// allSets 返回默认备份集与全部命名备份集
+func allSets(repo *meta.Store) ([]*meta.Store, error) {
+	names, err := repo.ListSets()
+	if err != nil {
+		return nil, fmt.Errorf("读取备份集列表失败: %w", err)
+	}
+	stores := []*meta.Store{repo}
+	for _, name := range names {
+		store, err := repo.WithSet(name)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, store)
+	}
+	return stores, nil
+}
+
+func setName(store *meta.Store) string {
+	if store.Set() == "" {
+		return "(default)"
+	}
+	return store.Set()
+}
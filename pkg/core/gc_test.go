@@ -0,0 +1,129 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"zbackup/pkg/chunk"
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/meta"
+)
+
+func TestGCAndCheck(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	repo := endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir}
+	run := func(name, content string) {
+		os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte(content), 0o644)
+		later := time.Now().Add(time.Duration(len(name)) * time.Minute)
+		os.Chtimes(filepath.Join(srcDir, "a.txt"), later, later)
+		err := Run(context.Background(), &BackupConfig{
+			Source:       endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: srcDir},
+			Dest:         repo,
+			Mode:         endpoint.ModeIncr,
+			Checksum:     endpoint.ChecksumSHA256,
+			Chunked:      true,
+			SnapshotName: name,
+			LogLevel:     "error",
+			NoProgress:   true,
+		})
+		if err != nil {
+			t.Fatalf("run %s failed: %v", name, err)
+		}
+	}
+	run("old", "version one")
+	run("newer", "version two")
+
+	report, err := Check(context.Background(), repo, CheckOptions{ReadData: true})
+	if err != nil || len(report.Problems) > 0 {
+		t.Fatalf("check on healthy repo: %v %v", err, report.Problems)
+	}
+	if report.Snapshots != 2 || report.Chunks != 2 || report.Unreferenced != 0 {
+		t.Fatalf("unexpected check report %+v", report)
+	}
+
+	store := meta.NewStore(endpoint.NewLocalFS(dstDir))
+	if err := store.DeleteSnapshot("old"); err != nil {
+		t.Fatalf("delete snapshot: %v", err)
+	}
+	junk := filepath.Join(dstDir, filepath.FromSlash(chunk.Dir), "ab", chunk.TempMarker+"leftover")
+	os.MkdirAll(filepath.Dir(junk), 0o755)
+	os.WriteFile(junk, []byte("partial"), 0o644)
+	past := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(junk, past, past)
+
+	// 宽限期内的未引用块保留，过期的临时文件删除
+	gcReport, err := GC(context.Background(), repo, GCOptions{Grace: time.Hour})
+	if err != nil {
+		t.Fatalf("gc: %v", err)
+	}
+	if gcReport.Referenced != 1 || gcReport.InGrace != 1 || len(gcReport.Removed) != 1 {
+		t.Fatalf("unexpected gc report %+v", gcReport)
+	}
+	if _, err := os.Stat(junk); !os.IsNotExist(err) {
+		t.Fatalf("expired temp file should be removed")
+	}
+
+	gcReport, err = GC(context.Background(), repo, GCOptions{DryRun: true})
+	if err != nil || len(gcReport.Removed) != 1 {
+		t.Fatalf("dry-run gc: %v %+v", err, gcReport)
+	}
+	if refs, _ := chunk.NewStore(endpoint.NewLocalFS(dstDir)).List(); len(refs) != 2 {
+		t.Fatalf("dry-run must not delete, have %d chunks", len(refs))
+	}
+	if _, err := GC(context.Background(), repo, GCOptions{}); err != nil {
+		t.Fatalf("gc: %v", err)
+	}
+	refs, _ := chunk.NewStore(endpoint.NewLocalFS(dstDir)).List()
+	if len(refs) != 1 {
+		t.Fatalf("expected only the referenced chunk to remain, have %d", len(refs))
+	}
+	target := t.TempDir()
+	if _, err := RestoreSnapshot(repo, "", "", target); err != nil {
+		t.Fatalf("restore after gc: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(target, "a.txt")); string(data) != "version two" {
+		t.Fatalf("restored %q", data)
+	}
+
+	chunkFile := filepath.Join(dstDir, filepath.FromSlash(chunk.Path(refs[0])))
+	os.WriteFile(chunkFile, []byte("tampered"), 0o644)
+	if report, _ := Check(context.Background(), repo, CheckOptions{}); len(report.Problems) != 0 {
+		t.Fatalf("check without --read-data should not read chunks: %v", report.Problems)
+	}
+	if report, _ := Check(context.Background(), repo, CheckOptions{ReadData: true}); len(report.Problems) != 1 {
+		t.Fatalf("expected tampered chunk to be reported, got %v", report.Problems)
+	}
+	os.Remove(chunkFile)
+	if report, _ := Check(context.Background(), repo, CheckOptions{}); len(report.Problems) != 1 {
+		t.Fatalf("expected missing chunk to be reported, got %v", report.Problems)
+	}
+}
+
+func TestCheckMirror(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("hello"), 0o644)
+	repo := endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir}
+	err := Run(context.Background(), &BackupConfig{
+		Source:     endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: srcDir},
+		Dest:       repo,
+		Mode:       endpoint.ModeIncr,
+		Checksum:   endpoint.ChecksumSHA256,
+		LogLevel:   "error",
+		NoProgress: true,
+	})
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if report, err := Check(context.Background(), repo, CheckOptions{ReadData: true}); err != nil || len(report.Problems) > 0 || report.Files != 1 {
+		t.Fatalf("check on healthy mirror: %v %+v", err, report)
+	}
+	os.WriteFile(filepath.Join(dstDir, "a.txt"), []byte("HELLO"), 0o644)
+	if report, _ := Check(context.Background(), repo, CheckOptions{ReadData: true}); len(report.Problems) != 1 {
+		t.Fatalf("expected changed mirror file to be reported, got %v", report.Problems)
+	}
+}
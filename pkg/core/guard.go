@@ -0,0 +1,85 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/transfer"
+)
+
+// ErrGuardTripped 表示保护条件不满足，本次运行在改动目标端之前中止
+var ErrGuardTripped = errors.New("保护条件不满足，已中止")
+
+// Guard 防止源端缺失或挂载失败时，全量模式把目标端镜像删空。
+// 源端检查在扫描前进行；删除检查在扫描结束之后、执行任何删除之前进行
+type Guard struct {
+	// MaxDeletes 单次运行允许删除的条目数上限，0 表示不限制
+	MaxDeletes int
+	// MaxDeletePercent 允许删除的条目占上一快照条目数的百分比上限，0 表示不限制
+	MaxDeletePercent float64
+	// RequireMount 要求源端根目录是挂载点
+	RequireMount bool
+	// Marker 非空时要求源端存在该相对路径的标记文件
+	Marker string
+	// Force 跳过全部检查
+	Force bool
+}
+
+// checkSource 在扫描前检查源端的挂载点与标记文件
+func (g Guard) checkSource(src endpoint.FileSystem) error {
+	if g.Force {
+		return nil
+	}
+	if g.Marker != "" {
+		if _, err := src.Stat(g.Marker); err != nil {
+			return guardError("源端缺少标记文件 %s（%v）", g.Marker, err)
+		}
+	}
+	if g.RequireMount {
+		checker, ok := src.(endpoint.MountChecker)
+		if !ok {
+			return fmt.Errorf("源端不支持挂载点检查")
+		}
+		mounted, err := checker.IsMountPoint()
+		if err != nil {
+			return guardError("无法确认源端 %s 是挂载点（%v）", src.Root(), err)
+		}
+		if !mounted {
+			return guardError("源端 %s 不是挂载点", src.Root())
+		}
+	}
+	return nil
+}
+
+// checkPlan 检查计划中的删除：源端为空，或删除数量、比例超过上限时中止。
+// baseFiles 为上一快照的条目数；scanned 为本次扫描到的源端条目数，
+// 计划不一定包含未变化的条目，不能据此判断源端为空
+func (g Guard) checkPlan(plan transfer.Plan, baseFiles, scanned int) error {
+	return g.checkDeletes(plan.Counts[transfer.ActionDelete], baseFiles, scanned)
+}
+
+// checkDeletes 按删除条目数 deletes 做与 checkPlan 相同的检查，供边扫描边执行时使用
+func (g Guard) checkDeletes(deletes, baseFiles, scanned int) error {
+	if g.Force || baseFiles == 0 {
+		return nil
+	}
+	if deletes == 0 {
+		return nil
+	}
+	if scanned == 0 {
+		return guardError("源端为空，计划删除上一快照中的全部 %d 个条目", deletes)
+	}
+	if g.MaxDeletes > 0 && deletes > g.MaxDeletes {
+		return guardError("计划删除 %d 个条目，超过上限 %d", deletes, g.MaxDeletes)
+	}
+	percent := float64(deletes) * 100 / float64(baseFiles)
+	if g.MaxDeletePercent > 0 && percent > g.MaxDeletePercent {
+		return guardError("计划删除 %d 个条目，占上一快照的 %.1f%%，超过上限 %g%%", deletes, percent, g.MaxDeletePercent)
+	}
+	return nil
+}
+
+func guardError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s；确认无误后可使用 --force 跳过检查", ErrGuardTripped, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/meta"
+	"zbackup/pkg/transfer"
+)
+
+func TestGuardCheckPlan(t *testing.T) {
+	base := &meta.Snapshot{Files: map[string]endpoint.FileMeta{}}
+	for i := range 10 {
+		rel := fmt.Sprintf("f%d", i)
+		base.Files[rel] = endpoint.FileMeta{RelPath: rel}
+	}
+	plan := func(deletes, others int) transfer.Plan {
+		var p transfer.Plan
+		for i := range others {
+			p.AddItem(transfer.TransferItem{RelPath: fmt.Sprintf("f%d", i), Action: transfer.ActionSkip})
+		}
+		for i := range deletes {
+			p.AddItem(transfer.TransferItem{RelPath: fmt.Sprintf("f%d", others+i), Action: transfer.ActionDelete})
+		}
+		return p
+	}
+	cases := []struct {
+		name    string
+		guard   Guard
+		plan    transfer.Plan
+		scanned int
+		tripped bool
+	}{
+		{"no deletes", Guard{MaxDeletes: 1}, plan(0, 10), 10, false},
+		{"empty source", Guard{}, plan(10, 0), 0, true},
+		{"empty source forced", Guard{Force: true}, plan(10, 0), 0, false},
+		// 计划只列出改动时，只有删除条目并不代表源端为空
+		{"deletes only", Guard{}, plan(1, 0), 9, false},
+		{"count within limit", Guard{MaxDeletes: 3}, plan(3, 7), 7, false},
+		{"count over limit", Guard{MaxDeletes: 2}, plan(3, 7), 7, true},
+		{"percent within limit", Guard{MaxDeletePercent: 30}, plan(3, 7), 7, false},
+		{"percent over limit", Guard{MaxDeletePercent: 20}, plan(3, 7), 7, true},
+	}
+	for _, tc := range cases {
+		err := tc.guard.checkPlan(tc.plan, len(base.Files), tc.scanned)
+		if errors.Is(err, ErrGuardTripped) != tc.tripped {
+			t.Errorf("%s: unexpected result %v", tc.name, err)
+		}
+	}
+	if err := (Guard{}).checkPlan(plan(1, 0), 0, 0); err != nil {
+		t.Fatalf("first run has nothing to delete: %v", err)
+	}
+}
+
+func TestGuardCheckSource(t *testing.T) {
+	dir := t.TempDir()
+	src := endpoint.NewLocalFS(dir)
+	if err := (Guard{Marker: ".backup-source"}).checkSource(src); !errors.Is(err, ErrGuardTripped) {
+		t.Fatalf("missing marker should trip guard: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, ".backup-source"), nil, 0o644)
+	if err := (Guard{Marker: ".backup-source"}).checkSource(src); err != nil {
+		t.Fatalf("marker present: %v", err)
+	}
+	if err := (Guard{RequireMount: true}).checkSource(src); !errors.Is(err, ErrGuardTripped) {
+		t.Fatalf("temp dir is not a mount point: %v", err)
+	}
+	if err := (Guard{RequireMount: true, Force: true}).checkSource(src); err != nil {
+		t.Fatalf("force should skip checks: %v", err)
+	}
+}
+
+func TestRunFullModeEmptySource(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0o644)
+	os.WriteFile(filepath.Join(srcDir, "b.txt"), []byte("b"), 0o644)
+	run := func(name string, guard Guard) error {
+		return Run(context.Background(), &BackupConfig{
+			Source:       endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: srcDir},
+			Dest:         endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir},
+			Mode:         endpoint.ModeFull,
+			Checksum:     endpoint.ChecksumSHA256,
+			SnapshotName: name,
+			LogLevel:     "error",
+			NoProgress:   true,
+			Guard:        guard,
+		})
+	}
+	if err := run("first", Guard{}); err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	// 模拟源端磁盘未挂载：目录还在，但内容全部消失
+	os.Remove(filepath.Join(srcDir, "a.txt"))
+	os.Remove(filepath.Join(srcDir, "b.txt"))
+	if err := run("second", Guard{}); !errors.Is(err, ErrGuardTripped) {
+		t.Fatalf("expected guard to trip, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "a.txt")); err != nil {
+		t.Fatalf("mirror must be untouched: %v", err)
+	}
+	store := meta.NewStore(endpoint.NewLocalFS(dstDir))
+	if latest, _ := store.LoadLatest(); latest == nil || latest.Name != "first" {
+		t.Fatalf("aborted run should not replace latest snapshot: %+v", latest)
+	}
+	if pending, _ := store.LoadPending(); pending != nil {
+		t.Fatalf("aborted run should not leave pending progress")
+	}
+
+	if err := run("third", Guard{Force: true}); err != nil {
+		t.Fatalf("forced run: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("forced run should delete: %v", err)
+	}
+}
+
+func TestRunGuardFailureWritesMetrics(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	metricsFile := filepath.Join(t.TempDir(), "zbackup.prom")
+	os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0o644)
+	// 扫描之前就中止的运行也要导出失败指标，告警才能覆盖
+	err := Run(context.Background(), &BackupConfig{
+		Source:       endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: srcDir},
+		Dest:         endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir},
+		Mode:         endpoint.ModeIncr,
+		Checksum:     endpoint.ChecksumSHA256,
+		SnapshotName: "first",
+		LogLevel:     "error",
+		NoProgress:   true,
+		MetricsFile:  metricsFile,
+		Guard:        Guard{Marker: ".backup-source"},
+	})
+	if !errors.Is(err, ErrGuardTripped) {
+		t.Fatalf("expected guard to trip, got %v", err)
+	}
+	data, err := os.ReadFile(metricsFile)
+	if err != nil {
+		t.Fatalf("metrics file not written: %v", err)
+	}
+	if !strings.Contains(string(data), "zbackup_last_run_success{dest=\""+dstDir+"\"} 0") {
+		t.Fatalf("failure not exported:\n%s", data)
+	}
+}
+
+func TestRunFailureExportsLastSuccessFromRepository(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	metricsFile := filepath.Join(t.TempDir(), "zbackup.prom")
+	os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0o644)
+	run := func(name string, guard Guard) error {
+		return Run(context.Background(), &BackupConfig{
+			Source:       endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: srcDir},
+			Dest:         endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir},
+			Mode:         endpoint.ModeIncr,
+			Checksum:     endpoint.ChecksumSHA256,
+			SnapshotName: name,
+			LogLevel:     "error",
+			NoProgress:   true,
+			MetricsFile:  metricsFile,
+			Guard:        guard,
+		})
+	}
+	if err := run("first", Guard{}); err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	// 指标文件丢失时，最后成功时间仍应取自仓库中完成的快照
+	os.Remove(metricsFile)
+	if err := run("second", Guard{Marker: ".backup-source"}); !errors.Is(err, ErrGuardTripped) {
+		t.Fatalf("expected guard to trip, got %v", err)
+	}
+	first, err := meta.NewStore(endpoint.NewLocalFS(dstDir)).Load("first")
+	if err != nil || first == nil {
+		t.Fatalf("load first snapshot: %v", err)
+	}
+	data, _ := os.ReadFile(metricsFile)
+	want := fmt.Sprintf("zbackup_last_success_timestamp_seconds{dest=%q} %d", dstDir, first.CreatedAt.Unix())
+	if !strings.Contains(string(data), want) {
+		t.Fatalf("missing %q in:\n%s", want, data)
+	}
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"fmt"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -10,15 +11,14 @@ import (
 	"zbackup/pkg/transfer"
 )
 
-// BuildPlan 根据当前扫描结果与上一快照生成增量计划
-func BuildPlan(files []endpoint.FileMeta, last *meta.Snapshot, cfg BackupConfig) transfer.Plan {
-	current := make(map[string]endpoint.FileMeta, len(files))
+// BuildPlan 根据当前扫描结果与上一快照的索引生成增量计划
+func BuildPlan(files []endpoint.FileMeta, last *meta.Index, cfg BackupConfig) (transfer.Plan, error) {
+	p := newPlanner(last, cfg)
 	var dirs []endpoint.FileMeta
 	var fileMetas []endpoint.FileMeta
 	for _, meta := range files {
-		rel := normRel(meta.RelPath)
-		meta.RelPath = rel
-		current[rel] = meta
+		meta.RelPath = normRel(meta.RelPath)
+		p.seen[meta.RelPath] = struct{}{}
 		if meta.IsDir {
 			dirs = append(dirs, meta)
 		} else {
@@ -34,86 +34,218 @@ func BuildPlan(files []endpoint.FileMeta, last *meta.Snapshot, cfg BackupConfig)
 	sort.Slice(fileMetas, func(i, j int) bool { return fileMetas[i].RelPath < fileMetas[j].RelPath })
 
 	plan := transfer.Plan{}
-	for _, dir := range dirs {
-		if shouldSkip(dir.RelPath, dir, last, cfg) {
-			continue
+	for _, meta := range append(dirs, fileMetas...) {
+		item, ok, err := p.item(meta)
+		if err != nil {
+			return transfer.Plan{}, err
 		}
-		plan.AddItem(transfer.TransferItem{
-			RelPath: dir.RelPath,
-			Meta:    dir,
-			Action:  transfer.ActionMkdir,
-		})
+		if ok {
+			plan.AddItem(item)
+		}
+	}
+	deletes, err := p.deletes()
+	if err != nil {
+		return transfer.Plan{}, err
+	}
+	for _, item := range deletes {
+		plan.AddItem(item)
 	}
+	return plan, nil
+}
+
+// StreamPlan 边扫描边生成计划条目并交给 emit：目录与文件按扫描顺序产出（目录先于其内容），
+// 全量模式的删除条目在扫描完整结束后才产出，扫描失败或删除检查未通过时不会产出任何删除
+func StreamPlan(fs endpoint.FileSystem, last *meta.Index, cfg BackupConfig, emit func(transfer.TransferItem) error) error {
+	p := newPlanner(last, cfg)
+	scanned := 0
+	err := fs.Walk(cfg.Excludes, func(meta endpoint.FileMeta) error {
+		scanned++
+		meta.RelPath = normRel(meta.RelPath)
+		if p.trackSeen {
+			p.seen[meta.RelPath] = struct{}{}
+		}
+		item, ok, err := p.item(meta)
+		if err != nil || !ok {
+			return err
+		}
+		return emit(item)
+	})
+	if err != nil {
+		return err
+	}
+	deletes, err := p.deletes()
+	if err != nil {
+		return err
+	}
+	count := 0
+	for _, item := range deletes {
+		if item.Action == transfer.ActionDelete {
+			count++
+		}
+	}
+	if err := cfg.Guard.checkDeletes(count, last.Len(), scanned); err != nil {
+		return err
+	}
+	for _, item := range deletes {
+		if err := emit(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planner 对单个扫描条目做出计划决策，并记录已见路径用于计算删除。
+// 上一快照以索引形式按路径查找，不展开为完整的文件表
+type planner struct {
+	last      *meta.Index
+	cfg       BackupConfig
+	action    transfer.TransferAction
+	seen      map[string]struct{}
+	trackSeen bool
+}
+
+func newPlanner(last *meta.Index, cfg BackupConfig) *planner {
 	action := transfer.ActionUpload
-	if cfg.Source.Type == endpoint.EndpointRemote {
+	if cfg.Source.Type != endpoint.EndpointLocal {
 		action = transfer.ActionDownload
 	}
-	for _, meta := range fileMetas {
-		if shouldSkip(meta.RelPath, meta, last, cfg) {
-			plan.AddItem(transfer.TransferItem{
+	return &planner{
+		last:      last,
+		cfg:       cfg,
+		action:    action,
+		seen:      make(map[string]struct{}),
+		trackSeen: last != nil && (cfg.Mode == endpoint.ModeFull || cfg.Tree),
+	}
+}
+
+// lookup 在上一快照中查找条目，没有上一快照时视为不存在
+func (p *planner) lookup(rel string) (endpoint.FileMeta, bool, error) {
+	if p.last == nil {
+		return endpoint.FileMeta{}, false, nil
+	}
+	old, ok, err := p.last.Lookup(rel)
+	if err != nil {
+		return endpoint.FileMeta{}, false, fmt.Errorf("读取上一快照失败: %w", err)
+	}
+	return old, ok, nil
+}
+
+// item 返回条目对应的计划；未变化的目录不产生计划。
+// 硬链接快照目录每次都是新目录：目录总要创建，未变化的文件从上一快照目录链接
+func (p *planner) item(meta endpoint.FileMeta) (transfer.TransferItem, bool, error) {
+	old, had, err := p.lookup(meta.RelPath)
+	if err != nil {
+		return transfer.TransferItem{}, false, err
+	}
+	if meta.IsDir {
+		if !p.cfg.Tree && had && old.IsDir {
+			return transfer.TransferItem{}, false, nil
+		}
+		return transfer.TransferItem{RelPath: meta.RelPath, Meta: meta, Action: transfer.ActionMkdir}, true, nil
+	}
+	if shouldSkip(meta, old, had, p.cfg) {
+		if p.cfg.Tree {
+			return transfer.TransferItem{
 				RelPath: meta.RelPath,
-				Meta:    meta,
-				Action:  transfer.ActionSkip,
+				Meta:    old,
+				Action:  transfer.ActionLink,
 				Reason:  "文件未变化",
-			})
-			continue
+			}, true, nil
 		}
-		plan.AddItem(transfer.TransferItem{
+		return transfer.TransferItem{
 			RelPath: meta.RelPath,
 			Meta:    meta,
-			Action:  action,
-		})
-	}
-	if last != nil && cfg.Mode == endpoint.ModeFull {
-		var deleteFiles []transfer.TransferItem
-		var deleteDirs []transfer.TransferItem
-		for rel, old := range last.Files {
-			if _, ok := current[rel]; ok {
-				continue
-			}
-			item := transfer.TransferItem{
-				RelPath: rel,
-				Meta:    old,
-				Action:  transfer.ActionDelete,
-			}
-			if old.IsDir {
-				deleteDirs = append(deleteDirs, item)
-			} else {
-				deleteFiles = append(deleteFiles, item)
-			}
-		}
-		sort.Slice(deleteFiles, func(i, j int) bool { return deleteFiles[i].RelPath < deleteFiles[j].RelPath })
-		sort.Slice(deleteDirs, func(i, j int) bool {
-			if depth(deleteDirs[i].RelPath) == depth(deleteDirs[j].RelPath) {
-				return deleteDirs[i].RelPath > deleteDirs[j].RelPath
-			}
-			return depth(deleteDirs[i].RelPath) > depth(deleteDirs[j].RelPath)
-		})
-		for _, item := range deleteFiles {
-			plan.AddItem(item)
+			Action:  transfer.ActionSkip,
+			Reason:  "文件未变化",
+		}, true, nil
+	}
+	return transfer.TransferItem{
+		RelPath:    meta.RelPath,
+		Meta:       meta,
+		Action:     p.action,
+		Overwrites: overwrites(meta, old, had, p.cfg),
+	}, true, nil
+}
+
+// deletes 返回全量模式下上一快照中存在但本次未扫描到的条目：先文件后目录，目录由深到浅。
+// 硬链接快照目录的增量模式不删除，这些条目改为从上一快照目录沿用
+func (p *planner) deletes() ([]transfer.TransferItem, error) {
+	if p.last == nil {
+		return nil, nil
+	}
+	if p.cfg.Mode != endpoint.ModeFull {
+		if p.cfg.Tree {
+			return p.carried()
 		}
-		for _, item := range deleteDirs {
-			plan.AddItem(item)
+		return nil, nil
+	}
+	var deleteFiles []transfer.TransferItem
+	var deleteDirs []transfer.TransferItem
+	// 索引按路径升序遍历，文件删除条目无需再排序
+	err := p.last.Each(func(old endpoint.FileMeta) error {
+		if _, ok := p.seen[old.RelPath]; ok {
+			return nil
+		}
+		item := transfer.TransferItem{
+			RelPath: old.RelPath,
+			Meta:    old,
+			Action:  transfer.ActionDelete,
+		}
+		if old.IsDir {
+			deleteDirs = append(deleteDirs, item)
+		} else {
+			deleteFiles = append(deleteFiles, item)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取上一快照失败: %w", err)
 	}
-	return plan
+	sort.Slice(deleteDirs, func(i, j int) bool {
+		if depth(deleteDirs[i].RelPath) == depth(deleteDirs[j].RelPath) {
+			return deleteDirs[i].RelPath > deleteDirs[j].RelPath
+		}
+		return depth(deleteDirs[i].RelPath) > depth(deleteDirs[j].RelPath)
+	})
+	return append(deleteFiles, deleteDirs...), nil
 }
 
-func shouldSkip(rel string, meta endpoint.FileMeta, last *meta.Snapshot, cfg BackupConfig) bool {
-	if meta.IsDir {
-		if last == nil {
-			return false
+// carried 返回上一快照中存在但本次未扫描到、需要沿用到新快照目录的条目
+func (p *planner) carried() ([]transfer.TransferItem, error) {
+	var items []transfer.TransferItem
+	err := p.last.Each(func(old endpoint.FileMeta) error {
+		if _, ok := p.seen[old.RelPath]; ok {
+			return nil
 		}
-		old, ok := last.Files[rel]
-		return ok && old.IsDir
-	}
-	if cfg.Mode == endpoint.ModeFull || last == nil {
-		return false
+		action := transfer.ActionLink
+		if old.IsDir {
+			action = transfer.ActionMkdir
+		}
+		items = append(items, transfer.TransferItem{RelPath: old.RelPath, Meta: old, Action: action, Reason: "源端已不存在，沿用上一快照"})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取上一快照失败: %w", err)
 	}
-	old, ok := last.Files[rel]
-	if !ok {
+	return items, nil
+}
+
+// shouldSkip 判断文件相对上一快照中的记录 old 未变化；had 为 false 表示上一快照中没有该文件
+func shouldSkip(meta, old endpoint.FileMeta, had bool, cfg BackupConfig) bool {
+	if cfg.Mode == endpoint.ModeFull || !had {
 		return false
 	}
+	return sameFile(old, meta, cfg)
+}
+
+// overwrites 表示上传会覆盖目标端已有的、内容不同的旧版本。
+// 全量模式不跳过任何文件，内容未变的文件重新写入时没有需要保留的旧版本
+func overwrites(meta, old endpoint.FileMeta, had bool, cfg BackupConfig) bool {
+	return had && !old.IsDir && !sameFile(old, meta, cfg)
+}
+
+// sameFile 按大小、修改时间与校验和判断文件是否未变化
+func sameFile(old, meta endpoint.FileMeta, cfg BackupConfig) bool {
 	if old.Size != meta.Size {
 		return false
 	}
@@ -1,6 +1,9 @@
 package core
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -24,7 +27,10 @@ func TestBuildPlanIncr(t *testing.T) {
 		Dest:   endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: "/dst"},
 		Mode:   endpoint.ModeIncr,
 	}
-	plan := BuildPlan(files, last, cfg)
+	plan, err := BuildPlan(files, indexOf(t, last), cfg)
+	if err != nil {
+		t.Fatalf("build plan: %v", err)
+	}
 	if plan.TotalFiles != 1 {
 		t.Fatalf("expected 1 file transfer, got %d", plan.TotalFiles)
 	}
@@ -46,13 +52,12 @@ func TestShouldSkipWithChecksum(t *testing.T) {
 		ModTime:  time.Unix(1, 0),
 		Checksum: "abc",
 	}
-	last := &meta.Snapshot{Files: map[string]endpoint.FileMeta{"a.txt": oldMeta}}
 	cfg := BackupConfig{Mode: endpoint.ModeIncr, Checksum: endpoint.ChecksumSHA256}
-	if !shouldSkip("a.txt", newMeta, last, cfg) {
+	if !shouldSkip(newMeta, oldMeta, true, cfg) {
 		t.Fatalf("should skip identical checksum")
 	}
 	newMeta.Checksum = "def"
-	if shouldSkip("a.txt", newMeta, last, cfg) {
+	if shouldSkip(newMeta, oldMeta, true, cfg) {
 		t.Fatalf("should not skip when checksum differs")
 	}
 }
@@ -67,7 +72,10 @@ func TestBuildPlanCreatesDirectories(t *testing.T) {
 		Dest:   endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: "/dst"},
 		Mode:   endpoint.ModeIncr,
 	}
-	plan := BuildPlan(files, nil, cfg)
+	plan, err := BuildPlan(files, nil, cfg)
+	if err != nil {
+		t.Fatalf("build plan: %v", err)
+	}
 	if len(plan.Items) < 2 {
 		t.Fatalf("expect mkdir and upload")
 	}
@@ -75,3 +83,92 @@ func TestBuildPlanCreatesDirectories(t *testing.T) {
 		t.Fatalf("first action should be mkdir, got %s", plan.Items[0].Action)
 	}
 }
+
+func TestStreamPlanDeletesOnlyAfterWalk(t *testing.T) {
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "keep.txt"), []byte("keep"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	last := indexOf(t, &meta.Snapshot{Files: map[string]endpoint.FileMeta{
+		"gone.txt": {RelPath: "gone.txt", Size: 1},
+	}})
+	cfg := BackupConfig{
+		Source: endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: src},
+		Dest:   endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: "/dst"},
+		Mode:   endpoint.ModeFull,
+	}
+	fs := endpoint.NewLocalFS(src)
+	var actions []transfer.TransferAction
+	err := StreamPlan(fs, last, cfg, func(item transfer.TransferItem) error {
+		actions = append(actions, item.Action)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream plan: %v", err)
+	}
+	if len(actions) != 2 || actions[0] != transfer.ActionUpload || actions[1] != transfer.ActionDelete {
+		t.Fatalf("unexpected actions: %v", actions)
+	}
+
+	stop := errors.New("stop")
+	actions = nil
+	err = StreamPlan(fs, last, cfg, func(item transfer.TransferItem) error {
+		actions = append(actions, item.Action)
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("expected emit error, got %v", err)
+	}
+	for _, action := range actions {
+		if action == transfer.ActionDelete {
+			t.Fatalf("delete emitted after failed scan")
+		}
+	}
+}
+
+func TestStreamPlanGuardBeforeDeletes(t *testing.T) {
+	src := t.TempDir()
+	os.WriteFile(filepath.Join(src, "keep.txt"), []byte("keep"), 0o644)
+	last := indexOf(t, &meta.Snapshot{Files: map[string]endpoint.FileMeta{
+		"keep.txt": {RelPath: "keep.txt", Size: 4},
+		"gone1":    {RelPath: "gone1", Size: 1},
+		"gone2":    {RelPath: "gone2", Size: 1},
+	}})
+	cfg := BackupConfig{
+		Source: endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: src},
+		Dest:   endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: "/dst"},
+		Mode:   endpoint.ModeFull,
+		Guard:  Guard{MaxDeletes: 1},
+	}
+	var actions []transfer.TransferAction
+	err := StreamPlan(endpoint.NewLocalFS(src), last, cfg, func(item transfer.TransferItem) error {
+		actions = append(actions, item.Action)
+		return nil
+	})
+	if !errors.Is(err, ErrGuardTripped) {
+		t.Fatalf("expected guard to trip, got %v", err)
+	}
+	// 扫描到的条目照常产出，删除一个也不产出
+	if len(actions) != 1 || actions[0] != transfer.ActionUpload {
+		t.Fatalf("unexpected actions: %v", actions)
+	}
+
+	cfg.Guard.Force = true
+	actions = nil
+	if err := StreamPlan(endpoint.NewLocalFS(src), last, cfg, func(item transfer.TransferItem) error {
+		actions = append(actions, item.Action)
+		return nil
+	}); err != nil || len(actions) != 3 {
+		t.Fatalf("forced plan should emit deletes: %v %v", actions, err)
+	}
+}
+
+// indexOf 把测试中构造的快照编码为规划使用的索引
+func indexOf(t *testing.T, snap *meta.Snapshot) *meta.Index {
+	t.Helper()
+	idx, err := snap.Index()
+	if err != nil {
+		t.Fatalf("encode index: %v", err)
+	}
+	return idx
+}
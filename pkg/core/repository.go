@@ -0,0 +1,256 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"zbackup/pkg/chunk"
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/meta"
+	"zbackup/pkg/notify"
+	"zbackup/pkg/snapfs"
+)
+
+// Repository 以只读方式访问备份仓库，供 mount、web 等浏览功能使用；可并发调用
+type Repository struct {
+	ep     endpoint.Endpoint
+	fs     endpoint.FileSystem
+	root   *meta.Store
+	chunks *chunk.Store
+
+	mu    sync.Mutex
+	data  map[string]endpoint.FileSystem
+	trees map[string]snapshotTree
+}
+
+// snapshotTree 缓存备份集的快照目录树，快照列表变化时重建
+type snapshotTree struct {
+	key string
+	fs  *snapfs.FS
+}
+
+// OpenRepository 连接备份仓库
+func OpenRepository(ep endpoint.Endpoint) (*Repository, error) {
+	repoFS, err := buildFS(context.Background(), &ep)
+	if err != nil {
+		return nil, err
+	}
+	return &Repository{
+		ep:     ep,
+		fs:     repoFS,
+		root:   meta.NewStore(repoFS),
+		chunks: chunk.NewStore(repoFS),
+		data:   make(map[string]endpoint.FileSystem),
+		trees:  make(map[string]snapshotTree),
+	}, nil
+}
+
+// Close 释放到目标端的连接
+func (r *Repository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	errs := []error{r.fs.Close()}
+	for _, dataFS := range r.data {
+		errs = append(errs, dataFS.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Name 返回仓库的显示名称
+func (r *Repository) Name() string {
+	return r.ep.DisplayName()
+}
+
+// Sets 返回默认备份集与全部命名备份集
+func (r *Repository) Sets() ([]*meta.Store, error) {
+	return allSets(r.root)
+}
+
+// Store 返回指定备份集的元数据存储，空串为默认备份集
+func (r *Repository) Store(set string) (*meta.Store, error) {
+	return r.root.WithSet(set)
+}
+
+// SnapshotFS 把备份集的全部快照呈现为只读目录树 /snapshots/<快照名>/...。
+// 分块快照的文件从数据块重组；镜像快照只有与最新快照中相同的文件版本仍在数据目录中，
+// 其余版本读取时报错。快照列表变化后再次调用会得到新的目录树
+func (r *Repository) SnapshotFS(set string) (*snapfs.FS, error) {
+	store, err := r.Store(set)
+	if err != nil {
+		return nil, err
+	}
+	names, err := store.ListSnapshots()
+	if err != nil {
+		return nil, fmt.Errorf("读取快照列表失败: %w", err)
+	}
+	key := strings.Join(names, "\n")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if tree, ok := r.trees[set]; ok && tree.key == key {
+		return tree.fs, nil
+	}
+	infos, err := store.SnapshotInfos()
+	if err != nil {
+		return nil, fmt.Errorf("读取快照列表失败: %w", err)
+	}
+	latest, err := store.LoadLatest()
+	if err != nil {
+		return nil, fmt.Errorf("读取最新快照失败: %w", err)
+	}
+	dataFS, err := r.dataFS(set)
+	if err != nil {
+		return nil, err
+	}
+	open := func(snap *meta.Snapshot, m endpoint.FileMeta) (io.ReadCloser, error) {
+		if snap.Chunked {
+			return r.chunks.Open(m.Chunks), nil
+		}
+		if snap.Tree != "" {
+			return r.fs.Open(filepath.Join(snap.Tree, m.RelPath))
+		}
+		if !sameVersion(latest, m) {
+			return nil, fmt.Errorf("快照 %s 中的 %s 已被更新的版本覆盖：镜像存储只保留最新版本", snap.Name, m.RelPath)
+		}
+		return dataFS.Open(m.RelPath)
+	}
+	tree := snapshotTree{key: key, fs: snapfs.New(infos, store.Load, open)}
+	r.trees[set] = tree
+	return tree.fs, nil
+}
+
+// dataFS 返回备份集的镜像数据目录，调用方需持有 r.mu
+func (r *Repository) dataFS(set string) (endpoint.FileSystem, error) {
+	if set == "" {
+		return r.fs, nil
+	}
+	if dataFS, ok := r.data[set]; ok {
+		return dataFS, nil
+	}
+	dataEp := setEndpoint(r.ep, set)
+	dataFS, err := buildFS(context.Background(), &dataEp)
+	if err != nil {
+		return nil, err
+	}
+	r.data[set] = dataFS
+	return dataFS, nil
+}
+
+// sameVersion 判断文件版本是否与最新镜像快照中的一致，即数据目录中的文件就是该版本
+func sameVersion(latest *meta.Snapshot, m endpoint.FileMeta) bool {
+	if latest == nil || latest.Chunked {
+		return false
+	}
+	cur, ok := latest.Files[m.RelPath]
+	return ok && cur.Size == m.Size && cur.ModTime.Equal(m.ModTime) && cur.Checksum == m.Checksum
+}
+
+// RunRecord 描述一次运行在 .zbackup/logs/ 中留下的报告与日志
+type RunRecord struct {
+	Snapshot string
+	// Report 为运行结束时写入的摘要；早期版本或被强行中断的运行没有报告
+	Report *notify.Summary
+	HasLog bool
+	// ModTime 为日志或报告文件的修改时间
+	ModTime time.Time
+}
+
+// Runs 列出备份集的运行记录，按时间从新到旧排序
+func (r *Repository) Runs(set string) ([]RunRecord, error) {
+	store, err := r.Store(set)
+	if err != nil {
+		return nil, err
+	}
+	logDir := path.Join(store.Dir(), "logs")
+	entries, err := r.fs.(endpoint.DirLister).ReadDir(logDir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取日志目录失败: %w", err)
+	}
+	runs := make(map[string]*RunRecord)
+	for _, entry := range entries {
+		name, ext, ok := runFile(entry.RelPath)
+		if entry.IsDir || !ok {
+			continue
+		}
+		run := runs[name]
+		if run == nil {
+			run = &RunRecord{Snapshot: name}
+			runs[name] = run
+		}
+		if entry.ModTime.After(run.ModTime) {
+			run.ModTime = entry.ModTime
+		}
+		if ext == ".log" {
+			run.HasLog = true
+			continue
+		}
+		report, err := r.readReport(path.Join(logDir, entry.RelPath))
+		if err != nil {
+			return nil, fmt.Errorf("读取运行报告 %s 失败: %w", entry.RelPath, err)
+		}
+		run.Report = report
+	}
+	list := make([]RunRecord, 0, len(runs))
+	for _, run := range runs {
+		list = append(list, *run)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		ti, tj := list[i].ModTime, list[j].ModTime
+		if list[i].Report != nil && list[j].Report != nil {
+			ti, tj = list[i].Report.StartedAt, list[j].Report.StartedAt
+		}
+		if ti.Equal(tj) {
+			return list[i].Snapshot > list[j].Snapshot
+		}
+		return ti.After(tj)
+	})
+	return list, nil
+}
+
+// OpenLog 打开某次运行的日志
+func (r *Repository) OpenLog(set, snapshot string) (io.ReadCloser, error) {
+	store, err := r.Store(set)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == "" || strings.ContainsAny(snapshot, `/\`) || strings.HasPrefix(snapshot, ".") {
+		return nil, fs.ErrNotExist
+	}
+	return r.fs.Open(path.Join(store.Dir(), "logs", "backup-"+snapshot+".log"))
+}
+
+func (r *Repository) readReport(rel string) (*notify.Summary, error) {
+	reader, err := r.fs.Open(rel)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	var summary notify.Summary
+	if err := json.NewDecoder(reader).Decode(&summary); err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// runFile 解析日志目录中的文件名 backup-<快照名>.log / .json
+func runFile(name string) (string, string, bool) {
+	ext := path.Ext(name)
+	if ext != ".log" && ext != ".json" || !strings.HasPrefix(name, "backup-") {
+		return "", "", false
+	}
+	snapshot := strings.TrimSuffix(strings.TrimPrefix(name, "backup-"), ext)
+	return snapshot, ext, snapshot != ""
+}
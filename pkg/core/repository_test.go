@@ -0,0 +1,93 @@
+package core
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zbackup/pkg/endpoint"
+)
+
+func TestRepositorySnapshotFS(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	repo := endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir}
+	run := func(name string) {
+		err := Run(context.Background(), &BackupConfig{
+			Source:       endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: srcDir},
+			Dest:         repo,
+			Mode:         endpoint.ModeIncr,
+			Checksum:     endpoint.ChecksumSHA256,
+			SnapshotName: name,
+			LogLevel:     "error",
+			NoProgress:   true,
+		})
+		if err != nil {
+			t.Fatalf("run %s failed: %v", name, err)
+		}
+	}
+	os.WriteFile(filepath.Join(srcDir, "same.txt"), []byte("unchanged"), 0o644)
+	os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("v1"), 0o644)
+	run("one")
+	os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("v2!"), 0o644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(srcDir, "a.txt"), later, later)
+	run("two")
+
+	r, err := OpenRepository(repo)
+	if err != nil {
+		t.Fatalf("open repository: %v", err)
+	}
+	defer r.Close()
+	fsys, err := r.SnapshotFS("")
+	if err != nil {
+		t.Fatalf("SnapshotFS: %v", err)
+	}
+	if data, err := fs.ReadFile(fsys, "snapshots/two/a.txt"); err != nil || string(data) != "v2!" {
+		t.Fatalf("latest version: %q %v", data, err)
+	}
+	// 未变化的文件在旧快照中仍可读取
+	if data, err := fs.ReadFile(fsys, "snapshots/one/same.txt"); err != nil || string(data) != "unchanged" {
+		t.Fatalf("unchanged file in old snapshot: %q %v", data, err)
+	}
+	// 被覆盖的旧版本不能读出最新内容冒充
+	if _, err := fs.ReadFile(fsys, "snapshots/one/a.txt"); err == nil || !strings.Contains(err.Error(), "最新版本") {
+		t.Fatalf("expected overwritten version error, got %v", err)
+	}
+	if info, err := fs.Stat(fsys, "snapshots/one/a.txt"); err != nil || info.Size() != 2 {
+		t.Fatalf("old metadata should still be listed: %v %v", info, err)
+	}
+
+	// 新快照出现后重新构建目录树
+	if again, _ := r.SnapshotFS(""); again != fsys {
+		t.Fatalf("unchanged snapshot list should reuse the tree")
+	}
+	run("three")
+	fresh, err := r.SnapshotFS("")
+	if err != nil || fresh == fsys {
+		t.Fatalf("expected a rebuilt tree: %v", err)
+	}
+	if _, err := fs.Stat(fresh, "snapshots/three/a.txt"); err != nil {
+		t.Fatalf("new snapshot missing: %v", err)
+	}
+
+	runs, err := r.Runs("")
+	if err != nil || len(runs) != 3 {
+		t.Fatalf("expected 3 runs, got %d: %v", len(runs), err)
+	}
+	if runs[0].Snapshot != "three" || !runs[0].HasLog || runs[0].Report == nil || runs[0].Report.Status != "success" {
+		t.Fatalf("unexpected latest run %+v", runs[0])
+	}
+	reader, err := r.OpenLog("", "one")
+	if err != nil {
+		t.Fatalf("open log: %v", err)
+	}
+	reader.Close()
+	if _, err := r.OpenLog("", "../../x"); err == nil {
+		t.Fatalf("log name with path separators must be rejected")
+	}
+}
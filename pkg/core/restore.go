@@ -0,0 +1,186 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"zbackup/pkg/chunk"
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/meta"
+)
+
+// restoreBlockSize 为恢复稀疏文件时检测全零块的粒度，与常见文件系统块大小一致
+const restoreBlockSize = 4096
+
+// RestoreSnapshot 把仓库中的快照恢复到本地目录 target，name 为空时恢复最新快照。
+// 分块快照从数据块重组文件；镜像快照从数据目录复制，数据目录只保存最新版本
+func RestoreSnapshot(repo endpoint.Endpoint, set, name, target string) (*meta.Snapshot, error) {
+	repoFS, err := buildFS(context.Background(), &repo)
+	if err != nil {
+		return nil, err
+	}
+	defer repoFS.Close()
+	store, err := meta.NewStore(repoFS).WithSet(set)
+	if err != nil {
+		return nil, err
+	}
+	var snap *meta.Snapshot
+	if name == "" {
+		snap, err = store.LoadLatest()
+	} else {
+		snap, err = store.Load(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取快照失败: %w", err)
+	}
+	if snap == nil {
+		return nil, fmt.Errorf("仓库中没有快照 %s", name)
+	}
+
+	var open func(m endpoint.FileMeta) (io.ReadCloser, error)
+	if snap.Chunked {
+		chunks := chunk.NewStore(repoFS)
+		open = func(m endpoint.FileMeta) (io.ReadCloser, error) {
+			return chunks.Open(m.Chunks), nil
+		}
+	} else if snap.Tree != "" {
+		open = func(m endpoint.FileMeta) (io.ReadCloser, error) {
+			return repoFS.Open(filepath.Join(snap.Tree, m.RelPath))
+		}
+	} else {
+		dataFS := repoFS
+		if set != "" {
+			dataEp := setEndpoint(repo, set)
+			if dataFS, err = buildFS(context.Background(), &dataEp); err != nil {
+				return nil, err
+			}
+			defer dataFS.Close()
+		}
+		open = func(m endpoint.FileMeta) (io.ReadCloser, error) {
+			return dataFS.Open(m.RelPath)
+		}
+	}
+
+	rels := make([]string, 0, len(snap.Files))
+	for rel := range snap.Files {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	var dirs []string
+	for _, rel := range rels {
+		m := snap.Files[rel]
+		full, err := restorePath(target, rel)
+		if err != nil {
+			return nil, err
+		}
+		if m.IsDir {
+			if err := os.MkdirAll(full, 0o755); err != nil {
+				return nil, err
+			}
+			dirs = append(dirs, rel)
+			continue
+		}
+		reader, err := open(m)
+		if err != nil {
+			return nil, fmt.Errorf("读取 %s 失败: %w", rel, err)
+		}
+		err = restoreFile(full, m, reader)
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("恢复 %s 失败: %w", rel, err)
+		}
+	}
+	// 目录时间在内容写完后由深到浅设置
+	for i := len(dirs) - 1; i >= 0; i-- {
+		m := snap.Files[dirs[i]]
+		full, _ := restorePath(target, dirs[i])
+		if perm := fs.FileMode(m.Mode).Perm(); perm != 0 {
+			_ = os.Chmod(full, perm)
+		}
+		_ = os.Chtimes(full, m.ModTime, m.ModTime)
+	}
+	return snap, nil
+}
+
+func restoreFile(full string, m endpoint.FileMeta, reader io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return err
+	}
+	perm := fs.FileMode(m.Mode).Perm()
+	if perm == 0 {
+		perm = 0o644
+	}
+	tmp := full + ".zbackup-restore"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	var n int64
+	if m.Sparse {
+		n, err = copySparse(file, reader)
+	} else {
+		n, err = io.Copy(file, reader)
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n != m.Size {
+		err = fmt.Errorf("大小为 %d，快照记录为 %d", n, m.Size)
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Chtimes(tmp, m.ModTime, m.ModTime)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, full)
+}
+
+// copySparse 按块写入 file，全零块用 Seek 跳过留作空洞，最后以 Truncate 补足末尾的空洞
+func copySparse(file *os.File, reader io.Reader) (int64, error) {
+	buf := make([]byte, restoreBlockSize)
+	zero := make([]byte, restoreBlockSize)
+	var n int64
+	for {
+		m, err := io.ReadFull(reader, buf)
+		if m > 0 {
+			var werr error
+			if bytes.Equal(buf[:m], zero[:m]) {
+				_, werr = file.Seek(int64(m), io.SeekCurrent)
+			} else {
+				_, werr = file.Write(buf[:m])
+			}
+			if werr != nil {
+				return n, werr
+			}
+			n += int64(m)
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return n, file.Truncate(n)
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// restorePath 拒绝跳出 target 的快照路径
+func restorePath(target, rel string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(rel))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("快照路径非法: %s", rel)
+	}
+	return filepath.Join(target, clean), nil
+}
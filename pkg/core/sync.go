@@ -0,0 +1,634 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/meta"
+	"zbackup/pkg/notify"
+	"zbackup/pkg/transfer"
+)
+
+// syncPlan 为双向同步的计划：toDest 在目标端执行，toSource 在源端执行
+type syncPlan struct {
+	toDest   transfer.Plan
+	toSource transfer.Plan
+	// conflicts 为两端都改动过的路径；Copy 非空时执行前先把源端的版本改名为冲突副本
+	conflicts []notify.Conflict
+	// unresolved 为本次不处理的路径，两端都沿用旧基准，下次同步时再次检测
+	unresolved []string
+}
+
+// runSync 以两端最近一次共同的同步快照为基准，把两端各自的改动传播到另一端。
+// 两端都改动过的文件保留两个版本：源端的版本改名为冲突副本后同步到两端，
+// 原路径使用目标端的版本；一端修改、另一端删除时保留修改后的版本
+func runSync(ctx context.Context, cfg *BackupConfig, summary *notify.Summary) (err error) {
+	startedAt := summary.StartedAt
+	var stats runStats
+	defer func() { stats.writeMetrics(cfg, startedAt, err) }()
+	srcFS, err := buildFS(ctx, &cfg.Source)
+	if err != nil {
+		return err
+	}
+	defer srcFS.Close()
+	repoFS, err := buildFS(ctx, &cfg.Dest)
+	if err != nil {
+		return err
+	}
+	defer repoFS.Close()
+	store, err := meta.NewStore(repoFS).WithSet(cfg.Set)
+	if err != nil {
+		return err
+	}
+	defer func() { stats.loadLastSuccess(cfg, store, err) }()
+	srcStore, err := meta.NewStore(srcFS).WithSet(cfg.Set)
+	if err != nil {
+		return err
+	}
+	destFS, dataDest := repoFS, cfg.Dest
+	if cfg.Set != "" {
+		dataDest = setEndpoint(cfg.Dest, cfg.Set)
+		if destFS, err = buildFS(ctx, &dataDest); err != nil {
+			return err
+		}
+		defer destFS.Close()
+	}
+
+	if err := checkSetMixing(meta.NewStore(repoFS), cfg.Set); err != nil {
+		return err
+	}
+	lock, err := store.AcquireLock(ctx, cfg.LockWait)
+	if err != nil {
+		return fmt.Errorf("获取目标端锁失败: %w", err)
+	}
+	defer lock.Release()
+	srcLock, err := srcStore.AcquireLock(ctx, cfg.LockWait)
+	if err != nil {
+		return fmt.Errorf("获取源端锁失败: %w", err)
+	}
+	defer srcLock.Release()
+	if !cfg.DryRun {
+		defer func() {
+			finishSummary(summary, cfg.SnapshotName, err)
+			if rerr := saveReport(repoFS, store.Dir(), *summary); rerr != nil {
+				fmt.Fprintf(os.Stderr, "写入运行报告失败: %v\n", rerr)
+			}
+		}()
+	}
+	// 任一端的锁被他人接管时取消本次同步，返回丢失原因
+	ctx, stopWatch := lock.Watch(ctx)
+	defer stopWatch()
+	ctx, stopSrcWatch := srcLock.Watch(ctx)
+	defer stopSrcWatch()
+	defer func() {
+		if cause := context.Cause(ctx); err != nil && errors.Is(cause, meta.ErrLockLost) {
+			err = cause
+		}
+	}()
+
+	logWriter, logPath, err := prepareLogWriter(cfg, repoFS, store.Dir())
+	if err != nil {
+		return err
+	}
+	progress, logger, err := newOutput(cfg, logWriter)
+	if err != nil {
+		return err
+	}
+	defer logger.Close()
+	if logPath != "" {
+		logger.Info("日志写入路径", "dest", logPath)
+	}
+	if err := cfg.Guard.checkSource(srcFS); err != nil {
+		logger.Error("源端检查未通过", "err", err)
+		return err
+	}
+
+	srcBase, dstBase, err := syncBase(srcStore, store)
+	if err != nil {
+		return fmt.Errorf("读取同步基准失败: %w", err)
+	}
+	if srcBase == nil {
+		logger.Info("两端没有共同的同步快照，本次只合并两端内容，不传播删除")
+	} else {
+		logger.Info("同步基准", "snapshot", srcBase.Name)
+	}
+	srcFiles, err := scanSyncSide(srcFS, cfg.Excludes, []string{meta.MetaDir})
+	if err != nil {
+		return fmt.Errorf("扫描源目录失败: %w", err)
+	}
+	// 默认备份集的数据目录即仓库根，跳过其中的元数据与硬链接快照目录；命名备份集不会与之混用
+	var internal []string
+	if cfg.Set == "" {
+		internal = []string{meta.MetaDir, treeDir}
+	}
+	dstFiles, err := scanSyncSide(destFS, cfg.Excludes, internal)
+	if err != nil {
+		return fmt.Errorf("扫描目标目录失败: %w", err)
+	}
+
+	srcHost := endpointHost(cfg.Source)
+	stamp := startedAt.UTC().Format("20060102T150405Z")
+	plan := planSync(srcFiles, dstFiles, snapshotFiles(srcBase), snapshotFiles(dstBase),
+		func(rel string) string { return conflictName(rel, srcHost, stamp) },
+		func(rel string) bool {
+			same, err := sameContent(srcFS, destFS, rel)
+			if err != nil {
+				logger.Warn("比较两端内容失败，按冲突处理", "path", rel, "err", err)
+			}
+			return same
+		})
+	for _, c := range plan.conflicts {
+		logger.Warn("同步冲突", "path", c.Path, "copy", c.Copy, "reason", c.Reason)
+		summary.AddConflict(c)
+	}
+	// 一个方向的删除来自另一端：另一端扫描为空时中止，删除比例按被删除一端的基准计算
+	for _, check := range []struct {
+		plan    transfer.Plan
+		base    *meta.Snapshot
+		scanned int
+		side    string
+	}{{plan.toDest, dstBase, len(srcFiles), "目标端"}, {plan.toSource, srcBase, len(dstFiles), "源端"}} {
+		if err := cfg.Guard.checkPlan(check.plan, len(snapshotFiles(check.base)), check.scanned); err != nil {
+			err = fmt.Errorf("%s: %w", check.side, err)
+			if !cfg.DryRun {
+				logger.Error("删除检查未通过", "err", err)
+				return err
+			}
+			logger.Warn("实际运行时将中止", "err", err)
+		}
+	}
+	if cfg.DryRun {
+		logger.Info("Dry-run 模式，只展示计划", "to_dest", len(plan.toDest.Items), "to_source", len(plan.toSource.Items), "conflicts", len(plan.conflicts))
+		for _, item := range plan.toDest.Items {
+			logger.Info("计划条目", "direction", "源端 -> 目标端", "action", item.Action, "path", item.RelPath, "size", item.Meta.Size, "reason", item.Reason)
+		}
+		for _, item := range plan.toSource.Items {
+			logger.Info("计划条目", "direction", "目标端 -> 源端", "action", item.Action, "path", item.RelPath, "size", item.Meta.Size, "reason", item.Reason)
+		}
+		return nil
+	}
+
+	failed := make(map[string]error)
+	for _, c := range plan.conflicts {
+		if c.Copy == "" {
+			continue
+		}
+		if err := renameFile(srcFS, c.Path, c.Copy); err != nil {
+			err = fmt.Errorf("保存冲突副本失败: %w", err)
+			logger.Error("同步失败", "path", c.Path, "err", err)
+			failed[c.Path] = err
+			plan.unresolved = append(plan.unresolved, c.Path)
+			plan.toDest = withoutItem(plan.toDest, c.Copy)
+			plan.toSource = withoutItem(plan.toSource, c.Path)
+			continue
+		}
+		delete(srcFiles, c.Path)
+		if st, err := srcFS.Stat(c.Copy); err == nil {
+			st.RelPath = c.Copy
+			srcFiles[c.Copy] = st
+		}
+	}
+
+	newExecutor := func(from, to endpoint.FileSystem, fromEP, toEP endpoint.Endpoint) transfer.Executor {
+		return transfer.Executor{
+			SourceFS:     from,
+			DestFS:       to,
+			Src:          fromEP,
+			Dst:          toEP,
+			Checksum:     cfg.Checksum,
+			Logger:       logger.Logger,
+			Progress:     progress,
+			Retries:      cfg.Retries,
+			RetryBackoff: cfg.RetryBackoff,
+			RetryChanged: cfg.RetryChanged,
+		}
+	}
+	up := newExecutor(srcFS, destFS, cfg.Source, dataDest)
+	upResult, upErr := up.Execute(ctx, plan.toDest)
+	down := newExecutor(destFS, srcFS, dataDest, cfg.Source)
+	downResult, downErr := down.Execute(ctx, plan.toSource)
+	execErr := errors.Join(upErr, downErr)
+	if len(failed) > 0 {
+		execErr = errors.Join(execErr, fmt.Errorf("%d 个冲突未能处理", len(failed)))
+	}
+	if execErr != nil {
+		logger.Error("同步过程中出现错误", "err", execErr)
+	}
+	if cause := context.Cause(ctx); errors.Is(cause, meta.ErrLockLost) {
+		logger.Error("锁已丢失，不保存同步快照", "err", cause)
+		return cause
+	}
+
+	// 写入端记录执行后的实际状态，读取端只在成功时更新，失败的条目下次同步会再次传播
+	newSrc, newDst := cloneFiles(srcFiles), cloneFiles(dstFiles)
+	settleSync(newDst, newSrc, destFS, plan.toDest, upResult, snapshotFiles(srcBase))
+	settleSync(newSrc, newDst, srcFS, plan.toSource, downResult, snapshotFiles(dstBase))
+	for _, rel := range plan.unresolved {
+		restoreBase(newSrc, snapshotFiles(srcBase), rel)
+		restoreBase(newDst, snapshotFiles(dstBase), rel)
+	}
+
+	combined := transfer.Plan{}
+	for _, item := range append(plan.toDest.Items, plan.toSource.Items...) {
+		combined.AddItem(item)
+	}
+	result := mergeResults(upResult, downResult)
+	for rel, err := range failed {
+		result.Failed[rel] = err
+	}
+	summarize(summary, combined, result)
+	stats.plan, stats.result, stats.snapshotFiles = combined, result, len(newDst)
+
+	now := time.Now().UTC()
+	snapshot := func(files map[string]endpoint.FileMeta) meta.Snapshot {
+		return meta.Snapshot{
+			Name:       cfg.SnapshotName,
+			CreatedAt:  now,
+			SourceRoot: cfg.Source.Path,
+			DestRoot:   dataDest.Path,
+			Files:      files,
+			Completed:  execErr == nil,
+			Sync:       true,
+		}
+	}
+	// 先写源端：目标端的快照决定了下次同步的共同基准
+	saveErr := srcStore.Save(snapshot(newSrc))
+	if saveErr == nil {
+		saveErr = store.Save(snapshot(newDst))
+	}
+	if saveErr != nil {
+		logger.Error("保存同步快照失败", "err", saveErr)
+	} else if srcBase != nil && srcBase.Name != cfg.SnapshotName {
+		// 源端的快照只用作同步基准，新的基准写入后旧的不再需要
+		if err := srcStore.DeleteSnapshot(srcBase.Name); err != nil {
+			logger.Warn("清理源端旧同步快照失败", "snapshot", srcBase.Name, "err", err)
+		}
+	}
+	if saveErr != nil {
+		return saveErr
+	}
+	if execErr != nil {
+		return execErr
+	}
+	logger.Info("同步完成", "snapshot", cfg.SnapshotName, "to_dest", len(upResult.Success), "to_source", len(downResult.Success), "conflicts", len(plan.conflicts))
+	return nil
+}
+
+// syncBase 返回两端都有的最近一个同步快照，分别为源端与目标端在该次同步后的状态
+func syncBase(srcStore, dstStore *meta.Store) (*meta.Snapshot, *meta.Snapshot, error) {
+	dstInfos, err := dstStore.SnapshotInfos()
+	if err != nil {
+		return nil, nil, err
+	}
+	dstSync := make(map[string]bool)
+	for _, info := range dstInfos {
+		if info.Sync {
+			dstSync[info.Name] = true
+		}
+	}
+	srcInfos, err := srcStore.SnapshotInfos()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, info := range srcInfos {
+		if !info.Sync || !dstSync[info.Name] {
+			continue
+		}
+		src, err := srcStore.Load(info.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		dst, err := dstStore.Load(info.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return src, dst, nil
+	}
+	return nil, nil, nil
+}
+
+// scanSyncSide 扫描一端的目录树，跳过 internal 中的仓库内部目录
+func scanSyncSide(fs endpoint.FileSystem, excludes, internal []string) (map[string]endpoint.FileMeta, error) {
+	list, err := fs.List(excludes)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]endpoint.FileMeta, len(list))
+	for _, meta := range list {
+		meta.RelPath = normRel(meta.RelPath)
+		if underAny(meta.RelPath, internal) {
+			continue
+		}
+		files[meta.RelPath] = meta
+	}
+	return files, nil
+}
+
+func underAny(rel string, dirs []string) bool {
+	for _, dir := range dirs {
+		if rel == dir || strings.HasPrefix(rel, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func snapshotFiles(snap *meta.Snapshot) map[string]endpoint.FileMeta {
+	if snap == nil {
+		return nil
+	}
+	return snap.Files
+}
+
+// planSync 对比两端当前状态与各自的基准生成同步计划。base 为 nil 时没有共同基准：
+// 只有一端存在的条目复制到另一端，不传播删除。same 用于判断两端大小相同的文件内容是否一致
+func planSync(src, dst, srcBase, dstBase map[string]endpoint.FileMeta, copyName func(string) string, same func(string) bool) syncPlan {
+	var plan syncPlan
+	var srcDeletes, dstDeletes []transfer.TransferItem
+	paths := make(map[string]struct{}, len(src)+len(dst))
+	for rel := range src {
+		paths[rel] = struct{}{}
+	}
+	for rel := range dst {
+		paths[rel] = struct{}{}
+	}
+	for rel := range srcBase {
+		paths[rel] = struct{}{}
+	}
+	for rel := range dstBase {
+		paths[rel] = struct{}{}
+	}
+	sorted := make([]string, 0, len(paths))
+	for rel := range paths {
+		sorted = append(sorted, rel)
+	}
+	sort.Strings(sorted)
+
+	for _, rel := range sorted {
+		s, sOK := src[rel]
+		d, dOK := dst[rel]
+		sChanged := changedSince(s, sOK, srcBase, rel)
+		dChanged := changedSince(d, dOK, dstBase, rel)
+		switch {
+		case !sChanged && !dChanged, !sOK && !dOK:
+		case sOK && dOK && s.IsDir != d.IsDir:
+			plan.conflicts = append(plan.conflicts, notify.Conflict{Path: rel, Reason: "两端同名条目一个是文件、一个是目录，需要手动处理"})
+			plan.unresolved = append(plan.unresolved, rel)
+		case sChanged && !dChanged, sChanged && !dOK:
+			if dChanged {
+				plan.conflicts = append(plan.conflicts, notify.Conflict{Path: rel, Reason: "目标端删除、源端修改，保留源端的版本"})
+			}
+			if sOK {
+				plan.toDest.AddItem(syncCopy(s, dOK, transfer.ActionUpload, "源端有改动"))
+			} else if dOK {
+				dstDeletes = append(dstDeletes, transfer.TransferItem{RelPath: rel, Meta: d, Action: transfer.ActionDelete, Reason: "源端已删除"})
+			}
+		case dChanged && !sChanged, dChanged && !sOK:
+			if sChanged {
+				plan.conflicts = append(plan.conflicts, notify.Conflict{Path: rel, Reason: "源端删除、目标端修改，保留目标端的版本"})
+			}
+			if dOK {
+				plan.toSource.AddItem(syncCopy(d, sOK, transfer.ActionDownload, "目标端有改动"))
+			} else if sOK {
+				srcDeletes = append(srcDeletes, transfer.TransferItem{RelPath: rel, Meta: s, Action: transfer.ActionDelete, Reason: "目标端已删除"})
+			}
+		default:
+			// 两端都新建或修改了同一路径：目录与内容相同的文件无需处理
+			if s.IsDir || (s.Size == d.Size && (s.ModTime.Equal(d.ModTime) || same(rel))) {
+				break
+			}
+			dup := copyName(rel)
+			plan.conflicts = append(plan.conflicts, notify.Conflict{Path: rel, Copy: dup, Reason: "两端都修改了该文件，源端的版本另存为冲突副本"})
+			s.RelPath = dup
+			plan.toDest.AddItem(transfer.TransferItem{RelPath: dup, Meta: s, Action: transfer.ActionUpload, Reason: "冲突副本"})
+			plan.toSource.AddItem(transfer.TransferItem{RelPath: rel, Meta: d, Action: transfer.ActionDownload, Reason: "冲突，使用目标端的版本"})
+		}
+	}
+	plan.addDeletes(&plan.toDest, dstDeletes, dst)
+	plan.addDeletes(&plan.toSource, srcDeletes, src)
+	return plan
+}
+
+// changedSince 判断一端的条目相对基准是否有改动：新增、删除、类型变化，或文件的大小、修改时间不同
+func changedSince(cur endpoint.FileMeta, ok bool, base map[string]endpoint.FileMeta, rel string) bool {
+	old, had := base[rel]
+	if ok != had {
+		return true
+	}
+	if !ok {
+		return false
+	}
+	if cur.IsDir || old.IsDir {
+		return cur.IsDir != old.IsDir
+	}
+	return !unchangedMeta(old, cur)
+}
+
+// unchangedMeta 按大小与修改时间判断文件未变，其中一方没有亚秒精度时按秒比较
+func unchangedMeta(old, cur endpoint.FileMeta) bool {
+	if old.Size != cur.Size {
+		return false
+	}
+	if old.ModTime.Equal(cur.ModTime) {
+		return true
+	}
+	if old.ModTime.Nanosecond() != 0 && cur.ModTime.Nanosecond() != 0 {
+		return false
+	}
+	return old.ModTime.Truncate(time.Second).Equal(cur.ModTime.Truncate(time.Second))
+}
+
+func syncCopy(meta endpoint.FileMeta, exists bool, action transfer.TransferAction, reason string) transfer.TransferItem {
+	if meta.IsDir {
+		return transfer.TransferItem{RelPath: meta.RelPath, Meta: meta, Action: transfer.ActionMkdir, Reason: reason}
+	}
+	return transfer.TransferItem{RelPath: meta.RelPath, Meta: meta, Action: action, Reason: reason, Overwrites: exists}
+}
+
+// addDeletes 把一端的删除条目按从深到浅的顺序追加到该端计划末尾。删除会递归删除整个目录，
+// 目录下仍有保留或将要写入的条目时不删除该目录，留到下次同步
+func (sp *syncPlan) addDeletes(plan *transfer.Plan, deletes []transfer.TransferItem, side map[string]endpoint.FileMeta) {
+	deleted := make(map[string]bool, len(deletes))
+	for _, item := range deletes {
+		deleted[item.RelPath] = true
+	}
+	kept := func(dir string) bool {
+		for rel := range side {
+			if !deleted[rel] && strings.HasPrefix(rel, dir+"/") {
+				return true
+			}
+		}
+		for _, item := range plan.Items {
+			if item.Action != transfer.ActionDelete && strings.HasPrefix(item.RelPath, dir+"/") {
+				return true
+			}
+		}
+		return false
+	}
+	sort.Slice(deletes, func(i, j int) bool { return deletes[i].RelPath > deletes[j].RelPath })
+	for _, item := range deletes {
+		if item.Meta.IsDir && kept(item.RelPath) {
+			sp.unresolved = append(sp.unresolved, item.RelPath)
+			continue
+		}
+		plan.AddItem(item)
+	}
+}
+
+// settleSync 根据一个方向的执行结果更新新基准：written 为写入端，记录执行后的实际状态；
+// read 为读取端，条目未成功时恢复为旧基准。删除失败只输出警告，以写入端是否仍存在为准
+func settleSync(written, read map[string]endpoint.FileMeta, writtenFS endpoint.FileSystem, plan transfer.Plan, result transfer.Result, readBase map[string]endpoint.FileMeta) {
+	for _, item := range plan.Items {
+		st, err := writtenFS.Stat(item.RelPath)
+		if err == nil {
+			st.RelPath = item.RelPath
+			written[item.RelPath] = st
+		} else {
+			delete(written, item.RelPath)
+		}
+		ok := err != nil
+		if item.Action != transfer.ActionDelete {
+			_, ok = result.Success[item.RelPath]
+		}
+		if !ok {
+			restoreBase(read, readBase, item.RelPath)
+		}
+	}
+}
+
+func restoreBase(files, base map[string]endpoint.FileMeta, rel string) {
+	if old, ok := base[rel]; ok {
+		files[rel] = old
+	} else {
+		delete(files, rel)
+	}
+}
+
+func cloneFiles(files map[string]endpoint.FileMeta) map[string]endpoint.FileMeta {
+	out := make(map[string]endpoint.FileMeta, len(files))
+	for rel, meta := range files {
+		out[rel] = meta
+	}
+	return out
+}
+
+func withoutItem(plan transfer.Plan, rel string) transfer.Plan {
+	out := transfer.Plan{}
+	for _, item := range plan.Items {
+		if item.RelPath != rel {
+			out.AddItem(item)
+		}
+	}
+	return out
+}
+
+func mergeResults(results ...transfer.Result) transfer.Result {
+	merged := transfer.Result{
+		Success:  make(map[string]endpoint.FileMeta),
+		Failed:   make(map[string]error),
+		Attempts: make(map[string]int),
+		Changed:  make(map[string]transfer.TransferItem),
+	}
+	for _, r := range results {
+		for rel, meta := range r.Success {
+			merged.Success[rel] = meta
+		}
+		for rel, err := range r.Failed {
+			merged.Failed[rel] = err
+		}
+		for rel, n := range r.Attempts {
+			merged.Attempts[rel] = n
+		}
+		for rel, item := range r.Changed {
+			merged.Changed[rel] = item
+		}
+		merged.Transferred += r.Transferred
+		merged.BytesTransferred += r.BytesTransferred
+		merged.Deleted = append(merged.Deleted, r.Deleted...)
+	}
+	return merged
+}
+
+// conflictName 返回冲突副本的路径：<原路径>.conflict-<主机>-<时间>
+func conflictName(rel, host, stamp string) string {
+	return fmt.Sprintf("%s.conflict-%s-%s", rel, host, stamp)
+}
+
+// endpointHost 返回端点所在的主机名，本地端点为本机名
+func endpointHost(ep endpoint.Endpoint) string {
+	host := ep.Host
+	if ep.Type == endpoint.EndpointLocal {
+		host, _ = os.Hostname()
+	}
+	if host == "" {
+		host = "unknown"
+	}
+	return strings.NewReplacer("/", "_", ":", "_").Replace(host)
+}
+
+// renameFile 在同一文件系统内改名，不支持重命名时复制后删除原文件
+func renameFile(fs endpoint.FileSystem, oldRel, newRel string) error {
+	if r, ok := fs.(endpoint.Renamer); ok {
+		return r.Rename(oldRel, newRel)
+	}
+	st, err := fs.Stat(oldRel)
+	if err != nil {
+		return err
+	}
+	reader, err := fs.Open(oldRel)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	writer, err := fs.Create(newRel, os.FileMode(st.Mode).Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, reader); err != nil {
+		writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return fs.Remove(oldRel)
+}
+
+// sameContent 比较两端同一路径文件的 SHA-256
+func sameContent(a, b endpoint.FileSystem, rel string) (bool, error) {
+	sa, err := fileDigest(a, rel)
+	if err != nil {
+		return false, err
+	}
+	sb, err := fileDigest(b, rel)
+	if err != nil {
+		return false, err
+	}
+	return string(sa) == string(sb), nil
+}
+
+func fileDigest(fs endpoint.FileSystem, rel string) ([]byte, error) {
+	if h, ok := fs.(endpoint.RemoteHashFS); ok {
+		if sum, err := h.ComputeRemoteHash(rel, endpoint.ChecksumSHA256); err == nil {
+			return sum, nil
+		}
+	}
+	reader, err := fs.Open(rel)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, reader); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
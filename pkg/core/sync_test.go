@@ -0,0 +1,232 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/meta"
+	"zbackup/pkg/notify"
+	"zbackup/pkg/transfer"
+)
+
+func TestPlanSync(t *testing.T) {
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	file := func(rel string, size int64, mtime time.Time) endpoint.FileMeta {
+		return endpoint.FileMeta{RelPath: rel, Size: size, ModTime: mtime}
+	}
+	dir := func(rel string) endpoint.FileMeta {
+		return endpoint.FileMeta{RelPath: rel, IsDir: true, ModTime: at}
+	}
+	later := at.Add(time.Hour)
+	base := map[string]endpoint.FileMeta{
+		"same.txt":    file("same.txt", 1, at),
+		"src-mod.txt": file("src-mod.txt", 1, at),
+		"dst-del.txt": file("dst-del.txt", 1, at),
+		"both.txt":    file("both.txt", 1, at),
+		"mod-del.txt": file("mod-del.txt", 1, at),
+		"gone":        dir("gone"),
+		"gone/x.txt":  file("gone/x.txt", 1, at),
+		"keep":        dir("keep"),
+		"keep/x.txt":  file("keep/x.txt", 1, at),
+	}
+	src := map[string]endpoint.FileMeta{
+		"same.txt":    file("same.txt", 1, at),
+		"src-mod.txt": file("src-mod.txt", 2, later),
+		"dst-del.txt": file("dst-del.txt", 1, at),
+		"both.txt":    file("both.txt", 2, later),
+		"new-src.txt": file("new-src.txt", 1, later),
+	}
+	dst := map[string]endpoint.FileMeta{
+		"same.txt":    file("same.txt", 1, at),
+		"src-mod.txt": file("src-mod.txt", 1, at),
+		"both.txt":    file("both.txt", 3, later),
+		"mod-del.txt": file("mod-del.txt", 5, later),
+		"gone":        dir("gone"),
+		"gone/x.txt":  file("gone/x.txt", 1, at),
+		"keep":        dir("keep"),
+		"keep/x.txt":  file("keep/x.txt", 1, at),
+		"keep/new":    file("keep/new", 1, later),
+	}
+	plan := planSync(src, dst, base, base, func(rel string) string { return rel + ".conflict" }, func(string) bool { return false })
+
+	actions := func(p transfer.Plan) map[string]transfer.TransferAction {
+		out := make(map[string]transfer.TransferAction)
+		for _, item := range p.Items {
+			out[item.RelPath] = item.Action
+		}
+		return out
+	}
+	wantDest := map[string]transfer.TransferAction{
+		"src-mod.txt":       transfer.ActionUpload,
+		"new-src.txt":       transfer.ActionUpload,
+		"both.txt.conflict": transfer.ActionUpload,
+		"gone/x.txt":        transfer.ActionDelete,
+		"gone":              transfer.ActionDelete,
+		"keep/x.txt":        transfer.ActionDelete,
+	}
+	wantSource := map[string]transfer.TransferAction{
+		"both.txt":    transfer.ActionDownload,
+		"mod-del.txt": transfer.ActionDownload,
+		"dst-del.txt": transfer.ActionDelete,
+		"keep/new":    transfer.ActionDownload,
+	}
+	for name, pair := range map[string][2]map[string]transfer.TransferAction{
+		"to dest":   {actions(plan.toDest), wantDest},
+		"to source": {actions(plan.toSource), wantSource},
+	} {
+		got, want := pair[0], pair[1]
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %v, want %v", name, got, want)
+		}
+		for rel, action := range want {
+			if got[rel] != action {
+				t.Fatalf("%s: %s = %q, want %q (%v)", name, rel, got[rel], action, got)
+			}
+		}
+	}
+	// gone 整个目录在源端被删除；keep 目录下目标端还有新文件，只删除未变化的内容
+	if last := plan.toDest.Items[len(plan.toDest.Items)-1]; last.RelPath != "gone" {
+		t.Fatalf("directory should be deleted after its content: %+v", plan.toDest.Items)
+	}
+	if len(plan.unresolved) != 1 || plan.unresolved[0] != "keep" {
+		t.Fatalf("directory with new content should be kept: %v", plan.unresolved)
+	}
+	conflicts := make(map[string]notify.Conflict)
+	for _, c := range plan.conflicts {
+		conflicts[c.Path] = c
+	}
+	if len(conflicts) != 2 || conflicts["both.txt"].Copy != "both.txt.conflict" || conflicts["mod-del.txt"].Copy != "" {
+		t.Fatalf("unexpected conflicts: %+v", plan.conflicts)
+	}
+
+	// 没有共同基准时只合并：只有一端存在的条目复制过去，不删除任何东西
+	first := planSync(src, dst, nil, nil, func(rel string) string { return rel + ".conflict" }, func(string) bool { return false })
+	for _, p := range []transfer.Plan{first.toDest, first.toSource} {
+		if p.Counts[transfer.ActionDelete] != 0 {
+			t.Fatalf("first sync should not delete: %+v", p.Items)
+		}
+	}
+	if len(first.conflicts) != 2 || first.conflicts[0].Path != "both.txt" || first.conflicts[1].Path != "src-mod.txt" {
+		t.Fatalf("unexpected first-sync conflicts: %+v", first.conflicts)
+	}
+}
+
+func TestRunSync(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	write := func(dir, rel, data string, mtime time.Time) {
+		full := filepath.Join(dir, rel)
+		os.MkdirAll(filepath.Dir(full), 0o755)
+		os.WriteFile(full, []byte(data), 0o644)
+		os.Chtimes(full, mtime, mtime)
+	}
+	read := func(dir, rel string) string {
+		data, err := os.ReadFile(filepath.Join(dir, rel))
+		if err != nil {
+			return "<missing>"
+		}
+		return string(data)
+	}
+	sync := func(name string) notify.Summary {
+		err := Run(context.Background(), &BackupConfig{
+			Source:       endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: srcDir},
+			Dest:         endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir},
+			Mode:         endpoint.ModeSync,
+			Checksum:     endpoint.ChecksumSHA256,
+			SnapshotName: name,
+			LogLevel:     "error",
+			NoProgress:   true,
+		})
+		if err != nil {
+			t.Fatalf("sync %s failed: %v", name, err)
+		}
+		data, err := os.ReadFile(reportPath(filepath.Join(dstDir, ".zbackup"), name))
+		if err != nil {
+			t.Fatalf("read report: %v", err)
+		}
+		var summary notify.Summary
+		if err := json.Unmarshal(data, &summary); err != nil {
+			t.Fatalf("decode report: %v", err)
+		}
+		return summary
+	}
+	old := time.Now().Add(-time.Hour)
+	write(srcDir, "laptop.txt", "from laptop", old)
+	write(dstDir, "server/notes.txt", "from server", old)
+	write(srcDir, "same.txt", "same", old)
+	write(dstDir, "same.txt", "same", old.Add(time.Minute))
+	write(srcDir, "doc.txt", "laptop draft", old)
+	write(dstDir, "doc.txt", "server draft", old.Add(time.Second))
+	first := sync("one")
+
+	if read(dstDir, "laptop.txt") != "from laptop" || read(srcDir, "server/notes.txt") != "from server" {
+		t.Fatalf("one-sided files should be copied both ways")
+	}
+	if first.FilesConflicted != 1 || first.Conflicts[0].Path != "doc.txt" {
+		t.Fatalf("unexpected conflicts: %+v", first.Conflicts)
+	}
+	copyRel := first.Conflicts[0].Copy
+	if !strings.HasPrefix(copyRel, "doc.txt.conflict-") {
+		t.Fatalf("unexpected conflict copy name %q", copyRel)
+	}
+	for _, dir := range []string{srcDir, dstDir} {
+		if read(dir, "doc.txt") != "server draft" || read(dir, copyRel) != "laptop draft" {
+			t.Fatalf("%s: both versions should be kept: %q %q", dir, read(dir, "doc.txt"), read(dir, copyRel))
+		}
+	}
+	// 两端各自记录同名的同步快照，仓库元数据目录不参与同步
+	for _, dir := range []string{srcDir, dstDir} {
+		snap, err := meta.NewStore(endpoint.NewLocalFS(dir)).Load("one")
+		if err != nil || snap == nil || !snap.Sync || len(snap.Files) != 6 {
+			t.Fatalf("%s: unexpected sync snapshot %+v %v", dir, snap, err)
+		}
+		for rel := range snap.Files {
+			if strings.HasPrefix(rel, meta.MetaDir) {
+				t.Fatalf("%s: metadata synced: %s", dir, rel)
+			}
+		}
+	}
+
+	// 第二次同步：以 one 为基准传播修改与删除，一端修改、另一端删除时保留修改
+	now := time.Now()
+	write(srcDir, "laptop.txt", "edited on laptop", now)
+	os.Remove(filepath.Join(dstDir, "same.txt"))
+	write(dstDir, "server/notes.txt", "edited on server", now)
+	os.Remove(filepath.Join(srcDir, "server", "notes.txt"))
+	second := sync("two")
+
+	if read(dstDir, "laptop.txt") != "edited on laptop" {
+		t.Fatalf("source edit not propagated")
+	}
+	if read(srcDir, "same.txt") != "<missing>" {
+		t.Fatalf("dest deletion not propagated")
+	}
+	if read(srcDir, "server/notes.txt") != "edited on server" {
+		t.Fatalf("modified version should win over deletion")
+	}
+	if second.FilesConflicted != 1 || second.Conflicts[0].Copy != "" {
+		t.Fatalf("unexpected conflicts: %+v", second.Conflicts)
+	}
+
+	// 没有改动时不传输任何文件；源端只保留最新的同步基准
+	third := sync("three")
+	if third.FilesTransferred != 0 || third.FilesDeleted != 0 || third.FilesConflicted != 0 {
+		t.Fatalf("idle sync should not change anything: %+v", third)
+	}
+	names, err := meta.NewStore(endpoint.NewLocalFS(srcDir)).ListSnapshots()
+	if err != nil || len(names) != 1 || names[0] != "three" {
+		t.Fatalf("unexpected source snapshots: %v %v", names, err)
+	}
+
+	// 一端只删除了一个文件时，该方向的计划只有删除条目，不应被当作另一端为空而中止
+	os.Remove(filepath.Join(srcDir, "laptop.txt"))
+	fourth := sync("four")
+	if read(dstDir, "laptop.txt") != "<missing>" || fourth.FilesDeleted != 1 {
+		t.Fatalf("single deletion not propagated: %+v", fourth)
+	}
+}
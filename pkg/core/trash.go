@@ -0,0 +1,83 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"zbackup/pkg/endpoint"
+)
+
+// trashMover 把数据目录中将被覆盖或删除的文件移到备份集的回收目录，保持相对路径
+type trashMover struct {
+	fs      endpoint.FileSystem
+	renamer endpoint.Renamer
+	// prefix 为数据目录相对仓库根的路径，默认备份集为空
+	prefix string
+	dir    string
+}
+
+func newTrashMover(repoFS endpoint.FileSystem, set, dir string) (*trashMover, error) {
+	renamer, ok := repoFS.(endpoint.Renamer)
+	if !ok {
+		return nil, fmt.Errorf("目标端不支持重命名，无法使用 --backup-dir")
+	}
+	return &trashMover{fs: repoFS, renamer: renamer, prefix: set, dir: dir}, nil
+}
+
+func (t *trashMover) move(rel string) error {
+	src := filepath.Join(t.prefix, rel)
+	dst := filepath.Join(t.dir, rel)
+	if _, err := t.fs.Stat(dst); err == nil {
+		info, err := t.fs.Stat(src)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir {
+			// 删除按先文件后目录的顺序执行，回收目录中已有同名目录是因为子项先移了过去，
+			// 不能整体删除：移动失败的子项与快照之外的文件都还在里面
+			return t.moveDir(rel, src)
+		}
+		// 同一快照续传时旧版本已经保存过，目标端现有的是上次未完成的写入
+		return t.fs.Remove(src)
+	}
+	if err := t.renamer.Rename(src, dst); err != nil {
+		if _, serr := t.fs.Stat(src); errors.Is(serr, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// moveDir 把目录中剩余的子项逐个移入回收目录中已存在的同名目录，全部移走后才删除该空目录
+func (t *trashMover) moveDir(rel, src string) error {
+	lister, ok := t.fs.(endpoint.DirLister)
+	if !ok {
+		return fmt.Errorf("目标端不支持列出目录，保留目录 %s", rel)
+	}
+	entries, err := lister.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	var failed int
+	for _, entry := range entries {
+		if err := t.move(filepath.Join(rel, entry.RelPath)); err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("目录 %s 中有 %d 个条目未能移入回收目录", rel, failed)
+	}
+	if entries, err = lister.ReadDir(src); err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("目录 %s 非空，保留原目录", rel)
+	}
+	return t.fs.Remove(src)
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"zbackup/pkg/endpoint"
+)
+
+func TestRunBackupToTrash(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	run := func(name string, set string) {
+		err := Run(context.Background(), &BackupConfig{
+			Source:         endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: srcDir},
+			Dest:           endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir},
+			Set:            set,
+			Mode:           endpoint.ModeFull,
+			Checksum:       endpoint.ChecksumSHA256,
+			SnapshotName:   name,
+			LogLevel:       "error",
+			NoProgress:     true,
+			BackupDir:      "old-versions",
+			BackupKeepDays: 30,
+			Guard:          Guard{Force: true},
+		})
+		if err != nil {
+			t.Fatalf("run %s failed: %v", name, err)
+		}
+	}
+	os.MkdirAll(filepath.Join(srcDir, "dir"), 0o755)
+	os.WriteFile(filepath.Join(srcDir, "dir", "a.txt"), []byte("v1"), 0o644)
+	os.WriteFile(filepath.Join(srcDir, "same.txt"), []byte("same"), 0o644)
+	os.WriteFile(filepath.Join(srcDir, "gone.txt"), []byte("bye"), 0o644)
+	run("one", "")
+
+	os.WriteFile(filepath.Join(srcDir, "dir", "a.txt"), []byte("v2!"), 0o644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(srcDir, "dir", "a.txt"), later, later)
+	os.Remove(filepath.Join(srcDir, "gone.txt"))
+	run("two", "")
+
+	trash := filepath.Join(dstDir, "old-versions", "two")
+	for rel, want := range map[string]string{"dir/a.txt": "v1", "gone.txt": "bye"} {
+		if data, err := os.ReadFile(filepath.Join(trash, rel)); err != nil || string(data) != want {
+			t.Fatalf("trash %s = %q %v", rel, data, err)
+		}
+	}
+	// 全量模式重新写入的未变化文件没有旧版本需要保存
+	if _, err := os.Stat(filepath.Join(trash, "same.txt")); !os.IsNotExist(err) {
+		t.Fatalf("unchanged file should not be moved to trash: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dstDir, "dir", "a.txt")); string(data) != "v2!" {
+		t.Fatalf("mirror should hold new version, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "gone.txt")); !os.IsNotExist(err) {
+		t.Fatalf("deleted file should leave the mirror: %v", err)
+	}
+
+	// 命名备份集的回收目录在其数据目录下；命名备份集不能与默认备份集共用仓库
+	dstDir = t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "same.txt"), []byte("changed"), 0o644)
+	run("s1", "etc")
+	os.Chtimes(filepath.Join(srcDir, "same.txt"), later, later)
+	os.WriteFile(filepath.Join(srcDir, "same.txt"), []byte("changed again"), 0o644)
+	run("s2", "etc")
+	if data, err := os.ReadFile(filepath.Join(dstDir, "etc", "old-versions", "s2", "same.txt")); err != nil || string(data) != "changed" {
+		t.Fatalf("set trash = %q %v", data, err)
+	}
+}
+
+// failRenameFS 对指定路径的重命名返回错误
+type failRenameFS struct {
+	*endpoint.LocalFS
+	fail string
+}
+
+func (f failRenameFS) Rename(oldRel, newRel string) error {
+	if oldRel == f.fail {
+		return errors.New("rename refused")
+	}
+	return f.LocalFS.Rename(oldRel, newRel)
+}
+
+func TestTrashMoverKeepsDirWithFailedChild(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "dir"), 0o755)
+	for _, name := range []string{"keep.txt", "moved.txt", "untracked.txt"} {
+		os.WriteFile(filepath.Join(root, "dir", name), []byte(name), 0o644)
+	}
+	trash, err := newTrashMover(failRenameFS{endpoint.NewLocalFS(root), filepath.Join("dir", "keep.txt")}, "", "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 与执行器相同的顺序：先文件后目录；untracked.txt 不在快照中，不会单独删除
+	if err := trash.move("dir/moved.txt"); err != nil {
+		t.Fatalf("move file: %v", err)
+	}
+	if err := trash.move("dir/keep.txt"); err == nil {
+		t.Fatalf("refused rename should fail")
+	}
+	if err := trash.move("dir"); err == nil {
+		t.Fatalf("dir with a child left behind should be reported as failed")
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "dir", "keep.txt")); err != nil || string(data) != "keep.txt" {
+		t.Fatalf("child whose move failed was lost: %q %v", data, err)
+	}
+	for _, name := range []string{"moved.txt", "untracked.txt"} {
+		if data, err := os.ReadFile(filepath.Join(root, "old", "dir", name)); err != nil || string(data) != name {
+			t.Fatalf("trash %s = %q %v", name, data, err)
+		}
+	}
+
+	// 剩余子项都能移走后删除空目录
+	trash.renamer = endpoint.NewLocalFS(root)
+	if err := trash.move("dir"); err != nil {
+		t.Fatalf("move dir: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "dir")); !os.IsNotExist(err) {
+		t.Fatalf("empty dir should be removed: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "old", "dir", "keep.txt")); err != nil || string(data) != "keep.txt" {
+		t.Fatalf("trash keep.txt = %q %v", data, err)
+	}
+}
+
+func TestCleanBackupDir(t *testing.T) {
+	for dir, want := range map[string]string{"old": "old", "a/b/": "a/b", ".zbackup/trash": ".zbackup/trash"} {
+		if got, err := CleanBackupDir(dir); err != nil || got != want {
+			t.Fatalf("CleanBackupDir(%q) = %q %v", dir, got, err)
+		}
+	}
+	for _, dir := range []string{"", ".", "/srv/old", "../old", "a/../../old", ".zbackup"} {
+		if _, err := CleanBackupDir(dir); err == nil {
+			t.Fatalf("CleanBackupDir(%q) should fail", dir)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/transfer"
+)
+
+// treeDir 为硬链接快照目录的上级目录，每个快照写入其下与快照同名的子目录
+const treeDir = "snapshots-tree"
+
+// treePath 返回快照的硬链接目录（相对仓库根）；命名备份集位于其数据目录之下
+func treePath(set, snapshot string) string {
+	return filepath.Join(set, treeDir, snapshot)
+}
+
+// treeEndpoint 返回硬链接目录对应的端点
+func treeEndpoint(repo endpoint.Endpoint, tree string) endpoint.Endpoint {
+	return setEndpoint(repo, filepath.ToSlash(tree))
+}
+
+// treeLinker 把上一快照目录中未变化的文件硬链接到本次快照目录
+type treeLinker struct {
+	fs     endpoint.FileSystem
+	linker endpoint.Linker
+	// prev 为上一快照的目录，为空时没有可链接的来源
+	prev string
+	dir  string
+}
+
+func newTreeLinker(repoFS endpoint.FileSystem, prev, dir string) (*treeLinker, error) {
+	linker, ok := repoFS.(endpoint.Linker)
+	if !ok {
+		return nil, fmt.Errorf("目标端不支持硬链接，无法使用 --tree")
+	}
+	return &treeLinker{fs: repoFS, linker: linker, prev: prev, dir: dir}, nil
+}
+
+func (t *treeLinker) link(item transfer.TransferItem) error {
+	dst := filepath.Join(t.dir, item.RelPath)
+	if t.prev == "" {
+		// 续传首个硬链接快照时，未变化的文件都由上次运行写入本次目录
+		if _, err := t.fs.Stat(dst); err != nil {
+			return fmt.Errorf("上一快照没有硬链接目录: %w", err)
+		}
+		return nil
+	}
+	src := filepath.Join(t.prev, item.RelPath)
+	err := t.linker.Link(src, dst)
+	if !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	// 续传时目标已由上次运行写入；大小不符说明是中断的上传，换成上一快照的版本
+	cur, err := t.fs.Stat(dst)
+	if err != nil {
+		return err
+	}
+	if cur.Size == item.Meta.Size {
+		return nil
+	}
+	if err := t.fs.Remove(dst); err != nil {
+		return err
+	}
+	return t.linker.Link(src, dst)
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/meta"
+	"zbackup/pkg/metrics"
+	"zbackup/pkg/transfer"
+)
+
+func TestRunTreeLinksUnchangedFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	run := func(name string, mode endpoint.BackupMode) metrics.RunMetrics {
+		var m metrics.RunMetrics
+		err := Run(context.Background(), &BackupConfig{
+			Source:       endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: srcDir},
+			Dest:         endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir},
+			Mode:         mode,
+			Checksum:     endpoint.ChecksumSHA256,
+			SnapshotName: name,
+			LogLevel:     "error",
+			NoProgress:   true,
+			Tree:         true,
+			Guard:        Guard{Force: true},
+			MetricsFile:  filepath.Join(t.TempDir(), "zbackup.prom"),
+			collectMetrics: func(rm metrics.RunMetrics) {
+				m = rm
+			},
+		})
+		if err != nil {
+			t.Fatalf("run %s failed: %v", name, err)
+		}
+		return m
+	}
+	tree := func(name, rel string) string {
+		return filepath.Join(dstDir, treeDir, name, rel)
+	}
+	os.MkdirAll(filepath.Join(srcDir, "dir", "empty"), 0o755)
+	os.WriteFile(filepath.Join(srcDir, "dir", "a.txt"), []byte("v1"), 0o644)
+	os.WriteFile(filepath.Join(srcDir, "same.txt"), []byte("same"), 0o644)
+	os.WriteFile(filepath.Join(srcDir, "gone.txt"), []byte("bye"), 0o644)
+	run("one", endpoint.ModeIncr)
+
+	os.WriteFile(filepath.Join(srcDir, "dir", "a.txt"), []byte("v2!"), 0o644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(srcDir, "dir", "a.txt"), later, later)
+	os.Remove(filepath.Join(srcDir, "gone.txt"))
+	m := run("two", endpoint.ModeIncr)
+	// 计划只计数不保留条目，传输量来自执行结果
+	if m.FilesTransferred != 1 || m.BytesTransferred != 3 || m.FilesByAction[transfer.ActionLink] != 2 {
+		t.Fatalf("unexpected metrics %+v", m)
+	}
+
+	for name, want := range map[string]string{"one": "v1", "two": "v2!"} {
+		if data, err := os.ReadFile(tree(name, "dir/a.txt")); err != nil || string(data) != want {
+			t.Fatalf("%s: dir/a.txt = %q %v", name, data, err)
+		}
+	}
+	first, _ := os.Stat(tree("one", "same.txt"))
+	second, err := os.Stat(tree("two", "same.txt"))
+	if err != nil || !os.SameFile(first, second) {
+		t.Fatalf("unchanged file should be hardlinked: %v", err)
+	}
+	changed, _ := os.Stat(tree("two", "dir/a.txt"))
+	if old, _ := os.Stat(tree("one", "dir/a.txt")); os.SameFile(old, changed) {
+		t.Fatal("changed file must not share the old inode")
+	}
+	// 增量模式沿用源端已删除的文件，空目录同样出现在新快照目录中
+	if data, err := os.ReadFile(tree("two", "gone.txt")); err != nil || string(data) != "bye" {
+		t.Fatalf("incremental tree should keep gone.txt: %q %v", data, err)
+	}
+	if info, err := os.Stat(tree("two", "dir/empty")); err != nil || !info.IsDir() {
+		t.Fatalf("empty dir missing from tree: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "same.txt")); !os.IsNotExist(err) {
+		t.Fatalf("tree layout should not write the mirror: %v", err)
+	}
+
+	store := meta.NewStore(endpoint.NewLocalFS(dstDir))
+	snap, err := store.Load("one")
+	if err != nil || snap.Tree != filepath.Join(treeDir, "one") {
+		t.Fatalf("snapshot tree = %+v %v", snap, err)
+	}
+
+	// 旧版本可以从仓库读取
+	repo, err := OpenRepository(endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir})
+	if err != nil {
+		t.Fatalf("open repository: %v", err)
+	}
+	defer repo.Close()
+	fsys, err := repo.SnapshotFS("")
+	if err != nil {
+		t.Fatalf("snapshot fs: %v", err)
+	}
+	if data, err := fs.ReadFile(fsys, "snapshots/one/dir/a.txt"); err != nil || string(data) != "v1" {
+		t.Fatalf("read old version = %q %v", data, err)
+	}
+
+	// 全量模式删除源端已不存在的文件；清理旧快照时一并删除其目录，不影响新快照的链接
+	run("three", endpoint.ModeFull)
+	if _, err := os.Stat(tree("three", "gone.txt")); !os.IsNotExist(err) {
+		t.Fatalf("full mode should drop gone.txt: %v", err)
+	}
+	if _, err := store.Prune(1); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, treeDir, "one")); !os.IsNotExist(err) {
+		t.Fatalf("pruned snapshot tree should be removed: %v", err)
+	}
+	if data, err := os.ReadFile(tree("three", "same.txt")); err != nil || string(data) != "same" {
+		t.Fatalf("latest tree = %q %v", data, err)
+	}
+}
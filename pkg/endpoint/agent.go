@@ -0,0 +1,384 @@
+package endpoint
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// agent 协议：远端运行 `zbackup serve --stdio`，通过 ssh 会话的 stdin/stdout 交换帧。
+//
+//	帧 = 类型(1 字节) | 长度(4 字节大端) | 内容
+//
+// 客户端先发送 hello 请求携带根目录，之后每个请求由一个 Q 帧发起，服务端以 R 帧结束。
+// list/readdir 在 R 帧之前返回若干 M 帧；open 先回 R 帧确认，再发送 D 帧与最终 R 帧；
+// create 在服务端确认后由客户端发送 D 帧并以 Z 帧结束，服务端写完后回 R 帧。
+const (
+	agentProtocolVersion = 1
+
+	frameRequest byte = 'Q'
+	frameReply   byte = 'R'
+	frameEntry   byte = 'M'
+	frameData    byte = 'D'
+	frameEnd     byte = 'Z'
+
+	agentChunkSize    = 256 << 10
+	maxAgentFrameSize = 16 << 20
+)
+
+const (
+	agentOpHello   = "hello"
+	agentOpList    = "list"
+	agentOpReadDir = "readdir"
+	agentOpStat    = "stat"
+	agentOpOpen    = "open"
+	agentOpCreate  = "create"
+	agentOpHash    = "hash"
+	agentOpMkdir   = "mkdir"
+	agentOpRemove  = "remove"
+	agentOpRename  = "rename"
+	agentOpLink    = "link"
+)
+
+// create 请求的写入方式
+const (
+	agentWriteTruncate  = ""
+	agentWriteAppend    = "append"
+	agentWriteExclusive = "exclusive"
+	agentWriteSparse    = "sparse"
+)
+
+const (
+	agentCodeNotExist = "notexist"
+	agentCodeExist    = "exist"
+)
+
+type agentRequest struct {
+	Op       string       `json:"op"`
+	Version  int          `json:"version,omitempty"`
+	Root     string       `json:"root,omitempty"`
+	Path     string       `json:"path,omitempty"`
+	To       string       `json:"to,omitempty"`
+	Excludes []string     `json:"excludes,omitempty"`
+	Perm     fs.FileMode  `json:"perm,omitempty"`
+	Write    string       `json:"write,omitempty"`
+	Size     int64        `json:"size,omitempty"`
+	Regions  []Region     `json:"regions,omitempty"`
+	Algo     ChecksumAlgo `json:"algo,omitempty"`
+}
+
+type agentReply struct {
+	Err     string    `json:"err,omitempty"`
+	Code    string    `json:"code,omitempty"`
+	Version int       `json:"version,omitempty"`
+	Meta    *FileMeta `json:"meta,omitempty"`
+	Sum     string    `json:"sum,omitempty"`
+}
+
+// err 把应答中的错误还原为可用 errors.Is 判断的错误
+func (r agentReply) err() error {
+	if r.Err == "" {
+		return nil
+	}
+	switch r.Code {
+	case agentCodeNotExist:
+		return fmt.Errorf("远端 agent: %s: %w", r.Err, fs.ErrNotExist)
+	case agentCodeExist:
+		return fmt.Errorf("远端 agent: %s: %w", r.Err, fs.ErrExist)
+	}
+	return fmt.Errorf("远端 agent: %s", r.Err)
+}
+
+func writeAgentFrame(w io.Writer, typ byte, payload []byte) error {
+	var header [5]byte
+	header[0] = typ
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+func writeAgentJSON(w io.Writer, typ byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeAgentFrame(w, typ, data)
+}
+
+func readAgentFrame(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxAgentFrameSize {
+		return 0, nil, fmt.Errorf("agent 帧过大: %d", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+// ServeAgent 在 r/w 上提供 agent 协议服务，直到对端关闭输入。
+// 文件操作委托给以 hello 请求中的根目录创建的 LocalFS
+func ServeAgent(r io.Reader, w io.Writer) error {
+	s := &agentServer{
+		r: bufio.NewReaderSize(r, agentChunkSize),
+		w: bufio.NewWriterSize(w, agentChunkSize),
+	}
+	for {
+		typ, payload, err := readAgentFrame(s.r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if typ != frameRequest {
+			return fmt.Errorf("agent: 意外的帧类型 %q", typ)
+		}
+		var req agentRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return fmt.Errorf("agent: 请求格式错误: %w", err)
+		}
+		if err := s.handle(req); err != nil {
+			return err
+		}
+		if err := s.w.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+type agentServer struct {
+	r  *bufio.Reader
+	w  *bufio.Writer
+	fs *LocalFS
+}
+
+// handle 处理单个请求；只有读写会话本身出错时才返回错误，文件操作错误通过应答返回
+func (s *agentServer) handle(req agentRequest) error {
+	if req.Op == agentOpHello {
+		if req.Version != agentProtocolVersion {
+			return s.reply(agentReply{Err: fmt.Sprintf("不支持的协议版本 %d", req.Version), Version: agentProtocolVersion})
+		}
+		root, err := expandHome(req.Root)
+		if err != nil {
+			return s.replyErr(err)
+		}
+		s.fs = NewLocalFS(root)
+		return s.reply(agentReply{Version: agentProtocolVersion})
+	}
+	if s.fs == nil {
+		return s.replyErr(errors.New("未收到 hello 请求"))
+	}
+	switch req.Op {
+	case agentOpList:
+		err := s.fs.Walk(req.Excludes, func(meta FileMeta) error {
+			return writeAgentJSON(s.w, frameEntry, meta)
+		})
+		return s.replyErr(err)
+	case agentOpReadDir:
+		metas, err := s.fs.ReadDir(req.Path)
+		for _, meta := range metas {
+			if err := writeAgentJSON(s.w, frameEntry, meta); err != nil {
+				return err
+			}
+		}
+		return s.replyErr(err)
+	case agentOpStat:
+		meta, err := s.fs.Stat(req.Path)
+		if err != nil {
+			return s.replyErr(err)
+		}
+		return s.reply(agentReply{Meta: &meta})
+	case agentOpOpen:
+		return s.serveOpen(req)
+	case agentOpCreate:
+		return s.serveCreate(req)
+	case agentOpHash:
+		sum, err := hashLocalFile(s.fs, req.Path, req.Algo)
+		if err != nil {
+			return s.replyErr(err)
+		}
+		return s.reply(agentReply{Sum: hex.EncodeToString(sum)})
+	case agentOpMkdir:
+		return s.replyErr(s.fs.MkdirAll(req.Path))
+	case agentOpRemove:
+		return s.replyErr(s.fs.Remove(req.Path))
+	case agentOpRename:
+		return s.replyErr(s.fs.Rename(req.Path, req.To))
+	case agentOpLink:
+		return s.replyErr(s.fs.Link(req.Path, req.To))
+	}
+	return s.replyErr(fmt.Errorf("未知操作 %q", req.Op))
+}
+
+func (s *agentServer) serveOpen(req agentRequest) error {
+	file, err := s.fs.Open(req.Path)
+	if err != nil {
+		return s.replyErr(err)
+	}
+	defer file.Close()
+	if err := s.reply(agentReply{}); err != nil {
+		return err
+	}
+	buf := make([]byte, agentChunkSize)
+	for {
+		n, readErr := file.Read(buf)
+		if n > 0 {
+			if err := writeAgentFrame(s.w, frameData, buf[:n]); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			return s.reply(agentReply{})
+		}
+		if readErr != nil {
+			return s.replyErr(readErr)
+		}
+	}
+}
+
+func (s *agentServer) serveCreate(req agentRequest) error {
+	var writer io.WriteCloser
+	var exclusive []byte
+	var err error
+	switch req.Write {
+	case agentWriteTruncate:
+		writer, err = s.fs.Create(req.Path, req.Perm)
+	case agentWriteAppend:
+		writer, err = s.fs.Append(req.Path)
+	case agentWriteSparse:
+		writer, err = s.fs.CreateSparse(req.Path, req.Perm, req.Size, req.Regions)
+	case agentWriteExclusive:
+		exclusive = []byte{}
+	default:
+		err = fmt.Errorf("未知写入方式 %q", req.Write)
+	}
+	if err != nil {
+		return s.replyErr(err)
+	}
+	if err := s.reply(agentReply{}); err != nil {
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	// 写入失败后继续读完剩余数据帧，保持会话可用
+	var writeErr error
+	for {
+		typ, payload, err := readAgentFrame(s.r)
+		if err != nil {
+			if writer != nil {
+				writer.Close()
+			}
+			return err
+		}
+		if typ == frameEnd {
+			break
+		}
+		if typ != frameData {
+			return fmt.Errorf("agent: 意外的帧类型 %q", typ)
+		}
+		if writeErr != nil {
+			continue
+		}
+		if writer == nil {
+			exclusive = append(exclusive, payload...)
+			continue
+		}
+		_, writeErr = writer.Write(payload)
+	}
+	if writer != nil {
+		if err := writer.Close(); writeErr == nil {
+			writeErr = err
+		}
+	} else {
+		writeErr = s.fs.WriteExclusive(req.Path, exclusive, req.Perm)
+	}
+	return s.replyErr(writeErr)
+}
+
+func (s *agentServer) reply(r agentReply) error {
+	return writeAgentJSON(s.w, frameReply, r)
+}
+
+func (s *agentServer) replyErr(err error) error {
+	if err == nil {
+		return s.reply(agentReply{})
+	}
+	r := agentReply{Err: err.Error()}
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		r.Code = agentCodeNotExist
+	case errors.Is(err, fs.ErrExist):
+		r.Code = agentCodeExist
+	}
+	return s.reply(r)
+}
+
+// expandHome 展开以 ~ 开头的路径，ssh 会话中的相对路径相对于用户主目录
+func expandHome(root string) (string, error) {
+	if root == "" {
+		return "", errors.New("根目录不能为空")
+	}
+	if root != "~" && !strings.HasPrefix(root, "~/") {
+		return root, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, strings.TrimPrefix(root, "~")), nil
+}
+
+func hashLocalFile(fsys FileSystem, relPath string, algo ChecksumAlgo) ([]byte, error) {
+	h := NewChecksumHash(algo)
+	if h == nil {
+		return nil, fmt.Errorf("不支持的校验算法 %q", algo)
+	}
+	reader, err := fsys.Open(relPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	if _, err := io.Copy(h, reader); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// NewChecksumHash 返回校验算法对应的哈希，ChecksumNone 或未知算法返回 nil
+func NewChecksumHash(algo ChecksumAlgo) hash.Hash {
+	switch algo {
+	case ChecksumMD5:
+		return md5.New()
+	case ChecksumSHA1:
+		return sha1.New()
+	case ChecksumSHA256:
+		return sha256.New()
+	default:
+		return nil
+	}
+}
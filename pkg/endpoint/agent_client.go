@@ -0,0 +1,418 @@
+package endpoint
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// agentSession 是与远端 agent 的一条会话，同一时间只服务一个请求
+type agentSession struct {
+	r *bufio.Reader
+	w *bufio.Writer
+	// close 结束会话；kill 为 true 时表示会话状态未知，应直接终止对端
+	close  func(kill bool) error
+	broken bool
+}
+
+// agentFS 通过远端 agent 访问文件系统。
+// 会话按需创建并复用：流式列举、读写文件会各自占用一条会话，互不阻塞
+type agentFS struct {
+	root  string
+	start func() (*agentSession, error)
+
+	mu   sync.Mutex
+	idle []*agentSession
+}
+
+func newAgentFS(root string, start func() (*agentSession, error)) *agentFS {
+	return &agentFS{root: root, start: start}
+}
+
+// get 取出一条空闲会话，没有时新建并完成握手
+func (a *agentFS) get() (*agentSession, error) {
+	a.mu.Lock()
+	if n := len(a.idle); n > 0 {
+		s := a.idle[n-1]
+		a.idle = a.idle[:n-1]
+		a.mu.Unlock()
+		return s, nil
+	}
+	a.mu.Unlock()
+	s, err := a.start()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := s.roundTrip(agentRequest{Op: agentOpHello, Version: agentProtocolVersion, Root: a.root})
+	if err == nil {
+		err = reply.err()
+	}
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("远端 agent 握手失败: %w", err), s.close(false))
+	}
+	return s, nil
+}
+
+// put 归还会话；处于未知状态的会话直接关闭
+func (a *agentFS) put(s *agentSession) {
+	if s.broken {
+		_ = s.close(true)
+		return
+	}
+	a.mu.Lock()
+	a.idle = append(a.idle, s)
+	a.mu.Unlock()
+}
+
+// closeIdle 关闭所有空闲会话；kill 为 true 时直接终止对端，用于连接可能已失效的场合
+func (a *agentFS) closeIdle(kill bool) error {
+	a.mu.Lock()
+	idle := a.idle
+	a.idle = nil
+	a.mu.Unlock()
+	var errs []error
+	for _, s := range idle {
+		if err := s.close(kill); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// call 执行只有一个应答的请求
+func (a *agentFS) call(req agentRequest) (agentReply, error) {
+	s, err := a.get()
+	if err != nil {
+		return agentReply{}, err
+	}
+	reply, err := s.roundTrip(req)
+	a.put(s)
+	if err != nil {
+		return agentReply{}, err
+	}
+	return reply, reply.err()
+}
+
+func (s *agentSession) send(req agentRequest) error {
+	if err := writeAgentJSON(s.w, frameRequest, req); err != nil {
+		s.broken = true
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		s.broken = true
+		return err
+	}
+	return nil
+}
+
+// next 读取下一帧，会话中断时把 EOF 转为 ErrUnexpectedEOF 以便按暂时性错误重试
+func (s *agentSession) next() (byte, []byte, error) {
+	typ, payload, err := readAgentFrame(s.r)
+	if err != nil {
+		s.broken = true
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, fmt.Errorf("远端 agent 会话中断: %w", err)
+	}
+	return typ, payload, nil
+}
+
+func (s *agentSession) readReply() (agentReply, error) {
+	typ, payload, err := s.next()
+	if err != nil {
+		return agentReply{}, err
+	}
+	if typ != frameReply {
+		s.broken = true
+		return agentReply{}, fmt.Errorf("远端 agent: 意外的帧类型 %q", typ)
+	}
+	var reply agentReply
+	if err := json.Unmarshal(payload, &reply); err != nil {
+		s.broken = true
+		return agentReply{}, err
+	}
+	return reply, nil
+}
+
+func (s *agentSession) roundTrip(req agentRequest) (agentReply, error) {
+	if err := s.send(req); err != nil {
+		return agentReply{}, err
+	}
+	return s.readReply()
+}
+
+func (a *agentFS) Walk(excludes []string, fn func(FileMeta) error) error {
+	return a.entries(agentRequest{Op: agentOpList, Excludes: excludes}, fn)
+}
+
+func (a *agentFS) ReadDir(relPath string) ([]FileMeta, error) {
+	var metas []FileMeta
+	err := a.entries(agentRequest{Op: agentOpReadDir, Path: filepathToPosix(relPath)}, func(meta FileMeta) error {
+		metas = append(metas, meta)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return metas, nil
+}
+
+// entries 读取 M 帧直到应答；回调出错时放弃会话，避免读取剩余条目
+func (a *agentFS) entries(req agentRequest, fn func(FileMeta) error) error {
+	s, err := a.get()
+	if err != nil {
+		return err
+	}
+	defer a.put(s)
+	if err := s.send(req); err != nil {
+		return err
+	}
+	for {
+		typ, payload, err := s.next()
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case frameEntry:
+			var meta FileMeta
+			if err := json.Unmarshal(payload, &meta); err != nil {
+				s.broken = true
+				return err
+			}
+			if err := fn(meta); err != nil {
+				s.broken = true
+				return err
+			}
+		case frameReply:
+			var reply agentReply
+			if err := json.Unmarshal(payload, &reply); err != nil {
+				s.broken = true
+				return err
+			}
+			return reply.err()
+		default:
+			s.broken = true
+			return fmt.Errorf("远端 agent: 意外的帧类型 %q", typ)
+		}
+	}
+}
+
+func (a *agentFS) Stat(relPath string) (FileMeta, error) {
+	reply, err := a.call(agentRequest{Op: agentOpStat, Path: filepathToPosix(relPath)})
+	if err != nil {
+		return FileMeta{}, err
+	}
+	if reply.Meta == nil {
+		return FileMeta{}, errors.New("远端 agent: stat 应答缺少元数据")
+	}
+	return *reply.Meta, nil
+}
+
+func (a *agentFS) Open(relPath string) (io.ReadCloser, error) {
+	req := agentRequest{Op: agentOpOpen, Path: filepathToPosix(relPath)}
+	s, err := a.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := s.roundTrip(req)
+	if err == nil {
+		err = reply.err()
+	}
+	if err != nil {
+		a.put(s)
+		return nil, err
+	}
+	return &agentReader{fs: a, s: s}, nil
+}
+
+func (a *agentFS) Create(relPath string, perm fs.FileMode) (io.WriteCloser, error) {
+	return a.create(agentRequest{Op: agentOpCreate, Path: filepathToPosix(relPath), Perm: perm})
+}
+
+func (a *agentFS) Append(relPath string) (io.WriteCloser, error) {
+	return a.create(agentRequest{Op: agentOpCreate, Path: filepathToPosix(relPath), Write: agentWriteAppend})
+}
+
+func (a *agentFS) CreateSparse(relPath string, perm fs.FileMode, size int64, regions []Region) (io.WriteCloser, error) {
+	return a.create(agentRequest{
+		Op:      agentOpCreate,
+		Path:    filepathToPosix(relPath),
+		Perm:    perm,
+		Write:   agentWriteSparse,
+		Size:    size,
+		Regions: regions,
+	})
+}
+
+func (a *agentFS) WriteExclusive(relPath string, data []byte, perm fs.FileMode) error {
+	writer, err := a.create(agentRequest{Op: agentOpCreate, Path: filepathToPosix(relPath), Perm: perm, Write: agentWriteExclusive})
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+func (a *agentFS) create(req agentRequest) (io.WriteCloser, error) {
+	s, err := a.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := s.roundTrip(req)
+	if err == nil {
+		err = reply.err()
+	}
+	if err != nil {
+		a.put(s)
+		return nil, err
+	}
+	return &agentWriter{fs: a, s: s}, nil
+}
+
+func (a *agentFS) MkdirAll(relPath string) error {
+	_, err := a.call(agentRequest{Op: agentOpMkdir, Path: filepathToPosix(relPath)})
+	return err
+}
+
+func (a *agentFS) Remove(relPath string) error {
+	_, err := a.call(agentRequest{Op: agentOpRemove, Path: filepathToPosix(relPath)})
+	return err
+}
+
+func (a *agentFS) Rename(oldRel, newRel string) error {
+	_, err := a.call(agentRequest{Op: agentOpRename, Path: filepathToPosix(oldRel), To: filepathToPosix(newRel)})
+	return err
+}
+
+func (a *agentFS) Link(oldRel, newRel string) error {
+	_, err := a.call(agentRequest{Op: agentOpLink, Path: filepathToPosix(oldRel), To: filepathToPosix(newRel)})
+	return err
+}
+
+func (a *agentFS) Hash(relPath string, algo ChecksumAlgo) ([]byte, error) {
+	reply, err := a.call(agentRequest{Op: agentOpHash, Path: filepathToPosix(relPath), Algo: algo})
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(reply.Sum)
+}
+
+// agentReader 读取 open 请求返回的数据帧
+type agentReader struct {
+	fs   *agentFS
+	s    *agentSession
+	buf  []byte
+	err  error
+	done bool
+}
+
+func (r *agentReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		typ, payload, err := r.s.next()
+		if err != nil {
+			r.err = err
+			continue
+		}
+		switch typ {
+		case frameData:
+			r.buf = payload
+		case frameReply:
+			var reply agentReply
+			if err := json.Unmarshal(payload, &reply); err != nil {
+				r.s.broken = true
+				r.err = err
+				continue
+			}
+			r.done = true
+			r.err = reply.err()
+			if r.err == nil {
+				r.err = io.EOF
+			}
+			r.fs.put(r.s)
+		default:
+			r.s.broken = true
+			r.err = fmt.Errorf("远端 agent: 意外的帧类型 %q", typ)
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Close 在数据未读完时放弃会话，避免为提前关闭的读取拉取整个文件
+func (r *agentReader) Close() error {
+	if r.s == nil {
+		return nil
+	}
+	if !r.done {
+		r.s.broken = true
+		r.fs.put(r.s)
+	}
+	r.s = nil
+	if r.err != nil && r.err != io.EOF {
+		return r.err
+	}
+	return nil
+}
+
+// agentWriter 把写入的数据以数据帧发送给远端，Close 时等待写入结果
+type agentWriter struct {
+	fs *agentFS
+	s  *agentSession
+}
+
+func (w *agentWriter) Write(p []byte) (int, error) {
+	if w.s == nil {
+		return 0, fs.ErrClosed
+	}
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), agentChunkSize)
+		if err := writeAgentFrame(w.s.w, frameData, p[:n]); err != nil {
+			w.s.broken = true
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	// 每次写入都立即送出，保证进度日志等追加写入及时落到远端
+	if err := w.s.w.Flush(); err != nil {
+		w.s.broken = true
+		return written, err
+	}
+	return written, nil
+}
+
+func (w *agentWriter) Close() error {
+	if w.s == nil {
+		return nil
+	}
+	s := w.s
+	w.s = nil
+	defer w.fs.put(s)
+	if err := writeAgentFrame(s.w, frameEnd, nil); err != nil {
+		s.broken = true
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		s.broken = true
+		return err
+	}
+	reply, err := s.readReply()
+	if err != nil {
+		return err
+	}
+	return reply.err()
+}
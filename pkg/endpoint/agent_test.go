@@ -0,0 +1,207 @@
+package endpoint
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newPipeAgent 创建通过内存管道连接到进程内 ServeAgent 的客户端
+func newPipeAgent(t *testing.T, root string) (*agentFS, *int) {
+	t.Helper()
+	started := 0
+	start := func() (*agentSession, error) {
+		started++
+		reqR, reqW := io.Pipe()
+		respR, respW := io.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			err := ServeAgent(reqR, respW)
+			respW.CloseWithError(io.EOF)
+			reqR.Close()
+			done <- err
+		}()
+		return &agentSession{
+			r: bufio.NewReader(respR),
+			w: bufio.NewWriter(reqW),
+			close: func(kill bool) error {
+				reqW.Close()
+				if kill {
+					respR.Close()
+					return nil
+				}
+				return <-done
+			},
+		}, nil
+	}
+	a := newAgentFS(root, start)
+	t.Cleanup(func() { a.closeIdle(false) })
+	return a, &started
+}
+
+func TestAgentFileOperations(t *testing.T) {
+	root := t.TempDir()
+	a, _ := newPipeAgent(t, root)
+
+	payload := make([]byte, agentChunkSize*2+17)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	w, err := a.Create("sub/data.bin", 0o600)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := w.Write(payload); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	r, err := a.Open("sub/data.bin")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(got) != string(payload) {
+		t.Fatalf("read back mismatch: %d bytes, err=%v", len(got), err)
+	}
+	meta, err := a.Stat("sub/data.bin")
+	if err != nil || meta.Size != int64(len(payload)) || meta.IsDir {
+		t.Fatalf("stat: %+v %v", meta, err)
+	}
+	sum, err := a.Hash("sub/data.bin", ChecksumSHA256)
+	want := sha256.Sum256(payload)
+	if err != nil || string(sum) != string(want[:]) {
+		t.Fatalf("hash mismatch: %x %v", sum, err)
+	}
+
+	if _, err := a.Open("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist, got %v", err)
+	}
+	if _, err := a.Stat("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist from stat, got %v", err)
+	}
+	if err := a.WriteExclusive("lock", []byte("1"), 0o644); err != nil {
+		t.Fatalf("exclusive: %v", err)
+	}
+	if err := a.WriteExclusive("lock", []byte("2"), 0o644); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expected ErrExist, got %v", err)
+	}
+
+	app, err := a.Append("log")
+	if err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	app.Write([]byte("a"))
+	// 追加写入在 Close 之前就应到达远端
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		data, _ := os.ReadFile(filepath.Join(root, "log"))
+		if string(data) == "a" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("append should be delivered before close, got %q", data)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	app.Write([]byte("b"))
+	app.Close()
+
+	if err := a.Rename("sub/data.bin", "moved/data.bin"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	entries, err := a.ReadDir("moved")
+	if err != nil || len(entries) != 1 || entries[0].RelPath != "data.bin" {
+		t.Fatalf("readdir: %+v %v", entries, err)
+	}
+	if err := a.Link("moved/data.bin", "linked/data.bin"); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	orig, _ := os.Stat(filepath.Join(root, "moved", "data.bin"))
+	linked, err := os.Stat(filepath.Join(root, "linked", "data.bin"))
+	if err != nil || !os.SameFile(orig, linked) {
+		t.Fatalf("link should share the inode: %v", err)
+	}
+	if err := a.Link("moved/data.bin", "linked/data.bin"); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("link onto existing target should report ErrExist, got %v", err)
+	}
+	if err := a.Remove("linked"); err != nil {
+		t.Fatalf("remove linked: %v", err)
+	}
+	if err := a.MkdirAll("empty/dir"); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := a.Remove("moved"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	var listed []string
+	err = a.Walk([]string{"log"}, func(m FileMeta) error {
+		listed = append(listed, m.RelPath)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+	want2 := []string{"empty", "empty/dir", "lock", "sub"}
+	if len(listed) != len(want2) {
+		t.Fatalf("walk got %v want %v", listed, want2)
+	}
+	for i := range want2 {
+		if listed[i] != want2[i] {
+			t.Fatalf("walk got %v want %v", listed, want2)
+		}
+	}
+}
+
+func TestAgentConcurrentSessions(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	a, started := newPipeAgent(t, root)
+	// 列举过程中打开文件不能因等待会话而阻塞
+	err := a.Walk(nil, func(m FileMeta) error {
+		r, err := a.Open(m.RelPath)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || string(data) != m.RelPath {
+			t.Fatalf("read %s: %q %v", m.RelPath, data, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+	if *started != 2 {
+		t.Fatalf("expected 2 sessions, started %d", *started)
+	}
+
+	// 回调出错时放弃该会话，后续请求使用新的会话
+	stop := errors.New("stop")
+	if err := a.Walk(nil, func(FileMeta) error { return stop }); !errors.Is(err, stop) {
+		t.Fatalf("expected stop, got %v", err)
+	}
+	if _, err := a.Stat("a"); err != nil {
+		t.Fatalf("stat after aborted walk: %v", err)
+	}
+}
+
+func TestRemoteFSFallsBackWithoutAgent(t *testing.T) {
+	r := NewRemoteFS(Endpoint{Type: EndpointRemote, Host: "example.invalid", Path: "/data"})
+	if r.agentFS() != nil {
+		t.Fatalf("agent should be disabled when SSHOptions.Agent is empty")
+	}
+}
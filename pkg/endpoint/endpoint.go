@@ -3,18 +3,32 @@ package endpoint
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
 )
 
-// EndpointType 表示端点类型：本地或远程
+// EndpointType 表示端点类型：本地、SSH 远程或对象存储
 type EndpointType int
 
 const (
 	EndpointLocal EndpointType = iota
 	EndpointRemote
+	// EndpointS3 为 s3://bucket/prefix 形式的 S3 兼容对象存储，Host 为 bucket，Path 为前缀
+	EndpointS3
+	// EndpointWebDAV 为 webdav://[user@]host[:port]/path 形式的 WebDAV 服务，Secure 表示 webdavs
+	EndpointWebDAV
+	// EndpointTar 为 tar://path/out.tar[.gz] 形式的本地归档文件，只能作为目标
+	EndpointTar
+)
+
+const (
+	s3Scheme      = "s3://"
+	webdavScheme  = "webdav://"
+	webdavsScheme = "webdavs://"
+	tarScheme     = "tar://"
 )
 
 // BackupMode 定义备份模式
@@ -23,6 +37,8 @@ type BackupMode string
 const (
 	ModeFull BackupMode = "full"
 	ModeIncr BackupMode = "incr"
+	// ModeSync 为双向同步：两端的改动互相传播，冲突时保留两个版本
+	ModeSync BackupMode = "sync"
 )
 
 // ChecksumAlgo 定义校验算法类型
@@ -40,6 +56,8 @@ type SSHOptions struct {
 	Port      int
 	Identity  string
 	ExtraOpts []string
+	// Agent 为远端 zbackup 可执行文件（可带路径），存在时通过 `serve --stdio` 访问远端；为空则只用 shell 命令
+	Agent string
 }
 
 // Endpoint 表示备份操作中的一端
@@ -49,6 +67,8 @@ type Endpoint struct {
 	Host    string
 	Path    string
 	SSHOpts SSHOptions
+	// Secure 表示通过 TLS 访问（webdavs://）
+	Secure bool
 }
 
 var remotePattern = regexp.MustCompile(`^([a-zA-Z0-9_\-\.]+@)?[^:]+:.+`)
@@ -60,6 +80,44 @@ func ParseEndpoint(raw string, port int, sshOpts SSHOptions) (Endpoint, error) {
 		return Endpoint{}, errors.New("空路径")
 	}
 
+	if strings.HasPrefix(raw, s3Scheme) {
+		bucket, prefix, _ := strings.Cut(strings.TrimPrefix(raw, s3Scheme), "/")
+		if bucket == "" {
+			return Endpoint{}, fmt.Errorf("s3 路径缺少 bucket: %s", raw)
+		}
+		return Endpoint{
+			Type: EndpointS3,
+			Host: bucket,
+			Path: strings.Trim(prefix, "/"),
+		}, nil
+	}
+
+	if strings.HasPrefix(raw, tarScheme) {
+		file := strings.TrimPrefix(raw, tarScheme)
+		if file == "" {
+			return Endpoint{}, fmt.Errorf("tar 路径缺少文件名: %s", raw)
+		}
+		return Endpoint{Type: EndpointTar, Path: filepath.Clean(file)}, nil
+	}
+
+	if strings.HasPrefix(raw, webdavScheme) || strings.HasPrefix(raw, webdavsScheme) {
+		secure := strings.HasPrefix(raw, webdavsScheme)
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return Endpoint{}, fmt.Errorf("WebDAV 路径格式非法: %s", raw)
+		}
+		if _, hasPassword := u.User.Password(); hasPassword {
+			return Endpoint{}, errors.New("WebDAV 密码请通过环境变量 ZBACKUP_WEBDAV_PASSWORD 提供，不要写在路径中")
+		}
+		return Endpoint{
+			Type:   EndpointWebDAV,
+			User:   u.User.Username(),
+			Host:   u.Host,
+			Path:   "/" + strings.Trim(u.Path, "/"),
+			Secure: secure,
+		}, nil
+	}
+
 	if remotePattern.MatchString(raw) {
 		colonIdx := strings.Index(raw, ":")
 		if colonIdx <= 0 || colonIdx == len(raw)-1 {
@@ -86,6 +144,7 @@ func ParseEndpoint(raw string, port int, sshOpts SSHOptions) (Endpoint, error) {
 				Port:      sshOpts.Port,
 				Identity:  sshOpts.Identity,
 				ExtraOpts: append([]string{}, sshOpts.ExtraOpts...),
+				Agent:     sshOpts.Agent,
 			},
 		}, nil
 	}
@@ -103,7 +162,7 @@ func ParseEndpoint(raw string, port int, sshOpts SSHOptions) (Endpoint, error) {
 
 // Join 构造子路径，兼容不同端点
 func (e Endpoint) Join(elem ...string) string {
-	if e.Type == EndpointRemote {
+	if e.Type != EndpointLocal {
 		return path.Join(append([]string{e.Path}, elem...)...)
 	}
 	return filepath.Join(append([]string{e.Path}, elem...)...)
@@ -111,6 +170,19 @@ func (e Endpoint) Join(elem ...string) string {
 
 // DisplayName 返回用于日志/进度显示的端点名
 func (e Endpoint) DisplayName() string {
+	if e.Type == EndpointS3 {
+		return s3Scheme + path.Join(e.Host, e.Path)
+	}
+	if e.Type == EndpointTar {
+		return tarScheme + e.Path
+	}
+	if e.Type == EndpointWebDAV {
+		scheme := webdavScheme
+		if e.Secure {
+			scheme = webdavsScheme
+		}
+		return scheme + e.Host + e.Path
+	}
 	if e.Type == EndpointRemote {
 		target := e.Host
 		if e.User != "" {
@@ -10,4 +10,7 @@ type FileMeta struct {
 	ModTime  time.Time `json:"mod_time"`
 	Checksum string    `json:"checksum,omitempty"`
 	IsDir    bool      `json:"is_dir"`
+	Sparse   bool      `json:"sparse,omitempty"`
+	// Chunks 仅用于分块存储模式：文件内容依次由这些数据块（内容的 SHA-256）拼接而成
+	Chunks []string `json:"chunks,omitempty"`
 }
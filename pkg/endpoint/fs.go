@@ -2,6 +2,7 @@ package endpoint
 
 import (
 	"errors"
+	"hash"
 	"io"
 	"io/fs"
 )
@@ -10,6 +11,8 @@ import (
 type FileSystem interface {
 	Root() string
 	List(excludes []string) ([]FileMeta, error)
+	// Walk 流式遍历所有条目，保证目录先于其内部条目返回；fn 返回错误时立即停止
+	Walk(excludes []string, fn func(FileMeta) error) error
 	Open(relPath string) (io.ReadCloser, error)
 	Create(relPath string, perm fs.FileMode) (io.WriteCloser, error)
 	MkdirAll(relPath string) error
@@ -18,5 +21,76 @@ type FileSystem interface {
 	Close() error
 }
 
+// collectWalk 基于 Walk 收集完整列表
+func collectWalk(fs FileSystem, excludes []string) ([]FileMeta, error) {
+	var metas []FileMeta
+	err := fs.Walk(excludes, func(meta FileMeta) error {
+		metas = append(metas, meta)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return metas, nil
+}
+
 // ErrNotImplemented 用于表示某些操作尚未支持
 var ErrNotImplemented = errors.New("not implemented")
+
+// ExclusiveFS 表示支持“仅当文件不存在时才创建”的原子写入能力，
+// 文件已存在时返回的错误满足 errors.Is(err, fs.ErrExist)
+type ExclusiveFS interface {
+	WriteExclusive(relPath string, data []byte, perm fs.FileMode) error
+}
+
+// DirLister 表示能列出单个目录直接子项的文件系统，返回的 RelPath 为子项名称
+type DirLister interface {
+	ReadDir(relPath string) ([]FileMeta, error)
+}
+
+// AppendFS 表示支持追加写入的文件系统，返回的 writer 在关闭前可持续写入
+type AppendFS interface {
+	Append(relPath string) (io.WriteCloser, error)
+}
+
+// UploadHasher 表示能按实际上传的数据流计算校验和的 writer。执行器在写入前调用 HashUpload，
+// Close 成功后以 h 的结果作为目标端校验和，不再把刚上传的文件读回计算
+type UploadHasher interface {
+	HashUpload(h hash.Hash)
+}
+
+// Aborter 表示可以放弃写入的 writer：已写入的内容被丢弃，目标保持原状。
+// 复制失败时应调用 Abort 而不是 Close，避免以部分内容覆盖目标
+type Aborter interface {
+	Abort()
+}
+
+// errWriteAborted 为放弃写入后 writer 返回的错误
+var errWriteAborted = errors.New("write aborted")
+
+// Renamer 表示支持在同一文件系统内重命名的文件系统，目标已存在时被原子替换
+type Renamer interface {
+	Rename(oldRel, newRel string) error
+}
+
+// Linker 表示支持在同一文件系统内创建硬链接的文件系统，目标已存在时返回 fs.ErrExist
+type Linker interface {
+	Link(oldRel, newRel string) error
+}
+
+// CommandRunner 表示能在端点所在主机上执行 shell 脚本的文件系统，用于创建文件系统快照等操作
+type CommandRunner interface {
+	// RunCommand 以 sh 执行脚本并返回标准输出，失败时错误中带有标准错误的内容
+	RunCommand(script string) ([]byte, error)
+}
+
+// BatchStater 表示能一次查询多个条目元数据的文件系统，避免逐个 stat 的往返开销；
+// 不存在的条目不出现在返回结果中
+type BatchStater interface {
+	StatBatch(relPaths []string) (map[string]FileMeta, error)
+}
+
+// MountChecker 表示能判断根目录是否为挂载点的文件系统，用于确认源端磁盘已挂载
+type MountChecker interface {
+	IsMountPoint() (bool, error)
+}
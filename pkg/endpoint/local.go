@@ -5,6 +5,7 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
 )
 
@@ -23,8 +24,12 @@ func (l *LocalFS) Root() string {
 }
 
 func (l *LocalFS) List(excludes []string) ([]FileMeta, error) {
-	var metas []FileMeta
-	err := filepath.WalkDir(l.root, func(fullPath string, entry fs.DirEntry, err error) error {
+	return collectWalk(l, excludes)
+}
+
+// Walk 按 filepath.WalkDir 的字典序前序遍历，目录总是先于其内容返回
+func (l *LocalFS) Walk(excludes []string, fn func(FileMeta) error) error {
+	return filepath.WalkDir(l.root, func(fullPath string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -49,16 +54,38 @@ func (l *LocalFS) List(excludes []string) ([]FileMeta, error) {
 			Mode:    uint32(info.Mode()),
 			ModTime: info.ModTime(),
 			IsDir:   info.IsDir(),
+			Sparse:  isSparse(info),
 		}
 		if info.IsDir() {
 			meta.Size = 0
 		}
-		metas = append(metas, meta)
-		return nil
+		return fn(meta)
 	})
+}
+
+func (l *LocalFS) ReadDir(relPath string) ([]FileMeta, error) {
+	entries, err := os.ReadDir(filepath.Join(l.root, relPath))
 	if err != nil {
 		return nil, err
 	}
+	metas := make([]FileMeta, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		meta := FileMeta{
+			RelPath: entry.Name(),
+			Size:    info.Size(),
+			Mode:    uint32(info.Mode()),
+			ModTime: info.ModTime(),
+			IsDir:   info.IsDir(),
+		}
+		if info.IsDir() {
+			meta.Size = 0
+		}
+		metas = append(metas, meta)
+	}
 	return metas, nil
 }
 
@@ -75,6 +102,50 @@ func (l *LocalFS) Create(relPath string, perm fs.FileMode) (io.WriteCloser, erro
 	return os.OpenFile(full, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
 }
 
+func (l *LocalFS) DataRegions(relPath string) ([]Region, error) {
+	return dataRegions(filepath.Join(l.root, relPath))
+}
+
+func (l *LocalFS) CreateSparse(relPath string, perm fs.FileMode, size int64, regions []Region) (io.WriteCloser, error) {
+	full := filepath.Join(l.root, relPath)
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(full, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return nil, err
+	}
+	return newSparseFileWriter(file, size, regions), nil
+}
+
+func (l *LocalFS) WriteExclusive(relPath string, data []byte, perm fs.FileMode) error {
+	full := filepath.Join(l.root, relPath)
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(full, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (l *LocalFS) Append(relPath string) (io.WriteCloser, error) {
+	full := filepath.Join(l.root, relPath)
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(full, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+}
+
+func (l *LocalFS) RunCommand(script string) ([]byte, error) {
+	return commandOutput(exec.Command("sh", "-c", script))
+}
+
 func (l *LocalFS) MkdirAll(relPath string) error {
 	full := filepath.Join(l.root, relPath)
 	return os.MkdirAll(full, 0o755)
@@ -85,6 +156,22 @@ func (l *LocalFS) Remove(relPath string) error {
 	return os.RemoveAll(full)
 }
 
+func (l *LocalFS) Rename(oldRel, newRel string) error {
+	dst := filepath.Join(l.root, newRel)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(filepath.Join(l.root, oldRel), dst)
+}
+
+func (l *LocalFS) Link(oldRel, newRel string) error {
+	dst := filepath.Join(l.root, newRel)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return os.Link(filepath.Join(l.root, oldRel), dst)
+}
+
 func (l *LocalFS) Stat(relPath string) (FileMeta, error) {
 	full := filepath.Join(l.root, relPath)
 	info, err := os.Stat(full)
@@ -98,6 +185,7 @@ func (l *LocalFS) Stat(relPath string) (FileMeta, error) {
 		Mode:    uint32(info.Mode()),
 		ModTime: info.ModTime(),
 		IsDir:   info.IsDir(),
+		Sparse:  isSparse(info),
 	}, nil
 }
 
@@ -1,6 +1,7 @@
 package endpoint
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -35,3 +36,52 @@ func TestLocalFSListSpecialNames(t *testing.T) {
 		t.Fatalf("missing entries dir=%v file=%v metas=%+v", foundDir, foundFile, metas)
 	}
 }
+
+func TestLocalFSWalkYieldsDirsBeforeContents(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmp, "a", "b"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "a", "b", "c.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	seen := make(map[string]int)
+	idx := 0
+	err := NewLocalFS(tmp).Walk(nil, func(m FileMeta) error {
+		seen[m.RelPath] = idx
+		idx++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+	if !(seen["a"] < seen["a/b"] && seen["a/b"] < seen["a/b/c.txt"]) {
+		t.Fatalf("unexpected order: %v", seen)
+	}
+	stop := errors.New("stop")
+	calls := 0
+	err = NewLocalFS(tmp).Walk(nil, func(m FileMeta) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("walk should stop on callback error, err=%v calls=%d", err, calls)
+	}
+}
+
+func TestLocalFSIsMountPoint(t *testing.T) {
+	if mounted, err := NewLocalFS("/").IsMountPoint(); err != nil || !mounted {
+		if errors.Is(err, ErrNotImplemented) {
+			t.Skip("mount point check unsupported")
+		}
+		t.Fatalf("/ should be a mount point: %v %v", mounted, err)
+	}
+	dir := filepath.Join(t.TempDir(), "sub")
+	os.Mkdir(dir, 0o755)
+	if mounted, err := NewLocalFS(dir).IsMountPoint(); err != nil || mounted {
+		t.Fatalf("plain directory should not be a mount point: %v %v", mounted, err)
+	}
+	if _, err := NewLocalFS(filepath.Join(dir, "missing")).IsMountPoint(); err == nil {
+		t.Fatalf("missing root should fail")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package endpoint
+
+import "fmt"
+
+// IsMountPoint 在非 Unix 平台上不可用
+func (l *LocalFS) IsMountPoint() (bool, error) {
+	return false, fmt.Errorf("当前平台不支持挂载点检查: %w", ErrNotImplemented)
+}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package endpoint
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// IsMountPoint 比较根目录与其上级目录所在的设备；绑定挂载同一文件系统的目录无法识别
+func (l *LocalFS) IsMountPoint() (bool, error) {
+	root, err := filepath.Abs(l.root)
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return false, err
+	}
+	parent, err := os.Stat(filepath.Dir(root))
+	if err != nil {
+		return false, err
+	}
+	st, ok1 := info.Sys().(*syscall.Stat_t)
+	pst, ok2 := parent.Sys().(*syscall.Stat_t)
+	if !ok1 || !ok2 {
+		return false, ErrNotImplemented
+	}
+	// 文件系统根目录的上级就是自身
+	return st.Dev != pst.Dev || st.Ino == pst.Ino, nil
+}
@@ -17,6 +17,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -25,6 +26,11 @@ type RemoteFS struct {
 	endpoint    Endpoint
 	controlPath string
 	hashCaps    map[ChecksumAlgo]hashCapability
+	sparseCap   hashCapability
+
+	agentMu  sync.Mutex
+	agent    *agentFS
+	agentCap hashCapability
 }
 
 type hashCapability struct {
@@ -54,31 +60,34 @@ func (r *RemoteFS) Root() string {
 }
 
 func (r *RemoteFS) List(excludes []string) ([]FileMeta, error) {
-	metas, unsupported, err := r.listWithFindPrintf(excludes)
-	if err == nil {
-		return metas, nil
-	}
-	if unsupported {
-		return r.listWithFindStat(excludes)
-	}
-	return nil, err
+	return collectWalk(r, excludes)
 }
 
-func (r *RemoteFS) listWithFindPrintf(excludes []string) ([]FileMeta, bool, error) {
-	script := fmt.Sprintf("cd %s && find . -mindepth 1 -printf '%%P|%%s|%%T@|%%m|%%y\\n'", shellQuote(r.endpoint.Path))
-	output, err := r.runSSHCommand(script)
-	if err != nil {
-		if isFindPrintfUnsupported(output) {
-			return nil, true, fmt.Errorf("远端 find 不支持 -printf")
+// Walk 流式读取远端 find 的输出，边扫描边回调；find 为前序遍历，目录先于其内容返回
+func (r *RemoteFS) Walk(excludes []string, fn func(FileMeta) error) error {
+	if a := r.agentFS(); a != nil {
+		return a.Walk(excludes, fn)
+	}
+	script := fmt.Sprintf("cd %s && find . -mindepth 1 -printf '%%P|%%s|%%T@|%%m|%%y|%%S\\n'", shellQuote(r.endpoint.Path))
+	yielded, stderr, err := r.streamList(script, excludes, fn)
+	if err == nil {
+		return nil
+	}
+	if yielded == 0 && isFindPrintfUnsupported(stderr) {
+		_, stderr, err = r.streamList(r.findStatScript(), excludes, fn)
+		if err == nil {
+			return nil
 		}
-		return nil, false, fmt.Errorf("远端列举失败: %w: %s", err, string(output))
 	}
-	metas, err := parseRemoteListOutput(output, excludes)
-	return metas, false, err
+	if len(stderr) > 0 {
+		return fmt.Errorf("远端列举失败: %w: %s", err, strings.TrimSpace(string(stderr)))
+	}
+	return err
 }
 
-func (r *RemoteFS) listWithFindStat(excludes []string) ([]FileMeta, error) {
-	script := fmt.Sprintf(`cd %[1]s && find . -mindepth 1 -print0 | while IFS= read -r -d '' file; do
+// findStatScript 用于不支持 find -printf 的远端，逐个调用 stat
+func (r *RemoteFS) findStatScript() string {
+	return fmt.Sprintf(`cd %[1]s && find . -mindepth 1 -print0 | while IFS= read -r -d '' file; do
 rel="${file#./}"
 [ -z "$rel" ] && continue
 stat_out=$(stat -c '%%s|%%Y|%%f' "$file" 2>/dev/null || stat -f '%%z|%%m|%%p' "$file" 2>/dev/null)
@@ -86,27 +95,101 @@ stat_out=$(stat -c '%%s|%%Y|%%f' "$file" 2>/dev/null || stat -f '%%z|%%m|%%p' "$
 if [ -d "$file" ]; then type="d"; else type="f"; fi
 printf '%%s|%%s|%%s\n' "$rel" "$stat_out" "$type"
 done`, shellQuote(r.endpoint.Path))
+}
+
+// streamList 执行列举脚本并逐行解析，回调返回错误时终止远端命令
+func (r *RemoteFS) streamList(script string, excludes []string, fn func(FileMeta) error) (int, []byte, error) {
+	cmd := r.sshCommand(script)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, nil, err
+	}
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return 0, nil, err
+	}
+	yielded := 0
+	var fnErr error
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		meta, ok := parseRemoteLine(scanner.Text())
+		if !ok || shouldExclude(meta.RelPath, excludes) {
+			continue
+		}
+		if fnErr = fn(meta); fnErr != nil {
+			break
+		}
+		yielded++
+	}
+	scanErr := scanner.Err()
+	if fnErr != nil || scanErr != nil {
+		_ = cmd.Process.Kill()
+	}
+	waitErr := cmd.Wait()
+	switch {
+	case fnErr != nil:
+		return yielded, nil, fnErr
+	case scanErr != nil:
+		return yielded, stderr.Bytes(), scanErr
+	case waitErr != nil:
+		return yielded, stderr.Bytes(), waitErr
+	}
+	return yielded, nil, nil
+}
+
+func (r *RemoteFS) ReadDir(relPath string) ([]FileMeta, error) {
+	if a := r.agentFS(); a != nil {
+		return a.ReadDir(relPath)
+	}
+	remote := path.Join(r.endpoint.Path, filepathToPosix(relPath))
+	script := fmt.Sprintf("find %s -mindepth 1 -maxdepth 1 -printf '%%P|%%s|%%T@|%%m|%%y\\n'", shellQuote(remote))
 	output, err := r.runSSHCommand(script)
+	if err == nil {
+		return parseRemoteListOutput(output, nil)
+	}
+	if !isFindPrintfUnsupported(output) {
+		return nil, fmt.Errorf("远端列举目录失败: %w: %s", err, string(output))
+	}
+	// BusyBox 等环境退化为 ls，只能得到名称与类型
+	output, err = r.runSSHCommand(fmt.Sprintf("ls -1Ap %s", shellQuote(remote)))
 	if err != nil {
-		return nil, fmt.Errorf("远端列举失败: %w: %s", err, string(output))
+		return nil, fmt.Errorf("远端列举目录失败: %w: %s", err, string(output))
+	}
+	var metas []FileMeta
+	for _, line := range strings.Split(string(output), "\n") {
+		if line == "" {
+			continue
+		}
+		isDir := strings.HasSuffix(line, "/")
+		metas = append(metas, FileMeta{RelPath: strings.TrimSuffix(line, "/"), IsDir: isDir})
 	}
-	return parseRemoteListOutput(output, excludes)
+	return metas, nil
 }
 
 func (r *RemoteFS) Open(relPath string) (io.ReadCloser, error) {
+	if a := r.agentFS(); a != nil {
+		return a.Open(relPath)
+	}
 	remote := path.Join(r.endpoint.Path, filepathToPosix(relPath))
 	cmd := r.sshCommand(fmt.Sprintf("cat %s", shellQuote(remote)))
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return nil, err
 	}
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
 	if err := cmd.Start(); err != nil {
 		return nil, err
 	}
-	return &cmdReadCloser{Cmd: cmd, Reader: stdout}, nil
+	return &cmdReadCloser{Cmd: cmd, Reader: stdout, Stderr: stderr}, nil
 }
 
 func (r *RemoteFS) Create(relPath string, perm fs.FileMode) (io.WriteCloser, error) {
+	if a := r.agentFS(); a != nil {
+		return a.Create(relPath, perm)
+	}
 	remote := path.Join(r.endpoint.Path, filepathToPosix(relPath))
 	dir := path.Dir(remote)
 	script := fmt.Sprintf("mkdir -p %s && cat > %s && chmod %04o %s",
@@ -122,19 +205,144 @@ func (r *RemoteFS) Create(relPath string, perm fs.FileMode) (io.WriteCloser, err
 	return &cmdWriteCloser{Cmd: cmd, Writer: stdin}, nil
 }
 
+// maxRemoteRegions 限制单次远端稀疏写入脚本中的 dd 数量
+const maxRemoteRegions = 256
+
+// CreateSparse 在远端先用 truncate 建立带空洞的文件，再用 dd 把各数据区域写到对应偏移。
+// 远端缺少 GNU dd/truncate 时返回 ErrNotImplemented，调用方应回退为普通写入
+func (r *RemoteFS) CreateSparse(relPath string, perm fs.FileMode, size int64, regions []Region) (io.WriteCloser, error) {
+	if a := r.agentFS(); a != nil {
+		return a.CreateSparse(relPath, perm, size, regions)
+	}
+	if regions == nil || !r.supportsSparse() {
+		return nil, ErrNotImplemented
+	}
+	regions = mergeRegions(regions, maxRemoteRegions)
+	remote := path.Join(r.endpoint.Path, filepathToPosix(relPath))
+	target := shellQuote(remote)
+	var b strings.Builder
+	fmt.Fprintf(&b, "mkdir -p %s && : > %s && truncate -s %d %s", shellQuote(path.Dir(remote)), target, size, target)
+	for _, region := range regions {
+		fmt.Fprintf(&b, " && dd of=%s bs=65536 seek=%d count=%d iflag=fullblock,count_bytes oflag=seek_bytes conv=notrunc status=none",
+			target, region.Offset, region.Length)
+	}
+	fmt.Fprintf(&b, " && chmod %04o %s", perm&0o777, target)
+	cmd := r.sshCommand(b.String())
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &cmdWriteCloser{Cmd: cmd, Writer: stdin}, nil
+}
+
+func (r *RemoteFS) supportsSparse() bool {
+	if !r.sparseCap.known {
+		probe := "command -v truncate >/dev/null && dd if=/dev/null of=/dev/null bs=65536 count=0 iflag=fullblock,count_bytes oflag=seek_bytes status=none"
+		_, err := r.runSSHCommand(probe)
+		r.sparseCap = hashCapability{known: true, supported: err == nil}
+	}
+	return r.sparseCap.supported
+}
+
+// exclusiveExitCode 是 WriteExclusive 脚本在目标已存在时使用的退出码
+const exclusiveExitCode = 17
+
+func (r *RemoteFS) WriteExclusive(relPath string, data []byte, perm fs.FileMode) error {
+	if a := r.agentFS(); a != nil {
+		return a.WriteExclusive(relPath, data, perm)
+	}
+	remote := path.Join(r.endpoint.Path, filepathToPosix(relPath))
+	script := fmt.Sprintf("mkdir -p %[1]s && if ( set -C; cat > %[2]s ) 2>/dev/null; then chmod %04[3]o %[2]s; elif [ -e %[2]s ]; then exit %[4]d; else exit 1; fi",
+		shellQuote(path.Dir(remote)), shellQuote(remote), perm&0o777, exclusiveExitCode)
+	cmd := r.sshCommand(script)
+	cmd.Stdin = bytes.NewReader(data)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == exclusiveExitCode {
+			return fmt.Errorf("%s: %w", relPath, fs.ErrExist)
+		}
+		return fmt.Errorf("远端独占写入失败: %w: %s", err, string(output))
+	}
+	return nil
+}
+
+// Append 保持一个 ssh 会话执行 cat >>，写入的数据会立即送达远端
+func (r *RemoteFS) Append(relPath string) (io.WriteCloser, error) {
+	if a := r.agentFS(); a != nil {
+		return a.Append(relPath)
+	}
+	remote := path.Join(r.endpoint.Path, filepathToPosix(relPath))
+	script := fmt.Sprintf("mkdir -p %s && cat >> %s", shellQuote(path.Dir(remote)), shellQuote(remote))
+	cmd := r.sshCommand(script)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &cmdWriteCloser{Cmd: cmd, Writer: stdin}, nil
+}
+
 func (r *RemoteFS) MkdirAll(relPath string) error {
+	if a := r.agentFS(); a != nil {
+		return a.MkdirAll(relPath)
+	}
 	remote := path.Join(r.endpoint.Path, filepathToPosix(relPath))
 	_, err := r.runSSHCommand(fmt.Sprintf("mkdir -p %s", shellQuote(remote)))
 	return err
 }
 
 func (r *RemoteFS) Remove(relPath string) error {
+	if a := r.agentFS(); a != nil {
+		return a.Remove(relPath)
+	}
 	remote := path.Join(r.endpoint.Path, filepathToPosix(relPath))
 	_, err := r.runSSHCommand(fmt.Sprintf("rm -rf %s", shellQuote(remote)))
 	return err
 }
 
+func (r *RemoteFS) Rename(oldRel, newRel string) error {
+	if a := r.agentFS(); a != nil {
+		return a.Rename(oldRel, newRel)
+	}
+	from := path.Join(r.endpoint.Path, filepathToPosix(oldRel))
+	to := path.Join(r.endpoint.Path, filepathToPosix(newRel))
+	output, err := r.runSSHCommand(fmt.Sprintf("mkdir -p %s && mv -f %s %s", shellQuote(path.Dir(to)), shellQuote(from), shellQuote(to)))
+	if err != nil {
+		return fmt.Errorf("远端重命名失败: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Link 在远端执行 ln 创建硬链接，目标已存在时以 exclusiveExitCode 退出
+func (r *RemoteFS) Link(oldRel, newRel string) error {
+	if a := r.agentFS(); a != nil {
+		return a.Link(oldRel, newRel)
+	}
+	from := path.Join(r.endpoint.Path, filepathToPosix(oldRel))
+	to := path.Join(r.endpoint.Path, filepathToPosix(newRel))
+	script := fmt.Sprintf("mkdir -p %[1]s && if [ -e %[3]s ] || [ -L %[3]s ]; then exit %[4]d; fi && ln %[2]s %[3]s",
+		shellQuote(path.Dir(to)), shellQuote(from), shellQuote(to), exclusiveExitCode)
+	output, err := r.runSSHCommand(script)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == exclusiveExitCode {
+			return fmt.Errorf("%s: %w", newRel, fs.ErrExist)
+		}
+		return fmt.Errorf("远端创建硬链接失败: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
 func (r *RemoteFS) Stat(relPath string) (FileMeta, error) {
+	if a := r.agentFS(); a != nil {
+		return a.Stat(relPath)
+	}
 	remote := path.Join(r.endpoint.Path, filepathToPosix(relPath))
 	script := fmt.Sprintf("stat -c '%%s|%%Y|%%f|%%F' %s 2>/dev/null || stat -f '%%z|%%m|%%p|%%HT' %s", shellQuote(remote), shellQuote(remote))
 	out, err := r.runSSHCommand(script)
@@ -159,6 +367,114 @@ func (r *RemoteFS) Stat(relPath string) (FileMeta, error) {
 	}, nil
 }
 
+// StatBatch 查询多个条目的大小、修改时间与权限：使用 agent 时在同一会话中逐个查询，
+// 否则通过一次 ssh 执行批量脚本，每个条目输出一行，不存在的条目输出 "-"
+func (r *RemoteFS) StatBatch(relPaths []string) (map[string]FileMeta, error) {
+	if a := r.agentFS(); a != nil {
+		metas := make(map[string]FileMeta, len(relPaths))
+		for _, rel := range relPaths {
+			meta, err := a.Stat(rel)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			metas[rel] = meta
+		}
+		return metas, nil
+	}
+	remotes := make([]string, len(relPaths))
+	for i, rel := range relPaths {
+		remotes[i] = path.Join(r.endpoint.Path, filepathToPosix(rel))
+	}
+	// 脚本经标准输入交给远端 sh：命令行参数受单个参数 128 KiB 的上限约束，深层路径较多时会超出
+	cmd := r.sshCommand("sh -s")
+	cmd.Stdin = strings.NewReader(statBatchScript(remotes))
+	out, err := commandOutput(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return parseStatBatch(out, relPaths)
+}
+
+// statBatchScript 生成依次 stat 各路径的脚本，每个路径输出一行 "大小|修改时间|权限"，不存在时输出 "-"；
+// 脚本从标准输入读取执行，长度不受命令行参数限制
+func statBatchScript(paths []string) string {
+	var script strings.Builder
+	script.WriteString("for f in")
+	for _, p := range paths {
+		script.WriteString(" " + shellQuote(p))
+	}
+	script.WriteString(`; do s=$(stat -c '%s|%Y|%f' "$f" 2>/dev/null || stat -f '%z|%m|%p' "$f" 2>/dev/null); printf '%s\n' "${s:--}"; done`)
+	return script.String()
+}
+
+// parseStatBatch 按 relPaths 的顺序解析 statBatchScript 的输出
+func parseStatBatch(out []byte, relPaths []string) (map[string]FileMeta, error) {
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if len(lines) != len(relPaths) {
+		return nil, fmt.Errorf("stat 输出 %d 行，预期 %d 行", len(lines), len(relPaths))
+	}
+	metas := make(map[string]FileMeta, len(relPaths))
+	for i, line := range lines {
+		if line == "-" {
+			continue
+		}
+		parts := strings.Split(line, "|")
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("stat output invalid: %s", line)
+		}
+		size, _ := strconv.ParseInt(parts[0], 10, 64)
+		metas[relPaths[i]] = FileMeta{
+			RelPath: relPaths[i],
+			Size:    size,
+			Mode:    parseMode(parts[2]),
+			ModTime: parseEpoch(parts[1]),
+		}
+	}
+	return metas, nil
+}
+
+// IsMountPoint 优先使用远端的 mountpoint 命令，没有时比较根目录与上级目录的设备号
+func (r *RemoteFS) IsMountPoint() (bool, error) {
+	root := shellQuote(r.endpoint.Path)
+	script := fmt.Sprintf(`p=%[1]s; [ -d "$p" ] || { echo missing; exit 0; }
+if command -v mountpoint >/dev/null 2>&1; then mountpoint -q "$p" && echo yes || echo no; exit 0; fi
+d=$(stat -c %%d "$p" 2>/dev/null || stat -f %%d "$p"); u=$(stat -c %%d "$p/.." 2>/dev/null || stat -f %%d "$p/..")
+[ "$d" != "$u" ] && echo yes || echo no`, root)
+	out, err := r.runSSHCommand(script)
+	if err != nil {
+		return false, fmt.Errorf("远端挂载点检查失败: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	switch strings.TrimSpace(string(out)) {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	case "missing":
+		return false, fmt.Errorf("%s: %w", r.endpoint.Path, fs.ErrNotExist)
+	default:
+		return false, fmt.Errorf("远端挂载点检查输出异常: %s", strings.TrimSpace(string(out)))
+	}
+}
+
+// RunCommand 通过 ssh 在远端执行脚本，不经过 agent
+func (r *RemoteFS) RunCommand(script string) ([]byte, error) {
+	return commandOutput(r.sshCommand(script))
+}
+
+// commandOutput 运行命令并返回标准输出，失败时把标准错误附在错误中
+func commandOutput(cmd *exec.Cmd) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return out, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
 func (r *RemoteFS) runSSHCommand(cmd string) ([]byte, error) {
 	command := r.sshCommand(cmd)
 	return command.CombinedOutput()
@@ -221,8 +537,82 @@ func targetHost(ep Endpoint) string {
 	return target
 }
 
-// Close 关闭 SSH 控制连接
+// agentFS 返回可用的远端 agent；远端没有 zbackup 或版本不兼容时返回 nil，调用方回退为 shell 命令。
+// 探测结果会被缓存，ssh 连接本身失败时不缓存，留待下次重试
+func (r *RemoteFS) agentFS() *agentFS {
+	if r.endpoint.SSHOpts.Agent == "" {
+		return nil
+	}
+	r.agentMu.Lock()
+	defer r.agentMu.Unlock()
+	if r.agentCap.known {
+		return r.agent
+	}
+	a := newAgentFS(r.endpoint.Path, r.startAgent)
+	s, err := a.get()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == sshConnectionFailureCode {
+			return nil
+		}
+		r.agentCap = hashCapability{known: true, supported: false}
+		return nil
+	}
+	a.put(s)
+	r.agent = a
+	r.agentCap = hashCapability{known: true, supported: true}
+	return a
+}
+
+// UsingAgent 返回是否正通过远端 agent 访问
+func (r *RemoteFS) UsingAgent() bool {
+	return r.agentFS() != nil
+}
+
+// startAgent 通过 ssh 启动远端 `zbackup serve --stdio`
+func (r *RemoteFS) startAgent() (*agentSession, error) {
+	cmd := r.sshCommand(r.endpoint.SSHOpts.Agent + " serve --stdio")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &agentSession{
+		r: bufio.NewReaderSize(stdout, agentChunkSize),
+		w: bufio.NewWriterSize(stdin, agentChunkSize),
+		close: func(kill bool) error {
+			stdin.Close()
+			if kill {
+				_ = cmd.Process.Kill()
+				_ = cmd.Wait()
+				return nil
+			}
+			if err := cmd.Wait(); err != nil {
+				if stderr.Len() > 0 {
+					return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+				}
+				return err
+			}
+			return nil
+		},
+	}, nil
+}
+
+// Close 关闭 agent 会话与 SSH 控制连接
 func (r *RemoteFS) Close() error {
+	r.agentMu.Lock()
+	if r.agent != nil {
+		_ = r.agent.closeIdle(false)
+	}
+	r.agentMu.Unlock()
 	if r.controlPath == "" {
 		return nil
 	}
@@ -239,9 +629,33 @@ func (r *RemoteFS) Close() error {
 	return nil
 }
 
+// Reconnect 检查 ControlMaster 是否存活，失效时删除残留的 socket，
+// 使下一条 ssh 命令重新建立主连接
+func (r *RemoteFS) Reconnect() error {
+	r.agentMu.Lock()
+	if r.agent != nil {
+		// 空闲会话可能随连接一起失效，丢弃后按需重建
+		_ = r.agent.closeIdle(true)
+	}
+	r.agentMu.Unlock()
+	if r.controlPath == "" {
+		return nil
+	}
+	args := baseSSHArgs(r.endpoint, "")
+	args = append(args, "-S", r.controlPath, "-O", "check", targetHost(r.endpoint))
+	if err := exec.Command("ssh", args...).Run(); err == nil {
+		return nil
+	}
+	if err := os.Remove(r.controlPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
 type cmdReadCloser struct {
 	Cmd    *exec.Cmd
 	Reader io.ReadCloser
+	Stderr *bytes.Buffer
 }
 
 func (c *cmdReadCloser) Read(p []byte) (int, error) {
@@ -252,7 +666,13 @@ func (c *cmdReadCloser) Close() error {
 	if err := c.Reader.Close(); err != nil {
 		return err
 	}
-	return c.Cmd.Wait()
+	if err := c.Cmd.Wait(); err != nil {
+		if c.Stderr != nil && c.Stderr.Len() > 0 {
+			return fmt.Errorf("%w: %s", err, strings.TrimSpace(c.Stderr.String()))
+		}
+		return err
+	}
+	return nil
 }
 
 type cmdWriteCloser struct {
@@ -310,12 +730,20 @@ func parseRemoteLine(line string) (FileMeta, bool) {
 	mod := parseEpoch(parts[2])
 	mode := parseMode(parts[3])
 	isDir := strings.TrimSpace(parts[4]) == "d"
+	sparse := false
+	if len(parts) > 5 && !isDir && size > 0 {
+		// find -printf %S 输出占用块数与文件大小之比，小于 1 表示存在空洞
+		if ratio, err := strconv.ParseFloat(strings.TrimSpace(parts[5]), 64); err == nil && ratio < 1 {
+			sparse = true
+		}
+	}
 	return FileMeta{
 		RelPath: rel,
 		Size:    size,
 		Mode:    mode,
 		ModTime: mod,
 		IsDir:   isDir,
+		Sparse:  sparse,
 	}, true
 }
 
@@ -374,6 +802,9 @@ func (r *RemoteFS) ComputeRemoteHash(relPath string, algo ChecksumAlgo) ([]byte,
 	if algo == ChecksumNone {
 		return nil, errors.New("checksum none unsupported for remote hash")
 	}
+	if a := r.agentFS(); a != nil {
+		return a.Hash(relPath, algo)
+	}
 	cap := r.hashCaps[algo]
 	if cap.known && !cap.supported {
 		return nil, ErrHashCommandUnavailable
@@ -1,6 +1,11 @@
 package endpoint
 
 import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -61,3 +66,57 @@ func TestFindPrintfUnsupported(t *testing.T) {
 		t.Fatal("should not detect on normal text")
 	}
 }
+
+func TestStatBatchScript(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a b.txt"), []byte("hello"), 0o644)
+	mtime := time.Unix(1700000000, 0)
+	os.Chtimes(filepath.Join(dir, "a b.txt"), mtime, mtime)
+	rels := []string{"a b.txt", "missing's.txt"}
+	paths := []string{filepath.Join(dir, rels[0]), filepath.Join(dir, rels[1])}
+	metas, err := parseStatBatch(runStatBatchScript(t, paths), rels)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(metas) != 1 {
+		t.Fatalf("missing file should be left out: %+v", metas)
+	}
+	if meta := metas["a b.txt"]; meta.Size != 5 || !meta.ModTime.Equal(mtime) || meta.Mode&0o777 != 0o644 {
+		t.Fatalf("unexpected meta %+v", meta)
+	}
+	if _, err := parseStatBatch([]byte("5|1700000000|81a4\n"), rels); err == nil {
+		t.Fatalf("short output should fail")
+	}
+}
+
+// runStatBatchScript 与 StatBatch 一样经标准输入执行脚本
+func runStatBatchScript(t *testing.T, paths []string) []byte {
+	t.Helper()
+	cmd := exec.Command("sh", "-s")
+	cmd.Stdin = strings.NewReader(statBatchScript(paths))
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("run script: %v", err)
+	}
+	return out
+}
+
+func TestStatBatchScriptDeepPaths(t *testing.T) {
+	rel := filepath.Join(strings.Repeat("a", 250), strings.Repeat("b", 250), strings.Repeat("c", 250), strings.Repeat("d", 250), "f.txt")
+	full := filepath.Join(t.TempDir(), rel)
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(full, []byte("x"), 0o644)
+	// 一批 128 个深层路径合计超过 128 KiB，放进命令行参数会失败
+	rels := make([]string, 128)
+	paths := make([]string, 128)
+	for i := range rels {
+		rels[i] = fmt.Sprintf("%d/%s", i, rel)
+		paths[i] = full
+	}
+	metas, err := parseStatBatch(runStatBatchScript(t, paths), rels)
+	if err != nil || len(metas) != len(rels) {
+		t.Fatalf("deep batch: %d metas, %v", len(metas), err)
+	}
+}
@@ -0,0 +1,51 @@
+package endpoint
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// sshConnectionFailureCode 是 ssh 自身（而非远端命令）失败时的退出码
+const sshConnectionFailureCode = 255
+
+// Reconnector 表示可以检测并重建底层连接的文件系统
+type Reconnector interface {
+	Reconnect() error
+}
+
+// IsTransient 判断错误是否由连接中断等暂时性问题引起，可以重试
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == sshConnectionFailureCode {
+		return true
+	}
+	var transient interface{ Transient() bool }
+	if errors.As(err, &transient) && transient.Transient() {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ETIMEDOUT) {
+		return true
+	}
+	text := strings.ToLower(err.Error())
+	for _, marker := range []string{
+		"connection reset",
+		"broken pipe",
+		"connection closed",
+		"timed out",
+		"connection refused",
+		"kex_exchange_identification",
+		"mux_client",
+		"control socket",
+		"unexpected eof",
+	} {
+		if strings.Contains(text, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+func TestIsTransient(t *testing.T) {
+	if !IsTransient(fmt.Errorf("copy: %w", syscall.ECONNRESET)) {
+		t.Fatal("ECONNRESET should be transient")
+	}
+	if !IsTransient(errors.New("exit status 255: Connection closed by 10.0.0.1 port 22")) {
+		t.Fatal("ssh connection closed should be transient")
+	}
+	if IsTransient(errors.New("cat: a.txt: Permission denied")) {
+		t.Fatal("permission denied should not be transient")
+	}
+	if IsTransient(nil) {
+		t.Fatal("nil is not transient")
+	}
+	err := exec.Command("sh", "-c", "exit 255").Run()
+	if err != nil && !IsTransient(err) {
+		t.Fatal("ssh exit code 255 should be transient")
+	}
+}
@@ -0,0 +1,684 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// s3PartSize 为分段上传的分段大小，文件不超过该大小时使用单次 PUT
+	s3PartSize = 16 << 20
+	// s3ListPageSize 为单次 ListObjectsV2 请求的最大条目数
+	s3ListPageSize = 1000
+	// s3ResponseTimeout 为请求发出后等待响应头的最长时间，服务端无响应时请求失败而不是一直挂起
+	s3ResponseTimeout = time.Minute
+	// s3IdleConnTimeout 为空闲连接的保留时间，超时后关闭，避免复用已被中间设备断开的连接
+	s3IdleConnTimeout = 30 * time.Second
+)
+
+// ErrS3ETagMismatch 表示对象存储返回的 ETag 与本地计算的 MD5 不一致
+var ErrS3ETagMismatch = errors.New("对象 ETag 与上传内容不一致")
+
+// S3Config 描述 S3 兼容对象存储的访问参数
+type S3Config struct {
+	// Endpoint 为自建服务（MinIO 等）的地址，如 http://127.0.0.1:9000；为空时使用 AWS
+	Endpoint     string
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// PathStyle 为 true 时使用 endpoint/bucket/key 形式的地址，自定义 Endpoint 默认开启
+	PathStyle bool
+}
+
+// S3ConfigFromEnv 从标准 AWS 环境变量读取配置：
+// AWS_ACCESS_KEY_ID、AWS_SECRET_ACCESS_KEY、AWS_SESSION_TOKEN、AWS_REGION（或 AWS_DEFAULT_REGION）、AWS_ENDPOINT_URL
+func S3ConfigFromEnv() S3Config {
+	cfg := S3Config{
+		Endpoint:     os.Getenv("AWS_ENDPOINT_URL"),
+		Region:       os.Getenv("AWS_REGION"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cfg.PathStyle = cfg.Endpoint != ""
+	return cfg
+}
+
+// S3FS 以 s3://bucket/prefix 为根实现 FileSystem。
+// 对象存储没有目录，目录以 "<path>/" 结尾的空对象表示，列举时也会为对象的上级路径补出目录条目
+type S3FS struct {
+	ctx    context.Context
+	bucket string
+	prefix string
+	cfg    S3Config
+	base   *url.URL
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3FS 创建对象存储文件系统，ep.Host 为 bucket，ep.Path 为前缀。
+// 全部请求都绑定 ctx，ctx 取消时进行中的请求随之中断
+func NewS3FS(ctx context.Context, ep Endpoint, cfg S3Config) (*S3FS, error) {
+	if ep.Host == "" {
+		return nil, errors.New("s3 端点缺少 bucket")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("未配置 S3 访问密钥，请设置 AWS_ACCESS_KEY_ID 与 AWS_SECRET_ACCESS_KEY")
+	}
+	raw := cfg.Endpoint
+	if raw == "" {
+		raw = fmt.Sprintf("https://s3.%s.amazonaws.com", cfg.Region)
+	}
+	base, err := url.Parse(raw)
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("S3 endpoint 非法: %q", raw)
+	}
+	if !cfg.PathStyle {
+		base.Host = ep.Host + "." + base.Host
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = s3ResponseTimeout
+	transport.IdleConnTimeout = s3IdleConnTimeout
+	return &S3FS{
+		ctx:    ctx,
+		bucket: ep.Host,
+		prefix: strings.Trim(ep.Path, "/"),
+		cfg:    cfg,
+		base:   base,
+		client: &http.Client{Transport: transport},
+		now:    time.Now,
+	}, nil
+}
+
+func (s *S3FS) Root() string {
+	return "s3://" + path.Join(s.bucket, s.prefix)
+}
+
+func (s *S3FS) List(excludes []string) ([]FileMeta, error) {
+	return collectWalk(s, excludes)
+}
+
+// Walk 分页列举前缀下的全部对象；对象按键名有序返回，目录条目在首次遇到其内容前补出
+func (s *S3FS) Walk(excludes []string, fn func(FileMeta) error) error {
+	root := s.dirKey("")
+	emitted := make(map[string]bool)
+	emitDirs := func(rel string) error {
+		var parents []string
+		for dir := path.Dir(rel); dir != "." && !emitted[dir]; dir = path.Dir(dir) {
+			parents = append(parents, dir)
+		}
+		for i := len(parents) - 1; i >= 0; i-- {
+			dir := parents[i]
+			emitted[dir] = true
+			if shouldExclude(dir, excludes) {
+				continue
+			}
+			if err := fn(FileMeta{RelPath: dir, IsDir: true, Mode: uint32(fs.ModeDir | 0o755)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return s.listObjects(root, "", func(obj s3Object) error {
+		rel := strings.TrimPrefix(obj.Key, root)
+		isDir := strings.HasSuffix(rel, "/")
+		rel = strings.TrimSuffix(rel, "/")
+		if rel == "" {
+			return nil
+		}
+		if err := emitDirs(rel); err != nil {
+			return err
+		}
+		if isDir {
+			if emitted[rel] {
+				return nil
+			}
+			emitted[rel] = true
+		}
+		if shouldExclude(rel, excludes) {
+			return nil
+		}
+		return fn(obj.meta(rel, isDir))
+	}, nil)
+}
+
+// ReadDir 以 "/" 为分隔符列出单层子项
+func (s *S3FS) ReadDir(relPath string) ([]FileMeta, error) {
+	dir := s.dirKey(relPath)
+	var metas []FileMeta
+	err := s.listObjects(dir, "/", func(obj s3Object) error {
+		name := strings.TrimPrefix(obj.Key, dir)
+		if name != "" {
+			metas = append(metas, obj.meta(name, false))
+		}
+		return nil
+	}, func(prefix string) error {
+		name := strings.TrimSuffix(strings.TrimPrefix(prefix, dir), "/")
+		metas = append(metas, FileMeta{RelPath: name, IsDir: true, Mode: uint32(fs.ModeDir | 0o755)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(metas) == 0 {
+		return nil, fmt.Errorf("%s: %w", relPath, fs.ErrNotExist)
+	}
+	return metas, nil
+}
+
+func (s *S3FS) Open(relPath string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, s.key(relPath), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3FS) Create(relPath string, perm fs.FileMode) (io.WriteCloser, error) {
+	return &s3Writer{fs: s, key: s.key(relPath)}, nil
+}
+
+// WriteExclusive 使用 If-None-Match: * 条件写入，对象已存在时返回 fs.ErrExist
+func (s *S3FS) WriteExclusive(relPath string, data []byte, perm fs.FileMode) error {
+	header := http.Header{"If-None-Match": []string{"*"}}
+	_, err := s.putObject(s.key(relPath), data, header)
+	var s3Err *S3Error
+	if errors.As(err, &s3Err) && s3Err.StatusCode == http.StatusPreconditionFailed {
+		return fmt.Errorf("%s: %w", relPath, fs.ErrExist)
+	}
+	return err
+}
+
+// MkdirAll 写入目录占位对象，使空目录也能被保留
+func (s *S3FS) MkdirAll(relPath string) error {
+	if strings.Trim(filepathToPosix(relPath), "/.") == "" {
+		return nil
+	}
+	_, err := s.putObject(s.dirKey(relPath), nil, nil)
+	return err
+}
+
+// Remove 删除对象本身以及以其为前缀的全部对象
+func (s *S3FS) Remove(relPath string) error {
+	if _, err := s.do(http.MethodDelete, s.key(relPath), nil, nil, nil); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	var keys []string
+	err := s.listObjects(s.dirKey(relPath), "", func(obj s3Object) error {
+		keys = append(keys, obj.Key)
+		return nil
+	}, nil)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if _, err := s.do(http.MethodDelete, key, nil, nil, nil); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *S3FS) Stat(relPath string) (FileMeta, error) {
+	rel := strings.Trim(filepathToPosix(relPath), "/")
+	resp, err := s.do(http.MethodHead, s.key(relPath), nil, nil, nil)
+	if err == nil {
+		resp.Body.Close()
+		modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		return FileMeta{RelPath: rel, Size: resp.ContentLength, Mode: 0o644, ModTime: modTime}, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return FileMeta{}, err
+	}
+	// 没有同名对象时，存在以其为前缀的对象即视为目录
+	found := false
+	stop := errors.New("stop")
+	err = s.listObjects(s.dirKey(relPath), "/", func(s3Object) error {
+		found = true
+		return stop
+	}, func(string) error {
+		found = true
+		return stop
+	})
+	if err != nil && !errors.Is(err, stop) {
+		return FileMeta{}, err
+	}
+	if !found {
+		return FileMeta{}, fmt.Errorf("stat %s: %w", relPath, fs.ErrNotExist)
+	}
+	return FileMeta{RelPath: rel, IsDir: true, Mode: uint32(fs.ModeDir | 0o755)}, nil
+}
+
+// ComputeRemoteHash 对单次上传且未用 KMS/客户密钥加密的对象直接使用 ETag 作为 MD5，其余情况需调用方读取计算
+func (s *S3FS) ComputeRemoteHash(relPath string, algo ChecksumAlgo) ([]byte, error) {
+	if algo != ChecksumMD5 {
+		return nil, ErrHashCommandUnavailable
+	}
+	resp, err := s.do(http.MethodHead, s.key(relPath), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if !etagIsMD5(resp.Header) {
+		return nil, ErrHashCommandUnavailable
+	}
+	sum, err := hex.DecodeString(strings.Trim(resp.Header.Get("ETag"), `"`))
+	if err != nil || len(sum) != md5.Size {
+		return nil, ErrHashCommandUnavailable
+	}
+	return sum, nil
+}
+
+func (s *S3FS) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// key 返回相对路径对应的对象键
+func (s *S3FS) key(relPath string) string {
+	rel := strings.Trim(filepathToPosix(relPath), "/")
+	if s.prefix == "" {
+		return rel
+	}
+	if rel == "" || rel == "." {
+		return s.prefix
+	}
+	return s.prefix + "/" + rel
+}
+
+// dirKey 返回目录对应的键前缀（以 / 结尾，根目录且无前缀时为空）
+func (s *S3FS) dirKey(relPath string) string {
+	rel := strings.Trim(filepathToPosix(relPath), "/")
+	if rel == "." {
+		rel = ""
+	}
+	key := s.key(rel)
+	if key == "" {
+		return ""
+	}
+	return key + "/"
+}
+
+type s3Object struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+}
+
+func (o s3Object) meta(rel string, isDir bool) FileMeta {
+	if isDir {
+		return FileMeta{RelPath: rel, IsDir: true, Mode: uint32(fs.ModeDir | 0o755), ModTime: o.LastModified}
+	}
+	return FileMeta{RelPath: rel, Size: o.Size, Mode: 0o644, ModTime: o.LastModified}
+}
+
+type s3ListResult struct {
+	Contents       []s3Object `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// listObjects 使用 ListObjectsV2 分页列举；onPrefix 仅在指定 delimiter 时被调用
+func (s *S3FS) listObjects(prefix, delimiter string, onObject func(s3Object) error, onPrefix func(string) error) error {
+	token := ""
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"max-keys":  {strconv.Itoa(s3ListPageSize)},
+		}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("解析 S3 列举结果失败: %w", err)
+		}
+		for _, obj := range result.Contents {
+			if err := onObject(obj); err != nil {
+				return err
+			}
+		}
+		if onPrefix != nil {
+			for _, p := range result.CommonPrefixes {
+				if err := onPrefix(p.Prefix); err != nil {
+					return err
+				}
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// putObject 单次上传并校验返回的 ETag
+func (s *S3FS) putObject(key string, data []byte, header http.Header) (string, error) {
+	sum := md5.Sum(data)
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	resp, err := s.do(http.MethodPut, key, nil, header, data)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if err := checkETag(resp.Header, sum[:]); err != nil {
+		return "", fmt.Errorf("%s: %w", key, err)
+	}
+	return etag, nil
+}
+
+// checkETag 在 ETag 为普通 MD5 时与本地值比较；加密等情况下的非 MD5 ETag 不做比较，
+// 此时请求体的完整性由 Content-MD5 保证
+func checkETag(header http.Header, sum []byte) error {
+	if !etagIsMD5(header) {
+		return nil
+	}
+	got, err := hex.DecodeString(strings.Trim(header.Get("ETag"), `"`))
+	if err != nil || len(got) != md5.Size {
+		return nil
+	}
+	if !bytes.Equal(got, sum) {
+		return ErrS3ETagMismatch
+	}
+	return nil
+}
+
+// etagIsMD5 判断响应中的 ETag 是否为内容的 MD5：SSE-KMS 与 SSE-C 加密的对象
+// 返回的 ETag 同样是 32 位十六进制，但并非 MD5
+func etagIsMD5(header http.Header) bool {
+	if strings.HasPrefix(header.Get("X-Amz-Server-Side-Encryption"), "aws:kms") {
+		return false
+	}
+	return header.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm") == ""
+}
+
+// S3Error 为对象存储返回的错误
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("S3 请求失败: HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("S3 请求失败: HTTP %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Transient 表示服务端限流或内部错误，可以重试
+func (e *S3Error) Transient() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests || e.Code == "SlowDown"
+}
+
+func (e *S3Error) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound {
+		return fs.ErrNotExist
+	}
+	return nil
+}
+
+// do 发送签名请求；key 为空时请求 bucket 本身。非 2xx 响应转为 *S3Error
+func (s *S3FS) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *s.base
+	p := "/" + key
+	if s.cfg.PathStyle {
+		p = "/" + s.bucket
+		if key != "" {
+			p += "/" + key
+		}
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + p
+	u.RawPath = s3EscapePath(u.Path)
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequestWithContext(s.ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	if body == nil {
+		req.Body = http.NoBody
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		payloadHash = sha256Hex(body)
+	}
+	signV4(req, s.cfg, payloadHash, s.now())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	s3Err := &S3Error{StatusCode: resp.StatusCode}
+	if data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); len(data) > 0 {
+		_ = xml.Unmarshal(data, s3Err)
+	}
+	return nil, s3Err
+}
+
+// s3Writer 缓冲写入的数据：不超过一个分段时在 Close 中单次 PUT，否则改用分段上传；
+// Abort 时不写入任何内容
+type s3Writer struct {
+	fs       *S3FS
+	key      string
+	buf      []byte
+	uploadID string
+	parts    []s3Part
+	partSums []byte
+	hash     hash.Hash
+	err      error
+	closed   bool
+}
+
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.closed {
+		return 0, fs.ErrClosed
+	}
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), s3PartSize-len(w.buf))
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(w.buf) == s3PartSize && len(p) > 0 {
+			if err := w.flushPart(); err != nil {
+				w.abortUpload(err)
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *s3Writer) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	if w.uploadID == "" {
+		if _, w.err = w.fs.putObject(w.key, w.buf, nil); w.err == nil {
+			w.hashSent(w.buf)
+		}
+		return w.err
+	}
+	if len(w.buf) > 0 {
+		if err := w.flushPart(); err != nil {
+			w.abortUpload(err)
+			return err
+		}
+	}
+	if err := w.complete(); err != nil {
+		w.abortUpload(err)
+		return err
+	}
+	return nil
+}
+
+func (w *s3Writer) flushPart() error {
+	if w.uploadID == "" {
+		resp, err := w.fs.do(http.MethodPost, w.key, url.Values{"uploads": {""}}, nil, nil)
+		if err != nil {
+			return err
+		}
+		var result struct {
+			UploadID string `xml:"UploadId"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil || result.UploadID == "" {
+			return fmt.Errorf("创建分段上传失败: %v", err)
+		}
+		w.uploadID = result.UploadID
+	}
+	number := len(w.parts) + 1
+	sum := md5.Sum(w.buf)
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {w.uploadID}}
+	header := http.Header{"Content-MD5": {base64.StdEncoding.EncodeToString(sum[:])}}
+	resp, err := w.fs.do(http.MethodPut, w.key, query, header, w.buf)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if err := checkETag(resp.Header, sum[:]); err != nil {
+		return fmt.Errorf("%s 第 %d 段: %w", w.key, number, err)
+	}
+	w.parts = append(w.parts, s3Part{PartNumber: number, ETag: etag})
+	w.partSums = append(w.partSums, sum[:]...)
+	w.hashSent(w.buf)
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// complete 完成分段上传，并按 md5(各段 md5)-N 的规则校验最终 ETag
+func (w *s3Writer) complete() error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: w.parts})
+	if err != nil {
+		return err
+	}
+	resp, err := w.fs.do(http.MethodPost, w.key, url.Values{"uploadId": {w.uploadID}}, nil, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// CompleteMultipartUpload 可能在 200 响应体中返回错误
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		XMLName xml.Name
+		ETag    string `xml:"ETag"`
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := xml.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("解析分段上传结果失败: %w", err)
+	}
+	if result.XMLName.Local == "Error" {
+		return &S3Error{StatusCode: resp.StatusCode, Code: result.Code, Message: result.Message}
+	}
+	want := md5.Sum(w.partSums)
+	expected := fmt.Sprintf("%s-%d", hex.EncodeToString(want[:]), len(w.parts))
+	if etag := strings.Trim(result.ETag, `"`); etagIsMD5(resp.Header) && strings.Contains(etag, "-") && etag != expected {
+		return fmt.Errorf("%s: %w", w.key, ErrS3ETagMismatch)
+	}
+	return nil
+}
+
+// HashUpload 让每段数据在服务端按 Content-MD5 确认接收后计入 h，
+// Close 成功后 h 即为对象内容的校验和，无需下载对象
+func (w *s3Writer) HashUpload(h hash.Hash) {
+	w.hash = h
+}
+
+func (w *s3Writer) hashSent(data []byte) {
+	if w.hash != nil {
+		w.hash.Write(data)
+	}
+}
+
+// Abort 丢弃缓冲的数据并中止进行中的分段上传，目标对象保持原状
+func (w *s3Writer) Abort() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+	w.buf = nil
+	if w.err == nil {
+		w.abortUpload(errWriteAborted)
+	}
+}
+
+// abortUpload 记录错误并中止进行中的分段上传
+func (w *s3Writer) abortUpload(err error) {
+	w.err = err
+	if w.uploadID != "" {
+		if resp, aerr := w.fs.do(http.MethodDelete, w.key, url.Values{"uploadId": {w.uploadID}}, nil, nil); aerr == nil {
+			resp.Body.Close()
+		}
+	}
+}
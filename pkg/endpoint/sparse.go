@@ -0,0 +1,132 @@
+package endpoint
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+// sparseBlockSize 为零块检测的粒度，与常见文件系统块大小一致
+const sparseBlockSize = 4096
+
+// Region 描述文件中的一段数据区域，区域之外的部分为空洞
+type Region struct {
+	Offset int64
+	Length int64
+}
+
+// SparseSourceFS 表示能报告文件数据区域的文件系统
+type SparseSourceFS interface {
+	DataRegions(relPath string) ([]Region, error)
+}
+
+// SparseDestFS 表示能在写入时保留空洞的文件系统。
+// regions 非空时写入流为各数据区域按顺序拼接的内容；
+// regions 为空时写入流为完整文件内容，由实现自行把全零块还原为空洞。
+// 不支持对应模式时返回 ErrNotImplemented
+type SparseDestFS interface {
+	CreateSparse(relPath string, perm fs.FileMode, size int64, regions []Region) (io.WriteCloser, error)
+}
+
+// RegionsSize 返回所有数据区域的总字节数
+func RegionsSize(regions []Region) int64 {
+	var total int64
+	for _, r := range regions {
+		total += r.Length
+	}
+	return total
+}
+
+// mergeRegions 合并间隔最小的相邻区域，直到数量不超过 limit；被合并的空洞按普通数据传输
+func mergeRegions(regions []Region, limit int) []Region {
+	if len(regions) <= limit || limit <= 0 {
+		return regions
+	}
+	gaps := make([]int64, 0, len(regions)-1)
+	for i := 1; i < len(regions); i++ {
+		gaps = append(gaps, regions[i].Offset-(regions[i-1].Offset+regions[i-1].Length))
+	}
+	sorted := append([]int64(nil), gaps...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	// 小于等于 threshold 的空洞都被合并
+	threshold := sorted[len(regions)-limit-1]
+	merged := []Region{regions[0]}
+	for i := 1; i < len(regions); i++ {
+		last := &merged[len(merged)-1]
+		if gaps[i-1] <= threshold {
+			last.Length = regions[i].Offset + regions[i].Length - last.Offset
+			continue
+		}
+		merged = append(merged, regions[i])
+	}
+	return merged
+}
+
+// sparseFileWriter 把写入流落到本地文件的指定位置，未写入的部分保持为空洞
+type sparseFileWriter struct {
+	file    *os.File
+	size    int64
+	regions []Region
+	idx     int
+	offset  int64
+}
+
+func newSparseFileWriter(file *os.File, size int64, regions []Region) *sparseFileWriter {
+	return &sparseFileWriter{file: file, size: size, regions: regions}
+}
+
+func (w *sparseFileWriter) Write(p []byte) (int, error) {
+	if w.regions == nil {
+		return w.writeDetectZero(p)
+	}
+	total := 0
+	for len(p) > 0 {
+		if w.idx >= len(w.regions) {
+			return total, fmt.Errorf("写入数据超出稀疏区域")
+		}
+		r := w.regions[w.idx]
+		n := int(min(int64(len(p)), r.Length-w.offset))
+		if _, err := w.file.WriteAt(p[:n], r.Offset+w.offset); err != nil {
+			return total, err
+		}
+		total += n
+		p = p[n:]
+		w.offset += int64(n)
+		if w.offset == r.Length {
+			w.idx++
+			w.offset = 0
+		}
+	}
+	return total, nil
+}
+
+var zeroBlock = make([]byte, sparseBlockSize)
+
+// writeDetectZero 逐块写入，全零块直接跳过形成空洞
+func (w *sparseFileWriter) writeDetectZero(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		n := min(len(p), sparseBlockSize)
+		chunk := p[:n]
+		if !bytes.Equal(chunk, zeroBlock[:n]) {
+			if _, err := w.file.WriteAt(chunk, w.offset); err != nil {
+				return total, err
+			}
+		}
+		w.offset += int64(n)
+		total += n
+		p = p[n:]
+	}
+	return total, nil
+}
+
+func (w *sparseFileWriter) Close() error {
+	if err := w.file.Truncate(w.size); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
@@ -0,0 +1,56 @@
+//go:build linux
+
+package endpoint
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+const (
+	seekData = 3 // SEEK_DATA
+	seekHole = 4 // SEEK_HOLE
+)
+
+// dataRegions 使用 SEEK_DATA/SEEK_HOLE 枚举文件中的数据区域
+func dataRegions(full string) ([]Region, error) {
+	file, err := os.Open(full)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	fd := int(file.Fd())
+	var regions []Region
+	var offset int64
+	for offset < size {
+		start, err := syscall.Seek(fd, offset, seekData)
+		if err != nil {
+			if errors.Is(err, syscall.ENXIO) {
+				break
+			}
+			if errors.Is(err, syscall.EINVAL) {
+				return nil, ErrNotImplemented
+			}
+			return nil, err
+		}
+		end, err := syscall.Seek(fd, start, seekHole)
+		if err != nil {
+			return nil, err
+		}
+		if end > size {
+			end = size
+		}
+		regions = append(regions, Region{Offset: start, Length: end - start})
+		offset = end
+	}
+	if regions == nil {
+		regions = []Region{}
+	}
+	return regions, nil
+}
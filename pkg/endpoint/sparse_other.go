@@ -0,0 +1,8 @@
+//go:build !linux
+
+package endpoint
+
+// dataRegions 在不支持 SEEK_DATA/SEEK_HOLE 的平台上不可用
+func dataRegions(full string) ([]Region, error) {
+	return nil, ErrNotImplemented
+}
@@ -0,0 +1,86 @@
+package endpoint
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestMergeRegions(t *testing.T) {
+	regions := []Region{{0, 10}, {12, 10}, {100, 10}, {111, 5}, {500, 1}}
+	merged := mergeRegions(regions, 3)
+	want := []Region{{0, 22}, {100, 16}, {500, 1}}
+	if len(merged) != len(want) {
+		t.Fatalf("unexpected merge result %+v", merged)
+	}
+	for i := range want {
+		if merged[i] != want[i] {
+			t.Fatalf("region %d: got %+v want %+v", i, merged[i], want[i])
+		}
+	}
+	if got := mergeRegions(regions, 10); len(got) != len(regions) {
+		t.Fatalf("should not merge under limit")
+	}
+}
+
+func TestLocalFSSparseRoundTrip(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SEEK_DATA/SEEK_HOLE only on linux")
+	}
+	srcDir := t.TempDir()
+	full := filepath.Join(srcDir, "disk.img")
+	const size = 8 << 20
+	file, err := os.Create(full)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	payload := bytes.Repeat([]byte("z"), 8192)
+	if _, err := file.WriteAt(payload, 1<<20); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := file.Truncate(size); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	file.Close()
+
+	src := NewLocalFS(srcDir)
+	meta, err := src.Stat("disk.img")
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if !meta.Sparse {
+		t.Skip("temp filesystem does not keep holes")
+	}
+	regions, err := src.DataRegions("disk.img")
+	if err != nil {
+		t.Fatalf("regions: %v", err)
+	}
+	if RegionsSize(regions) >= size {
+		t.Fatalf("regions should skip holes: %+v", regions)
+	}
+
+	dst := NewLocalFS(t.TempDir())
+	writer, err := dst.CreateSparse("disk.img", 0o644, size, nil)
+	if err != nil {
+		t.Fatalf("create sparse: %v", err)
+	}
+	reader, _ := src.Open("disk.img")
+	if _, err := io.Copy(writer, reader); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	reader.Close()
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	got, _ := os.ReadFile(filepath.Join(dst.Root(), "disk.img"))
+	want, _ := os.ReadFile(full)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("content mismatch")
+	}
+	if out, _ := dst.Stat("disk.img"); !out.Sparse {
+		t.Fatalf("zero blocks should become holes")
+	}
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package endpoint
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// isSparse 通过实际占用块数判断文件是否包含空洞
+func isSparse(info fs.FileInfo) bool {
+	if info.IsDir() || info.Size() == 0 {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	return int64(st.Blocks)*512 < info.Size()
+}
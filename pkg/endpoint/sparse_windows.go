@@ -0,0 +1,10 @@
+//go:build windows
+
+package endpoint
+
+import "io/fs"
+
+// isSparse 在 Windows 上暂不检测稀疏文件
+func isSparse(info fs.FileInfo) bool {
+	return false
+}
@@ -0,0 +1,548 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// webdavTempPrefix 为上传中临时文件的名称前缀，上传完成后通过 MOVE 原子替换目标
+const webdavTempPrefix = ".zbackup-tmp-"
+
+var (
+	// webdavResponseTimeout 为请求发出后等待响应头的最长时间，服务端无响应时请求失败而不是一直挂起
+	webdavResponseTimeout = time.Minute
+	// webdavIdleConnTimeout 为空闲连接的保留时间，超时后关闭，避免复用已被中间设备断开的连接
+	webdavIdleConnTimeout = 30 * time.Second
+)
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>` +
+	`<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/><D:getcontentlength/><D:getlastmodified/></D:prop></D:propfind>`
+
+// WebDAVFS 通过 WebDAV 协议访问远端目录：PROPFIND 列举，GET/PUT 读写，MKCOL 建目录，
+// DELETE 删除，写入先上传到临时文件再 MOVE 覆盖目标
+type WebDAVFS struct {
+	ctx    context.Context
+	base   *url.URL
+	auth   *webdavAuth
+	client *http.Client
+
+	mu   sync.Mutex
+	dirs map[string]bool // 已确认存在的目录（集合）
+}
+
+// NewWebDAVFS 创建 WebDAV 文件系统；user 为空时不做认证。
+// 所有请求绑定 ctx，ctx 取消时进行中的请求随之中断
+func NewWebDAVFS(ctx context.Context, ep Endpoint, user, password string) *WebDAVFS {
+	scheme := "http"
+	if ep.Secure {
+		scheme = "https"
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = webdavResponseTimeout
+	transport.IdleConnTimeout = webdavIdleConnTimeout
+	return &WebDAVFS{
+		ctx:  ctx,
+		base: &url.URL{Scheme: scheme, Host: ep.Host, Path: strings.TrimSuffix(ep.Path, "/")},
+		auth: &webdavAuth{user: user, password: password},
+		client: &http.Client{
+			Transport: transport,
+			// 重定向会把 PROPFIND 等方法改成 GET，只让 GET/HEAD 跟随，其余交给调用方处理
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if m := via[0].Method; m != http.MethodGet && m != http.MethodHead {
+					return http.ErrUseLastResponse
+				}
+				if len(via) >= 10 {
+					return fmt.Errorf("重定向次数过多")
+				}
+				return nil
+			},
+		},
+		dirs: make(map[string]bool),
+	}
+}
+
+func (w *WebDAVFS) Root() string {
+	return w.base.String()
+}
+
+func (w *WebDAVFS) List(excludes []string) ([]FileMeta, error) {
+	return collectWalk(w, excludes)
+}
+
+// Walk 逐层 PROPFIND（Depth: 1）做前序遍历，目录先于其内容返回
+func (w *WebDAVFS) Walk(excludes []string, fn func(FileMeta) error) error {
+	return w.walkDir("", excludes, fn)
+}
+
+func (w *WebDAVFS) walkDir(rel string, excludes []string, fn func(FileMeta) error) error {
+	entries, err := w.propfind(rel, "1", true)
+	if err != nil {
+		return err
+	}
+	for _, meta := range entries {
+		if meta.RelPath == rel || strings.HasPrefix(path.Base(meta.RelPath), webdavTempPrefix) {
+			continue
+		}
+		if !shouldExclude(meta.RelPath, excludes) {
+			if err := fn(meta); err != nil {
+				return err
+			}
+		}
+		if meta.IsDir {
+			if err := w.walkDir(meta.RelPath, excludes, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *WebDAVFS) ReadDir(relPath string) ([]FileMeta, error) {
+	rel := cleanRel(relPath)
+	entries, err := w.propfind(rel, "1", true)
+	if err != nil {
+		return nil, err
+	}
+	metas := make([]FileMeta, 0, len(entries))
+	for _, meta := range entries {
+		if meta.RelPath == rel {
+			continue
+		}
+		meta.RelPath = path.Base(meta.RelPath)
+		metas = append(metas, meta)
+	}
+	return metas, nil
+}
+
+func (w *WebDAVFS) Stat(relPath string) (FileMeta, error) {
+	rel := cleanRel(relPath)
+	w.mu.Lock()
+	known := w.dirs[rel]
+	w.mu.Unlock()
+	entries, err := w.propfind(rel, "0", known)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	if len(entries) == 0 {
+		return FileMeta{}, fmt.Errorf("stat %s: %w", relPath, fs.ErrNotExist)
+	}
+	return entries[0], nil
+}
+
+func (w *WebDAVFS) Open(relPath string) (io.ReadCloser, error) {
+	resp, err := w.do(http.MethodGet, cleanRel(relPath), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := expectStatus(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Create 把内容流式上传到同目录的临时文件，Close 时 MOVE 覆盖目标
+func (w *WebDAVFS) Create(relPath string, perm fs.FileMode) (io.WriteCloser, error) {
+	rel := cleanRel(relPath)
+	if err := w.MkdirAll(path.Dir(rel)); err != nil {
+		return nil, err
+	}
+	// 流式请求体无法在认证质询后重放，先用一个轻量请求完成认证协商
+	if !w.auth.established() {
+		if _, err := w.propfind("", "0", true); err != nil {
+			return nil, err
+		}
+	}
+	tmp := tempSibling(rel)
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		resp, err := w.send(http.MethodPut, tmp, nil, pr, -1)
+		if err == nil && resp.StatusCode == http.StatusUnauthorized {
+			// 摘要认证的 nonce 过期时更新质询参数，由上层重试整个文件
+			w.auth.challenge(resp.Header)
+		}
+		if err == nil {
+			err = expectStatus(resp, http.StatusCreated, http.StatusNoContent, http.StatusOK)
+			if err == nil {
+				resp.Body.Close()
+			}
+		}
+		pr.CloseWithError(err)
+		done <- err
+	}()
+	return &webdavWriter{fs: w, pw: pw, done: done, tmp: tmp, rel: rel}, nil
+}
+
+// WriteExclusive 使用 If-None-Match: * 条件上传，目标已存在时返回 fs.ErrExist
+func (w *WebDAVFS) WriteExclusive(relPath string, data []byte, perm fs.FileMode) error {
+	rel := cleanRel(relPath)
+	if err := w.MkdirAll(path.Dir(rel)); err != nil {
+		return err
+	}
+	resp, err := w.do(http.MethodPut, rel, http.Header{"If-None-Match": {"*"}}, data)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		resp.Body.Close()
+		return fmt.Errorf("%s: %w", relPath, fs.ErrExist)
+	}
+	if err := expectStatus(resp, http.StatusCreated, http.StatusNoContent, http.StatusOK); err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// MkdirAll 自上而下逐级 MKCOL，已存在的目录（405）视为成功
+func (w *WebDAVFS) MkdirAll(relPath string) error {
+	rel := cleanRel(relPath)
+	if rel == "" {
+		return nil
+	}
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		dir := strings.Join(parts[:i+1], "/")
+		w.mu.Lock()
+		known := w.dirs[dir]
+		w.mu.Unlock()
+		if known {
+			continue
+		}
+		resp, err := w.do("MKCOL", dir+"/", nil, nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			if err := expectStatus(resp, http.StatusCreated, http.StatusOK, http.StatusNoContent); err != nil {
+				return err
+			}
+		}
+		resp.Body.Close()
+		w.mu.Lock()
+		w.dirs[dir] = true
+		w.mu.Unlock()
+	}
+	return nil
+}
+
+// Remove 删除文件或整个目录，目标不存在时不报错
+func (w *WebDAVFS) Remove(relPath string) error {
+	rel := cleanRel(relPath)
+	resp, err := w.do(http.MethodDelete, rel, nil, nil)
+	if err != nil {
+		return err
+	}
+	w.forgetDirs(rel)
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil
+	}
+	if err := expectStatus(resp, http.StatusNoContent, http.StatusOK, http.StatusAccepted); err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Rename 使用 MOVE（Overwrite: T）重命名，目标已存在时被替换
+func (w *WebDAVFS) Rename(oldRel, newRel string) error {
+	from, to := cleanRel(oldRel), cleanRel(newRel)
+	if err := w.MkdirAll(path.Dir(to)); err != nil {
+		return err
+	}
+	header := http.Header{
+		"Destination": {w.urlFor(to).String()},
+		"Overwrite":   {"T"},
+	}
+	resp, err := w.do("MOVE", from, header, nil)
+	if err != nil {
+		return err
+	}
+	w.forgetDirs(from)
+	if err := expectStatus(resp, http.StatusCreated, http.StatusNoContent, http.StatusOK); err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (w *WebDAVFS) Close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
+
+func (w *WebDAVFS) forgetDirs(rel string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for dir := range w.dirs {
+		if dir == rel || strings.HasPrefix(dir, rel+"/") {
+			delete(w.dirs, dir)
+		}
+	}
+}
+
+type davMultistatus struct {
+	Responses []struct {
+		Href      string `xml:"DAV: href"`
+		Propstats []struct {
+			Prop struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+				ContentLength string `xml:"DAV: getcontentlength"`
+				LastModified  string `xml:"DAV: getlastmodified"`
+			} `xml:"DAV: prop"`
+			Status string `xml:"DAV: status"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// propfind 返回按路径排序的条目，RelPath 相对于根目录。
+// 只有 collection 为 true（根目录或已知目录）时才在路径末尾加 /：Apache mod_dav 等服务端
+// 对带 / 的文件路径返回 404，对不带 / 的目录返回重定向，收到重定向时改用带 / 的路径重试
+func (w *WebDAVFS) propfind(rel, depth string, collection bool) ([]FileMeta, error) {
+	header := http.Header{
+		"Depth":        {depth},
+		"Content-Type": {"application/xml; charset=utf-8"},
+	}
+	target := rel
+	if collection && target != "" {
+		target += "/"
+	}
+	resp, err := w.do("PROPFIND", target, header, []byte(propfindBody))
+	if err != nil {
+		return nil, err
+	}
+	if isRedirect(resp.StatusCode) && target != "" && !collection {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		resp, err = w.do("PROPFIND", target+"/", header, []byte(propfindBody))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := expectStatus(resp, http.StatusMultiStatus); err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var ms davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("解析 PROPFIND 响应失败: %w", err)
+	}
+	var metas []FileMeta
+	for _, r := range ms.Responses {
+		entryRel, ok := w.relFromHref(r.Href)
+		if !ok {
+			continue
+		}
+		meta := FileMeta{RelPath: entryRel, Mode: 0o644}
+		for _, ps := range r.Propstats {
+			if !strings.Contains(ps.Status, " 200") {
+				continue
+			}
+			if ps.Prop.ResourceType.Collection != nil {
+				meta.IsDir = true
+				meta.Mode = uint32(fs.ModeDir | 0o755)
+			}
+			if ps.Prop.ContentLength != "" {
+				meta.Size, _ = strconv.ParseInt(strings.TrimSpace(ps.Prop.ContentLength), 10, 64)
+			}
+			if ps.Prop.LastModified != "" {
+				meta.ModTime, _ = http.ParseTime(ps.Prop.LastModified)
+			}
+		}
+		if meta.IsDir {
+			meta.Size = 0
+			w.mu.Lock()
+			w.dirs[entryRel] = true
+			w.mu.Unlock()
+		}
+		metas = append(metas, meta)
+	}
+	sort.Slice(metas, func(i, j int) bool { return metas[i].RelPath < metas[j].RelPath })
+	return metas, nil
+}
+
+func isRedirect(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// relFromHref 把响应中的 href（绝对 URL 或路径）转换为相对根目录的路径
+func (w *WebDAVFS) relFromHref(href string) (string, bool) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	p := strings.TrimSuffix(u.Path, "/")
+	base := strings.TrimSuffix(w.base.Path, "/")
+	if p != base && !strings.HasPrefix(p, base+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(p, base), "/"), true
+}
+
+func (w *WebDAVFS) urlFor(rel string) *url.URL {
+	u := *w.base
+	u.Path = w.base.Path + "/" + rel
+	return &u
+}
+
+// do 发送可重放的请求，收到认证质询时带认证重试一次
+func (w *WebDAVFS) do(method, rel string, header http.Header, body []byte) (*http.Response, error) {
+	resp, err := w.send(method, rel, header, bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && w.auth.challenge(resp.Header) {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		resp, err = w.send(method, rel, header, bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		w.auth.confirm()
+	}
+	return resp, nil
+}
+
+func (w *WebDAVFS) send(method, rel string, header http.Header, body io.Reader, length int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(w.ctx, method, w.urlFor(rel).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = length
+	if length == 0 {
+		req.Body = http.NoBody
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w.auth.apply(req)
+	return w.client.Do(req)
+}
+
+// WebDAVError 为 WebDAV 服务返回的非预期状态码
+type WebDAVError struct {
+	Method     string
+	Path       string
+	StatusCode int
+}
+
+func (e *WebDAVError) Error() string {
+	return fmt.Sprintf("WebDAV %s %s 失败: HTTP %d %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Transient 表示服务端错误或限流，可以重试
+func (e *WebDAVError) Transient() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+func (e *WebDAVError) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound {
+		return fs.ErrNotExist
+	}
+	return nil
+}
+
+// expectStatus 检查状态码，不符合时关闭响应体并返回 *WebDAVError
+func expectStatus(resp *http.Response, codes ...int) error {
+	for _, code := range codes {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	return &WebDAVError{Method: resp.Request.Method, Path: resp.Request.URL.Path, StatusCode: resp.StatusCode}
+}
+
+func cleanRel(rel string) string {
+	rel = strings.Trim(path.Clean("/"+filepathToPosix(rel)), "/")
+	return rel
+}
+
+func tempSibling(rel string) string {
+	suffix := make([]byte, 6)
+	_, _ = rand.Read(suffix)
+	name := webdavTempPrefix + path.Base(rel) + "-" + hex.EncodeToString(suffix)
+	if dir := path.Dir(rel); dir != "." {
+		return dir + "/" + name
+	}
+	return name
+}
+
+// webdavWriter 把写入的数据送入进行中的 PUT 请求，Close 后用 MOVE 覆盖目标，
+// Abort 则中断请求并删除临时文件
+type webdavWriter struct {
+	fs     *WebDAVFS
+	pw     *io.PipeWriter
+	done   chan error
+	tmp    string
+	rel    string
+	hash   hash.Hash
+	closed bool
+	err    error
+}
+
+// Write 在 PUT 请求读走数据后才返回，计入 hash 的都是已经发出的内容
+func (w *webdavWriter) Write(p []byte) (int, error) {
+	n, err := w.pw.Write(p)
+	if w.hash != nil {
+		w.hash.Write(p[:n])
+	}
+	return n, err
+}
+
+// HashUpload 让发出的数据计入 h，Close 成功（PUT 与 MOVE 都完成）后 h 即为目标文件的校验和
+func (w *webdavWriter) HashUpload(h hash.Hash) {
+	w.hash = h
+}
+
+func (w *webdavWriter) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	w.pw.Close()
+	if w.err = <-w.done; w.err != nil {
+		return w.err
+	}
+	if w.err = w.fs.Rename(w.tmp, w.rel); w.err != nil {
+		_ = w.fs.Remove(w.tmp)
+	}
+	return w.err
+}
+
+// Abort 中断上传并删除临时文件，不覆盖目标
+func (w *webdavWriter) Abort() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+	w.err = errWriteAborted
+	w.pw.CloseWithError(errWriteAborted)
+	<-w.done
+	_ = w.fs.Remove(w.tmp)
+}
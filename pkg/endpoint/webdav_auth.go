@@ -0,0 +1,156 @@
+package endpoint
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// webdavAuth 根据服务端的 WWW-Authenticate 质询选择 Basic 或 Digest 认证，
+// 质询结果会被缓存，后续请求直接携带认证头
+type webdavAuth struct {
+	user     string
+	password string
+
+	mu     sync.Mutex
+	scheme string
+	digest map[string]string
+	nc     int
+}
+
+// challenge 处理 401 响应中的质询，返回是否可以带认证重试
+func (a *webdavAuth) challenge(header http.Header) bool {
+	if a.user == "" {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, value := range header.Values("WWW-Authenticate") {
+		scheme, params, _ := strings.Cut(strings.TrimSpace(value), " ")
+		switch strings.ToLower(scheme) {
+		case "digest":
+			a.scheme = "digest"
+			a.digest = parseAuthParams(params)
+			a.nc = 0
+			return true
+		case "basic":
+			if a.scheme == "" || a.scheme == "none" {
+				a.scheme = "basic"
+			}
+		}
+	}
+	return a.scheme == "basic"
+}
+
+// apply 为请求加上认证头；尚未收到质询时不做处理
+func (a *webdavAuth) apply(req *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch a.scheme {
+	case "basic":
+		req.SetBasicAuth(a.user, a.password)
+	case "digest":
+		a.nc++
+		cnonce := make([]byte, 8)
+		_, _ = rand.Read(cnonce)
+		req.Header.Set("Authorization", digestAuthorization(a.digest, a.user, a.password,
+			req.Method, req.URL.RequestURI(), a.nc, hex.EncodeToString(cnonce)))
+	}
+}
+
+// confirm 记录服务端未要求认证，之后的流式上传无需再预先协商
+func (a *webdavAuth) confirm() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.scheme == "" {
+		a.scheme = "none"
+	}
+}
+
+func (a *webdavAuth) established() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.scheme != "" || a.user == ""
+}
+
+// digestAuthorization 按 RFC 7616 计算 Digest 认证头，支持 MD5/SHA-256 及其 -sess 变体与 qop=auth
+func digestAuthorization(params map[string]string, user, password, method, uri string, nc int, cnonce string) string {
+	algorithm := params["algorithm"]
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+	var newHash func() hash.Hash = md5.New
+	if strings.HasPrefix(strings.ToUpper(algorithm), "SHA-256") {
+		newHash = sha256.New
+	}
+	h := func(s string) string {
+		sum := newHash()
+		sum.Write([]byte(s))
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+	realm, nonce := params["realm"], params["nonce"]
+	ha1 := h(user + ":" + realm + ":" + password)
+	if strings.HasSuffix(strings.ToLower(algorithm), "-sess") {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+	qop := ""
+	for _, q := range strings.Split(params["qop"], ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+	ncValue := fmt.Sprintf("%08x", nc)
+	var response string
+	if qop != "" {
+		response = h(strings.Join([]string{ha1, nonce, ncValue, cnonce, qop, ha2}, ":"))
+	} else {
+		response = h(ha1 + ":" + nonce + ":" + ha2)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=%s, response="%s"`,
+		user, realm, nonce, uri, algorithm, response)
+	if opaque, ok := params["opaque"]; ok {
+		fmt.Fprintf(&b, `, opaque="%s"`, opaque)
+	}
+	if qop != "" {
+		fmt.Fprintf(&b, `, qop=%s, nc=%s, cnonce="%s"`, qop, ncValue, cnonce)
+	}
+	return b.String()
+}
+
+// parseAuthParams 解析 key=value, key="quoted value" 形式的质询参数
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := 1
+			for end < len(rest) && rest[end] != '"' {
+				if rest[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			value = strings.ReplaceAll(rest[1:min(end, len(rest))], `\"`, `"`)
+			s = rest[min(end+1, len(rest)):]
+		} else {
+			value, s, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+		}
+		params[key] = value
+	}
+	return params
+}
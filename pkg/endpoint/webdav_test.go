@@ -0,0 +1,327 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestDigestAuthorizationRFC2617(t *testing.T) {
+	params := map[string]string{
+		"realm":  "testrealm@host.com",
+		"qop":    "auth,auth-int",
+		"nonce":  "dcd98b7102dd2f0e8b11d0f600bfb0c093",
+		"opaque": "5ccc069c403ebaf9f0171e9517f40e41",
+	}
+	got := digestAuthorization(params, "Mufasa", "Circle Of Life", "GET", "/dir/index.html", 1, "0a4f113b")
+	if !strings.Contains(got, `response="6629fae49393a05397450978507c4ef1"`) {
+		t.Fatalf("unexpected digest header: %s", got)
+	}
+	if !strings.Contains(got, `opaque="5ccc069c403ebaf9f0171e9517f40e41"`) || !strings.Contains(got, "nc=00000001") {
+		t.Fatalf("digest header missing fields: %s", got)
+	}
+}
+
+// davServer 以 golang.org/x/net/webdav 为实现、临时目录为存储启动测试服务。
+// x/net/webdav 不处理认证与 PUT 的 If-None-Match，由外层补上，行为与 Apache、Nextcloud 等一致；
+// 它还会清理请求路径的末尾 /，外层按 Apache mod_dav 的方式对带 / 的文件 PROPFIND 返回 404、
+// 对不带 / 的目录返回 301
+type davServer struct {
+	root    string
+	auth    string // "", "basic" 或 "digest"
+	user    string
+	pass    string
+	handler *webdav.Handler
+
+	mu        sync.Mutex
+	propfinds []string
+}
+
+func newDAVServer(t *testing.T, auth string) (*davServer, *WebDAVFS) {
+	t.Helper()
+	d := &davServer{root: t.TempDir(), auth: auth, user: "alice", pass: "s3cret"}
+	d.handler = &webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: webdav.Dir(d.root),
+		LockSystem: webdav.NewMemLS(),
+	}
+	srv := httptest.NewServer(d)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	if err := os.MkdirAll(filepath.Join(d.root, "repo"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dav := NewWebDAVFS(context.Background(), Endpoint{Type: EndpointWebDAV, Host: u.Host, Path: "/dav/repo"}, d.user, d.pass)
+	t.Cleanup(func() { dav.Close() })
+	return d, dav
+}
+
+func (d *davServer) authorized(r *http.Request) bool {
+	switch d.auth {
+	case "basic":
+		user, pass, ok := r.BasicAuth()
+		return ok && user == d.user && pass == d.pass
+	case "digest":
+		value, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Digest ")
+		if !ok {
+			return false
+		}
+		params := parseAuthParams(value)
+		var nc int
+		fmt.Sscanf(params["nc"], "%x", &nc)
+		want := digestAuthorization(map[string]string{"realm": "dav", "nonce": "n0", "qop": "auth"},
+			d.user, d.pass, r.Method, params["uri"], nc, params["cnonce"])
+		return params["uri"] == r.URL.RequestURI() &&
+			strings.Contains(want, `response="`+params["response"]+`"`)
+	}
+	return true
+}
+
+func (d *davServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !d.authorized(r) {
+		if d.auth == "digest" {
+			w.Header().Set("WWW-Authenticate", `Digest realm="dav", nonce="n0", qop="auth", algorithm=MD5`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Basic realm="dav"`)
+		}
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method == http.MethodPut && r.Header.Get("If-None-Match") == "*" {
+		rel := strings.TrimPrefix(r.URL.Path, d.handler.Prefix)
+		if _, err := d.handler.FileSystem.Stat(r.Context(), rel); err == nil {
+			io.Copy(io.Discard, r.Body)
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+	}
+	if r.Method == "PROPFIND" {
+		d.mu.Lock()
+		d.propfinds = append(d.propfinds, r.URL.Path)
+		d.mu.Unlock()
+		rel := strings.TrimPrefix(r.URL.Path, d.handler.Prefix)
+		if info, err := d.handler.FileSystem.Stat(r.Context(), rel); err == nil {
+			slash := strings.HasSuffix(r.URL.Path, "/")
+			if !info.IsDir() && slash {
+				io.Copy(io.Discard, r.Body)
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if info.IsDir() && !slash {
+				io.Copy(io.Discard, r.Body)
+				http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+				return
+			}
+		}
+	}
+	d.handler.ServeHTTP(w, r)
+}
+
+func writeDAVFile(t *testing.T, dav *WebDAVFS, rel, content string) {
+	t.Helper()
+	w, err := dav.Create(rel, 0o644)
+	if err != nil {
+		t.Fatalf("create %s: %v", rel, err)
+	}
+	if _, err := io.WriteString(w, content); err != nil {
+		t.Fatalf("write %s: %v", rel, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close %s: %v", rel, err)
+	}
+}
+
+func readDAVFile(t *testing.T, dav *WebDAVFS, rel string) string {
+	t.Helper()
+	r, err := dav.Open(rel)
+	if err != nil {
+		t.Fatalf("open %s: %v", rel, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read %s: %v", rel, err)
+	}
+	return string(data)
+}
+
+func TestWebDAVFSReadWriteAndList(t *testing.T) {
+	for _, auth := range []string{"", "basic", "digest"} {
+		t.Run("auth="+auth, func(t *testing.T) {
+			_, dav := newDAVServer(t, auth)
+
+			writeDAVFile(t, dav, "a/b/文件 1.txt", "hello")
+			writeDAVFile(t, dav, "a/b/文件 1.txt", "hello again")
+			writeDAVFile(t, dav, "top.txt", "x")
+			if got := readDAVFile(t, dav, "a/b/文件 1.txt"); got != "hello again" {
+				t.Fatalf("unexpected content %q", got)
+			}
+
+			var walked []string
+			err := dav.Walk(nil, func(meta FileMeta) error {
+				walked = append(walked, fmt.Sprintf("%s:%v", meta.RelPath, meta.IsDir))
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("walk: %v", err)
+			}
+			want := "a:true a/b:true a/b/文件 1.txt:false top.txt:false"
+			if strings.Join(walked, " ") != want {
+				t.Fatalf("unexpected walk %v", walked)
+			}
+
+			meta, err := dav.Stat("a/b/文件 1.txt")
+			if err != nil || meta.Size != int64(len("hello again")) || meta.IsDir {
+				t.Fatalf("unexpected stat %+v: %v", meta, err)
+			}
+			if _, err := dav.Stat("missing"); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("expected ErrNotExist, got %v", err)
+			}
+			entries, err := dav.ReadDir("a")
+			if err != nil || len(entries) != 1 || entries[0].RelPath != "b" || !entries[0].IsDir {
+				t.Fatalf("unexpected readdir %+v: %v", entries, err)
+			}
+
+			if err := dav.WriteExclusive("lock", []byte("1"), 0o644); err != nil {
+				t.Fatalf("exclusive write: %v", err)
+			}
+			if err := dav.WriteExclusive("lock", []byte("2"), 0o644); !errors.Is(err, fs.ErrExist) {
+				t.Fatalf("expected ErrExist, got %v", err)
+			}
+			if err := dav.Rename("top.txt", "c/moved.txt"); err != nil {
+				t.Fatalf("rename: %v", err)
+			}
+			if got := readDAVFile(t, dav, "c/moved.txt"); got != "x" {
+				t.Fatalf("unexpected moved content %q", got)
+			}
+			if err := dav.Remove("a"); err != nil {
+				t.Fatalf("remove: %v", err)
+			}
+			if err := dav.Remove("a"); err != nil {
+				t.Fatalf("removing missing path should succeed: %v", err)
+			}
+			if _, err := dav.Stat("a/b"); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("expected removed dir, got %v", err)
+			}
+			writeDAVFile(t, dav, "a/b/again.txt", "y")
+		})
+	}
+}
+
+func TestWebDAVWriterAbortKeepsTarget(t *testing.T) {
+	_, dav := newDAVServer(t, "")
+	writeDAVFile(t, dav, "a.txt", "good content")
+	w, err := dav.Create("a.txt", 0o644)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := io.WriteString(w, "trunc"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	w.(Aborter).Abort()
+	if err := w.Close(); err == nil {
+		t.Fatalf("close after abort should fail")
+	}
+	if got := readDAVFile(t, dav, "a.txt"); got != "good content" {
+		t.Fatalf("aborted upload replaced target: %q", got)
+	}
+}
+
+func TestWebDAVWriterHashesUpload(t *testing.T) {
+	_, dav := newDAVServer(t, "digest")
+	payload := strings.Repeat("0123456789", 10000)
+	w, err := dav.Create("a.txt", 0o644)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	h := sha256.New()
+	w.(UploadHasher).HashUpload(h)
+	if _, err := io.WriteString(w, payload); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if want := sha256.Sum256([]byte(payload)); !bytes.Equal(h.Sum(nil), want[:]) {
+		t.Fatalf("upload hash mismatch")
+	}
+	if got := readDAVFile(t, dav, "a.txt"); got != payload {
+		t.Fatalf("unexpected content length %d", len(got))
+	}
+}
+
+func TestWebDAVFSPropfindTrailingSlash(t *testing.T) {
+	d, dav := newDAVServer(t, "")
+	writeDAVFile(t, dav, "file.txt", "x")
+	if err := os.MkdirAll(filepath.Join(d.root, "repo", "outside"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	d.propfinds = nil
+
+	if meta, err := dav.Stat("file.txt"); err != nil || meta.IsDir {
+		t.Fatalf("stat file: %+v, %v", meta, err)
+	}
+	// 不是本实例创建的目录先不带 / 请求，收到重定向后带 / 重试
+	if meta, err := dav.Stat("outside"); err != nil || !meta.IsDir {
+		t.Fatalf("stat unknown dir: %+v, %v", meta, err)
+	}
+	if meta, err := dav.Stat("outside"); err != nil || !meta.IsDir {
+		t.Fatalf("stat known dir: %+v, %v", meta, err)
+	}
+	want := "/dav/repo/file.txt /dav/repo/outside /dav/repo/outside/ /dav/repo/outside/"
+	if got := strings.Join(d.propfinds, " "); got != want {
+		t.Fatalf("unexpected PROPFIND paths:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestWebDAVFSRequestsDoNotHang(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+	u, _ := url.Parse(srv.URL)
+	ep := Endpoint{Type: EndpointWebDAV, Host: u.Host, Path: "/dav"}
+
+	oldTimeout := webdavResponseTimeout
+	webdavResponseTimeout = 100 * time.Millisecond
+	dav := NewWebDAVFS(context.Background(), ep, "", "")
+	webdavResponseTimeout = oldTimeout
+	if _, err := dav.Stat("a.txt"); err == nil {
+		t.Fatalf("stat should fail when the server never responds")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	dav = NewWebDAVFS(ctx, ep, "", "")
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if _, err := dav.Stat("a.txt"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("stat should stop with the run context, got %v", err)
+	}
+}
+
+func TestWebDAVFSRejectsBadCredentials(t *testing.T) {
+	d, dav := newDAVServer(t, "basic")
+	d.pass = "other"
+	_, err := dav.Stat("")
+	var davErr *WebDAVError
+	if !errors.As(err, &davErr) || davErr.StatusCode != http.StatusUnauthorized || IsTransient(err) {
+		t.Fatalf("expected permanent 401 error, got %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package fssnap
+
+import (
+	"fmt"
+	"path"
+
+	"zbackup/pkg/endpoint"
+)
+
+// Btrfs 为源端所在的子卷创建只读快照，快照放在子卷旁边的 .<子卷名>.zbackup-<快照名>
+type Btrfs struct {
+	// Subvolume 为要做快照的子卷，为空时使用源路径本身
+	Subvolume string
+
+	snap string
+}
+
+func (b *Btrfs) Name() string {
+	return "btrfs"
+}
+
+func (b *Btrfs) Create(run endpoint.CommandRunner, source, name string) (string, error) {
+	root, err := resolve(run, source)
+	if err != nil {
+		return "", err
+	}
+	subvol := root
+	if b.Subvolume != "" {
+		if subvol, err = resolve(run, b.Subvolume); err != nil {
+			return "", err
+		}
+	}
+	rel, err := within(subvol, root)
+	if err != nil {
+		return "", err
+	}
+	b.snap = path.Join(path.Dir(subvol), "."+path.Base(subvol)+".zbackup-"+name)
+	// 先删除中断的运行残留的同名快照
+	script := b.removeScript() + fmt.Sprintf(" && btrfs subvolume snapshot -r %s %s >/dev/null", shellQuote(subvol), shellQuote(b.snap))
+	if _, err := run.RunCommand(script); err != nil {
+		return "", fmt.Errorf("创建 btrfs 快照失败: %w", err)
+	}
+	return path.Join(b.snap, rel), nil
+}
+
+func (b *Btrfs) Remove(run endpoint.CommandRunner) error {
+	if b.snap == "" {
+		return nil
+	}
+	if _, err := run.RunCommand(b.removeScript()); err != nil {
+		return fmt.Errorf("删除 btrfs 快照 %s 失败: %w", b.snap, err)
+	}
+	b.snap = ""
+	return nil
+}
+
+func (b *Btrfs) removeScript() string {
+	return fmt.Sprintf("if [ -e %[1]s ]; then btrfs subvolume delete %[1]s >/dev/null; fi", shellQuote(b.snap))
+}
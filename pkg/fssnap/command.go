@@ -0,0 +1,49 @@
+package fssnap
+
+import (
+	"fmt"
+	"strings"
+
+	"zbackup/pkg/endpoint"
+)
+
+// Command 用一对自定义命令创建和删除冻结视图。命令通过环境变量 ZBACKUP_SOURCE、
+// ZBACKUP_SNAPSHOT 获得源路径与快照名，删除命令另有 ZBACKUP_VIEW；
+// 创建命令标准输出的最后一个非空行为视图路径，没有输出时直接读取源路径（如只暂停写入的场景）
+type Command struct {
+	CreateCmd string
+	RemoveCmd string
+
+	env  string
+	view string
+}
+
+func (c *Command) Name() string {
+	return "command"
+}
+
+func (c *Command) Create(run endpoint.CommandRunner, source, name string) (string, error) {
+	c.env = fmt.Sprintf("ZBACKUP_SOURCE=%s ZBACKUP_SNAPSHOT=%s; export ZBACKUP_SOURCE ZBACKUP_SNAPSHOT; ", shellQuote(source), shellQuote(name))
+	out, err := run.RunCommand(c.env + c.CreateCmd)
+	if err != nil {
+		return "", fmt.Errorf("执行快照创建命令失败: %w", err)
+	}
+	c.view = source
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		c.view = last
+	}
+	return c.view, nil
+}
+
+func (c *Command) Remove(run endpoint.CommandRunner) error {
+	if c.env == "" || c.RemoveCmd == "" {
+		return nil
+	}
+	script := c.env + fmt.Sprintf("ZBACKUP_VIEW=%s; export ZBACKUP_VIEW; ", shellQuote(c.view)) + c.RemoveCmd
+	if _, err := run.RunCommand(script); err != nil {
+		return fmt.Errorf("执行快照删除命令失败: %w", err)
+	}
+	c.env = ""
+	return nil
+}
@@ -0,0 +1,87 @@
+package fssnap
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"zbackup/pkg/endpoint"
+)
+
+// Fake 把本地源目录完整复制到 Dir 下作为冻结视图，不执行任何命令，供测试使用
+type Fake struct {
+	Dir string
+	// Err 非空时 Create 在复制完成后返回该错误，用于测试失败时的清理
+	Err error
+	// Created、Removed 为 Create 与实际删除视图的次数
+	Created int
+	Removed int
+
+	view string
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) Create(run endpoint.CommandRunner, source, name string) (string, error) {
+	f.Created++
+	f.view = filepath.Join(f.Dir, name)
+	if err := copyTree(source, f.view); err != nil {
+		return "", err
+	}
+	if f.Err != nil {
+		return "", f.Err
+	}
+	return f.view, nil
+}
+
+func (f *Fake) Remove(run endpoint.CommandRunner) error {
+	if f.view == "" {
+		return nil
+	}
+	if err := os.RemoveAll(f.view); err != nil {
+		return err
+	}
+	f.view = ""
+	f.Removed++
+	return nil
+}
+
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|0o700)
+		}
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+		return os.Chtimes(target, info.ModTime(), info.ModTime())
+	})
+}
@@ -0,0 +1,82 @@
+// Package fssnap 在扫描源端之前创建文件系统级快照（btrfs、ZFS、LVM 或自定义命令），
+// 让备份读取一个冻结的只读视图，避免逐个文件读取正在写入的目录时得到不一致的结果
+package fssnap
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"zbackup/pkg/endpoint"
+)
+
+// Provider 为源端创建冻结视图。命令通过 endpoint.CommandRunner 在源端所在主机上执行，
+// 同一个 Provider 只用于一次运行
+type Provider interface {
+	// Name 返回用于日志的提供者名称
+	Name() string
+	// Create 为 source 创建冻结视图，返回视图中与 source 对应的路径；name 为本次快照名
+	Create(run endpoint.CommandRunner, source, name string) (string, error)
+	// Remove 删除 Create 留下的全部资源；Create 失败或未调用时也可安全调用
+	Remove(run endpoint.CommandRunner) error
+}
+
+// defaultLVMSize 为 LVM 快照默认的写时复制空间
+const defaultLVMSize = "1G"
+
+// Parse 解析 --fs-snapshot 参数：btrfs[:<子卷>]、zfs:<数据集>、lvm:<卷组>/<逻辑卷>[:<大小>]
+func Parse(spec string) (Provider, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "btrfs":
+		return &Btrfs{Subvolume: arg}, nil
+	case "zfs":
+		if arg == "" {
+			return nil, fmt.Errorf("ZFS 快照需要指定数据集，如 zfs:tank/data")
+		}
+		return &ZFS{Dataset: arg}, nil
+	case "lvm":
+		volume, size, _ := strings.Cut(arg, ":")
+		vg, lv, ok := strings.Cut(volume, "/")
+		if !ok || vg == "" || lv == "" {
+			return nil, fmt.Errorf("LVM 快照需要指定逻辑卷，如 lvm:vg0/data[:2G]")
+		}
+		if size == "" {
+			size = defaultLVMSize
+		}
+		return &LVM{VolumeGroup: vg, Volume: lv, Size: size}, nil
+	}
+	return nil, fmt.Errorf("未知的文件系统快照类型 %q，可选 btrfs、zfs、lvm", kind)
+}
+
+// resolve 返回 source 在源端主机上的绝对路径（解析符号链接）
+func resolve(run endpoint.CommandRunner, source string) (string, error) {
+	out, err := run.RunCommand(fmt.Sprintf("cd %s && pwd -P", shellQuote(source)))
+	if err != nil {
+		return "", fmt.Errorf("解析源路径 %s 失败: %w", source, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// within 返回 p 相对 root 的路径，p 不在 root 之下时返回错误
+func within(root, p string) (string, error) {
+	root, p = path.Clean(root), path.Clean(p)
+	if p == root {
+		return ".", nil
+	}
+	prefix := strings.TrimSuffix(root, "/") + "/"
+	if !strings.HasPrefix(p, prefix) {
+		return "", fmt.Errorf("源路径 %s 不在 %s 之下", p, root)
+	}
+	return strings.TrimPrefix(p, prefix), nil
+}
+
+// firstLine 返回命令输出的第一行
+func firstLine(out []byte) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return strings.TrimSpace(line)
+}
+
+func shellQuote(val string) string {
+	return "'" + strings.ReplaceAll(val, "'", `'\''`) + "'"
+}
@@ -0,0 +1,128 @@
+package fssnap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zbackup/pkg/endpoint"
+)
+
+// scriptRunner 记录执行的脚本，pwd -P 直接返回 cd 的目标，其余按前缀返回预设输出
+type scriptRunner struct {
+	scripts []string
+	outputs map[string]string
+}
+
+func (r *scriptRunner) RunCommand(script string) ([]byte, error) {
+	r.scripts = append(r.scripts, script)
+	if dir, ok := strings.CutPrefix(script, "cd '"); ok && strings.HasSuffix(script, "' && pwd -P") {
+		return []byte(strings.TrimSuffix(dir, "' && pwd -P") + "\n"), nil
+	}
+	for prefix, out := range r.outputs {
+		if strings.HasPrefix(script, prefix) {
+			return []byte(out), nil
+		}
+	}
+	return nil, nil
+}
+
+func TestParse(t *testing.T) {
+	p, err := Parse("lvm:vg0/data")
+	if err != nil {
+		t.Fatalf("parse lvm: %v", err)
+	}
+	if l := p.(*LVM); l.VolumeGroup != "vg0" || l.Volume != "data" || l.Size != defaultLVMSize {
+		t.Fatalf("lvm = %+v", l)
+	}
+	if p, err := Parse("btrfs:/srv"); err != nil || p.(*Btrfs).Subvolume != "/srv" {
+		t.Fatalf("btrfs = %+v %v", p, err)
+	}
+	for _, bad := range []string{"zfs", "lvm:data", "ext4"} {
+		if _, err := Parse(bad); err == nil {
+			t.Fatalf("Parse(%q) should fail", bad)
+		}
+	}
+}
+
+func TestProviderViews(t *testing.T) {
+	cases := []struct {
+		provider Provider
+		outputs  map[string]string
+		view     string
+		created  string
+		removed  string
+	}{
+		{
+			provider: &Btrfs{Subvolume: "/srv"},
+			view:     "/.srv.zbackup-s1/db",
+			created:  "btrfs subvolume snapshot -r '/srv' '/.srv.zbackup-s1'",
+			removed:  "btrfs subvolume delete '/.srv.zbackup-s1'",
+		},
+		{
+			provider: &ZFS{Dataset: "tank/srv"},
+			outputs:  map[string]string{"zfs get": "/srv\n"},
+			view:     "/srv/.zfs/snapshot/zbackup-s1/db",
+			created:  "zfs snapshot 'tank/srv@zbackup-s1'",
+			removed:  "zfs destroy 'tank/srv@zbackup-s1'",
+		},
+		{
+			provider: &LVM{VolumeGroup: "vg0", Volume: "srv", Size: "2G"},
+			outputs:  map[string]string{"findmnt": "/srv\n"},
+			view:     "/run/zbackup/vg0-srv-zbackup-s1/db",
+			created:  "lvcreate -q -s -L '2G' -n 'srv-zbackup-s1' 'vg0/srv'",
+			removed:  "lvremove -q -f 'vg0/srv-zbackup-s1'",
+		},
+	}
+	for _, c := range cases {
+		run := &scriptRunner{outputs: c.outputs}
+		view, err := c.provider.Create(run, "/srv/db", "s1")
+		if err != nil || view != c.view {
+			t.Fatalf("%s: view = %q %v", c.provider.Name(), view, err)
+		}
+		if last := run.scripts[len(run.scripts)-1]; !strings.Contains(last, c.created) {
+			t.Fatalf("%s: create script %q", c.provider.Name(), last)
+		}
+		if err := c.provider.Remove(run); err != nil {
+			t.Fatalf("%s: remove: %v", c.provider.Name(), err)
+		}
+		if last := run.scripts[len(run.scripts)-1]; !strings.Contains(last, c.removed) {
+			t.Fatalf("%s: remove script %q", c.provider.Name(), last)
+		}
+		// 已清理或从未创建时再次清理不执行命令
+		n := len(run.scripts)
+		if err := c.provider.Remove(run); err != nil || len(run.scripts) != n {
+			t.Fatalf("%s: second remove ran %d scripts: %v", c.provider.Name(), len(run.scripts)-n, err)
+		}
+	}
+
+	if _, err := (&ZFS{Dataset: "tank/other"}).Create(&scriptRunner{outputs: map[string]string{"zfs get": "/other\n"}}, "/srv/db", "s1"); err == nil {
+		t.Fatal("source outside the dataset should fail")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	dir := t.TempDir()
+	run := endpoint.NewLocalFS(dir)
+	marker := filepath.Join(dir, "removed")
+	c := &Command{
+		CreateCmd: `mkdir -p "$ZBACKUP_SOURCE/view-$ZBACKUP_SNAPSHOT" && echo noise >&2 && echo "$ZBACKUP_SOURCE/view-$ZBACKUP_SNAPSHOT"`,
+		RemoveCmd: `rmdir "$ZBACKUP_VIEW" && touch ` + marker,
+	}
+	view, err := c.Create(run, dir, "s1")
+	if err != nil || view != filepath.Join(dir, "view-s1") {
+		t.Fatalf("view = %q %v", view, err)
+	}
+	if err := c.Remove(run); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Fatalf("remove command did not run: %v", err)
+	}
+
+	failing := &Command{CreateCmd: "echo broken >&2; exit 3"}
+	if _, err := failing.Create(run, dir, "s2"); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Fatalf("create error should carry stderr, got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package fssnap
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"zbackup/pkg/endpoint"
+)
+
+// lvmMountDir 为 LVM 快照卷的只读挂载位置
+const lvmMountDir = "/run/zbackup"
+
+// LVM 为源端所在的逻辑卷创建写时复制快照卷，并只读挂载到 /run/zbackup/<快照卷名>
+type LVM struct {
+	VolumeGroup string
+	Volume      string
+	// Size 为快照卷的写时复制空间（lvcreate -L），备份期间原卷的改动超过它时快照失效
+	Size string
+
+	snap  string
+	mount string
+}
+
+func (l *LVM) Name() string {
+	return "lvm"
+}
+
+func (l *LVM) Create(run endpoint.CommandRunner, source, name string) (string, error) {
+	root, err := resolve(run, source)
+	if err != nil {
+		return "", err
+	}
+	origin := "/dev/" + l.VolumeGroup + "/" + l.Volume
+	out, err := run.RunCommand(fmt.Sprintf("findmnt -n -o TARGET --first-only --source %s", shellQuote(origin)))
+	if err != nil {
+		return "", fmt.Errorf("查找逻辑卷 %s 的挂载点失败: %w", origin, err)
+	}
+	rel, err := within(firstLine(out), root)
+	if err != nil {
+		return "", err
+	}
+	snapLV := l.Volume + "-zbackup-" + lvName(name)
+	l.snap = l.VolumeGroup + "/" + snapLV
+	l.mount = path.Join(lvmMountDir, l.VolumeGroup+"-"+snapLV)
+	dev := "/dev/" + l.snap
+	// XFS 快照与原卷 UUID 相同，需要 nouuid 才能同时挂载
+	script := l.removeScript() + fmt.Sprintf(` && lvcreate -q -s -L %[1]s -n %[2]s %[3]s >/dev/null && mkdir -p %[4]s && opts=ro && if [ "$(blkid -o value -s TYPE %[5]s)" = xfs ]; then opts=ro,nouuid; fi && mount -o "$opts" %[5]s %[4]s`,
+		shellQuote(l.Size), shellQuote(snapLV), shellQuote(l.VolumeGroup+"/"+l.Volume), shellQuote(l.mount), shellQuote(dev))
+	if _, err := run.RunCommand(script); err != nil {
+		return "", fmt.Errorf("创建 LVM 快照失败: %w", err)
+	}
+	return path.Join(l.mount, rel), nil
+}
+
+func (l *LVM) Remove(run endpoint.CommandRunner) error {
+	if l.snap == "" {
+		return nil
+	}
+	if _, err := run.RunCommand(l.removeScript()); err != nil {
+		return fmt.Errorf("删除 LVM 快照 %s 失败: %w", l.snap, err)
+	}
+	l.snap, l.mount = "", ""
+	return nil
+}
+
+func (l *LVM) removeScript() string {
+	return fmt.Sprintf(`if mountpoint -q %[1]s 2>/dev/null; then umount %[1]s; fi && if lvs %[2]s >/dev/null 2>&1; then lvremove -q -f %[2]s >/dev/null; fi && { rmdir %[1]s 2>/dev/null || true; }`,
+		shellQuote(l.mount), shellQuote(l.snap))
+}
+
+// lvName 把快照名中逻辑卷名不允许的字符替换为下划线
+func lvName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '+', r == '_', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,60 @@
+package fssnap
+
+import (
+	"fmt"
+	"path"
+
+	"zbackup/pkg/endpoint"
+)
+
+// ZFS 为数据集创建 <数据集>@zbackup-<快照名>，通过挂载点下的 .zfs/snapshot 目录读取
+type ZFS struct {
+	Dataset string
+
+	snap string
+}
+
+func (z *ZFS) Name() string {
+	return "zfs"
+}
+
+func (z *ZFS) Create(run endpoint.CommandRunner, source, name string) (string, error) {
+	root, err := resolve(run, source)
+	if err != nil {
+		return "", err
+	}
+	out, err := run.RunCommand(fmt.Sprintf("zfs get -H -o value mountpoint %s", shellQuote(z.Dataset)))
+	if err != nil {
+		return "", fmt.Errorf("读取数据集 %s 的挂载点失败: %w", z.Dataset, err)
+	}
+	mountpoint := firstLine(out)
+	if !path.IsAbs(mountpoint) {
+		return "", fmt.Errorf("数据集 %s 没有可用的挂载点（%s）", z.Dataset, mountpoint)
+	}
+	rel, err := within(mountpoint, root)
+	if err != nil {
+		return "", err
+	}
+	snapName := "zbackup-" + name
+	z.snap = z.Dataset + "@" + snapName
+	script := z.removeScript() + fmt.Sprintf(" && zfs snapshot %s", shellQuote(z.snap))
+	if _, err := run.RunCommand(script); err != nil {
+		return "", fmt.Errorf("创建 ZFS 快照失败: %w", err)
+	}
+	return path.Join(mountpoint, ".zfs", "snapshot", snapName, rel), nil
+}
+
+func (z *ZFS) Remove(run endpoint.CommandRunner) error {
+	if z.snap == "" {
+		return nil
+	}
+	if _, err := run.RunCommand(z.removeScript()); err != nil {
+		return fmt.Errorf("删除 ZFS 快照 %s 失败: %w", z.snap, err)
+	}
+	z.snap = ""
+	return nil
+}
+
+func (z *ZFS) removeScript() string {
+	return fmt.Sprintf("if zfs list -H -t snapshot %[1]s >/dev/null 2>&1; then zfs destroy %[1]s; fi", shellQuote(z.snap))
+}
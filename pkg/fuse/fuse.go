@@ -0,0 +1,19 @@
+// Package fuse 实现只读的 FUSE 用户态文件系统服务，把任意 fs.FS 挂载到本地目录。
+// 直接使用内核的 /dev/fuse 协议，不依赖 libfuse；以 root 运行时直接调用 mount(2)，
+// 否则借助 fusermount3 / fusermount 完成挂载。目前仅支持 Linux
+package fuse
+
+import "errors"
+
+// ErrUnsupported 表示当前平台不支持 FUSE 挂载
+var ErrUnsupported = errors.New("FUSE 挂载目前仅支持 Linux")
+
+// Options 控制挂载行为
+type Options struct {
+	// FSName 显示在 mount / df 输出中的来源名称
+	FSName string
+	// AllowOther 允许其他用户访问挂载点（非 root 时需要 /etc/fuse.conf 中启用 user_allow_other）
+	AllowOther bool
+	// ErrorLog 非空时，读取条目或文件内容失败会通过它报告；返回给内核的只是错误码
+	ErrorLog func(op, path string, err error)
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package fuse
+
+import "io/fs"
+
+// Server 在非 Linux 平台上不可用
+type Server struct{}
+
+// Mount 在非 Linux 平台上总是返回 ErrUnsupported
+func Mount(mountpoint string, fsys fs.FS, opts Options) (*Server, error) {
+	return nil, ErrUnsupported
+}
+
+// Serve 在非 Linux 平台上总是返回 ErrUnsupported
+func (s *Server) Serve() error { return ErrUnsupported }
+
+// Unmount 在非 Linux 平台上总是返回 ErrUnsupported
+func (s *Server) Unmount() error { return ErrUnsupported }
@@ -0,0 +1,124 @@
+package fuse
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Mount 把 fsys 只读挂载到 mountpoint，之后需调用 Serve 处理请求
+func Mount(mountpoint string, fsys fs.FS, opts Options) (*Server, error) {
+	abs, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("挂载点 %s 不是目录", abs)
+	}
+	if opts.FSName == "" {
+		opts.FSName = "zbackup"
+	}
+	s := newServer(fsys, opts)
+	s.mountpoint = abs
+	if os.Geteuid() == 0 {
+		s.fd, err = mountDirect(abs, opts)
+	} else {
+		s.fusermount, err = findFusermount()
+		if err == nil {
+			s.fd, err = mountFusermount(s.fusermount, abs, opts)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Unmount 卸载文件系统，Serve 随后返回
+func (s *Server) Unmount() error {
+	if s.fusermount == "" {
+		return syscall.Unmount(s.mountpoint, 0)
+	}
+	out, err := exec.Command(s.fusermount, "-u", s.mountpoint).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("卸载 %s 失败: %v: %s", s.mountpoint, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// mountDirect 以 root 身份直接调用 mount(2)
+func mountDirect(mountpoint string, opts Options) (int, error) {
+	fd, err := syscall.Open("/dev/fuse", syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("打开 /dev/fuse 失败: %w", err)
+	}
+	data := fmt.Sprintf("fd=%d,rootmode=40000,user_id=%d,group_id=%d,default_permissions", fd, os.Getuid(), os.Getgid())
+	if opts.AllowOther {
+		data += ",allow_other"
+	}
+	flags := uintptr(syscall.MS_RDONLY | syscall.MS_NOSUID | syscall.MS_NODEV)
+	if err := syscall.Mount(opts.FSName, mountpoint, "fuse.zbackup", flags, data); err != nil {
+		syscall.Close(fd)
+		return -1, fmt.Errorf("挂载 %s 失败: %w", mountpoint, err)
+	}
+	return fd, nil
+}
+
+func findFusermount() (string, error) {
+	for _, name := range []string{"fusermount3", "fusermount"} {
+		if bin, err := exec.LookPath(name); err == nil {
+			return bin, nil
+		}
+	}
+	return "", fmt.Errorf("非 root 用户挂载需要 fusermount3 或 fusermount（通常由 fuse3 / fuse 软件包提供）")
+}
+
+// mountFusermount 由 setuid 的 fusermount 完成挂载，并通过 unix socket 取回 /dev/fuse 的描述符
+func mountFusermount(bin, mountpoint string, opts Options) (int, error) {
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+	defer syscall.Close(pair[0])
+	remote := os.NewFile(uintptr(pair[1]), "fusermount-comm")
+	defer remote.Close()
+
+	options := "ro,nosuid,nodev,default_permissions,subtype=zbackup,fsname=" + strings.ReplaceAll(opts.FSName, ",", "_")
+	if opts.AllowOther {
+		options += ",allow_other"
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(bin, "-o", options, "--", mountpoint)
+	cmd.ExtraFiles = []*os.File{remote}
+	cmd.Env = append(os.Environ(), "_FUSE_COMMFD=3")
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return -1, fmt.Errorf("%s 挂载 %s 失败: %v: %s", bin, mountpoint, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	buf := make([]byte, 4)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_, oobn, _, _, err := syscall.Recvmsg(pair[0], buf, oob, 0)
+	if err != nil {
+		return -1, fmt.Errorf("接收 fusermount 传回的描述符失败: %w", err)
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) == 0 {
+		return -1, fmt.Errorf("fusermount 未传回描述符: %v", err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) == 0 {
+		return -1, fmt.Errorf("fusermount 未传回描述符: %v", err)
+	}
+	syscall.CloseOnExec(fds[0])
+	return fds[0], nil
+}
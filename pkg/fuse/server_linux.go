@@ -0,0 +1,513 @@
+package fuse
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 内核协议版本 7.31；只用到其中与只读访问相关的请求
+const (
+	protoMajor = 7
+	protoMinor = 31
+
+	inHeaderSize  = 40
+	outHeaderSize = 16
+	maxWrite      = 128 << 10
+	// 读请求的缓冲区需大于内核单个请求的上限（max_write 加头部）
+	readBufSize = 1<<20 + 4096
+
+	// 内容不可变，内核可以长时间缓存条目与属性
+	cacheTimeout = time.Hour
+	rootID       = 1
+)
+
+const (
+	opLookup      = 1
+	opForget      = 2
+	opGetattr     = 3
+	opSetattr     = 4
+	opReadlink    = 5
+	opSymlink     = 6
+	opMknod       = 8
+	opMkdir       = 9
+	opUnlink      = 10
+	opRmdir       = 11
+	opRename      = 12
+	opLink        = 13
+	opOpen        = 14
+	opRead        = 15
+	opWrite       = 16
+	opStatfs      = 17
+	opRelease     = 18
+	opFsync       = 20
+	opSetxattr    = 21
+	opGetxattr    = 22
+	opListxattr   = 23
+	opRemovexattr = 24
+	opFlush       = 25
+	opInit        = 26
+	opOpendir     = 27
+	opReaddir     = 28
+	opReleasedir  = 29
+	opFsyncdir    = 30
+	opAccess      = 34
+	opCreate      = 35
+	opInterrupt   = 36
+	opDestroy     = 38
+	opBatchForget = 42
+	opFallocate   = 43
+	opRename2     = 45
+	opCopyRange   = 47
+)
+
+const (
+	openKeepCache = 1 << 1
+
+	sIFDIR = 0o040000
+	sIFREG = 0o100000
+	dtDir  = 4
+	dtReg  = 8
+)
+
+var order = binary.NativeEndian
+
+// Server 处理一个挂载点上的 FUSE 请求
+type Server struct {
+	fsys       fs.FS
+	opts       Options
+	fd         int
+	mountpoint string
+	fusermount string
+	uid, gid   uint32
+
+	mu      sync.Mutex
+	paths   map[uint64]string
+	inodes  map[string]uint64
+	nextIno uint64
+	handles map[uint64]any
+	nextFh  uint64
+
+	wg sync.WaitGroup
+}
+
+func newServer(fsys fs.FS, opts Options) *Server {
+	return &Server{
+		fsys:    fsys,
+		opts:    opts,
+		fd:      -1,
+		uid:     uint32(os.Getuid()),
+		gid:     uint32(os.Getgid()),
+		paths:   map[uint64]string{rootID: "."},
+		inodes:  map[string]uint64{".": rootID},
+		nextIno: rootID + 1,
+		handles: make(map[uint64]any),
+		nextFh:  1,
+	}
+}
+
+// Serve 处理请求直到文件系统被卸载
+func (s *Server) Serve() error {
+	defer syscall.Close(s.fd)
+	buf := make([]byte, readBufSize)
+	for {
+		n, err := syscall.Read(s.fd, buf)
+		switch {
+		case err == syscall.EINTR, err == syscall.EAGAIN, err == syscall.ENOENT:
+			// ENOENT 表示请求在读取前已被中断
+			continue
+		case err == syscall.ENODEV:
+			s.wg.Wait()
+			return nil
+		case err != nil:
+			s.wg.Wait()
+			return fmt.Errorf("读取 FUSE 请求失败: %w", err)
+		}
+		req := append([]byte(nil), buf[:n]...)
+		switch opcodeOf(req) {
+		case opInit, opForget, opBatchForget, opInterrupt:
+			s.reply(s.handle(req))
+		case opDestroy:
+			s.wg.Wait()
+			s.reply(s.handle(req))
+			return nil
+		default:
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.reply(s.handle(req))
+			}()
+		}
+	}
+}
+
+func (s *Server) reply(out []byte) {
+	if out == nil {
+		return
+	}
+	// 请求已被中断时内核返回 ENOENT，忽略即可
+	_, _ = syscall.Write(s.fd, out)
+}
+
+func opcodeOf(req []byte) uint32 {
+	if len(req) < inHeaderSize {
+		return 0
+	}
+	return order.Uint32(req[4:])
+}
+
+type inHeader struct {
+	opcode uint32
+	unique uint64
+	nodeid uint64
+}
+
+// handle 处理单个请求，返回需写回内核的应答；无需应答的请求返回 nil
+func (s *Server) handle(req []byte) []byte {
+	if len(req) < inHeaderSize {
+		return nil
+	}
+	size := int(order.Uint32(req[0:]))
+	if size < inHeaderSize || size > len(req) {
+		return nil
+	}
+	h := inHeader{
+		opcode: order.Uint32(req[4:]),
+		unique: order.Uint64(req[8:]),
+		nodeid: order.Uint64(req[16:]),
+	}
+	body := req[inHeaderSize:size]
+	switch h.opcode {
+	case opForget, opBatchForget, opInterrupt:
+		// 条目编号在整个挂载期间保持不变，不需要回收
+		return nil
+	case opInit:
+		return s.init(h, body)
+	case opDestroy, opFlush, opFsync, opFsyncdir:
+		return replyOK(h, nil)
+	case opLookup:
+		return s.lookup(h, body)
+	case opGetattr:
+		return s.getattr(h)
+	case opOpen:
+		return s.open(h, body)
+	case opRead:
+		return s.read(h, body)
+	case opRelease, opReleasedir:
+		return s.release(h, body)
+	case opOpendir:
+		return s.opendir(h)
+	case opReaddir:
+		return s.readdir(h, body)
+	case opStatfs:
+		return s.statfs(h)
+	case opAccess:
+		if len(body) >= 4 && order.Uint32(body)&2 != 0 {
+			return replyErr(h, syscall.EROFS)
+		}
+		return replyOK(h, nil)
+	case opGetxattr:
+		return replyErr(h, syscall.ENODATA)
+	case opListxattr:
+		if len(body) >= 4 && order.Uint32(body) == 0 {
+			return replyOK(h, make([]byte, 8))
+		}
+		return replyOK(h, nil)
+	case opSetattr, opSymlink, opMknod, opMkdir, opUnlink, opRmdir, opRename, opLink,
+		opWrite, opSetxattr, opRemovexattr, opCreate, opFallocate, opRename2, opCopyRange:
+		return replyErr(h, syscall.EROFS)
+	default:
+		return replyErr(h, syscall.ENOSYS)
+	}
+}
+
+func (s *Server) init(h inHeader, body []byte) []byte {
+	if len(body) < 16 {
+		return replyErr(h, syscall.EINVAL)
+	}
+	major := order.Uint32(body[0:])
+	readahead := order.Uint32(body[8:])
+	if major < protoMajor {
+		return replyErr(h, syscall.EPROTO)
+	}
+	out := make([]byte, 64)
+	order.PutUint32(out[0:], protoMajor)
+	order.PutUint32(out[4:], protoMinor)
+	order.PutUint32(out[8:], readahead)
+	// 不启用 FUSE_ASYNC_READ：内核按顺序发出读请求，文件内容可以复用同一个流
+	order.PutUint32(out[20:], maxWrite)
+	order.PutUint32(out[24:], 1) // time_gran
+	return replyOK(h, out)
+}
+
+func (s *Server) lookup(h inHeader, body []byte) []byte {
+	parent, ok := s.pathOf(h.nodeid)
+	if !ok {
+		return replyErr(h, syscall.ENOENT)
+	}
+	name := cstring(body)
+	rel := childPath(parent, name)
+	info, err := fs.Stat(s.fsys, rel)
+	if err != nil {
+		return replyErr(h, s.errno("lookup", rel, err))
+	}
+	ino := s.inode(rel)
+	out := make([]byte, 40, 128)
+	order.PutUint64(out[0:], ino)
+	order.PutUint64(out[16:], uint64(cacheTimeout/time.Second))
+	order.PutUint64(out[24:], uint64(cacheTimeout/time.Second))
+	return replyOK(h, s.appendAttr(out, ino, info))
+}
+
+func (s *Server) getattr(h inHeader) []byte {
+	rel, ok := s.pathOf(h.nodeid)
+	if !ok {
+		return replyErr(h, syscall.ENOENT)
+	}
+	info, err := fs.Stat(s.fsys, rel)
+	if err != nil {
+		return replyErr(h, s.errno("getattr", rel, err))
+	}
+	out := make([]byte, 16, 104)
+	order.PutUint64(out[0:], uint64(cacheTimeout/time.Second))
+	return replyOK(h, s.appendAttr(out, h.nodeid, info))
+}
+
+func (s *Server) open(h inHeader, body []byte) []byte {
+	rel, ok := s.pathOf(h.nodeid)
+	if !ok {
+		return replyErr(h, syscall.ENOENT)
+	}
+	if len(body) >= 4 && order.Uint32(body)&syscall.O_ACCMODE != syscall.O_RDONLY {
+		return replyErr(h, syscall.EROFS)
+	}
+	file, err := s.fsys.Open(rel)
+	if err != nil {
+		return replyErr(h, s.errno("open", rel, err))
+	}
+	if _, ok := file.(io.ReaderAt); !ok {
+		file.Close()
+		return replyErr(h, syscall.ENOTSUP)
+	}
+	out := make([]byte, 16)
+	order.PutUint64(out[0:], s.addHandle(file))
+	order.PutUint32(out[8:], openKeepCache)
+	return replyOK(h, out)
+}
+
+func (s *Server) read(h inHeader, body []byte) []byte {
+	if len(body) < 24 {
+		return replyErr(h, syscall.EINVAL)
+	}
+	fh := order.Uint64(body[0:])
+	offset := int64(order.Uint64(body[8:]))
+	size := min(order.Uint32(body[16:]), maxWrite)
+	file, ok := s.lookupHandle(fh).(fs.File)
+	if !ok {
+		return replyErr(h, syscall.EBADF)
+	}
+	buf := make([]byte, size)
+	n, err := file.(io.ReaderAt).ReadAt(buf, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		rel, _ := s.pathOf(h.nodeid)
+		return replyErr(h, s.errno("read", rel, err))
+	}
+	return replyOK(h, buf[:n])
+}
+
+func (s *Server) release(h inHeader, body []byte) []byte {
+	if len(body) >= 8 {
+		fh := order.Uint64(body)
+		s.mu.Lock()
+		handle := s.handles[fh]
+		delete(s.handles, fh)
+		s.mu.Unlock()
+		if file, ok := handle.(fs.File); ok {
+			file.Close()
+		}
+	}
+	return replyOK(h, nil)
+}
+
+type dirHandle struct {
+	path    string
+	entries []fs.DirEntry
+}
+
+func (s *Server) opendir(h inHeader) []byte {
+	rel, ok := s.pathOf(h.nodeid)
+	if !ok {
+		return replyErr(h, syscall.ENOENT)
+	}
+	entries, err := fs.ReadDir(s.fsys, rel)
+	if err != nil {
+		return replyErr(h, s.errno("readdir", rel, err))
+	}
+	out := make([]byte, 16)
+	order.PutUint64(out[0:], s.addHandle(&dirHandle{path: rel, entries: entries}))
+	return replyOK(h, out)
+}
+
+func (s *Server) readdir(h inHeader, body []byte) []byte {
+	if len(body) < 24 {
+		return replyErr(h, syscall.EINVAL)
+	}
+	fh := order.Uint64(body[0:])
+	offset := order.Uint64(body[8:])
+	size := int(order.Uint32(body[16:]))
+	dir, ok := s.lookupHandle(fh).(*dirHandle)
+	if !ok {
+		return replyErr(h, syscall.EBADF)
+	}
+	var out []byte
+	for i := offset; i < uint64(len(dir.entries)); i++ {
+		entry := dir.entries[i]
+		name := entry.Name()
+		recLen := (24 + len(name) + 7) &^ 7
+		if len(out)+recLen > size {
+			break
+		}
+		typ := uint32(dtReg)
+		if entry.IsDir() {
+			typ = dtDir
+		}
+		rec := make([]byte, recLen)
+		order.PutUint64(rec[0:], s.inode(childPath(dir.path, name)))
+		order.PutUint64(rec[8:], i+1)
+		order.PutUint32(rec[16:], uint32(len(name)))
+		order.PutUint32(rec[20:], typ)
+		copy(rec[24:], name)
+		out = append(out, rec...)
+	}
+	return replyOK(h, out)
+}
+
+func (s *Server) statfs(h inHeader) []byte {
+	out := make([]byte, 80)
+	order.PutUint32(out[40:], 4096) // bsize
+	order.PutUint32(out[44:], 255)  // namelen
+	order.PutUint32(out[48:], 4096) // frsize
+	return replyOK(h, out)
+}
+
+// appendAttr 追加 fuse_attr 结构
+func (s *Server) appendAttr(out []byte, ino uint64, info fs.FileInfo) []byte {
+	mode := uint32(info.Mode().Perm())
+	nlink := uint32(1)
+	if info.IsDir() {
+		mode |= sIFDIR
+		nlink = 2
+	} else {
+		mode |= sIFREG
+	}
+	var sec uint64
+	var nsec uint32
+	if mt := info.ModTime(); !mt.IsZero() && mt.Unix() > 0 {
+		sec, nsec = uint64(mt.Unix()), uint32(mt.Nanosecond())
+	}
+	size := uint64(info.Size())
+	attr := make([]byte, 88)
+	order.PutUint64(attr[0:], ino)
+	order.PutUint64(attr[8:], size)
+	order.PutUint64(attr[16:], (size+511)/512)
+	for _, off := range []int{24, 32, 40} {
+		order.PutUint64(attr[off:], sec)
+	}
+	for _, off := range []int{48, 52, 56} {
+		order.PutUint32(attr[off:], nsec)
+	}
+	order.PutUint32(attr[60:], mode)
+	order.PutUint32(attr[64:], nlink)
+	order.PutUint32(attr[68:], s.uid)
+	order.PutUint32(attr[72:], s.gid)
+	order.PutUint32(attr[80:], 4096) // blksize
+	return append(out, attr...)
+}
+
+func (s *Server) pathOf(ino uint64) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rel, ok := s.paths[ino]
+	return rel, ok
+}
+
+// inode 为路径分配稳定的条目编号
+func (s *Server) inode(rel string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ino, ok := s.inodes[rel]; ok {
+		return ino
+	}
+	ino := s.nextIno
+	s.nextIno++
+	s.inodes[rel] = ino
+	s.paths[ino] = rel
+	return ino
+}
+
+func (s *Server) addHandle(handle any) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fh := s.nextFh
+	s.nextFh++
+	s.handles[fh] = handle
+	return fh
+}
+
+func (s *Server) lookupHandle(fh uint64) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handles[fh]
+}
+
+// errno 把 fs.FS 的错误映射为内核错误码，非预期的错误通过 ErrorLog 报告
+func (s *Server) errno(op, rel string, err error) syscall.Errno {
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrInvalid):
+		return syscall.ENOENT
+	case errors.Is(err, fs.ErrPermission):
+		return syscall.EACCES
+	}
+	if s.opts.ErrorLog != nil {
+		s.opts.ErrorLog(op, rel, err)
+	}
+	return syscall.EIO
+}
+
+func replyOK(h inHeader, payload []byte) []byte {
+	out := make([]byte, outHeaderSize, outHeaderSize+len(payload))
+	order.PutUint32(out[0:], uint32(outHeaderSize+len(payload)))
+	order.PutUint64(out[8:], h.unique)
+	return append(out, payload...)
+}
+
+func replyErr(h inHeader, errno syscall.Errno) []byte {
+	out := make([]byte, outHeaderSize)
+	order.PutUint32(out[0:], outHeaderSize)
+	order.PutUint32(out[4:], uint32(-int32(errno)))
+	order.PutUint64(out[8:], h.unique)
+	return out
+}
+
+func cstring(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+func childPath(parent, name string) string {
+	if parent == "." {
+		return name
+	}
+	return path.Join(parent, name)
+}
@@ -0,0 +1,129 @@
+package fuse
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// request 按内核格式编码一个请求
+func request(opcode uint32, unique, nodeid uint64, body []byte) []byte {
+	req := make([]byte, inHeaderSize, inHeaderSize+len(body))
+	order.PutUint32(req[0:], uint32(inHeaderSize+len(body)))
+	order.PutUint32(req[4:], opcode)
+	order.PutUint64(req[8:], unique)
+	order.PutUint64(req[16:], nodeid)
+	return append(req, body...)
+}
+
+func readIn(fh, offset uint64, size uint32) []byte {
+	body := make([]byte, 40)
+	order.PutUint64(body[0:], fh)
+	order.PutUint64(body[8:], offset)
+	order.PutUint32(body[16:], size)
+	return body
+}
+
+// parseReply 校验应答头并返回错误码与负载
+func parseReply(t *testing.T, out []byte, unique uint64) (syscall.Errno, []byte) {
+	t.Helper()
+	if len(out) < outHeaderSize || int(order.Uint32(out[0:])) != len(out) || order.Uint64(out[8:]) != unique {
+		t.Fatalf("malformed reply %v", out)
+	}
+	return syscall.Errno(-int32(order.Uint32(out[4:]))), out[outHeaderSize:]
+}
+
+func TestServerRequests(t *testing.T) {
+	mtime := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"dir/hello.txt": {Data: []byte("hello, world"), Mode: 0o640, ModTime: mtime},
+		"dir/sub":       {Mode: 0o755 | 1<<31},
+	}
+	s := newServer(fsys, Options{})
+
+	initBody := make([]byte, 16)
+	order.PutUint32(initBody[0:], 7)
+	order.PutUint32(initBody[4:], 38)
+	order.PutUint32(initBody[8:], 1<<17)
+	errno, payload := parseReply(t, s.handle(request(opInit, 1, 0, initBody)), 1)
+	if errno != 0 || len(payload) != 64 || order.Uint32(payload[0:]) != protoMajor {
+		t.Fatalf("init reply: %v %v", errno, payload)
+	}
+
+	lookup := func(unique, parent uint64, name string) (uint64, []byte) {
+		errno, payload := parseReply(t, s.handle(request(opLookup, unique, parent, append([]byte(name), 0))), unique)
+		if errno != 0 || len(payload) != 128 {
+			t.Fatalf("lookup %s: %v", name, errno)
+		}
+		return order.Uint64(payload[0:]), payload[40:]
+	}
+	dirIno, dirAttr := lookup(2, rootID, "dir")
+	if order.Uint32(dirAttr[60:])&sIFDIR == 0 {
+		t.Fatalf("dir should have S_IFDIR mode, got %o", order.Uint32(dirAttr[60:]))
+	}
+	fileIno, fileAttr := lookup(3, dirIno, "hello.txt")
+	if order.Uint64(fileAttr[8:]) != 12 || order.Uint32(fileAttr[60:]) != sIFREG|0o640 || order.Uint64(fileAttr[32:]) != uint64(mtime.Unix()) {
+		t.Fatalf("unexpected file attr size=%d mode=%o", order.Uint64(fileAttr[8:]), order.Uint32(fileAttr[60:]))
+	}
+	if again, _ := lookup(4, dirIno, "hello.txt"); again != fileIno {
+		t.Fatalf("inode should be stable, got %d and %d", fileIno, again)
+	}
+	if errno, _ := parseReply(t, s.handle(request(opLookup, 5, dirIno, []byte("missing\x00"))), 5); errno != syscall.ENOENT {
+		t.Fatalf("lookup missing: %v", errno)
+	}
+
+	if errno, payload := parseReply(t, s.handle(request(opGetattr, 6, fileIno, make([]byte, 16))), 6); errno != 0 || order.Uint64(payload[16:]) != fileIno {
+		t.Fatalf("getattr: %v", errno)
+	}
+
+	openBody := make([]byte, 8)
+	order.PutUint32(openBody, syscall.O_RDWR)
+	if errno, _ := parseReply(t, s.handle(request(opOpen, 7, fileIno, openBody)), 7); errno != syscall.EROFS {
+		t.Fatalf("open for writing should fail with EROFS, got %v", errno)
+	}
+	order.PutUint32(openBody, syscall.O_RDONLY)
+	errno, payload = parseReply(t, s.handle(request(opOpen, 8, fileIno, openBody)), 8)
+	if errno != 0 {
+		t.Fatalf("open: %v", errno)
+	}
+	fh := order.Uint64(payload)
+	if errno, data := parseReply(t, s.handle(request(opRead, 9, fileIno, readIn(fh, 7, 100))), 9); errno != 0 || string(data) != "world" {
+		t.Fatalf("read: %v %q", errno, data)
+	}
+	parseReply(t, s.handle(request(opRelease, 10, fileIno, readIn(fh, 0, 0))), 10)
+	if errno, _ := parseReply(t, s.handle(request(opRead, 11, fileIno, readIn(fh, 0, 10))), 11); errno != syscall.EBADF {
+		t.Fatalf("read after release should fail, got %v", errno)
+	}
+
+	errno, payload = parseReply(t, s.handle(request(opOpendir, 12, dirIno, make([]byte, 8))), 12)
+	if errno != 0 {
+		t.Fatalf("opendir: %v", errno)
+	}
+	dh := order.Uint64(payload)
+	var names []string
+	for offset := uint64(0); ; {
+		// 缓冲区只容得下一个条目，验证按偏移量分批读取
+		errno, data := parseReply(t, s.handle(request(opReaddir, 13, dirIno, readIn(dh, offset, 40))), 13)
+		if errno != 0 {
+			t.Fatalf("readdir: %v", errno)
+		}
+		if len(data) == 0 {
+			break
+		}
+		namelen := order.Uint32(data[16:])
+		names = append(names, string(data[24:24+namelen]))
+		offset = order.Uint64(data[8:])
+	}
+	if strings.Join(names, ",") != "hello.txt,sub" {
+		t.Fatalf("unexpected dir entries %v", names)
+	}
+
+	if errno, _ := parseReply(t, s.handle(request(opMkdir, 14, dirIno, []byte("x\x00"))), 14); errno != syscall.EROFS {
+		t.Fatalf("mkdir should fail with EROFS, got %v", errno)
+	}
+	if out := s.handle(request(opForget, 15, fileIno, make([]byte, 8))); out != nil {
+		t.Fatalf("forget must not be answered")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"os"
 	"strings"
 )
 
@@ -26,6 +27,10 @@ func New(level string, writers ...io.Writer) (*Logger, error) {
 		output = io.MultiWriter(writers...)
 	}
 	for _, w := range writers {
+		// 标准输出与标准错误由进程持有，不随 Logger 关闭
+		if w == os.Stdout || w == os.Stderr {
+			continue
+		}
 		if c, ok := w.(io.Closer); ok {
 			closerList = append(closerList, c)
 		}
@@ -0,0 +1,523 @@
+package meta
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"zbackup/pkg/endpoint"
+)
+
+// 快照索引格式（.idx）：
+//
+//	magic | uvarint 头长度 | 头 JSON | 数据块... | 块目录 | 8 字节块目录偏移 | magic
+//
+// 文件条目按 RelPath 字节序排列，每 indexChunkSize 条压缩为一个 flate 数据块，
+// 块内路径做前缀压缩。块目录记录每块的首个路径、偏移、长度与条目数，
+// 查找时只需二分定位并解压单个数据块。
+var indexMagic = []byte("ZBIDX\x01")
+
+const indexChunkSize = 1024
+
+const (
+	flagDir       = 1 << 0
+	flagSparse    = 1 << 1
+	flagHexDigest = 1 << 2
+	flagChunks    = 1 << 3
+)
+
+// ErrIndexOrder 表示写入索引的条目未按路径升序排列
+var ErrIndexOrder = errors.New("索引条目必须按路径升序写入")
+
+// indexHeader 为索引中除文件列表以外的快照信息
+type indexHeader struct {
+	Name       string    `json:"name"`
+	CreatedAt  time.Time `json:"created_at"`
+	SourceRoot string    `json:"source_root"`
+	DestRoot   string    `json:"dest_root"`
+	Completed  bool      `json:"completed"`
+	Chunked    bool      `json:"chunked,omitempty"`
+	Tree       string    `json:"tree,omitempty"`
+	Sync       bool      `json:"sync,omitempty"`
+}
+
+type chunkInfo struct {
+	first  string
+	offset int64
+	length int64
+	count  int
+}
+
+// IndexWriter 以流式方式写出快照索引，条目需按路径升序加入
+type IndexWriter struct {
+	w       *countingWriter
+	chunk   bytes.Buffer
+	prev    string
+	inChunk int
+	first   string
+	started bool
+	chunks  []chunkInfo
+	scratch []byte
+}
+
+// NewIndexWriter 写出索引头并返回写入器
+func NewIndexWriter(w io.Writer, snap Snapshot) (*IndexWriter, error) {
+	cw := &countingWriter{w: w}
+	header, err := json.Marshal(indexHeader{
+		Name:       snap.Name,
+		CreatedAt:  snap.CreatedAt.UTC(),
+		SourceRoot: snap.SourceRoot,
+		DestRoot:   snap.DestRoot,
+		Completed:  snap.Completed,
+		Chunked:    snap.Chunked,
+		Tree:       snap.Tree,
+		Sync:       snap.Sync,
+	})
+	if err != nil {
+		return nil, err
+	}
+	buf := append([]byte{}, indexMagic...)
+	buf = binary.AppendUvarint(buf, uint64(len(header)))
+	buf = append(buf, header...)
+	if _, err := cw.Write(buf); err != nil {
+		return nil, err
+	}
+	return &IndexWriter{w: cw}, nil
+}
+
+// Add 追加一个条目
+func (iw *IndexWriter) Add(meta endpoint.FileMeta) error {
+	if iw.started && meta.RelPath <= iw.prev {
+		return fmt.Errorf("%w: %q 位于 %q 之后", ErrIndexOrder, meta.RelPath, iw.prev)
+	}
+	if iw.inChunk == 0 {
+		iw.first = meta.RelPath
+		iw.prev = ""
+	}
+	iw.scratch = appendRecord(iw.scratch[:0], iw.prev, meta)
+	iw.chunk.Write(iw.scratch)
+	iw.prev = meta.RelPath
+	iw.started = true
+	iw.inChunk++
+	if iw.inChunk >= indexChunkSize {
+		return iw.flushChunk()
+	}
+	return nil
+}
+
+// Close 写出剩余数据块与块目录
+func (iw *IndexWriter) Close() error {
+	if err := iw.flushChunk(); err != nil {
+		return err
+	}
+	footerOffset := iw.w.n
+	var buf []byte
+	buf = binary.AppendUvarint(buf, uint64(len(iw.chunks)))
+	for _, c := range iw.chunks {
+		buf = appendString(buf, c.first)
+		buf = binary.AppendUvarint(buf, uint64(c.offset))
+		buf = binary.AppendUvarint(buf, uint64(c.length))
+		buf = binary.AppendUvarint(buf, uint64(c.count))
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(footerOffset))
+	buf = append(buf, indexMagic...)
+	_, err := iw.w.Write(buf)
+	return err
+}
+
+func (iw *IndexWriter) flushChunk() error {
+	if iw.inChunk == 0 {
+		return nil
+	}
+	offset := iw.w.n
+	zw, err := flate.NewWriter(iw.w, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := zw.Write(iw.chunk.Bytes()); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	iw.chunks = append(iw.chunks, chunkInfo{first: iw.first, offset: offset, length: iw.w.n - offset, count: iw.inChunk})
+	iw.chunk.Reset()
+	iw.inChunk = 0
+	return nil
+}
+
+// EncodeIndex 把完整快照编码为索引格式
+func EncodeIndex(snap Snapshot) ([]byte, error) {
+	var buf bytes.Buffer
+	iw, err := NewIndexWriter(&buf, snap)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(snap.Files))
+	for rel := range snap.Files {
+		keys = append(keys, rel)
+	}
+	sort.Strings(keys)
+	for _, rel := range keys {
+		meta := snap.Files[rel]
+		meta.RelPath = rel
+		if err := iw.Add(meta); err != nil {
+			return nil, err
+		}
+	}
+	if err := iw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Index 是只读的快照索引，支持按路径查找与顺序遍历而无需展开全部条目
+type Index struct {
+	data   []byte
+	header indexHeader
+	chunks []chunkInfo
+	count  int
+
+	cachedChunk int
+	cached      []endpoint.FileMeta
+}
+
+// IsIndex 判断数据是否为索引格式
+func IsIndex(data []byte) bool {
+	return bytes.HasPrefix(data, indexMagic)
+}
+
+// OpenIndex 解析索引数据
+func OpenIndex(data []byte) (*Index, error) {
+	if !IsIndex(data) || len(data) < len(indexMagic)*2+8 {
+		return nil, errors.New("快照索引格式错误")
+	}
+	if !bytes.HasSuffix(data, indexMagic) {
+		return nil, errors.New("快照索引不完整")
+	}
+	pos := len(indexMagic)
+	headerLen, n := binary.Uvarint(data[pos:])
+	if n <= 0 || pos+n+int(headerLen) > len(data) {
+		return nil, errors.New("快照索引头损坏")
+	}
+	pos += n
+	idx := &Index{data: data, cachedChunk: -1}
+	if err := json.Unmarshal(data[pos:pos+int(headerLen)], &idx.header); err != nil {
+		return nil, fmt.Errorf("快照索引头损坏: %w", err)
+	}
+	tail := len(data) - len(indexMagic) - 8
+	footerOffset := int(binary.LittleEndian.Uint64(data[tail:]))
+	if footerOffset < pos || footerOffset > tail {
+		return nil, errors.New("快照索引目录损坏")
+	}
+	r := &byteReader{data: data[footerOffset:tail]}
+	chunkCount := r.uvarint()
+	for i := uint64(0); i < chunkCount && r.err == nil; i++ {
+		c := chunkInfo{
+			first:  r.string(),
+			offset: int64(r.uvarint()),
+			length: int64(r.uvarint()),
+			count:  int(r.uvarint()),
+		}
+		if c.offset < 0 || c.offset+c.length > int64(footerOffset) {
+			return nil, errors.New("快照索引目录损坏")
+		}
+		idx.chunks = append(idx.chunks, c)
+		idx.count += c.count
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("快照索引目录损坏: %w", r.err)
+	}
+	return idx, nil
+}
+
+// Len 返回条目数量，nil 索引返回 0
+func (idx *Index) Len() int {
+	if idx == nil {
+		return 0
+	}
+	return idx.count
+}
+
+// Lookup 按路径查找条目
+func (idx *Index) Lookup(rel string) (endpoint.FileMeta, bool, error) {
+	i := sort.Search(len(idx.chunks), func(i int) bool { return idx.chunks[i].first > rel }) - 1
+	if i < 0 {
+		return endpoint.FileMeta{}, false, nil
+	}
+	records, err := idx.chunk(i)
+	if err != nil {
+		return endpoint.FileMeta{}, false, err
+	}
+	j := sort.Search(len(records), func(j int) bool { return records[j].RelPath >= rel })
+	if j < len(records) && records[j].RelPath == rel {
+		return records[j], true, nil
+	}
+	return endpoint.FileMeta{}, false, nil
+}
+
+// Each 按路径顺序遍历全部条目
+func (idx *Index) Each(fn func(endpoint.FileMeta) error) error {
+	for i := range idx.chunks {
+		records, err := idx.decodeChunk(i)
+		if err != nil {
+			return err
+		}
+		for _, meta := range records {
+			if err := fn(meta); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Info 返回快照概要，无需解压条目
+func (idx *Index) Info() SnapshotInfo {
+	return SnapshotInfo{
+		Name:       idx.header.Name,
+		CreatedAt:  idx.header.CreatedAt,
+		SourceRoot: idx.header.SourceRoot,
+		Completed:  idx.header.Completed,
+		Files:      idx.count,
+		Chunked:    idx.header.Chunked,
+		Tree:       idx.header.Tree,
+		Sync:       idx.header.Sync,
+	}
+}
+
+// Snapshot 展开为完整的 Snapshot
+func (idx *Index) Snapshot() (*Snapshot, error) {
+	snap := &Snapshot{
+		Name:       idx.header.Name,
+		CreatedAt:  idx.header.CreatedAt,
+		SourceRoot: idx.header.SourceRoot,
+		DestRoot:   idx.header.DestRoot,
+		Completed:  idx.header.Completed,
+		Chunked:    idx.header.Chunked,
+		Tree:       idx.header.Tree,
+		Sync:       idx.header.Sync,
+		Files:      make(map[string]endpoint.FileMeta, idx.count),
+	}
+	err := idx.Each(func(meta endpoint.FileMeta) error {
+		snap.Files[meta.RelPath] = meta
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+func (idx *Index) chunk(i int) ([]endpoint.FileMeta, error) {
+	if idx.cachedChunk == i {
+		return idx.cached, nil
+	}
+	records, err := idx.decodeChunk(i)
+	if err != nil {
+		return nil, err
+	}
+	idx.cachedChunk = i
+	idx.cached = records
+	return records, nil
+}
+
+func (idx *Index) decodeChunk(i int) ([]endpoint.FileMeta, error) {
+	c := idx.chunks[i]
+	zr := flate.NewReader(bytes.NewReader(idx.data[c.offset : c.offset+c.length]))
+	defer zr.Close()
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("解压快照索引失败: %w", err)
+	}
+	r := &byteReader{data: raw}
+	records := make([]endpoint.FileMeta, 0, c.count)
+	prev := ""
+	for j := 0; j < c.count; j++ {
+		meta := readRecord(r, prev)
+		if r.err != nil {
+			return nil, fmt.Errorf("快照索引条目损坏: %w", r.err)
+		}
+		records = append(records, meta)
+		prev = meta.RelPath
+	}
+	return records, nil
+}
+
+// appendRecord 编码单个条目，路径相对 prev 做前缀压缩；prev 为空时写出完整路径
+func appendRecord(buf []byte, prev string, meta endpoint.FileMeta) []byte {
+	shared := commonPrefix(prev, meta.RelPath)
+	buf = binary.AppendUvarint(buf, uint64(shared))
+	buf = appendString(buf, meta.RelPath[shared:])
+	buf = binary.AppendVarint(buf, meta.Size)
+	buf = binary.AppendVarint(buf, meta.ModTime.Unix())
+	buf = binary.AppendUvarint(buf, uint64(meta.ModTime.Nanosecond()))
+	buf = binary.AppendUvarint(buf, uint64(meta.Mode))
+	var flags byte
+	if meta.IsDir {
+		flags |= flagDir
+	}
+	if meta.Sparse {
+		flags |= flagSparse
+	}
+	checksum := []byte(meta.Checksum)
+	if raw, err := hex.DecodeString(meta.Checksum); err == nil && len(raw) > 0 && hex.EncodeToString(raw) == meta.Checksum {
+		flags |= flagHexDigest
+		checksum = raw
+	}
+	if len(meta.Chunks) > 0 {
+		flags |= flagChunks
+	}
+	buf = append(buf, flags)
+	buf = binary.AppendUvarint(buf, uint64(len(checksum)))
+	buf = append(buf, checksum...)
+	if len(meta.Chunks) > 0 {
+		// 数据块引用为 SHA-256 十六进制串，按原始字节存放
+		buf = binary.AppendUvarint(buf, uint64(len(meta.Chunks)))
+		for _, ref := range meta.Chunks {
+			raw, _ := hex.DecodeString(ref)
+			buf = binary.AppendUvarint(buf, uint64(len(raw)))
+			buf = append(buf, raw...)
+		}
+	}
+	return buf
+}
+
+func readRecord(r *byteReader, prev string) endpoint.FileMeta {
+	shared := int(r.uvarint())
+	suffix := r.string()
+	if shared > len(prev) {
+		r.fail(errors.New("前缀长度越界"))
+		return endpoint.FileMeta{}
+	}
+	meta := endpoint.FileMeta{RelPath: prev[:shared] + suffix}
+	meta.Size = r.varint()
+	sec := r.varint()
+	nsec := int64(r.uvarint())
+	meta.ModTime = time.Unix(sec, nsec).UTC()
+	meta.Mode = uint32(r.uvarint())
+	flags := r.byte()
+	meta.IsDir = flags&flagDir != 0
+	meta.Sparse = flags&flagSparse != 0
+	checksum := r.bytes()
+	if flags&flagHexDigest != 0 {
+		meta.Checksum = hex.EncodeToString(checksum)
+	} else {
+		meta.Checksum = string(checksum)
+	}
+	if flags&flagChunks != 0 {
+		n := r.uvarint()
+		if n > uint64(len(r.data)) {
+			r.fail(errors.New("数据块数量越界"))
+			return endpoint.FileMeta{}
+		}
+		meta.Chunks = make([]string, 0, n)
+		for i := uint64(0); i < n; i++ {
+			meta.Chunks = append(meta.Chunks, hex.EncodeToString(r.bytes()))
+		}
+	}
+	return meta
+}
+
+func commonPrefix(a, b string) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// byteReader 顺序解码变长整数与字节串，首个错误之后的读取均返回零值
+type byteReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *byteReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *byteReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.fail(io.ErrUnexpectedEOF)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *byteReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data[r.pos:])
+	if n <= 0 {
+		r.fail(io.ErrUnexpectedEOF)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *byteReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos >= len(r.data) {
+		r.fail(io.ErrUnexpectedEOF)
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *byteReader) bytes() []byte {
+	n := int(r.uvarint())
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.data) {
+		r.fail(io.ErrUnexpectedEOF)
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *byteReader) string() string {
+	return string(r.bytes())
+}
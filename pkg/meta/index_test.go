@@ -0,0 +1,148 @@
+package meta
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"zbackup/pkg/endpoint"
+)
+
+func TestIndexRoundTripAndLookup(t *testing.T) {
+	files := make(map[string]endpoint.FileMeta)
+	for i := 0; i < indexChunkSize*2+10; i++ {
+		rel := fmt.Sprintf("dir%02d/文件-%05d.txt", i%7, i)
+		files[rel] = endpoint.FileMeta{
+			RelPath:  rel,
+			Size:     int64(i),
+			Mode:     0o644,
+			ModTime:  time.Unix(1700000000+int64(i), 123456789),
+			Checksum: fmt.Sprintf("%064x", i),
+		}
+	}
+	files["dir00"] = endpoint.FileMeta{RelPath: "dir00", IsDir: true, Mode: 0o755}
+	files["vm.img"] = endpoint.FileMeta{RelPath: "vm.img", Size: 1 << 30, Sparse: true, Checksum: "not-hex"}
+	snap := Snapshot{Name: "s1", CreatedAt: time.Now(), SourceRoot: "/src", DestRoot: "/dst", Files: files, Completed: true}
+
+	data, err := EncodeIndex(snap)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	legacy, _ := json.Marshal(snap)
+	if len(data)*4 > len(legacy) {
+		t.Fatalf("index should be much smaller than json: %d vs %d", len(data), len(legacy))
+	}
+	idx, err := OpenIndex(data)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if idx.Len() != len(files) {
+		t.Fatalf("unexpected len %d", idx.Len())
+	}
+	for rel, want := range files {
+		got, ok, err := idx.Lookup(rel)
+		if err != nil || !ok {
+			t.Fatalf("lookup %s: ok=%v err=%v", rel, ok, err)
+		}
+		if got.Size != want.Size || !got.ModTime.Equal(want.ModTime) || got.Checksum != want.Checksum ||
+			got.IsDir != want.IsDir || got.Sparse != want.Sparse || got.Mode != want.Mode {
+			t.Fatalf("lookup %s: got %+v want %+v", rel, got, want)
+		}
+	}
+	if _, ok, _ := idx.Lookup("missing"); ok {
+		t.Fatalf("missing path should not be found")
+	}
+	back, err := idx.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if back.Name != "s1" || !back.Completed || len(back.Files) != len(files) {
+		t.Fatalf("unexpected snapshot %+v", back.Name)
+	}
+}
+
+func TestIndexRoundTripChunks(t *testing.T) {
+	refs := []string{fmt.Sprintf("%064x", 1), fmt.Sprintf("%064x", 2), fmt.Sprintf("%064x", 1)}
+	snap := Snapshot{Name: "c1", Chunked: true, Files: map[string]endpoint.FileMeta{
+		"db.dump": {RelPath: "db.dump", Size: 3 << 20, Chunks: refs},
+		"empty":   {RelPath: "empty"},
+	}}
+	data, err := EncodeIndex(snap)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	back, err := decodeSnapshot(data)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !back.Chunked {
+		t.Fatalf("chunked flag lost")
+	}
+	if got := back.Files["db.dump"].Chunks; fmt.Sprint(got) != fmt.Sprint(refs) {
+		t.Fatalf("unexpected chunks %v", got)
+	}
+	if got := back.Files["empty"].Chunks; got != nil {
+		t.Fatalf("empty file should have no chunks, got %v", got)
+	}
+}
+
+func TestIndexWriterRejectsUnsorted(t *testing.T) {
+	iw, err := NewIndexWriter(&bytes.Buffer{}, Snapshot{Name: "x"})
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	if err := iw.Add(endpoint.FileMeta{RelPath: "b"}); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := iw.Add(endpoint.FileMeta{RelPath: "a"}); !errors.Is(err, ErrIndexOrder) {
+		t.Fatalf("expected order error, got %v", err)
+	}
+}
+
+func TestStoreMigratesLegacyJSON(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(endpoint.NewLocalFS(dir))
+	legacy := Snapshot{
+		Name:      "old",
+		Files:     map[string]endpoint.FileMeta{"a.txt": {RelPath: "a.txt", Size: 1}},
+		Completed: true,
+	}
+	data, _ := json.MarshalIndent(legacy, "", "  ")
+	snapDir := filepath.Join(dir, metaDir, snapshotDir)
+	if err := os.MkdirAll(snapDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(snapDir, "old.json"), data, 0o644); err != nil {
+		t.Fatalf("write legacy: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, metaDir, legacyPendingFile), data, 0o644); err != nil {
+		t.Fatalf("write legacy pending: %v", err)
+	}
+	loaded, err := store.Load("old")
+	if err != nil || loaded == nil || loaded.Files["a.txt"].Size != 1 {
+		t.Fatalf("legacy load failed: %+v %v", loaded, err)
+	}
+	n, err := store.Migrate()
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 conversions, got %d", n)
+	}
+	if _, err := os.Stat(filepath.Join(snapDir, "old.json")); !os.IsNotExist(err) {
+		t.Fatalf("legacy json should be removed")
+	}
+	names, err := store.ListSnapshots()
+	if err != nil || len(names) != 1 || names[0] != "old" {
+		t.Fatalf("unexpected snapshots %v %v", names, err)
+	}
+	pending, err := store.LoadPending()
+	if err != nil || pending == nil || pending.Files["a.txt"].Size != 1 {
+		t.Fatalf("pending not migrated: %+v %v", pending, err)
+	}
+}
@@ -0,0 +1,346 @@
+package meta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"zbackup/pkg/endpoint"
+)
+
+// 进度日志格式（pending.log）：
+//
+//	magic | 帧(头 JSON) | 帧(条目)...
+//
+// 每帧为 uvarint 长度 + 内容 + 4 字节 CRC32，条目内容与快照索引中的记录编码一致。
+// 回放时遇到不完整或校验失败的帧即停止，从而容忍崩溃时写了一半的尾部。
+//
+// 不支持追加写入的目标端（S3、WebDAV）上 pending.log 只含 magic 与头，条目帧在每次 Sync 时
+// 写成编号递增的分段对象 pending.log.1、pending.log.2…，回放时按编号顺序接在 pending.log 之后
+var journalMagic = []byte("ZBJNL\x01")
+
+const journalFile = "pending.log"
+
+// JournalHeader 记录进度日志所属的快照以及作为基准的快照名
+type JournalHeader struct {
+	Name       string    `json:"name"`
+	Base       string    `json:"base,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	SourceRoot string    `json:"source_root"`
+	DestRoot   string    `json:"dest_root"`
+	Chunked    bool      `json:"chunked,omitempty"`
+	Tree       string    `json:"tree,omitempty"`
+}
+
+// Journal 是只追加的进度日志，每条成功的条目立即写出
+type Journal struct {
+	store  *Store
+	mu     sync.Mutex
+	writer io.WriteCloser
+	// buffered 在目标端不支持追加写入时保存上次 Sync 之后的条目帧，Sync 时写成新的分段
+	buffered *bytes.Buffer
+	// segments 为已写出的分段数
+	segments int
+	scratch  []byte
+}
+
+// OpenJournal 新建进度日志，覆盖已有的 pending.log；调用前应先用 CompactPending 合并旧日志
+func (s *Store) OpenJournal(header JournalHeader) (*Journal, error) {
+	header.CreatedAt = header.CreatedAt.UTC()
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	// 残留的分段属于旧日志，先删除，避免被接在新日志之后回放
+	if err := s.removeJournalSegments(); err != nil {
+		return nil, err
+	}
+	start := appendFrame(append([]byte{}, journalMagic...), data)
+	if err := s.writeFile(s.journalPath(), start, 0o644); err != nil {
+		return nil, err
+	}
+	j := &Journal{store: s}
+	appender, ok := s.fs.(endpoint.AppendFS)
+	if !ok {
+		j.buffered = &bytes.Buffer{}
+		return j, nil
+	}
+	writer, err := appender.Append(s.journalPath())
+	if err != nil {
+		return nil, err
+	}
+	j.writer = writer
+	return j, nil
+}
+
+// Append 追加一条成功记录。远端的追加会话可能随连接中断而失效，
+// 写入失败时重新打开日志后再写一次，仍失败时返回错误，调用方应中止运行
+func (j *Journal) Append(meta endpoint.FileMeta) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.scratch = appendRecord(j.scratch[:0], "", meta)
+	frame := appendFrame(nil, j.scratch)
+	if j.buffered != nil {
+		j.buffered.Write(frame)
+		return nil
+	}
+	if _, err := j.writer.Write(frame); err == nil {
+		return nil
+	} else if rerr := j.reopen(); rerr != nil {
+		return fmt.Errorf("%w；重新打开进度日志失败: %v", err, rerr)
+	}
+	_, err := j.writer.Write(frame)
+	return err
+}
+
+// reopen 重建连接并重新打开追加会话。中断时可能留下写了一半的帧，回放遇到它就会停止，
+// 因此先把日志截断到最后一个完整的帧，之后追加的记录才能被回放
+func (j *Journal) reopen() error {
+	j.writer.Close()
+	if rc, ok := j.store.fs.(endpoint.Reconnector); ok {
+		if err := rc.Reconnect(); err != nil {
+			return err
+		}
+	}
+	data, err := j.store.readFile(j.store.journalPath())
+	if err != nil {
+		return err
+	}
+	valid := journalPrefix(data)
+	if valid == 0 {
+		return errors.New("进度日志头损坏")
+	}
+	if valid < len(data) {
+		if err := j.store.writeFile(j.store.journalPath(), data[:valid], 0o644); err != nil {
+			return err
+		}
+	}
+	writer, err := j.store.fs.(endpoint.AppendFS).Append(j.store.journalPath())
+	if err != nil {
+		return err
+	}
+	j.writer = writer
+	return nil
+}
+
+// Sync 把已追加的记录落盘
+func (j *Journal) Sync() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.buffered != nil {
+		if j.buffered.Len() == 0 {
+			return nil
+		}
+		// 写入失败时保留缓冲，下次 Sync 以同一编号重试
+		if err := j.store.writeFile(j.store.journalSegmentPath(j.segments+1), j.buffered.Bytes(), 0o644); err != nil {
+			return err
+		}
+		j.segments++
+		j.buffered.Reset()
+		return nil
+	}
+	if syncer, ok := j.writer.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
+// Close 落盘并关闭日志
+func (j *Journal) Close() error {
+	if err := j.Sync(); err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.writer != nil {
+		err := j.writer.Close()
+		j.writer = nil
+		return err
+	}
+	return nil
+}
+
+// CompactPending 把 pending.log 及其分段合并进 pending.idx 并删除日志
+func (s *Store) CompactPending(snap Snapshot) error {
+	if err := s.SavePending(snap); err != nil {
+		return err
+	}
+	return s.removeJournal()
+}
+
+// removeJournal 删除 pending.log 及其分段
+func (s *Store) removeJournal() error {
+	if err := s.fs.Remove(s.journalPath()); err != nil && !isNotFound(err) {
+		return err
+	}
+	return s.removeJournalSegments()
+}
+
+// removeJournalSegments 先找出分段数，再从最大编号往下删除。中途失败时剩下的仍是从 1 开始的
+// 连续分段，下次清理能够找到；从小编号删起会留下找不到的高编号分段，被接在下一份日志之后回放
+func (s *Store) removeJournalSegments() error {
+	n := 0
+	for {
+		if _, err := s.fs.Stat(s.journalSegmentPath(n + 1)); err != nil {
+			if isNotFound(err) {
+				break
+			}
+			return err
+		}
+		n++
+	}
+	for ; n > 0; n-- {
+		if err := s.fs.Remove(s.journalSegmentPath(n)); err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// readJournal 读取 pending.log，并按编号顺序接上各分段
+func (s *Store) readJournal() ([]byte, error) {
+	data, err := s.readFile(s.journalPath())
+	if err != nil {
+		return nil, err
+	}
+	for n := 1; ; n++ {
+		segment, err := s.readFile(s.journalSegmentPath(n))
+		if err != nil {
+			if isNotFound(err) {
+				return data, nil
+			}
+			return nil, err
+		}
+		data = append(data, segment...)
+	}
+}
+
+// replayJournal 在 base 之上回放 pending.log；日志不存在时原样返回 base
+func (s *Store) replayJournal(base *Snapshot) (*Snapshot, error) {
+	data, err := s.readJournal()
+	if err != nil {
+		if isNotFound(err) {
+			return base, nil
+		}
+		return nil, err
+	}
+	header, records, err := decodeJournal(data)
+	if err != nil {
+		return nil, err
+	}
+	if base == nil {
+		if header.Base != "" {
+			if base, err = s.Load(header.Base); err != nil {
+				return nil, fmt.Errorf("读取进度日志基准快照失败: %w", err)
+			}
+		}
+		snap := &Snapshot{Files: make(map[string]endpoint.FileMeta)}
+		if base != nil {
+			for rel, meta := range base.Files {
+				snap.Files[rel] = meta
+			}
+		}
+		base = snap
+	}
+	base.Name = header.Name
+	base.CreatedAt = header.CreatedAt
+	base.SourceRoot = header.SourceRoot
+	base.DestRoot = header.DestRoot
+	base.Chunked = header.Chunked
+	base.Tree = header.Tree
+	base.Completed = false
+	for _, meta := range records {
+		base.Files[meta.RelPath] = meta
+	}
+	return base, nil
+}
+
+func decodeJournal(data []byte) (JournalHeader, []endpoint.FileMeta, error) {
+	var header JournalHeader
+	if !bytes.HasPrefix(data, journalMagic) {
+		return header, nil, errors.New("进度日志格式错误")
+	}
+	rest := data[len(journalMagic):]
+	payload, rest, ok := readFrame(rest)
+	if !ok {
+		return header, nil, errors.New("进度日志头损坏")
+	}
+	if err := json.Unmarshal(payload, &header); err != nil {
+		return header, nil, fmt.Errorf("进度日志头损坏: %w", err)
+	}
+	var records []endpoint.FileMeta
+	for len(rest) > 0 {
+		payload, rest, ok = readFrame(rest)
+		if !ok {
+			// 崩溃时未写完的尾部帧直接丢弃
+			break
+		}
+		r := &byteReader{data: payload}
+		meta := readRecord(r, "")
+		if r.err != nil {
+			break
+		}
+		records = append(records, meta)
+	}
+	return header, records, nil
+}
+
+// journalPrefix 返回日志中由 magic、头与完整条目帧组成的前缀长度，头不完整时返回 0
+func journalPrefix(data []byte) int {
+	if !bytes.HasPrefix(data, journalMagic) {
+		return 0
+	}
+	rest := data[len(journalMagic):]
+	if _, next, ok := readFrame(rest); ok {
+		rest = next
+	} else {
+		return 0
+	}
+	for len(rest) > 0 {
+		payload, next, ok := readFrame(rest)
+		if !ok {
+			break
+		}
+		r := &byteReader{data: payload}
+		if readRecord(r, ""); r.err != nil {
+			break
+		}
+		rest = next
+	}
+	return len(data) - len(rest)
+}
+
+func appendFrame(buf []byte, payload []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(payload)))
+	buf = append(buf, payload...)
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(payload))
+}
+
+func readFrame(data []byte) ([]byte, []byte, bool) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < size+4 {
+		return nil, nil, false
+	}
+	payload := data[n : n+int(size)]
+	sum := binary.LittleEndian.Uint32(data[n+int(size):])
+	if crc32.ChecksumIEEE(payload) != sum {
+		return nil, nil, false
+	}
+	return payload, data[n+int(size)+4:], true
+}
+
+func (s *Store) journalPath() string {
+	return filepath.Join(s.dir(), journalFile)
+}
+
+func (s *Store) journalSegmentPath(n int) string {
+	return s.journalPath() + "." + strconv.Itoa(n)
+}
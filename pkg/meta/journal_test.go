@@ -0,0 +1,192 @@
+package meta
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zbackup/pkg/endpoint"
+)
+
+// flakyAppendFS 模拟远端追加会话断开：断开后每次写入只送达一半数据并返回错误，
+// Reconnect 之后新开的会话恢复正常
+type flakyAppendFS struct {
+	*endpoint.LocalFS
+	broken     bool
+	reconnects int
+	failReopen bool
+}
+
+func (f *flakyAppendFS) Append(relPath string) (io.WriteCloser, error) {
+	w, err := f.LocalFS.Append(relPath)
+	if err != nil {
+		return nil, err
+	}
+	return &flakyWriter{WriteCloser: w, fs: f}, nil
+}
+
+func (f *flakyAppendFS) Reconnect() error {
+	f.reconnects++
+	if f.failReopen {
+		return errors.New("connection refused")
+	}
+	f.broken = false
+	return nil
+}
+
+type flakyWriter struct {
+	io.WriteCloser
+	fs   *flakyAppendFS
+	dead bool
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	if w.fs.broken || w.dead {
+		w.dead = true
+		n, _ := w.WriteCloser.Write(p[:len(p)/2])
+		return n, errors.New("broken pipe")
+	}
+	return w.WriteCloser.Write(p)
+}
+
+func TestJournalReopensAfterBrokenSession(t *testing.T) {
+	fs := &flakyAppendFS{LocalFS: endpoint.NewLocalFS(t.TempDir())}
+	store := NewStore(fs)
+	journal, err := store.OpenJournal(JournalHeader{Name: "snap"})
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	if err := journal.Append(endpoint.FileMeta{RelPath: "a.txt", Size: 1}); err != nil {
+		t.Fatalf("append a: %v", err)
+	}
+	fs.broken = true
+	if err := journal.Append(endpoint.FileMeta{RelPath: "b.txt", Size: 2}); err != nil {
+		t.Fatalf("append after reconnect: %v", err)
+	}
+	if err := journal.Append(endpoint.FileMeta{RelPath: "c.txt", Size: 3}); err != nil {
+		t.Fatalf("append c: %v", err)
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if fs.reconnects != 1 {
+		t.Fatalf("reconnects = %d, want 1", fs.reconnects)
+	}
+	// 中断时写了一半的帧已被截掉，之后的记录都能回放
+	pending, err := store.LoadPending()
+	if err != nil || pending == nil || len(pending.Files) != 3 {
+		t.Fatalf("unexpected pending snapshot: %+v %v", pending, err)
+	}
+
+	journal, err = store.OpenJournal(JournalHeader{Name: "again"})
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	fs.broken, fs.failReopen = true, true
+	if err := journal.Append(endpoint.FileMeta{RelPath: "d.txt"}); err == nil {
+		t.Fatalf("append should fail when the connection cannot be rebuilt")
+	}
+}
+
+// objectFS 隐藏 LocalFS 的追加能力，模拟 S3、WebDAV 等只能整体写入对象的目标端
+type objectFS struct {
+	endpoint.FileSystem
+	writes []string
+	// failRemove 非空时删除该名称的文件返回错误
+	failRemove string
+}
+
+func (o *objectFS) Remove(relPath string) error {
+	if o.failRemove != "" && filepath.Base(relPath) == o.failRemove {
+		return errors.New("remove failed")
+	}
+	return o.FileSystem.Remove(relPath)
+}
+
+func (o *objectFS) Create(relPath string, perm fs.FileMode) (io.WriteCloser, error) {
+	o.writes = append(o.writes, filepath.Base(relPath))
+	return o.FileSystem.Create(relPath, perm)
+}
+
+func TestJournalWritesSegmentsWithoutAppend(t *testing.T) {
+	dir := t.TempDir()
+	fs := &objectFS{FileSystem: endpoint.NewLocalFS(dir)}
+	store := NewStore(fs)
+	journal, err := store.OpenJournal(JournalHeader{Name: "snap"})
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	journal.Append(endpoint.FileMeta{RelPath: "a.txt", Size: 1})
+	journal.Append(endpoint.FileMeta{RelPath: "b.txt", Size: 2})
+	if err := journal.Sync(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	journal.Sync()
+	journal.Append(endpoint.FileMeta{RelPath: "c.txt", Size: 3})
+	if err := journal.Sync(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	// 未 Sync 的记录在崩溃时丢失，已写出的分段不受影响
+	journal.Append(endpoint.FileMeta{RelPath: "d.txt", Size: 4})
+
+	// 每次 Sync 只写出新的分段，不重写 pending.log
+	want := []string{"pending.log", "pending.log.1", "pending.log.2"}
+	if strings.Join(fs.writes, " ") != strings.Join(want, " ") {
+		t.Fatalf("unexpected writes %v, want %v", fs.writes, want)
+	}
+	pending, err := store.LoadPending()
+	if err != nil || pending == nil || len(pending.Files) != 3 || pending.Name != "snap" {
+		t.Fatalf("unexpected pending snapshot: %+v %v", pending, err)
+	}
+
+	if err := store.CompactPending(*pending); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	for _, name := range want {
+		if _, err := os.Stat(filepath.Join(dir, ".zbackup", name)); !os.IsNotExist(err) {
+			t.Fatalf("%s should be removed after compaction: %v", name, err)
+		}
+	}
+	pending, err = store.LoadPending()
+	if err != nil || pending == nil || len(pending.Files) != 3 {
+		t.Fatalf("compacted pending snapshot: %+v %v", pending, err)
+	}
+}
+
+func TestJournalCleanupFailureLeavesNoOrphanSegments(t *testing.T) {
+	fs := &objectFS{FileSystem: endpoint.NewLocalFS(t.TempDir())}
+	store := NewStore(fs)
+	journal, err := store.OpenJournal(JournalHeader{Name: "old"})
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	for _, rel := range []string{"a.txt", "b.txt", "c.txt"} {
+		journal.Append(endpoint.FileMeta{RelPath: rel, Size: 1})
+		if err := journal.Sync(); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+	}
+	fs.failRemove = "pending.log.2"
+	if err := store.ClearPending(); err == nil {
+		t.Fatalf("clear should report the failed remove")
+	}
+
+	// 下一次运行的新日志不能回放旧日志残留的分段
+	fs.failRemove = ""
+	journal, err = store.OpenJournal(JournalHeader{Name: "new"})
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	journal.Append(endpoint.FileMeta{RelPath: "x.txt", Size: 1})
+	if err := journal.Sync(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	pending, err := store.LoadPending()
+	if err != nil || pending == nil || pending.Name != "new" || len(pending.Files) != 1 {
+		t.Fatalf("stale segments replayed: %+v %v", pending, err)
+	}
+}
@@ -0,0 +1,309 @@
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"zbackup/pkg/endpoint"
+)
+
+var (
+	// lockRefreshInterval 为持锁进程刷新心跳的间隔
+	lockRefreshInterval = time.Minute
+	// lockStaleAfter 为跨主机判断锁失效的心跳超时时间
+	lockStaleAfter = 10 * time.Minute
+	// lockPollInterval 为 --wait 等待期间的重试间隔
+	lockPollInterval = time.Second
+)
+
+// ErrLocked 表示目标端已被其他 zbackup 进程锁定
+var ErrLocked = errors.New("目标端已被锁定")
+
+// ErrLockLost 表示持锁期间锁文件被删除或被其他进程接管
+var ErrLockLost = errors.New("目标端锁已丢失")
+
+// LockInfo 记录 .zbackup/lock 中的持锁进程信息
+type LockInfo struct {
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// String 返回便于日志显示的描述
+func (i LockInfo) String() string {
+	return fmt.Sprintf("host=%s pid=%d started_at=%s", i.Host, i.PID, i.StartedAt.Format(time.RFC3339))
+}
+
+// LockedError 携带当前持锁者信息
+type LockedError struct {
+	Info LockInfo
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%v（%s），如确认对方已退出可执行 zbackup unlock", ErrLocked, e.Info)
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrLocked
+}
+
+// Lock 表示当前进程持有的目标端锁
+type Lock struct {
+	store    *Store
+	info     LockInfo
+	mu       sync.Mutex
+	stop     chan struct{}
+	done     chan struct{}
+	released bool
+	// lost 在锁被他人接管后关闭，lostErr 为丢失原因
+	lost    chan struct{}
+	lostErr error
+}
+
+// AcquireLock 获取目标端锁；wait 大于 0 时在锁被占用期间持续等待
+func (s *Store) AcquireLock(ctx context.Context, wait time.Duration) (*Lock, error) {
+	host, _ := os.Hostname()
+	deadline := time.Now().Add(wait)
+	for {
+		now := time.Now().UTC()
+		info := LockInfo{Host: host, PID: os.Getpid(), StartedAt: now, UpdatedAt: now}
+		err := s.createLock(info)
+		if err == nil {
+			lock := &Lock{store: s, info: info, stop: make(chan struct{}), done: make(chan struct{}), lost: make(chan struct{})}
+			go lock.refreshLoop()
+			return lock, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("创建锁文件失败: %w", err)
+		}
+		holder, stale, err := s.inspectLock(host)
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("读取锁文件失败: %w", err)
+		}
+		if stale {
+			if err := s.removeStaleLock(holder); err != nil {
+				return nil, fmt.Errorf("清理失效锁失败: %w", err)
+			}
+			continue
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, &LockedError{Info: holder}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(min(remaining, lockPollInterval)):
+		}
+	}
+}
+
+// ReadLock 读取当前锁信息，不存在时返回 nil
+func (s *Store) ReadLock() (*LockInfo, error) {
+	data, err := s.readFile(s.lockPath())
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var info LockInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("锁文件格式错误: %w", err)
+	}
+	return &info, nil
+}
+
+// BreakLock 强制删除锁文件，返回被删除的锁信息，用于手动恢复
+func (s *Store) BreakLock() (*LockInfo, error) {
+	info, err := s.ReadLock()
+	if err != nil {
+		// 锁文件损坏时仍然允许删除
+		info = &LockInfo{}
+	} else if info == nil {
+		return nil, nil
+	}
+	if err := s.fs.Remove(s.lockPath()); err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Info 返回持锁信息
+func (l *Lock) Info() LockInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.info
+}
+
+// Release 停止心跳并删除锁文件；锁已被他人接管时不会误删
+func (l *Lock) Release() error {
+	l.mu.Lock()
+	if l.released {
+		l.mu.Unlock()
+		return nil
+	}
+	l.released = true
+	l.mu.Unlock()
+	close(l.stop)
+	<-l.done
+	current, err := l.store.ReadLock()
+	if err != nil {
+		return err
+	}
+	if current == nil || !l.owns(*current) {
+		return nil
+	}
+	if err := l.store.fs.Remove(l.store.lockPath()); err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Watch 返回在锁丢失时取消的 context，取消原因为 ErrLockLost；
+// 返回的 cancel 须在运行结束时调用
+func (l *Lock) Watch(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	go func() {
+		select {
+		case <-l.lost:
+			l.mu.Lock()
+			err := l.lostErr
+			l.mu.Unlock()
+			cancel(err)
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() { cancel(nil) }
+}
+
+func (l *Lock) owns(info LockInfo) bool {
+	return info.Host == l.info.Host && info.PID == l.info.PID && info.StartedAt.Equal(l.info.StartedAt)
+}
+
+// refreshLoop 定期刷新心跳。刷新前先读回锁文件，锁已被 unlock 删除或被其他进程接管时
+// 停止刷新并通知持锁者，不覆盖新持锁者的锁；读取失败时本次不刷新
+func (l *Lock) refreshLoop() {
+	defer close(l.done)
+	ticker := time.NewTicker(lockRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			current, err := l.store.ReadLock()
+			if err != nil {
+				continue
+			}
+			if current == nil || !l.owns(*current) {
+				l.lose(current)
+				return
+			}
+			l.mu.Lock()
+			l.info.UpdatedAt = time.Now().UTC()
+			info := l.info
+			l.mu.Unlock()
+			if data, err := json.Marshal(info); err == nil {
+				_ = l.store.writeFile(l.store.lockPath(), data, 0o644)
+			}
+		}
+	}
+}
+
+func (l *Lock) lose(current *LockInfo) {
+	err := fmt.Errorf("%w：锁文件已被删除", ErrLockLost)
+	if current != nil {
+		err = fmt.Errorf("%w：已被其他进程接管（%s）", ErrLockLost, current)
+	}
+	l.mu.Lock()
+	l.lostErr = err
+	l.mu.Unlock()
+	close(l.lost)
+}
+
+func (s *Store) createLock(info LockInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err := s.fs.MkdirAll(s.dir()); err != nil {
+		return err
+	}
+	if excl, ok := s.fs.(endpoint.ExclusiveFS); ok {
+		return excl.WriteExclusive(s.lockPath(), data, 0o644)
+	}
+	// 不支持原子创建的文件系统退化为先检查后写入
+	if _, err := s.fs.Stat(s.lockPath()); err == nil {
+		return os.ErrExist
+	}
+	return s.writeFile(s.lockPath(), data, 0o644)
+}
+
+// removeStaleLock 删除判断为失效的锁。删除前重新读取锁文件，仍是判断时的持锁者才删除，
+// 避免多个等待者同时判断失效时，后到的一方删掉先到者刚创建的新锁
+func (s *Store) removeStaleLock(holder LockInfo) error {
+	current, err := s.inspectCurrent()
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if current.Host != holder.Host || current.PID != holder.PID ||
+		!current.StartedAt.Equal(holder.StartedAt) || !current.UpdatedAt.Equal(holder.UpdatedAt) {
+		return nil
+	}
+	if err := s.fs.Remove(s.lockPath()); err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// inspectCurrent 读取现有锁；内容不完整时只以文件修改时间作为心跳
+func (s *Store) inspectCurrent() (LockInfo, error) {
+	info, err := s.ReadLock()
+	if err != nil {
+		stat, statErr := s.fs.Stat(s.lockPath())
+		if statErr != nil {
+			return LockInfo{}, statErr
+		}
+		return LockInfo{UpdatedAt: stat.ModTime}, nil
+	}
+	if info == nil {
+		return LockInfo{}, os.ErrNotExist
+	}
+	return *info, nil
+}
+
+// inspectLock 读取现有锁并判断是否已失效
+func (s *Store) inspectLock(host string) (LockInfo, bool, error) {
+	info, err := s.inspectCurrent()
+	if err != nil {
+		return LockInfo{}, false, err
+	}
+	// 内容不完整时按文件修改时间判断，避免与正在写入的进程冲突
+	return info, info.stale(host, time.Now()), nil
+}
+
+// stale 判断锁是否失效：同主机时以进程是否存活为准，否则看心跳是否超时
+func (i LockInfo) stale(host string, now time.Time) bool {
+	if i.Host == host && i.PID > 0 {
+		return !processAlive(i.PID)
+	}
+	return now.Sub(i.UpdatedAt) > lockStaleAfter
+}
+
+func (s *Store) lockPath() string {
+	return filepath.Join(s.dir(), lockFile)
+}
@@ -0,0 +1,150 @@
+package meta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"zbackup/pkg/endpoint"
+)
+
+func TestAcquireLockExclusive(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(endpoint.NewLocalFS(dir))
+	lock, err := store.AcquireLock(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	if _, err := store.AcquireLock(context.Background(), 0); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, metaDir, lockFile)); !os.IsNotExist(err) {
+		t.Fatalf("lock file should be removed, err=%v", err)
+	}
+	again, err := store.AcquireLock(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("re-acquire failed: %v", err)
+	}
+	_ = again.Release()
+}
+
+func TestAcquireLockReclaimsStale(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(endpoint.NewLocalFS(dir))
+	host, _ := os.Hostname()
+	stale := LockInfo{Host: "other-host", PID: 1, StartedAt: time.Now().Add(-time.Hour), UpdatedAt: time.Now().Add(-time.Hour)}
+	data, _ := json.Marshal(stale)
+	if err := store.writeFile(filepath.Join(metaDir, lockFile), data, 0o644); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+	lock, err := store.AcquireLock(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("stale lock should be reclaimed: %v", err)
+	}
+	if lock.Info().Host != host || lock.Info().PID != os.Getpid() {
+		t.Fatalf("unexpected lock owner: %+v", lock.Info())
+	}
+	_ = lock.Release()
+}
+
+func TestAcquireLockWaitAndBreak(t *testing.T) {
+	oldPoll := lockPollInterval
+	lockPollInterval = 10 * time.Millisecond
+	defer func() { lockPollInterval = oldPoll }()
+
+	store := NewStore(endpoint.NewLocalFS(t.TempDir()))
+	holder, err := store.AcquireLock(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		_ = holder.Release()
+	}()
+	waiter, err := store.AcquireLock(context.Background(), 2*time.Second)
+	if err != nil {
+		t.Fatalf("wait should succeed after release: %v", err)
+	}
+	info, err := store.BreakLock()
+	if err != nil || info == nil || info.PID != os.Getpid() {
+		t.Fatalf("break lock failed: info=%v err=%v", info, err)
+	}
+	if err := waiter.Release(); err != nil {
+		t.Fatalf("release after break should be a no-op: %v", err)
+	}
+}
+
+func TestLockLostWhenTakenOver(t *testing.T) {
+	oldRefresh := lockRefreshInterval
+	lockRefreshInterval = 10 * time.Millisecond
+	defer func() { lockRefreshInterval = oldRefresh }()
+
+	store := NewStore(endpoint.NewLocalFS(t.TempDir()))
+	lock, err := store.AcquireLock(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	ctx, stop := lock.Watch(context.Background())
+	defer stop()
+	// 模拟 unlock 后另一台主机取得了锁
+	if _, err := store.BreakLock(); err != nil {
+		t.Fatalf("break lock: %v", err)
+	}
+	other := LockInfo{Host: "other-host", PID: 42, StartedAt: time.Now().UTC(), UpdatedAt: time.Now().UTC()}
+	data, _ := json.Marshal(other)
+	if err := store.writeFile(filepath.Join(metaDir, lockFile), data, 0o644); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatalf("run should be cancelled after losing the lock")
+	}
+	if !errors.Is(context.Cause(ctx), ErrLockLost) {
+		t.Fatalf("unexpected cause: %v", context.Cause(ctx))
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := lock.Release(); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	current, err := store.ReadLock()
+	if err != nil || current == nil || current.Host != "other-host" {
+		t.Fatalf("new holder's lock must be kept: %+v %v", current, err)
+	}
+}
+
+func TestRemoveStaleLockKeepsNewHolder(t *testing.T) {
+	store := NewStore(endpoint.NewLocalFS(t.TempDir()))
+	write := func(info LockInfo) {
+		data, _ := json.Marshal(info)
+		if err := store.writeFile(filepath.Join(metaDir, lockFile), data, 0o644); err != nil {
+			t.Fatalf("write lock: %v", err)
+		}
+	}
+	old := time.Now().Add(-time.Hour).UTC()
+	stale := LockInfo{Host: "other-host", PID: 1, StartedAt: old, UpdatedAt: old}
+	write(stale)
+	// 另一个等待者已清理失效锁并创建了新锁，本等待者不应再删除
+	fresh := LockInfo{Host: "third-host", PID: 2, StartedAt: time.Now().UTC(), UpdatedAt: time.Now().UTC()}
+	write(fresh)
+	if err := store.removeStaleLock(stale); err != nil {
+		t.Fatalf("remove stale lock: %v", err)
+	}
+	if current, _ := store.ReadLock(); current == nil || current.Host != "third-host" {
+		t.Fatalf("fresh lock removed: %+v", current)
+	}
+	write(stale)
+	if err := store.removeStaleLock(stale); err != nil {
+		t.Fatalf("remove stale lock: %v", err)
+	}
+	if current, _ := store.ReadLock(); current != nil {
+		t.Fatalf("stale lock should be removed: %+v", current)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package meta
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive 通过 signal 0 判断进程是否存在
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
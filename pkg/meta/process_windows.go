@@ -0,0 +1,15 @@
+//go:build windows
+
+package meta
+
+import "os"
+
+// processAlive 在 Windows 上依赖 FindProcess 打开进程句柄
+func processAlive(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = proc.Release()
+	return true
+}
@@ -0,0 +1,153 @@
+package meta
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapshotInfo 为快照概要，供列表与清理使用
+type SnapshotInfo struct {
+	Name       string    `json:"name"`
+	CreatedAt  time.Time `json:"created_at"`
+	SourceRoot string    `json:"source_root"`
+	Completed  bool      `json:"completed"`
+	Files      int       `json:"files"`
+	Latest     bool      `json:"latest,omitempty"`
+	Chunked    bool      `json:"chunked,omitempty"`
+	Tree       string    `json:"tree,omitempty"`
+	Sync       bool      `json:"sync,omitempty"`
+}
+
+// SnapshotInfos 返回当前备份集全部快照的概要，按创建时间从新到旧排序
+func (s *Store) SnapshotInfos() ([]SnapshotInfo, error) {
+	names, err := s.ListSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	latest, err := s.latestName()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]SnapshotInfo, 0, len(names))
+	for _, name := range names {
+		idx, err := s.LoadIndex(name)
+		if err != nil {
+			return nil, fmt.Errorf("读取快照 %s 失败: %w", name, err)
+		}
+		if idx == nil {
+			continue
+		}
+		info := idx.Info()
+		info.Name = name
+		info.Latest = name == latest
+		infos = append(infos, info)
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		if infos[i].CreatedAt.Equal(infos[j].CreatedAt) {
+			return infos[i].Name > infos[j].Name
+		}
+		return infos[i].CreatedAt.After(infos[j].CreatedAt)
+	})
+	return infos, nil
+}
+
+// DeleteSnapshot 删除指定快照及其硬链接目录，不允许删除 latest 指向的快照
+func (s *Store) DeleteSnapshot(name string) error {
+	latest, err := s.latestName()
+	if err != nil {
+		return err
+	}
+	if name == latest {
+		return fmt.Errorf("快照 %s 为当前 latest，不能删除", name)
+	}
+	// 先删除硬链接目录：失败时快照仍在，下次清理可以重试
+	idx, err := s.LoadIndex(name)
+	if err != nil {
+		return fmt.Errorf("读取快照 %s 失败: %w", name, err)
+	}
+	if idx != nil && idx.header.Tree != "" {
+		if err := s.fs.Remove(idx.header.Tree); err != nil && !isNotFound(err) {
+			return fmt.Errorf("删除快照目录 %s 失败: %w", idx.header.Tree, err)
+		}
+	}
+	for _, ext := range []string{indexExt, legacyExt} {
+		if err := s.fs.Remove(s.snapshotPath(name, ext)); err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prune 保留最新的 keep 个快照并删除其余快照，返回被删除的名称
+func (s *Store) Prune(keep int) ([]string, error) {
+	candidates, err := s.PruneCandidates(keep)
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, name := range candidates {
+		if err := s.DeleteSnapshot(name); err != nil {
+			return removed, err
+		}
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
+
+// PruneCandidates 返回保留最新 keep 个快照时应删除的快照名，不做任何修改。
+// latest 以及未完成进度日志引用的快照始终保留
+func (s *Store) PruneCandidates(keep int) ([]string, error) {
+	if keep < 1 {
+		return nil, fmt.Errorf("至少需要保留 1 个快照")
+	}
+	infos, err := s.SnapshotInfos()
+	if err != nil {
+		return nil, err
+	}
+	protected, err := s.journalRefs()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for i, info := range infos {
+		if i < keep || info.Latest || protected[info.Name] {
+			continue
+		}
+		names = append(names, info.Name)
+	}
+	return names, nil
+}
+
+func (s *Store) latestName() (string, error) {
+	data, err := s.readFile(s.latestPath())
+	if err != nil {
+		if isNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// journalRefs 返回进度日志所属及作为基准的快照名
+func (s *Store) journalRefs() (map[string]bool, error) {
+	refs := make(map[string]bool)
+	data, err := s.readFile(s.journalPath())
+	if err != nil {
+		if isNotFound(err) {
+			return refs, nil
+		}
+		return nil, err
+	}
+	header, _, err := decodeJournal(data)
+	if err != nil {
+		return nil, err
+	}
+	refs[header.Name] = true
+	if header.Base != "" {
+		refs[header.Base] = true
+	}
+	return refs, nil
+}
@@ -0,0 +1,87 @@
+package meta
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// setsDir 存放各命名备份集元数据的目录，位于 .zbackup 之下
+const setsDir = "sets"
+
+var setNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateSetName 校验备份集名称：只允许字母、数字与 . _ -，且不能以符号开头
+func ValidateSetName(name string) error {
+	if !setNamePattern.MatchString(name) {
+		return fmt.Errorf("非法的备份集名称 %q：只允许字母、数字与 . _ -，且需以字母或数字开头", name)
+	}
+	return nil
+}
+
+// WithSet 返回访问指定备份集的 Store；name 为空时返回默认备份集。
+// 每个备份集拥有独立的快照、latest、进度日志与锁，存放在 .zbackup/sets/<name>/ 下
+func (s *Store) WithSet(name string) (*Store, error) {
+	if name == "" {
+		return &Store{fs: s.fs}, nil
+	}
+	if err := ValidateSetName(name); err != nil {
+		return nil, err
+	}
+	return &Store{fs: s.fs, set: name}, nil
+}
+
+// Set 返回当前备份集名称，默认备份集为空串
+func (s *Store) Set() string {
+	return s.set
+}
+
+// Dir 返回当前备份集元数据目录相对目标端根目录的路径
+func (s *Store) Dir() string {
+	return s.dir()
+}
+
+// ListSets 返回仓库中所有命名备份集（按名称排序，不含默认备份集）
+func (s *Store) ListSets() ([]string, error) {
+	entries, err := s.readDir(filepath.Join(metaDir, setsDir))
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		name := path.Base(entry.RelPath)
+		if entry.IsDir && ValidateSetName(name) == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// InUse 判断当前备份集是否已有快照或未完成的进度
+func (s *Store) InUse() (bool, error) {
+	names, err := s.ListSnapshots()
+	if err != nil || len(names) > 0 {
+		return len(names) > 0, err
+	}
+	for _, name := range []string{journalFile, pendingFile, legacyPendingFile} {
+		if _, err := s.fs.Stat(filepath.Join(s.dir(), name)); err == nil {
+			return true, nil
+		} else if !isNotFound(err) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) dir() string {
+	if s.set == "" {
+		return metaDir
+	}
+	return filepath.Join(metaDir, setsDir, s.set)
+}
@@ -0,0 +1,118 @@
+package meta
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"zbackup/pkg/endpoint"
+)
+
+func TestSetsHaveIndependentLineage(t *testing.T) {
+	repo := NewStore(endpoint.NewLocalFS(t.TempDir()))
+	etc, err := repo.WithSet("etc")
+	if err != nil {
+		t.Fatalf("with set: %v", err)
+	}
+	home, _ := repo.WithSet("home")
+	if err := etc.Save(Snapshot{Name: "e1", CreatedAt: time.Now(), Completed: true}); err != nil {
+		t.Fatalf("save etc: %v", err)
+	}
+	if err := home.Save(Snapshot{Name: "h1", CreatedAt: time.Now(), Completed: true}); err != nil {
+		t.Fatalf("save home: %v", err)
+	}
+	if latest, err := etc.LoadLatest(); err != nil || latest == nil || latest.Name != "e1" {
+		t.Fatalf("etc latest: %+v %v", latest, err)
+	}
+	if latest, err := repo.LoadLatest(); err != nil || latest != nil {
+		t.Fatalf("default set should be empty: %+v %v", latest, err)
+	}
+	sets, err := repo.ListSets()
+	if err != nil || !reflect.DeepEqual(sets, []string{"etc", "home"}) {
+		t.Fatalf("unexpected sets %v %v", sets, err)
+	}
+	// 各备份集的锁互不影响
+	lock, err := etc.AcquireLock(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("lock etc: %v", err)
+	}
+	defer lock.Release()
+	other, err := home.AcquireLock(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("lock home should succeed: %v", err)
+	}
+	other.Release()
+	if _, err := repo.WithSet("../x"); err == nil {
+		t.Fatalf("invalid set name should be rejected")
+	}
+}
+
+func TestPruneKeepsLatestAndJournalBase(t *testing.T) {
+	store, _ := NewStore(endpoint.NewLocalFS(t.TempDir())).WithSet("srv")
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, name := range []string{"s1", "s2", "s3", "s4"} {
+		snap := Snapshot{Name: name, CreatedAt: base.Add(time.Duration(i) * time.Hour), Completed: true}
+		if err := store.Save(snap); err != nil {
+			t.Fatalf("save %s: %v", name, err)
+		}
+	}
+	// latest 回退到 s2，模拟手工切换；s1 被进度日志引用
+	if err := store.writeFile(store.latestPath(), []byte("s2\n"), 0o644); err != nil {
+		t.Fatalf("write latest: %v", err)
+	}
+	journal, err := store.OpenJournal(JournalHeader{Name: "s5", Base: "s1"})
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	journal.Close()
+
+	removed, err := store.Prune(1)
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if !reflect.DeepEqual(removed, []string{"s3"}) {
+		t.Fatalf("unexpected removed %v", removed)
+	}
+	names, _ := store.ListSnapshots()
+	if !reflect.DeepEqual(names, []string{"s1", "s2", "s4"}) {
+		t.Fatalf("unexpected remaining %v", names)
+	}
+	if err := store.DeleteSnapshot("s2"); err == nil {
+		t.Fatalf("deleting latest should fail")
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	dstDir := t.TempDir()
+	store := NewStore(endpoint.NewLocalFS(dstDir))
+	old := time.Now().AddDate(0, 0, -40)
+	for _, snap := range []Snapshot{
+		{Name: "old", CreatedAt: old, Completed: true, Files: map[string]endpoint.FileMeta{}},
+		{Name: "new", CreatedAt: time.Now(), Completed: true, Files: map[string]endpoint.FileMeta{}},
+	} {
+		if err := store.Save(snap); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"old", "new", "orphan"} {
+		dir := filepath.Join(dstDir, store.TrashDir("old-versions", name))
+		os.MkdirAll(dir, 0o755)
+		os.WriteFile(filepath.Join(dir, "f"), []byte(name), 0o644)
+	}
+	// 快照已被清理的回收目录按目录修改时间判断
+	os.Chtimes(filepath.Join(dstDir, store.TrashDir("old-versions", "orphan")), old, old)
+
+	removed, err := store.PurgeTrash("old-versions", time.Now().AddDate(0, 0, -30))
+	if err != nil || len(removed) != 2 {
+		t.Fatalf("unexpected purge result %v %v", removed, err)
+	}
+	for name, exists := range map[string]bool{"old": false, "orphan": false, "new": true} {
+		_, err := os.Stat(filepath.Join(dstDir, store.TrashDir("old-versions", name)))
+		if (err == nil) != exists {
+			t.Fatalf("trash %s exists=%v, want %v", name, err == nil, exists)
+		}
+	}
+}
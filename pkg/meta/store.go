@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -17,9 +19,17 @@ const (
 	metaDir       = ".zbackup"
 	snapshotDir   = "snapshots"
 	latestSymlink = "latest"
-	pendingFile   = "pending.json"
+	pendingFile   = "pending.idx"
+	lockFile      = "lock"
+
+	indexExt          = ".idx"
+	legacyExt         = ".json"
+	legacyPendingFile = "pending.json"
 )
 
+// MetaDir 为仓库根下存放元数据的目录，扫描目录树时需要跳过
+const MetaDir = metaDir
+
 // Snapshot 描述一次备份的结果
 type Snapshot struct {
 	Name       string                       `json:"name"`
@@ -28,21 +38,28 @@ type Snapshot struct {
 	DestRoot   string                       `json:"dest_root"`
 	Files      map[string]endpoint.FileMeta `json:"files"`
 	Completed  bool                         `json:"completed"`
+	// Chunked 表示文件内容以数据块形式存放在 .zbackup/chunks 中，而不是镜像到数据目录
+	Chunked bool `json:"chunked,omitempty"`
+	// Tree 为该快照独立的硬链接目录（相对仓库根），为空表示文件镜像在数据目录中
+	Tree string `json:"tree,omitempty"`
+	// Sync 表示快照由双向同步写入，记录同步完成后本端的文件状态，作为下次同步的共同基准
+	Sync bool `json:"sync,omitempty"`
 }
 
-// Store 负责在目标端存取快照
+// Store 负责在目标端存取快照；set 非空时只访问该备份集的元数据
 type Store struct {
-	fs endpoint.FileSystem
+	fs  endpoint.FileSystem
+	set string
 }
 
-// NewStore 创建 Store
+// NewStore 创建默认备份集的 Store
 func NewStore(fs endpoint.FileSystem) *Store {
 	return &Store{fs: fs}
 }
 
 // LoadLatest 读取 latest 指向的快照
 func (s *Store) LoadLatest() (*Snapshot, error) {
-	data, err := s.readFile(filepath.Join(metaDir, latestSymlink))
+	data, err := s.readFile(s.latestPath())
 	if err != nil {
 		if isNotFound(err) {
 			return nil, nil
@@ -56,49 +73,62 @@ func (s *Store) LoadLatest() (*Snapshot, error) {
 	return s.Load(name)
 }
 
-// Load 按名称读取快照
-func (s *Store) Load(name string) (*Snapshot, error) {
-	path := filepath.Join(metaDir, snapshotDir, fmt.Sprintf("%s.json", name))
-	data, err := s.readFile(path)
+// LoadLatestIndex 读取 latest 指向的快照索引，不展开全部条目
+func (s *Store) LoadLatestIndex() (*Index, error) {
+	data, err := s.readFile(s.latestPath())
 	if err != nil {
 		if isNotFound(err) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	var snap Snapshot
-	if err := json.Unmarshal(data, &snap); err != nil {
-		return nil, err
+	name := strings.TrimSpace(string(data))
+	if name == "" {
+		return nil, fmt.Errorf("latest 为空")
 	}
-	return &snap, nil
+	return s.LoadIndex(name)
 }
 
-// Save 将快照写入存储，并更新 latest
-func (s *Store) Save(snap Snapshot) error {
-	if snap.Files == nil {
-		snap.Files = make(map[string]endpoint.FileMeta)
+// Load 按名称读取快照，兼容旧版 JSON 快照
+func (s *Store) Load(name string) (*Snapshot, error) {
+	data, err := s.readSnapshotData(name)
+	if err != nil || data == nil {
+		return nil, err
 	}
-	snap.CreatedAt = snap.CreatedAt.UTC()
-	data, err := json.MarshalIndent(snap, "", "  ")
-	if err != nil {
-		return err
+	return decodeSnapshot(data)
+}
+
+// LoadIndex 按名称读取快照索引，适合只需按路径查找或顺序遍历的场景
+func (s *Store) LoadIndex(name string) (*Index, error) {
+	data, err := s.readSnapshotData(name)
+	if err != nil || data == nil {
+		return nil, err
 	}
-	dir := filepath.Join(metaDir, snapshotDir)
-	if err := s.fs.MkdirAll(dir); err != nil {
-		return err
+	if IsIndex(data) {
+		return OpenIndex(data)
 	}
-	writer, err := s.fs.Create(filepath.Join(dir, fmt.Sprintf("%s.json", snap.Name)), 0o644)
+	snap, err := decodeSnapshot(data)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if _, err := writer.Write(data); err != nil {
-		writer.Close()
-		return err
+	return snap.Index()
+}
+
+// Index 把内存中的快照编码为只读索引
+func (snap *Snapshot) Index() (*Index, error) {
+	encoded, err := EncodeIndex(*snap)
+	if err != nil {
+		return nil, err
 	}
-	if err := writer.Close(); err != nil {
+	return OpenIndex(encoded)
+}
+
+// Save 将快照写入存储，并更新 latest
+func (s *Store) Save(snap Snapshot) error {
+	if err := s.writeSnapshot(snap); err != nil {
 		return err
 	}
-	if err := s.writeFile(filepath.Join(metaDir, latestSymlink), []byte(snap.Name+"\n"), 0o644); err != nil {
+	if err := s.writeFile(s.latestPath(), []byte(snap.Name+"\n"), 0o644); err != nil {
 		return err
 	}
 	return nil
@@ -106,59 +136,208 @@ func (s *Store) Save(snap Snapshot) error {
 
 // SavePending 保存未完成快照
 func (s *Store) SavePending(snap Snapshot) error {
-	if snap.Files == nil {
-		snap.Files = make(map[string]endpoint.FileMeta)
-	}
 	snap.Completed = false
-	data, err := json.MarshalIndent(snap, "", "  ")
+	data, err := EncodeIndex(snap)
 	if err != nil {
 		return err
 	}
-	if err := s.fs.MkdirAll(metaDir); err != nil {
-		return err
-	}
-	writer, err := s.fs.Create(filepath.Join(metaDir, pendingFile), 0o644)
-	if err != nil {
-		return err
+	return s.writeFile(filepath.Join(s.dir(), pendingFile), data, 0o644)
+}
+
+// LoadPending 读取未完成快照：以 pending.idx（兼容旧版 pending.json）为基础回放 pending.log
+func (s *Store) LoadPending() (*Snapshot, error) {
+	var base *Snapshot
+	for _, name := range []string{pendingFile, legacyPendingFile} {
+		data, err := s.readFile(filepath.Join(s.dir(), name))
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		if base, err = decodeSnapshot(data); err != nil {
+			return nil, err
+		}
+		break
 	}
-	if _, err := writer.Write(data); err != nil {
-		writer.Close()
-		return err
+	return s.replayJournal(base)
+}
+
+// ClearPending 删除未完成快照与进度日志
+func (s *Store) ClearPending() error {
+	for _, name := range []string{pendingFile, legacyPendingFile} {
+		if err := s.fs.Remove(filepath.Join(s.dir(), name)); err != nil && !isNotFound(err) {
+			return err
+		}
 	}
-	return writer.Close()
+	return s.removeJournal()
 }
 
-// LoadPending 读取未完成快照
-func (s *Store) LoadPending() (*Snapshot, error) {
-	data, err := s.readFile(filepath.Join(metaDir, pendingFile))
+// ListSnapshots 返回所有快照名称（按名称排序）
+func (s *Store) ListSnapshots() ([]string, error) {
+	entries, err := s.readDir(filepath.Join(s.dir(), snapshotDir))
 	if err != nil {
 		if isNotFound(err) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	var snap Snapshot
-	if err := json.Unmarshal(data, &snap); err != nil {
-		return nil, err
+	seen := make(map[string]bool)
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir {
+			continue
+		}
+		base := path.Base(entry.RelPath)
+		ext := path.Ext(base)
+		if ext != indexExt && ext != legacyExt {
+			continue
+		}
+		name := strings.TrimSuffix(base, ext)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
 	}
-	return &snap, nil
+	sort.Strings(names)
+	return names, nil
 }
 
-// ClearPending 删除未完成快照
-func (s *Store) ClearPending() error {
-	if err := s.fs.Remove(filepath.Join(metaDir, pendingFile)); err != nil && !isNotFound(err) {
+// Migrate 把旧版 JSON 快照与 pending.json 转换为索引格式，返回转换的数量
+func (s *Store) Migrate() (int, error) {
+	names, err := s.ListSnapshots()
+	if err != nil {
+		return 0, err
+	}
+	converted := 0
+	for _, name := range names {
+		legacy := s.snapshotPath(name, legacyExt)
+		data, err := s.readFile(legacy)
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return converted, err
+		}
+		snap, err := decodeSnapshot(data)
+		if err != nil {
+			return converted, fmt.Errorf("解析快照 %s 失败: %w", name, err)
+		}
+		if err := s.writeSnapshot(*snap); err != nil {
+			return converted, err
+		}
+		converted++
+	}
+	pending, err := s.readFile(filepath.Join(s.dir(), legacyPendingFile))
+	if err == nil {
+		snap, err := decodeSnapshot(pending)
+		if err != nil {
+			return converted, fmt.Errorf("解析 pending.json 失败: %w", err)
+		}
+		if err := s.SavePending(*snap); err != nil {
+			return converted, err
+		}
+		if err := s.fs.Remove(filepath.Join(s.dir(), legacyPendingFile)); err != nil && !isNotFound(err) {
+			return converted, err
+		}
+		converted++
+	} else if !isNotFound(err) {
+		return converted, err
+	}
+	return converted, nil
+}
+
+// writeSnapshot 以索引格式写入快照并删除同名旧版 JSON，不修改 latest
+func (s *Store) writeSnapshot(snap Snapshot) error {
+	snap.CreatedAt = snap.CreatedAt.UTC()
+	data, err := EncodeIndex(snap)
+	if err != nil {
+		return err
+	}
+	if err := s.writeFile(s.snapshotPath(snap.Name, indexExt), data, 0o644); err != nil {
+		return err
+	}
+	if err := s.fs.Remove(s.snapshotPath(snap.Name, legacyExt)); err != nil && !isNotFound(err) {
 		return err
 	}
 	return nil
 }
 
+func (s *Store) readSnapshotData(name string) ([]byte, error) {
+	for _, ext := range []string{indexExt, legacyExt} {
+		data, err := s.readFile(s.snapshotPath(name, ext))
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		return data, nil
+	}
+	return nil, nil
+}
+
+func (s *Store) latestPath() string {
+	return filepath.Join(s.dir(), latestSymlink)
+}
+
+func (s *Store) snapshotPath(name, ext string) string {
+	return filepath.Join(s.dir(), snapshotDir, name+ext)
+}
+
+func (s *Store) readDir(rel string) ([]endpoint.FileMeta, error) {
+	if lister, ok := s.fs.(endpoint.DirLister); ok {
+		return lister.ReadDir(rel)
+	}
+	all, err := s.fs.List(nil)
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.ToSlash(rel) + "/"
+	var entries []endpoint.FileMeta
+	for _, meta := range all {
+		if strings.HasPrefix(meta.RelPath, prefix) && !strings.Contains(meta.RelPath[len(prefix):], "/") {
+			meta.RelPath = meta.RelPath[len(prefix):]
+			entries = append(entries, meta)
+		}
+	}
+	if entries == nil {
+		return nil, fs.ErrNotExist
+	}
+	return entries, nil
+}
+
+func decodeSnapshot(data []byte) (*Snapshot, error) {
+	if IsIndex(data) {
+		idx, err := OpenIndex(data)
+		if err != nil {
+			return nil, err
+		}
+		return idx.Snapshot()
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	if snap.Files == nil {
+		snap.Files = make(map[string]endpoint.FileMeta)
+	}
+	return &snap, nil
+}
+
 func (s *Store) readFile(rel string) ([]byte, error) {
 	reader, err := s.fs.Open(rel)
 	if err != nil {
 		return nil, err
 	}
-	defer reader.Close()
-	return io.ReadAll(reader)
+	data, err := io.ReadAll(reader)
+	if closeErr := reader.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
 }
 
 func (s *Store) writeFile(rel string, data []byte, perm fs.FileMode) error {
@@ -27,6 +27,13 @@ func TestStoreSaveLoad(t *testing.T) {
 	if len(loaded.Files) != 1 {
 		t.Fatalf("unexpected file count")
 	}
+	idx, err := store.LoadLatestIndex()
+	if err != nil || idx.Info().Name != snap.Name || idx.Len() != 1 {
+		t.Fatalf("unexpected latest index: %v", err)
+	}
+	if meta, ok, err := idx.Lookup("demo.txt"); err != nil || !ok || meta.Size != 100 {
+		t.Fatalf("lookup demo.txt: %+v %v %v", meta, ok, err)
+	}
 }
 
 func TestPendingSnapshot(t *testing.T) {
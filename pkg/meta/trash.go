@@ -0,0 +1,86 @@
+package meta
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// TrashEntry 为回收目录中某次运行保存的旧文件
+type TrashEntry struct {
+	Snapshot string
+	// Time 为对应快照的创建时间；快照已被清理时为目录的修改时间，两者都没有时为零值
+	Time time.Time
+}
+
+// TrashDir 返回快照对应的回收目录（相对仓库根）。dir 为 --backup-dir 指定的目录，
+// 与 rsync 相同，相对备份集的数据目录；每次运行的旧文件保存在其下以快照名命名的子目录中
+func (s *Store) TrashDir(dir, snapshot string) string {
+	return filepath.Join(s.set, dir, snapshot)
+}
+
+// TrashEntries 列出回收目录 dir 中的各次运行，按时间从新到旧排序
+func (s *Store) TrashEntries(dir string) ([]TrashEntry, error) {
+	entries, err := s.readDir(filepath.Join(s.set, dir))
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	infos, err := s.SnapshotInfos()
+	if err != nil {
+		return nil, err
+	}
+	created := make(map[string]time.Time, len(infos))
+	for _, info := range infos {
+		created[info.Name] = info.CreatedAt
+	}
+	var list []TrashEntry
+	for _, entry := range entries {
+		if !entry.IsDir {
+			continue
+		}
+		name := path.Base(entry.RelPath)
+		t, ok := created[name]
+		if !ok {
+			t = entry.ModTime
+		}
+		list = append(list, TrashEntry{Snapshot: name, Time: t})
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Time.After(list[j].Time) })
+	return list, nil
+}
+
+// TrashCandidates 返回回收目录 dir 中早于 before 的运行，不做任何修改；时间未知的目录始终保留
+func (s *Store) TrashCandidates(dir string, before time.Time) ([]string, error) {
+	entries, err := s.TrashEntries(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.Time.IsZero() && entry.Time.Before(before) {
+			names = append(names, entry.Snapshot)
+		}
+	}
+	return names, nil
+}
+
+// PurgeTrash 删除回收目录 dir 中早于 before 的运行，返回被删除的快照名
+func (s *Store) PurgeTrash(dir string, before time.Time) ([]string, error) {
+	names, err := s.TrashCandidates(dir, before)
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, name := range names {
+		if err := s.fs.Remove(s.TrashDir(dir, name)); err != nil && !isNotFound(err) {
+			return removed, fmt.Errorf("删除回收目录 %s 失败: %w", name, err)
+		}
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
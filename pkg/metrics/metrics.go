@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"zbackup/pkg/transfer"
+)
+
+const lastSuccessMetric = "zbackup_last_success_timestamp_seconds"
+
+// RunMetrics 汇总一次运行的指标，用于导出 Prometheus 文本格式
+type RunMetrics struct {
+	Dest             string
+	StartedAt        time.Time
+	FinishedAt       time.Time
+	Success          bool
+	BytesTransferred int64
+	FilesByAction    map[transfer.TransferAction]int
+	FilesTransferred int
+	Failures         int
+	FilesChanged     int
+	SnapshotFiles    int
+	LastSuccess      time.Time
+}
+
+// Collect 根据计划与执行结果生成指标
+func Collect(plan transfer.Plan, result transfer.Result, success bool) RunMetrics {
+	m := RunMetrics{
+		Success:       success,
+		FilesByAction: make(map[transfer.TransferAction]int),
+		Failures:      len(result.Failed),
+		FilesChanged:  len(result.Changed),
+	}
+	for action, n := range plan.Counts {
+		m.FilesByAction[action] = n
+	}
+	m.FilesTransferred = result.Transferred
+	m.BytesTransferred = result.BytesTransferred
+	return m
+}
+
+// WriteTo 以 Prometheus 文本格式输出指标
+func (m RunMetrics) WriteTo(w io.Writer) (int64, error) {
+	return writeRuns(w, []RunMetrics{m})
+}
+
+// WriteTextfile 原子写入 node_exporter textfile，见 WriteTextfile 函数
+func (m RunMetrics) WriteTextfile(path string) error {
+	return WriteTextfile(path, m)
+}
+
+// writeRuns 输出多次运行的指标：每个指标的 HELP/TYPE 只输出一次，各运行的序列以 dest 标签区分
+func writeRuns(w io.Writer, runs []RunMetrics) (int64, error) {
+	var b strings.Builder
+	// gauge 为每次运行输出一条序列，value 返回空串的运行不输出
+	gauge := func(name, help string, value func(m RunMetrics) string) {
+		header := false
+		for _, m := range runs {
+			v := value(m)
+			if v == "" {
+				continue
+			}
+			if !header {
+				fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+				header = true
+			}
+			fmt.Fprintf(&b, "%s{%s} %s\n", name, m.labels(), v)
+		}
+	}
+	gauge("zbackup_last_run_success", "Whether the last run completed without errors.",
+		func(m RunMetrics) string { return boolValue(m.Success) })
+	gauge("zbackup_last_run_timestamp_seconds", "Unix time when the last run finished.",
+		func(m RunMetrics) string { return unixValue(m.FinishedAt) })
+	gauge("zbackup_last_run_duration_seconds", "Duration of the last run in seconds.",
+		func(m RunMetrics) string {
+			return strconv.FormatFloat(m.FinishedAt.Sub(m.StartedAt).Seconds(), 'f', 3, 64)
+		})
+	gauge(lastSuccessMetric, "Unix time of the last successful run.", func(m RunMetrics) string {
+		if m.LastSuccess.IsZero() {
+			return ""
+		}
+		return unixValue(m.LastSuccess)
+	})
+	gauge("zbackup_last_run_bytes_transferred", "Bytes transferred in the last run.",
+		func(m RunMetrics) string { return strconv.FormatInt(m.BytesTransferred, 10) })
+	gauge("zbackup_last_run_files_transferred", "Files transferred in the last run.",
+		func(m RunMetrics) string { return strconv.Itoa(m.FilesTransferred) })
+	gauge("zbackup_last_run_failures", "Plan items that failed in the last run.",
+		func(m RunMetrics) string { return strconv.Itoa(m.Failures) })
+	gauge("zbackup_last_run_files_changed", "Files that changed on the source while being copied in the last run.",
+		func(m RunMetrics) string { return strconv.Itoa(m.FilesChanged) })
+	gauge("zbackup_snapshot_files", "Entries recorded in the latest snapshot.",
+		func(m RunMetrics) string { return strconv.Itoa(m.SnapshotFiles) })
+
+	fmt.Fprintf(&b, "# HELP zbackup_last_run_plan_items Plan items by action in the last run.\n# TYPE zbackup_last_run_plan_items gauge\n")
+	for _, m := range runs {
+		actions := make([]string, 0, len(m.FilesByAction))
+		for action := range m.FilesByAction {
+			actions = append(actions, string(action))
+		}
+		sort.Strings(actions)
+		for _, action := range actions {
+			fmt.Fprintf(&b, "zbackup_last_run_plan_items{%s,action=\"%s\"} %d\n", m.labels(), action, m.FilesByAction[transfer.TransferAction(action)])
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func (m RunMetrics) labels() string {
+	return fmt.Sprintf(`dest="%s"`, escapeLabel(m.Dest))
+}
+
+// WriteTextfile 把一次或多次运行（多目标备份时每个目标端一次）的指标原子写入同一个
+// node_exporter textfile。成功的运行以结束时间作为最后成功时间，
+// 失败的运行导出调用方填写的 LastSuccess（通常为仓库中最近一次完成的快照时间）
+func WriteTextfile(path string, runs ...RunMetrics) error {
+	for i := range runs {
+		if runs[i].Success {
+			runs[i].LastSuccess = runs[i].FinishedAt
+		}
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := writeRuns(tmp, runs); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func escapeLabel(val string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(val)
+}
+
+func boolValue(v bool) string {
+	if v {
+		return "1"
+	}
+	return "0"
+}
+
+func unixValue(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/transfer"
+)
+
+func TestCollectAndWriteTextfile(t *testing.T) {
+	plan := transfer.Plan{}
+	plan.AddItem(transfer.TransferItem{RelPath: "dir", Action: transfer.ActionMkdir, Meta: endpoint.FileMeta{IsDir: true}})
+	plan.AddItem(transfer.TransferItem{RelPath: "dir/a.txt", Action: transfer.ActionUpload, Meta: endpoint.FileMeta{Size: 10}})
+	plan.AddItem(transfer.TransferItem{RelPath: "dir/b.txt", Action: transfer.ActionUpload, Meta: endpoint.FileMeta{Size: 20}})
+	plan.AddItem(transfer.TransferItem{RelPath: "same.txt", Action: transfer.ActionSkip})
+	result := transfer.Result{
+		Success: map[string]endpoint.FileMeta{"dir": {}, "dir/a.txt": {Size: 10}},
+		Failed:  map[string]error{"dir/b.txt": errors.New("boom")},
+		// 执行器只统计成功传输的文件
+		Transferred:      1,
+		BytesTransferred: 10,
+	}
+	m := Collect(plan, result, true)
+	if m.BytesTransferred != 10 || m.FilesTransferred != 1 || m.Failures != 1 {
+		t.Fatalf("unexpected metrics: %+v", m)
+	}
+	m.Dest = `/data/"backup"`
+	m.StartedAt = time.Unix(1700000000, 0)
+	m.FinishedAt = time.Unix(1700000060, 0)
+	m.SnapshotFiles = 3
+
+	path := filepath.Join(t.TempDir(), "zbackup.prom")
+	if err := m.WriteTextfile(path); err != nil {
+		t.Fatalf("write textfile: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read textfile: %v", err)
+	}
+	text := string(data)
+	for _, want := range []string{
+		`zbackup_last_run_success{dest="/data/\"backup\""} 1`,
+		`zbackup_last_run_duration_seconds{dest="/data/\"backup\""} 60.000`,
+		`zbackup_last_run_bytes_transferred{dest="/data/\"backup\""} 10`,
+		`zbackup_last_run_plan_items{dest="/data/\"backup\"",action="upload"} 2`,
+		`zbackup_last_success_timestamp_seconds{dest="/data/\"backup\""} 1700000060`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("missing %q in:\n%s", want, text)
+		}
+	}
+
+	failed := Collect(plan, result, false)
+	failed.Dest = m.Dest
+	failed.StartedAt = time.Unix(1700001000, 0)
+	failed.FinishedAt = time.Unix(1700001010, 0)
+	failed.LastSuccess = time.Unix(1700000060, 0)
+	if err := failed.WriteTextfile(path); err != nil {
+		t.Fatalf("write failed textfile: %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	if !strings.Contains(string(data), `zbackup_last_success_timestamp_seconds{dest="/data/\"backup\""} 1700000060`) {
+		t.Fatalf("last success should be exported:\n%s", data)
+	}
+}
+
+func TestWriteTextfileMultipleDests(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	runs := []RunMetrics{
+		{Dest: "/mnt/a", StartedAt: at, FinishedAt: at, Success: true, FilesByAction: map[transfer.TransferAction]int{transfer.ActionUpload: 1}},
+		{Dest: "nas:/b", StartedAt: at, FinishedAt: at, Success: false},
+	}
+	path := filepath.Join(t.TempDir(), "zbackup.prom")
+	if err := WriteTextfile(path, runs...); err != nil {
+		t.Fatalf("write textfile: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	text := string(data)
+	if n := strings.Count(text, "# TYPE zbackup_last_run_success gauge"); n != 1 {
+		t.Fatalf("header written %d times:\n%s", n, text)
+	}
+	for _, want := range []string{
+		`zbackup_last_run_success{dest="/mnt/a"} 1`,
+		`zbackup_last_run_success{dest="nas:/b"} 0`,
+		`zbackup_last_success_timestamp_seconds{dest="/mnt/a"} 1700000000`,
+		`zbackup_last_run_plan_items{dest="/mnt/a",action="upload"} 1`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("missing %q in:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, `zbackup_last_success_timestamp_seconds{dest="nas:/b"}`) {
+		t.Fatalf("failed dest without a previous success should have no last success series:\n%s", text)
+	}
+}
@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// CommandNotifier 执行本地命令，正文通过 stdin 传入，摘要字段通过环境变量传入
+type CommandNotifier struct {
+	Command string
+}
+
+func (c *CommandNotifier) Notify(ctx context.Context, msg Message) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", c.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", c.Command)
+	}
+	s := msg.Summary
+	cmd.Env = append(os.Environ(),
+		"ZBACKUP_STATUS="+string(s.Status),
+		"ZBACKUP_SNAPSHOT="+s.Snapshot,
+		"ZBACKUP_SOURCE="+s.Source,
+		"ZBACKUP_DEST="+s.Dest,
+		"ZBACKUP_SET="+s.Set,
+		"ZBACKUP_ERROR="+s.Error,
+		"ZBACKUP_FILES_TRANSFERRED="+strconv.Itoa(s.FilesTransferred),
+		"ZBACKUP_FILES_FAILED="+strconv.Itoa(s.FilesFailed),
+		"ZBACKUP_FILES_CHANGED="+strconv.Itoa(s.FilesChanged),
+		"ZBACKUP_CONFLICTS="+strconv.Itoa(s.FilesConflicted),
+		"ZBACKUP_SUBJECT="+msg.Subject,
+	)
+	cmd.Stdin = strings.NewReader(msg.Body)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("通知命令执行失败: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// Rule 决定何时发送通知
+type Rule string
+
+const (
+	RuleFailure Rule = "failure"
+	RuleAlways  Rule = "always"
+	RuleChange  Rule = "change"
+)
+
+// Status 表示一次运行的结果
+type Status string
+
+const (
+	StatusSuccess Status = "success"
+	StatusFailure Status = "failure"
+)
+
+// maxFailedFiles 限制摘要中列出的失败文件、变化文件与冲突数量，避免消息过长
+const maxFailedFiles = 20
+
+// Summary 是发送给各通知渠道的运行摘要
+type Summary struct {
+	Host             string    `json:"host"`
+	Snapshot         string    `json:"snapshot"`
+	Source           string    `json:"source"`
+	Dest             string    `json:"dest"`
+	Set              string    `json:"set,omitempty"`
+	Mode             string    `json:"mode"`
+	Status           Status    `json:"status"`
+	Error            string    `json:"error,omitempty"`
+	StartedAt        time.Time `json:"started_at"`
+	FinishedAt       time.Time `json:"finished_at"`
+	DurationSeconds  float64   `json:"duration_seconds"`
+	FilesTransferred int       `json:"files_transferred"`
+	BytesTransferred int64     `json:"bytes_transferred"`
+	FilesDeleted     int       `json:"files_deleted"`
+	FilesFailed      int       `json:"files_failed"`
+	FailedFiles      []string  `json:"failed_files,omitempty"`
+	// FilesChanged 为复制期间源文件发生变化、目标端内容可能不一致的文件数
+	FilesChanged int      `json:"files_changed,omitempty"`
+	ChangedFiles []string `json:"changed_files,omitempty"`
+	// FilesConflicted 为双向同步中两端都改动过的文件数，Conflicts 为冲突报告
+	FilesConflicted int        `json:"files_conflicted,omitempty"`
+	Conflicts       []Conflict `json:"conflicts,omitempty"`
+	// Attempts 记录经过重试的条目及其尝试次数
+	Attempts map[string]int `json:"attempts,omitempty"`
+}
+
+// Conflict 描述双向同步中的一个冲突及其处理方式
+type Conflict struct {
+	Path string `json:"path"`
+	// Copy 为另一版本另存的冲突副本，为空表示一端修改、另一端删除，保留了修改后的版本
+	Copy   string `json:"copy,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// Changed 表示本次运行是否改动了目标端、出现冲突或失败
+func (s Summary) Changed() bool {
+	return s.FilesTransferred > 0 || s.FilesDeleted > 0 || s.FilesConflicted > 0 || s.Status == StatusFailure
+}
+
+// AddFailed 记录失败文件，超过上限时只计数
+func (s *Summary) AddFailed(rel string) {
+	s.FilesFailed++
+	if len(s.FailedFiles) < maxFailedFiles {
+		s.FailedFiles = append(s.FailedFiles, rel)
+	}
+}
+
+// AddChanged 记录备份过程中发生变化的文件，超过上限时只计数
+func (s *Summary) AddChanged(rel string) {
+	s.FilesChanged++
+	if len(s.ChangedFiles) < maxFailedFiles {
+		s.ChangedFiles = append(s.ChangedFiles, rel)
+	}
+}
+
+// AddConflict 记录同步冲突，超过上限时只计数
+func (s *Summary) AddConflict(c Conflict) {
+	s.FilesConflicted++
+	if len(s.Conflicts) < maxFailedFiles {
+		s.Conflicts = append(s.Conflicts, c)
+	}
+}
+
+// SMTPConfig 描述发送邮件所需的 SMTP 服务器信息
+type SMTPConfig struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Config 汇总所有通知渠道与触发规则
+type Config struct {
+	On              Rule
+	Webhook         string
+	Command         string
+	SMTP            SMTPConfig
+	SubjectTemplate string
+	BodyTemplate    string
+	Timeout         time.Duration
+}
+
+// Enabled 表示是否配置了任一通知渠道
+func (c Config) Enabled() bool {
+	return c.Webhook != "" || c.Command != "" || c.SMTP.Addr != ""
+}
+
+// ShouldNotify 根据规则判断本次运行是否需要通知
+func (c Config) ShouldNotify(s Summary) bool {
+	switch c.On {
+	case RuleAlways:
+		return true
+	case RuleChange:
+		return s.Changed()
+	default:
+		return s.Status == StatusFailure
+	}
+}
+
+// Notifier 表示一个通知渠道
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Message 是渲染后的通知内容
+type Message struct {
+	Summary Summary
+	Subject string
+	Body    string
+}
+
+const (
+	defaultSubject = `[zbackup] {{.Status}} {{.Dest}} ({{.Snapshot}})`
+	defaultBody    = `zbackup 运行{{if eq .Status "success"}}成功{{else}}失败{{end}}
+主机: {{.Host}}
+快照: {{.Snapshot}}
+源端: {{.Source}}
+目标: {{.Dest}}
+模式: {{.Mode}}
+耗时: {{printf "%.1f" .DurationSeconds}}s
+传输: {{.FilesTransferred}} 个文件 / {{.BytesTransferred}} 字节
+删除: {{.FilesDeleted}}
+失败: {{.FilesFailed}}
+{{- if .Attempts}}
+重试: {{len .Attempts}} 个条目
+{{- end}}
+{{- if .FilesChanged}}
+备份中发生变化: {{.FilesChanged}} 个文件
+{{- range .ChangedFiles}}
+  ~ {{.}}
+{{- end}}
+{{- end}}
+{{- if .FilesConflicted}}
+同步冲突: {{.FilesConflicted}} 个文件
+{{- range .Conflicts}}
+  ! {{.Path}}{{if .Copy}} -> {{.Copy}}{{end}} ({{.Reason}})
+{{- end}}
+{{- end}}
+{{- if .Error}}
+错误: {{.Error}}
+{{- end}}
+{{- range .FailedFiles}}
+  - {{.}}
+{{- end}}
+`
+)
+
+// Render 按模板生成通知标题与正文
+func (c Config) Render(s Summary) (Message, error) {
+	subject, err := renderTemplate("subject", c.SubjectTemplate, defaultSubject, s)
+	if err != nil {
+		return Message{}, err
+	}
+	body, err := renderTemplate("body", c.BodyTemplate, defaultBody, s)
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{Summary: s, Subject: subject, Body: body}, nil
+}
+
+// Notifiers 根据配置构造所有通知渠道
+func (c Config) Notifiers() []Notifier {
+	var list []Notifier
+	if c.Webhook != "" {
+		list = append(list, &WebhookNotifier{URL: c.Webhook})
+	}
+	if c.SMTP.Addr != "" {
+		list = append(list, &SMTPNotifier{Config: c.SMTP})
+	}
+	if c.Command != "" {
+		list = append(list, &CommandNotifier{Command: c.Command})
+	}
+	return list
+}
+
+// Send 在满足规则时依次调用所有渠道，返回合并后的错误
+func Send(ctx context.Context, cfg Config, s Summary) error {
+	if !cfg.Enabled() || !cfg.ShouldNotify(s) {
+		return nil
+	}
+	msg, err := cfg.Render(s)
+	if err != nil {
+		return err
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	var errs []error
+	for _, n := range cfg.Notifiers() {
+		nctx, cancel := context.WithTimeout(ctx, timeout)
+		if err := n.Notify(nctx, msg); err != nil {
+			errs = append(errs, err)
+		}
+		cancel()
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateTemplates 提前检查自定义模板语法
+func (c Config) ValidateTemplates() error {
+	_, err := c.Render(Summary{Status: StatusFailure})
+	return err
+}
+
+func renderTemplate(name, text, fallback string, s Summary) (string, error) {
+	if text == "" {
+		text = fallback
+	}
+	tpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("解析通知模板失败: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, s); err != nil {
+		return "", fmt.Errorf("渲染通知模板失败: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestShouldNotifyRules(t *testing.T) {
+	ok := Summary{Status: StatusSuccess}
+	changed := Summary{Status: StatusSuccess, FilesTransferred: 1}
+	failed := Summary{Status: StatusFailure}
+	cases := []struct {
+		rule Rule
+		s    Summary
+		want bool
+	}{
+		{RuleFailure, ok, false},
+		{RuleFailure, failed, true},
+		{RuleAlways, ok, true},
+		{RuleChange, ok, false},
+		{RuleChange, changed, true},
+		{RuleChange, failed, true},
+	}
+	for _, c := range cases {
+		if got := (Config{On: c.rule}).ShouldNotify(c.s); got != c.want {
+			t.Fatalf("rule %s status %s: got %v want %v", c.rule, c.s.Status, got, c.want)
+		}
+	}
+}
+
+func TestRenderCustomTemplate(t *testing.T) {
+	cfg := Config{SubjectTemplate: "{{.Status}}:{{.Snapshot}}", BodyTemplate: "failed={{.FilesFailed}}"}
+	s := Summary{Status: StatusFailure, Snapshot: "snap"}
+	s.AddFailed("a.txt")
+	msg, err := cfg.Render(s)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if msg.Subject != "failure:snap" || msg.Body != "failed=1" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+	if err := (Config{BodyTemplate: "{{.Nope"}).ValidateTemplates(); err == nil {
+		t.Fatalf("invalid template should fail")
+	}
+}
+
+func TestSendWebhook(t *testing.T) {
+	var got webhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected content type %q", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+	}))
+	defer srv.Close()
+	cfg := Config{On: RuleFailure, Webhook: srv.URL}
+	if err := Send(context.Background(), cfg, Summary{Status: StatusSuccess, Snapshot: "skip"}); err != nil {
+		t.Fatalf("send success: %v", err)
+	}
+	if got.Snapshot != "" {
+		t.Fatalf("success run should not notify with failure rule")
+	}
+	if err := Send(context.Background(), cfg, Summary{Status: StatusFailure, Snapshot: "snap", Error: "boom"}); err != nil {
+		t.Fatalf("send failure: %v", err)
+	}
+	if got.Snapshot != "snap" || got.Error != "boom" || !strings.Contains(got.Message, "boom") {
+		t.Fatalf("unexpected payload: %+v", got)
+	}
+}
+
+func TestSendWebhookErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	err := Send(context.Background(), Config{On: RuleAlways, Webhook: srv.URL}, Summary{Status: StatusSuccess})
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("expected status error, got %v", err)
+	}
+}
+
+func TestSendCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	out := filepath.Join(t.TempDir(), "out.txt")
+	cfg := Config{On: RuleAlways, Command: `{ echo "$ZBACKUP_STATUS $ZBACKUP_SNAPSHOT"; cat; } > ` + out}
+	if err := Send(context.Background(), cfg, Summary{Status: StatusSuccess, Snapshot: "snap"}); err != nil {
+		t.Fatalf("send command: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read output: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "success snap\n") || !strings.Contains(string(data), "zbackup 运行成功") {
+		t.Fatalf("unexpected command output: %q", data)
+	}
+}
@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPNotifier 通过 SMTP 服务器发送邮件
+type SMTPNotifier struct {
+	Config SMTPConfig
+}
+
+func (s *SMTPNotifier) Notify(ctx context.Context, msg Message) error {
+	cfg := s.Config
+	if cfg.From == "" || len(cfg.To) == 0 {
+		return errors.New("SMTP 通知需要同时指定发件人与收件人")
+	}
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("SMTP 地址非法: %w", err)
+	}
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+	data := buildMail(cfg.From, cfg.To, msg.Subject, msg.Body, time.Now())
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(cfg.Addr, auth, cfg.From, cfg.To, data)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("SMTP 通知失败: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("SMTP 通知超时: %w", ctx.Err())
+	}
+}
+
+func buildMail(from string, to []string, subject, body string, now time.Time) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return buf.Bytes()
+}
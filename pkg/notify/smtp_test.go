@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP 是只实现最小命令集的 SMTP 服务，用于测试
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	mails := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 fake ESMTP")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					mails <- data.String()
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 fake")
+			case strings.HasPrefix(cmd, "DATA"):
+				inData = true
+				reply("354 go ahead")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return ln.Addr().String(), mails
+}
+
+func TestSendSMTP(t *testing.T) {
+	addr, mails := fakeSMTP(t)
+	cfg := Config{
+		On: RuleFailure,
+		SMTP: SMTPConfig{
+			Addr: addr,
+			From: "zbackup@example.com",
+			To:   []string{"ops@example.com"},
+		},
+	}
+	if err := Send(context.Background(), cfg, Summary{Status: StatusFailure, Snapshot: "snap", Error: "磁盘已满"}); err != nil {
+		t.Fatalf("send smtp: %v", err)
+	}
+	mail := <-mails
+	if !strings.Contains(mail, "To: ops@example.com") || !strings.Contains(mail, "Subject: [zbackup] failure") {
+		t.Fatalf("unexpected headers: %q", mail)
+	}
+	if !strings.Contains(mail, "错误: 磁盘已满") {
+		t.Fatalf("body missing error: %q", mail)
+	}
+}
@@ -0,0 +1,302 @@
+// Package review 在执行前以分组摘要的形式展示传输计划：按动作汇总条目数与字节数，
+// 按顶层目录分组，可逐级展开目录查看具体条目，最后由用户确认是否执行
+package review
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"zbackup/pkg/transfer"
+)
+
+// ErrRejected 表示用户没有确认计划
+var ErrRejected = errors.New("计划未获确认")
+
+// maxItems 为展开目录时直接列出的条目上限
+const maxItems = 50
+
+// actions 为摘要中动作的显示顺序
+var actions = []transfer.TransferAction{
+	transfer.ActionUpload,
+	transfer.ActionDownload,
+	transfer.ActionDelete,
+	transfer.ActionMkdir,
+	transfer.ActionLink,
+	transfer.ActionSkip,
+}
+
+var actionLabels = map[transfer.TransferAction]string{
+	transfer.ActionUpload:   "上传",
+	transfer.ActionDownload: "下载",
+	transfer.ActionDelete:   "删除",
+	transfer.ActionMkdir:    "建目录",
+	transfer.ActionLink:     "硬链接",
+	transfer.ActionSkip:     "跳过",
+}
+
+// unchanged 表示条目内容没有变化：跳过或从上一快照目录硬链接
+func unchanged(action transfer.TransferAction) bool {
+	return action == transfer.ActionSkip || action == transfer.ActionLink
+}
+
+// Stat 为一组条目的数量与字节数
+type Stat struct {
+	Count int
+	Bytes int64
+}
+
+// Dir 为计划中的一个目录，统计其下全部条目（含子目录）按动作的汇总
+type Dir struct {
+	Name  string
+	Path  string
+	Stats map[transfer.TransferAction]Stat
+	// Dirs 为子目录，按名称排序
+	Dirs []*Dir
+	// Items 为直接位于该目录下、需要操作的条目（不含跳过与硬链接），按路径排序
+	Items []transfer.TransferItem
+
+	parent   *Dir
+	children map[string]*Dir
+}
+
+// Summarize 把计划按目录层级汇总
+func Summarize(plan transfer.Plan) *Dir {
+	root := newDir("", "", nil)
+	for _, item := range plan.Items {
+		rel := strings.Trim(path.Clean("/"+item.RelPath), "/")
+		if rel == "" {
+			continue
+		}
+		dir := root
+		parts := strings.Split(rel, "/")
+		for _, part := range parts[:len(parts)-1] {
+			dir.add(item)
+			dir = dir.child(part)
+		}
+		dir.add(item)
+		if !unchanged(item.Action) {
+			dir.Items = append(dir.Items, item)
+		}
+	}
+	root.sort()
+	return root
+}
+
+func newDir(name, p string, parent *Dir) *Dir {
+	return &Dir{Name: name, Path: p, Stats: make(map[transfer.TransferAction]Stat), parent: parent, children: make(map[string]*Dir)}
+}
+
+func (d *Dir) child(name string) *Dir {
+	c, ok := d.children[name]
+	if !ok {
+		c = newDir(name, path.Join(d.Path, name), d)
+		d.children[name] = c
+		d.Dirs = append(d.Dirs, c)
+	}
+	return c
+}
+
+func (d *Dir) add(item transfer.TransferItem) {
+	s := d.Stats[item.Action]
+	s.Count++
+	if !item.Meta.IsDir && item.Action != transfer.ActionDelete {
+		s.Bytes += item.Meta.Size
+	}
+	d.Stats[item.Action] = s
+}
+
+func (d *Dir) sort() {
+	sort.Slice(d.Dirs, func(i, j int) bool { return d.Dirs[i].Name < d.Dirs[j].Name })
+	sort.Slice(d.Items, func(i, j int) bool { return d.Items[i].RelPath < d.Items[j].RelPath })
+	for _, c := range d.Dirs {
+		c.sort()
+	}
+}
+
+// changed 表示目录下有需要操作的条目
+func (d *Dir) changed() bool {
+	for action, s := range d.Stats {
+		if !unchanged(action) && s.Count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Options 控制确认方式
+type Options struct {
+	// DeleteThreshold 删除条目数超过该值时，需要输入删除数量而不是 y 确认；小于 0 表示总是如此
+	DeleteThreshold int
+}
+
+// Run 在 out 上展示计划摘要，从 in 逐行读取命令，直到用户确认或取消。
+// 确认返回 nil；取消或输入结束返回 ErrRejected
+func Run(in io.Reader, out io.Writer, plan transfer.Plan, opts Options) error {
+	root := Summarize(plan)
+	scanner := bufio.NewScanner(in)
+	cur := root
+	show := true
+	for {
+		if show {
+			render(out, cur)
+		}
+		show = false
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return ErrRejected
+		}
+		cmd := strings.TrimSpace(scanner.Text())
+		switch cmd {
+		case "":
+		case "y", "yes":
+			return confirm(scanner, out, root, opts)
+		case "n", "no", "q":
+			return ErrRejected
+		case "..":
+			if cur.parent != nil {
+				cur = cur.parent
+			}
+			show = true
+		case "/":
+			cur, show = root, true
+		case "l":
+			show = true
+		case "?", "h":
+			printHelp(out)
+		default:
+			n, err := strconv.Atoi(cmd)
+			visible := changedDirs(cur)
+			if err != nil || n < 1 || n > len(visible) {
+				fmt.Fprintf(out, "无法识别的输入 %q，输入 ? 查看帮助\n", cmd)
+				continue
+			}
+			cur, show = visible[n-1], true
+		}
+	}
+}
+
+// confirm 在删除数量超过阈值时要求输入删除数量
+func confirm(scanner *bufio.Scanner, out io.Writer, root *Dir, opts Options) error {
+	deletes := root.Stats[transfer.ActionDelete].Count
+	if deletes == 0 || (opts.DeleteThreshold >= 0 && deletes <= opts.DeleteThreshold) {
+		return nil
+	}
+	fmt.Fprintf(out, "本次将删除目标端 %d 个条目，请输入该数字确认: ", deletes)
+	if !scanner.Scan() {
+		fmt.Fprintln(out)
+		return ErrRejected
+	}
+	if strings.TrimSpace(scanner.Text()) != strconv.Itoa(deletes) {
+		return ErrRejected
+	}
+	return nil
+}
+
+func printHelp(out io.Writer) {
+	fmt.Fprintln(out, "  <编号>  展开对应目录")
+	fmt.Fprintln(out, "  ..      返回上级目录")
+	fmt.Fprintln(out, "  /       返回顶层")
+	fmt.Fprintln(out, "  l       重新显示当前目录")
+	fmt.Fprintln(out, "  y       确认并执行")
+	fmt.Fprintln(out, "  n / q   取消")
+}
+
+// changedDirs 返回当前目录下有变化的子目录，顺序与显示的编号一致
+func changedDirs(d *Dir) []*Dir {
+	var list []*Dir
+	for _, c := range d.Dirs {
+		if c.changed() {
+			list = append(list, c)
+		}
+	}
+	return list
+}
+
+func render(out io.Writer, d *Dir) {
+	title := "全部"
+	if d.Path != "" {
+		title = d.Path + "/"
+	}
+	fmt.Fprintf(out, "\n计划摘要 [%s]\n", title)
+	for _, action := range actions {
+		s, ok := d.Stats[action]
+		if !ok {
+			continue
+		}
+		if unchanged(action) || action == transfer.ActionMkdir || action == transfer.ActionDelete {
+			fmt.Fprintf(out, "  %-6s %8d 个\n", actionLabels[action], s.Count)
+		} else {
+			fmt.Fprintf(out, "  %-6s %8d 个  %s\n", actionLabels[action], s.Count, formatBytes(s.Bytes))
+		}
+	}
+
+	visible := changedDirs(d)
+	if len(visible) > 0 {
+		fmt.Fprintln(out, "目录:")
+	}
+	for i, c := range visible {
+		fmt.Fprintf(out, "  [%d] %s/  %s\n", i+1, c.Name, statLine(c.Stats))
+	}
+	if unchanged := len(d.Dirs) - len(visible); unchanged > 0 {
+		fmt.Fprintf(out, "  另有 %d 个目录没有变化\n", unchanged)
+	}
+	if len(d.Items) > 0 {
+		fmt.Fprintln(out, "条目:")
+	}
+	for i, item := range d.Items {
+		if i == maxItems {
+			fmt.Fprintf(out, "  ... 还有 %d 个\n", len(d.Items)-maxItems)
+			break
+		}
+		name := path.Base(item.RelPath)
+		if item.Meta.IsDir {
+			name += "/"
+		}
+		line := fmt.Sprintf("  %-6s %s", actionLabels[item.Action], name)
+		if !item.Meta.IsDir && item.Action != transfer.ActionDelete {
+			line += "  " + formatBytes(item.Meta.Size)
+		}
+		if item.Reason != "" {
+			line += "  (" + item.Reason + ")"
+		}
+		fmt.Fprintln(out, line)
+	}
+	fmt.Fprintln(out, "输入编号展开目录，.. 返回上级，y 执行，n 取消，? 帮助")
+}
+
+// statLine 把目录的动作统计压缩为一行，不含跳过与硬链接
+func statLine(stats map[transfer.TransferAction]Stat) string {
+	var parts []string
+	for _, action := range actions {
+		s, ok := stats[action]
+		if !ok || unchanged(action) {
+			continue
+		}
+		part := fmt.Sprintf("%s %d", actionLabels[action], s.Count)
+		if s.Bytes > 0 {
+			part += " (" + formatBytes(s.Bytes) + ")"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "，")
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
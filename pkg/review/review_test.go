@@ -0,0 +1,83 @@
+package review
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/transfer"
+)
+
+func testPlan() transfer.Plan {
+	var plan transfer.Plan
+	plan.AddItem(transfer.TransferItem{RelPath: "home", Action: transfer.ActionSkip, Meta: endpoint.FileMeta{IsDir: true}})
+	plan.AddItem(transfer.TransferItem{RelPath: "home/a/x.bin", Action: transfer.ActionUpload, Meta: endpoint.FileMeta{Size: 2048}, Reason: "新文件"})
+	plan.AddItem(transfer.TransferItem{RelPath: "home/a/y.bin", Action: transfer.ActionUpload, Meta: endpoint.FileMeta{Size: 1024}})
+	plan.AddItem(transfer.TransferItem{RelPath: "home/b/z.txt", Action: transfer.ActionSkip, Meta: endpoint.FileMeta{Size: 10}})
+	plan.AddItem(transfer.TransferItem{RelPath: "etc/old.conf", Action: transfer.ActionDelete, Meta: endpoint.FileMeta{Size: 5}})
+	plan.AddItem(transfer.TransferItem{RelPath: "top.txt", Action: transfer.ActionUpload, Meta: endpoint.FileMeta{Size: 1}})
+	return plan
+}
+
+func TestSummarize(t *testing.T) {
+	root := Summarize(testPlan())
+	if s := root.Stats[transfer.ActionUpload]; s.Count != 3 || s.Bytes != 3073 {
+		t.Fatalf("unexpected upload totals %+v", s)
+	}
+	if s := root.Stats[transfer.ActionDelete]; s.Count != 1 || s.Bytes != 0 {
+		t.Fatalf("deletes should not count bytes: %+v", s)
+	}
+	if len(root.Dirs) != 2 || root.Dirs[0].Name != "etc" || root.Dirs[1].Name != "home" {
+		t.Fatalf("unexpected top-level dirs %+v", root.Dirs)
+	}
+	home := root.Dirs[1]
+	if s := home.Stats[transfer.ActionUpload]; s.Count != 2 || s.Bytes != 3072 {
+		t.Fatalf("unexpected home totals %+v", s)
+	}
+	if len(root.Items) != 1 || root.Items[0].RelPath != "top.txt" {
+		t.Fatalf("skipped entries should not be listed: %+v", root.Items)
+	}
+	if changed := changedDirs(home); len(changed) != 1 || changed[0].Path != "home/a" {
+		t.Fatalf("unchanged dirs should be hidden: %+v", changed)
+	}
+}
+
+func TestRun(t *testing.T) {
+	var out bytes.Buffer
+	// 展开 home，再展开 a，返回顶层后确认
+	err := Run(strings.NewReader("2\n1\n/\ny\n"), &out, testPlan(), Options{DeleteThreshold: 10})
+	if err != nil {
+		t.Fatalf("expected confirmation, got %v", err)
+	}
+	text := out.String()
+	for _, want := range []string{"计划摘要 [home/]", "计划摘要 [home/a/]", "x.bin  2.0 KiB  (新文件)", "另有 1 个目录没有变化"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("output should contain %q:\n%s", want, text)
+		}
+	}
+
+	if err := Run(strings.NewReader("9\nn\n"), &out, testPlan(), Options{}); !errors.Is(err, ErrRejected) {
+		t.Fatalf("expected rejection, got %v", err)
+	}
+	if err := Run(strings.NewReader(""), &out, testPlan(), Options{}); !errors.Is(err, ErrRejected) {
+		t.Fatalf("end of input should reject, got %v", err)
+	}
+}
+
+func TestRunDeleteThreshold(t *testing.T) {
+	var out bytes.Buffer
+	if err := Run(strings.NewReader("y\ny\n"), &out, testPlan(), Options{DeleteThreshold: 0}); !errors.Is(err, ErrRejected) {
+		t.Fatalf("y must not confirm deletes above threshold, got %v", err)
+	}
+	if !strings.Contains(out.String(), "删除目标端 1 个条目") {
+		t.Fatalf("missing delete prompt:\n%s", out.String())
+	}
+	if err := Run(strings.NewReader("y\n1\n"), &out, testPlan(), Options{DeleteThreshold: -1}); err != nil {
+		t.Fatalf("typing the delete count should confirm, got %v", err)
+	}
+	if err := Run(strings.NewReader("y\n"), &out, testPlan(), Options{DeleteThreshold: 1}); err != nil {
+		t.Fatalf("deletes within threshold need no extra confirmation, got %v", err)
+	}
+}
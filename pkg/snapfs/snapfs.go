@@ -0,0 +1,405 @@
+package snapfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/meta"
+)
+
+// SnapshotsDir 为挂载根目录下存放各快照的目录
+const SnapshotsDir = "snapshots"
+
+// Loader 按名称读取完整快照
+type Loader func(name string) (*meta.Snapshot, error)
+
+// Opener 打开快照中某个文件的内容
+type Opener func(snap *meta.Snapshot, m endpoint.FileMeta) (io.ReadCloser, error)
+
+// FS 把仓库中的快照呈现为只读目录树：/snapshots/<快照名>/<相对路径>。
+// 快照在首次访问其目录时才读取，文件内容在读取时才向目标端请求。
+// FS 实现 fs.FS、fs.StatFS 与 fs.ReadDirFS，打开的文件实现 io.ReaderAt
+type FS struct {
+	root  *node
+	snaps map[string]*snapshotDir
+	load  Loader
+	open  Opener
+}
+
+// New 根据快照概要构建目录树
+func New(infos []meta.SnapshotInfo, load Loader, open Opener) *FS {
+	f := &FS{
+		snaps: make(map[string]*snapshotDir, len(infos)),
+		load:  load,
+		open:  open,
+	}
+	var newest time.Time
+	dir := newDir(SnapshotsDir, time.Time{})
+	for _, info := range infos {
+		f.snaps[info.Name] = &snapshotDir{info: info}
+		dir.add(snapshotRoot(info.Name, info.CreatedAt))
+		if info.CreatedAt.After(newest) {
+			newest = info.CreatedAt
+		}
+	}
+	dir.modTime = newest
+	f.root = newDir(".", newest)
+	f.root.add(dir)
+	f.root.sort()
+	return f
+}
+
+// node 为目录树中的一个条目；快照内的条目带有其所属快照与文件元数据
+type node struct {
+	name     string
+	dir      bool
+	size     int64
+	perm     fs.FileMode
+	modTime  time.Time
+	meta     endpoint.FileMeta
+	snap     *meta.Snapshot
+	children map[string]*node
+	sorted   []string
+}
+
+func newDir(name string, modTime time.Time) *node {
+	return &node{name: name, dir: true, perm: 0o555, modTime: modTime, children: make(map[string]*node)}
+}
+
+// snapshotRoot 返回快照根目录；列出 /snapshots 时使用尚未读取快照的占位条目，属性与读取后一致
+func snapshotRoot(name string, created time.Time) *node {
+	n := newDir(name, created)
+	n.perm = 0o755
+	return n
+}
+
+func (n *node) add(child *node) {
+	n.children[child.name] = child
+}
+
+// sort 在目录树构建完成后对子项排序，之后目录树只读，可并发访问
+func (n *node) sort() {
+	n.sorted = make([]string, 0, len(n.children))
+	for name, child := range n.children {
+		n.sorted = append(n.sorted, name)
+		if child.dir {
+			child.sort()
+		}
+	}
+	sort.Strings(n.sorted)
+}
+
+func (n *node) info() fs.FileInfo {
+	return fileInfo{n}
+}
+
+// snapshotDir 延迟读取单个快照并构建其目录树；读取失败时下次访问重试
+type snapshotDir struct {
+	info meta.SnapshotInfo
+	mu   sync.Mutex
+	root *node
+}
+
+func (f *FS) loadSnapshot(name string) (*node, error) {
+	sd, ok := f.snaps[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	if sd.root != nil {
+		return sd.root, nil
+	}
+	snap, err := f.load(name)
+	if err != nil {
+		return nil, err
+	}
+	if snap == nil {
+		return nil, fs.ErrNotExist
+	}
+	sd.root = buildTree(snap, sd.info.CreatedAt)
+	return sd.root, nil
+}
+
+// buildTree 由快照的文件列表构建目录树，快照中缺失的上级目录以快照时间补齐
+func buildTree(snap *meta.Snapshot, created time.Time) *node {
+	root := snapshotRoot(snap.Name, created)
+	for rel, m := range snap.Files {
+		rel = strings.Trim(path.Clean("/"+rel), "/")
+		if rel == "" {
+			continue
+		}
+		parent := root
+		parts := strings.Split(rel, "/")
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := parent.children[part]
+			if !ok || !child.dir {
+				child = newDir(part, created)
+				child.perm = 0o755
+				parent.add(child)
+			}
+			parent = child
+		}
+		name := parts[len(parts)-1]
+		n, ok := parent.children[name]
+		if !ok || n.dir != m.IsDir {
+			if m.IsDir {
+				n = newDir(name, m.ModTime)
+			} else {
+				n = &node{name: name}
+			}
+			parent.add(n)
+		}
+		n.meta = m
+		n.snap = snap
+		n.modTime = m.ModTime
+		n.perm = fs.FileMode(m.Mode).Perm()
+		if m.IsDir {
+			if n.perm == 0 {
+				n.perm = 0o755
+			}
+		} else {
+			n.size = m.Size
+			if n.perm == 0 {
+				n.perm = 0o644
+			}
+		}
+	}
+	root.sort()
+	return root
+}
+
+// lookup 按 fs.FS 路径查找条目
+func (f *FS) lookup(op, name string) (*node, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return f.root, nil
+	}
+	parts := strings.Split(name, "/")
+	n, ok := f.root.children[parts[0]]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if len(parts) == 1 {
+		return n, nil
+	}
+	if _, ok := n.children[parts[1]]; !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	n, err := f.loadSnapshot(parts[1])
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	for _, part := range parts[2:] {
+		if !n.dir {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if n, ok = n.children[part]; !ok {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+	}
+	return n, nil
+}
+
+// Stat 返回条目信息，不读取文件内容
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	n, err := f.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return n.info(), nil
+}
+
+// ReadDir 列出目录内容，按名称排序
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	n, err := f.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !n.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("不是目录")}
+	}
+	names := n.sorted
+	entries := make([]fs.DirEntry, len(names))
+	for i, child := range names {
+		entries[i] = fs.FileInfoToDirEntry(n.children[child].info())
+	}
+	return entries, nil
+}
+
+// Open 打开条目；文件内容在首次读取时才向目标端请求
+func (f *FS) Open(name string) (fs.File, error) {
+	n, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if n.dir {
+		return &dirHandle{node: n, path: name}, nil
+	}
+	return &fileHandle{fs: f, node: n, path: name}, nil
+}
+
+type fileInfo struct{ n *node }
+
+func (i fileInfo) Name() string {
+	if i.n.name == "." {
+		return "."
+	}
+	return i.n.name
+}
+func (i fileInfo) Size() int64        { return i.n.size }
+func (i fileInfo) ModTime() time.Time { return i.n.modTime }
+func (i fileInfo) IsDir() bool        { return i.n.dir }
+func (i fileInfo) Sys() any           { return i.n.meta }
+func (i fileInfo) Mode() fs.FileMode {
+	if i.n.dir {
+		return fs.ModeDir | i.n.perm
+	}
+	return i.n.perm
+}
+
+type dirHandle struct {
+	node   *node
+	path   string
+	offset int
+}
+
+func (d *dirHandle) Stat() (fs.FileInfo, error) { return d.node.info(), nil }
+func (d *dirHandle) Close() error               { return nil }
+func (d *dirHandle) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: errors.New("是目录")}
+}
+
+func (d *dirHandle) ReadDir(count int) ([]fs.DirEntry, error) {
+	names := d.node.sorted
+	rest := names[d.offset:]
+	if count > 0 {
+		if len(rest) == 0 {
+			return nil, io.EOF
+		}
+		rest = rest[:min(count, len(rest))]
+	}
+	entries := make([]fs.DirEntry, len(rest))
+	for i, name := range rest {
+		entries[i] = fs.FileInfoToDirEntry(d.node.children[name].info())
+	}
+	d.offset += len(rest)
+	return entries, nil
+}
+
+// fileHandle 顺序读取时复用同一个流；ReadAt 的偏移量落在当前位置之前时重新打开，
+// 之后的则跳过中间的数据，适合 cp 这类顺序读取的工具
+type fileHandle struct {
+	fs   *FS
+	node *node
+	path string
+
+	mu     sync.Mutex
+	reader io.ReadCloser
+	pos    int64 // reader 已读到的位置
+	offset int64 // Read 的当前位置，不受 ReadAt 影响
+	closed bool
+}
+
+func (h *fileHandle) Stat() (fs.FileInfo, error) { return h.node.info(), nil }
+
+func (h *fileHandle) Read(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n, err := h.readLocked(p, h.offset)
+	h.offset += int64(n)
+	return n, err
+}
+
+func (h *fileHandle) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: h.path, Err: fs.ErrInvalid}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	total := 0
+	for total < len(p) {
+		n, err := h.readLocked(p[total:], off+int64(total))
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (h *fileHandle) readLocked(p []byte, off int64) (int, error) {
+	if h.closed {
+		return 0, fs.ErrClosed
+	}
+	if off >= h.node.size {
+		return 0, io.EOF
+	}
+	if h.reader == nil || off < h.pos {
+		if err := h.reopen(); err != nil {
+			return 0, err
+		}
+	}
+	if off > h.pos {
+		n, err := io.CopyN(io.Discard, h.reader, off-h.pos)
+		h.pos += n
+		if err != nil {
+			return 0, h.shortRead(err)
+		}
+	}
+	if rest := h.node.size - h.pos; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+	n, err := h.reader.Read(p)
+	h.pos += int64(n)
+	if errors.Is(err, io.EOF) {
+		if h.pos < h.node.size {
+			return n, h.shortRead(err)
+		}
+		err = nil
+	}
+	if err == nil && h.pos >= h.node.size {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (h *fileHandle) reopen() error {
+	if h.reader != nil {
+		h.reader.Close()
+		h.reader = nil
+	}
+	reader, err := h.fs.open(h.node.snap, h.node.meta)
+	if err != nil {
+		return &fs.PathError{Op: "read", Path: h.path, Err: err}
+	}
+	h.reader = reader
+	h.pos = 0
+	return nil
+}
+
+func (h *fileHandle) shortRead(err error) error {
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return &fs.PathError{Op: "read", Path: h.path, Err: err}
+}
+
+func (h *fileHandle) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	if h.reader != nil {
+		return h.reader.Close()
+	}
+	return nil
+}
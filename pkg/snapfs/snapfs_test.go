@@ -0,0 +1,142 @@
+package snapfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/meta"
+)
+
+func testSnapshots() map[string]*meta.Snapshot {
+	t1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+	return map[string]*meta.Snapshot{
+		"first": {Name: "first", CreatedAt: t1, Files: map[string]endpoint.FileMeta{
+			"etc":        {RelPath: "etc", IsDir: true, Mode: uint32(fs.ModeDir | 0o750), ModTime: t1},
+			"etc/hosts":  {RelPath: "etc/hosts", Size: 9, Mode: 0o644, ModTime: t1},
+			"empty":      {RelPath: "empty", Mode: 0o600, ModTime: t1},
+			"deep/x/y.z": {RelPath: "deep/x/y.z", Size: 3, ModTime: t1},
+		}},
+		"second": {Name: "second", CreatedAt: t2, Files: map[string]endpoint.FileMeta{
+			"etc":       {RelPath: "etc", IsDir: true, Mode: uint32(fs.ModeDir | 0o755), ModTime: t2},
+			"etc/hosts": {RelPath: "etc/hosts", Size: 12, Mode: 0o644, ModTime: t2},
+		}},
+	}
+}
+
+// content 为每个快照中的文件生成确定的内容
+func content(snap, rel string, size int64) []byte {
+	return bytes.Repeat([]byte(snap[:1]+rel[:1]), int(size))[:size]
+}
+
+func newTestFS(t *testing.T, loads, opens *int) *FS {
+	t.Helper()
+	snaps := testSnapshots()
+	var infos []meta.SnapshotInfo
+	for _, snap := range snaps {
+		infos = append(infos, meta.SnapshotInfo{Name: snap.Name, CreatedAt: snap.CreatedAt})
+	}
+	load := func(name string) (*meta.Snapshot, error) {
+		*loads++
+		return snaps[name], nil
+	}
+	open := func(snap *meta.Snapshot, m endpoint.FileMeta) (io.ReadCloser, error) {
+		*opens++
+		return io.NopCloser(bytes.NewReader(content(snap.Name, m.RelPath, m.Size))), nil
+	}
+	return New(infos, load, open)
+}
+
+func TestFS(t *testing.T) {
+	var loads, opens int
+	fsys := newTestFS(t, &loads, &opens)
+	if err := fstest.TestFS(fsys,
+		"snapshots/first/etc/hosts",
+		"snapshots/first/empty",
+		"snapshots/first/deep/x/y.z",
+		"snapshots/second/etc/hosts",
+	); err != nil {
+		t.Fatal(err)
+	}
+	data, err := fs.ReadFile(fsys, "snapshots/second/etc/hosts")
+	if err != nil || !bytes.Equal(data, content("second", "etc/hosts", 12)) {
+		t.Fatalf("unexpected content %q: %v", data, err)
+	}
+	info, err := fs.Stat(fsys, "snapshots/first/etc")
+	if err != nil || info.Mode() != fs.ModeDir|0o750 {
+		t.Fatalf("unexpected dir info %v: %v", info, err)
+	}
+	// 快照中缺失的上级目录以快照时间补齐
+	info, err = fs.Stat(fsys, "snapshots/first/deep/x")
+	if err != nil || !info.IsDir() || !info.ModTime().Equal(testSnapshots()["first"].CreatedAt) {
+		t.Fatalf("unexpected synthesized dir %v: %v", info, err)
+	}
+	if _, err := fs.Stat(fsys, "snapshots/second/empty"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("file absent from snapshot should not exist, got %v", err)
+	}
+	if _, err := fs.Stat(fsys, "snapshots/third"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("unknown snapshot should not exist, got %v", err)
+	}
+}
+
+func TestLazyLoadAndReadAt(t *testing.T) {
+	var loads, opens int
+	fsys := newTestFS(t, &loads, &opens)
+	entries, err := fs.ReadDir(fsys, SnapshotsDir)
+	if err != nil || len(entries) != 2 || entries[0].Name() != "first" {
+		t.Fatalf("unexpected snapshot list %v: %v", entries, err)
+	}
+	if loads != 0 {
+		t.Fatalf("listing snapshots should not load them, loaded %d", loads)
+	}
+	f, err := fsys.Open("snapshots/second/etc/hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if loads != 1 || opens != 0 {
+		t.Fatalf("expected one load and no opens, got %d/%d", loads, opens)
+	}
+	want := content("second", "etc/hosts", 12)
+	ra := f.(io.ReaderAt)
+	buf := make([]byte, 4)
+	for _, off := range []int64{0, 4, 8, 2} {
+		if n, err := ra.ReadAt(buf, off); n != 4 || (err != nil && err != io.EOF) || !bytes.Equal(buf, want[off:off+4]) {
+			t.Fatalf("ReadAt %d = %q, %v", off, buf[:n], err)
+		}
+	}
+	// 顺序读取复用同一个流，只有向回读取才会重新打开
+	if opens != 2 {
+		t.Fatalf("expected 2 opens, got %d", opens)
+	}
+	if n, err := ra.ReadAt(buf, 10); n != 2 || err != io.EOF {
+		t.Fatalf("ReadAt past end = %d, %v", n, err)
+	}
+	if loads != 1 {
+		t.Fatalf("snapshot should be loaded once, got %d", loads)
+	}
+}
+
+func TestLoadErrorRetried(t *testing.T) {
+	fail := true
+	fsys := New([]meta.SnapshotInfo{{Name: "s"}}, func(name string) (*meta.Snapshot, error) {
+		if fail {
+			return nil, errors.New("connection reset")
+		}
+		return &meta.Snapshot{Name: name, Files: map[string]endpoint.FileMeta{"a": {RelPath: "a"}}}, nil
+	}, nil)
+	if _, err := fs.Stat(fsys, "snapshots/s/a"); err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Fatalf("expected load error, got %v", err)
+	}
+	fail = false
+	if _, err := fs.Stat(fsys, "snapshots/s/a"); err != nil {
+		t.Fatalf("load should be retried: %v", err)
+	}
+}
@@ -9,9 +9,14 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"io/fs"
 	"log/slog"
 	"os"
+	"path"
+	"sort"
+	"time"
 
+	"zbackup/pkg/chunk"
 	"zbackup/pkg/endpoint"
 	"zbackup/pkg/ui"
 )
@@ -26,88 +31,374 @@ type Executor struct {
 	Logger    *slog.Logger
 	Progress  ui.Progress
 	OnSuccess func(item TransferItem, meta endpoint.FileMeta)
+	// Retries 为单个条目遇到暂时性错误时的最大重试次数
+	Retries int
+	// RetryBackoff 为首次重试前的等待时间，之后每次翻倍
+	RetryBackoff time.Duration
+	// Chunks 非空时使用分块存储：文件内容切块后写入仓库的块目录，不再镜像到 DestFS，
+	// 目录与删除条目只体现在快照中
+	Chunks *chunk.Store
+	// Backup 非空时，目标端被覆盖（Overwrites 条目）或删除的文件先交给它移走保存。
+	// 覆盖时新版本先写入同目录的暂存文件，成功后才移走旧版本并把暂存文件重命名到位，
+	// 上传或移走失败时目标端原文件不做任何改动；此时 DestFS 需要支持重命名
+	Backup func(relPath string) error
+	// Link 非空时 DestFS 为本次快照的硬链接目录：Link 条目交给它从上一快照目录链接；
+	// 覆盖已有文件前先删除目标，避免写穿与上一快照共用的 inode
+	Link func(item TransferItem) error
+	// RetryChanged 表示在全部条目执行完后，把复制期间源文件发生变化的条目再传输一次
+	RetryChanged bool
 }
 
 // Result 描述执行结果
 type Result struct {
 	Success map[string]endpoint.FileMeta
 	Failed  map[string]error
+	// Attempts 记录经过重试的条目实际尝试的次数
+	Attempts map[string]int
+	// Changed 记录复制结束时源文件大小或修改时间已与扫描时不同的条目，目标端内容可能不完整。
+	// 这些条目仍计入 Success，但记录的是扫描时的元数据，下次运行会重新传输
+	Changed map[string]TransferItem
+	// Transferred 与 BytesTransferred 统计成功上传或下载的文件数与字节数，流式执行时计划不保留条目，
+	// 汇总与指标以此为准
+	Transferred      int
+	BytesTransferred int64
+	// Deleted 记录已执行的删除条目，合并快照时从上一快照中移除
+	Deleted []string
+
+	// unchecked 为已复制、尚未批量核对源文件是否变化的条目
+	unchecked []TransferItem
 }
 
+// ErrChecksumMismatch 表示传输后源端与目标端校验和不一致
+var ErrChecksumMismatch = errors.New("校验失败")
+
+// maxRetryBackoff 为重试等待时间的上限
+const maxRetryBackoff = time.Minute
+
+// changeCheckBatch 为源端支持批量 stat 时一次核对的条目数
+const changeCheckBatch = 128
+
+// stagedPrefix 为覆盖前暂存新版本的文件名前缀，暂存文件与目标文件位于同一目录
+const stagedPrefix = ".zbackup-new-"
+
 // Execute 执行计划
 func (e *Executor) Execute(ctx context.Context, plan Plan) (Result, error) {
+	e.Progress.Start(plan.TotalFiles, plan.TotalBytes)
+	items := make(chan TransferItem)
+	go func() {
+		defer close(items)
+		for _, item := range plan.Items {
+			select {
+			case items <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return e.ExecuteStream(ctx, items)
+}
+
+// ExecuteStream 逐个执行从 items 收到的条目，直到通道关闭。
+// 调用方负责事先调用 Progress.Start 并在产生条目时通过 Progress.Grow 追加总量
+func (e *Executor) ExecuteStream(ctx context.Context, items <-chan TransferItem) (Result, error) {
 	result := Result{
-		Success: make(map[string]endpoint.FileMeta),
-		Failed:  make(map[string]error),
+		Success:  make(map[string]endpoint.FileMeta),
+		Failed:   make(map[string]error),
+		Attempts: make(map[string]int),
+		Changed:  make(map[string]TransferItem),
 	}
-	e.Progress.Start(plan.TotalFiles, plan.TotalBytes)
 	var errs []error
-	for _, item := range plan.Items {
+	for {
+		var item TransferItem
+		var ok bool
 		select {
 		case <-ctx.Done():
 			return result, ctx.Err()
-		default:
+		case item, ok = <-items:
+		}
+		if !ok {
+			break
+		}
+		if err := e.executeItem(ctx, item, &result); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	e.flushChangeChecks(&result)
+	if e.RetryChanged && len(result.Changed) > 0 {
+		errs = append(errs, e.retryChanged(ctx, &result)...)
+		e.flushChangeChecks(&result)
+	}
+	e.Progress.Finish()
+	if len(errs) > 0 {
+		return result, fmt.Errorf("%d 个文件传输失败", len(errs))
+	}
+	return result, nil
+}
+
+func (e *Executor) executeItem(ctx context.Context, item TransferItem, result *Result) error {
+	switch item.Action {
+	case ActionUpload, ActionDownload:
+		e.Progress.NextFile(item.RelPath, item.Meta.Size)
+		// 需要保存旧版本时先写入暂存文件，上传失败不会影响目标端现有的文件
+		dest := item.RelPath
+		if item.Overwrites && e.Backup != nil && e.Chunks == nil {
+			dest = stagedPath(item.RelPath)
 		}
-		switch item.Action {
-		case ActionUpload, ActionDownload:
-			e.Progress.NextFile(item.RelPath, item.Meta.Size)
-			if meta, err := e.copyFile(item); err != nil {
+		if item.Overwrites && e.Link != nil {
+			if err := e.DestFS.Remove(item.RelPath); err != nil {
+				err = fmt.Errorf("断开硬链接失败: %w", err)
 				e.Logger.Error("传输失败", "path", item.RelPath, "err", err)
-				errs = append(errs, err)
 				result.Failed[item.RelPath] = err
+				return err
+			}
+		}
+		var meta endpoint.FileMeta
+		err := e.withRetry(ctx, item, result, func() error {
+			var err error
+			if e.Chunks != nil {
+				meta, err = e.storeChunks(item)
 			} else {
-				e.Logger.Info("传输完成", "path", item.RelPath, "size", item.Meta.Size)
-				result.Success[item.RelPath] = meta
-				if e.OnSuccess != nil {
-					e.OnSuccess(item, meta)
-				}
+				meta, err = e.copyFile(item, dest)
 			}
-		case ActionDelete:
-			if err := e.DestFS.Remove(item.RelPath); err != nil {
-				e.Logger.Warn("删除失败", "path", item.RelPath, "err", err)
+			return err
+		})
+		if err == nil && dest != item.RelPath {
+			err = e.replaceStaged(item.RelPath, dest)
+		}
+		if err != nil {
+			if dest != item.RelPath {
+				if rerr := e.DestFS.Remove(dest); rerr != nil {
+					e.Logger.Warn("删除暂存文件失败", "path", dest, "err", rerr)
+				}
 			}
-		case ActionMkdir:
-			if err := e.DestFS.MkdirAll(item.RelPath); err != nil {
-				e.Logger.Error("创建目录失败", "path", item.RelPath, "err", err)
-				errs = append(errs, err)
-				result.Failed[item.RelPath] = err
+			e.Logger.Error("传输失败", "path", item.RelPath, "err", err)
+			result.Failed[item.RelPath] = err
+			return err
+		}
+		e.Logger.Info("传输完成", "path", item.RelPath, "size", item.Meta.Size)
+		if _, ok := result.Success[item.RelPath]; !ok {
+			result.Transferred++
+			result.BytesTransferred += item.Meta.Size
+		}
+		result.Success[item.RelPath] = meta
+		e.checkChanged(item, result)
+		if e.OnSuccess != nil {
+			e.OnSuccess(item, meta)
+		}
+	case ActionDelete:
+		result.Deleted = append(result.Deleted, item.RelPath)
+		if e.Chunks != nil {
+			e.Logger.Debug("从快照中移除", "path", item.RelPath)
+			break
+		}
+		if e.Backup != nil {
+			if err := e.Backup(item.RelPath); err != nil {
+				e.Logger.Warn("移入回收目录失败，保留原文件", "path", item.RelPath, "err", err)
 			} else {
-				result.Success[item.RelPath] = item.Meta
-				e.Logger.Debug("创建目录成功", "path", item.RelPath)
-				if e.OnSuccess != nil {
-					e.OnSuccess(item, item.Meta)
-				}
+				e.Logger.Debug("已移入回收目录", "path", item.RelPath)
 			}
-		case ActionSkip:
-			e.Logger.Debug("跳过未变化文件", "path", item.RelPath, "reason", item.Reason)
+			break
 		}
+		if err := e.DestFS.Remove(item.RelPath); err != nil {
+			e.Logger.Warn("删除失败", "path", item.RelPath, "err", err)
+		}
+	case ActionMkdir:
+		err := e.withRetry(ctx, item, result, func() error {
+			if e.Chunks != nil {
+				return nil
+			}
+			return e.DestFS.MkdirAll(item.RelPath)
+		})
+		if err != nil {
+			e.Logger.Error("创建目录失败", "path", item.RelPath, "err", err)
+			result.Failed[item.RelPath] = err
+			return err
+		}
+		result.Success[item.RelPath] = item.Meta
+		e.Logger.Debug("创建目录成功", "path", item.RelPath)
+		if e.OnSuccess != nil {
+			e.OnSuccess(item, item.Meta)
+		}
+	case ActionLink:
+		err := e.withRetry(ctx, item, result, func() error {
+			return e.Link(item)
+		})
+		if err != nil {
+			e.Logger.Error("创建硬链接失败", "path", item.RelPath, "err", err)
+			result.Failed[item.RelPath] = err
+			return err
+		}
+		result.Success[item.RelPath] = item.Meta
+		e.Logger.Debug("硬链接未变化文件", "path", item.RelPath)
+		if e.OnSuccess != nil {
+			e.OnSuccess(item, item.Meta)
+		}
+	case ActionSkip:
+		e.Logger.Debug("跳过未变化文件", "path", item.RelPath, "reason", item.Reason)
 	}
-	e.Progress.Finish()
-	if len(errs) > 0 {
-		return result, fmt.Errorf("%d 个文件传输失败", len(errs))
+	return nil
+}
+
+// retryChanged 重新传输复制期间发生变化的条目，元数据取重试前的最新状态；
+// 源文件已不存在的条目保留在 Changed 中。重试失败时撤销先前的成功记录
+func (e *Executor) retryChanged(ctx context.Context, result *Result) []error {
+	items := make([]TransferItem, 0, len(result.Changed))
+	for _, item := range result.Changed {
+		items = append(items, item)
 	}
-	return result, nil
+	sort.Slice(items, func(i, j int) bool { return items[i].RelPath < items[j].RelPath })
+	var errs []error
+	for _, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		cur, err := e.SourceFS.Stat(item.RelPath)
+		if err != nil {
+			e.Logger.Warn("变化的文件无法重新读取，不再重试", "path", item.RelPath, "err", err)
+			continue
+		}
+		delete(result.Changed, item.RelPath)
+		item.Meta.Size, item.Meta.ModTime = cur.Size, cur.ModTime
+		e.Progress.Grow(1, cur.Size)
+		e.Logger.Info("重新传输备份过程中发生变化的文件", "path", item.RelPath)
+		if err := e.executeItem(ctx, item, result); err != nil {
+			if prev, ok := result.Success[item.RelPath]; ok {
+				result.Transferred--
+				result.BytesTransferred -= prev.Size
+			}
+			delete(result.Success, item.RelPath)
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// stagedPath 返回 rel 同目录下的暂存文件路径
+func stagedPath(rel string) string {
+	return path.Join(path.Dir(rel), stagedPrefix+path.Base(rel))
+}
+
+// replaceStaged 把目标端的旧版本交给 Backup 移走，再把暂存的新版本重命名为 rel
+func (e *Executor) replaceStaged(rel, staged string) error {
+	renamer, ok := e.DestFS.(endpoint.Renamer)
+	if !ok {
+		return fmt.Errorf("目标端不支持重命名，无法保存旧版本")
+	}
+	if err := e.Backup(rel); err != nil {
+		return fmt.Errorf("保存旧版本失败: %w", err)
+	}
+	e.Logger.Debug("旧版本已移入回收目录", "path", rel)
+	if err := renamer.Rename(staged, rel); err != nil {
+		return fmt.Errorf("替换目标文件失败: %w", err)
+	}
+	return nil
+}
+
+// checkChanged 核对复制结束时源文件是否仍与扫描时一致。源端支持批量 stat 时先排队，
+// 攒够一批或执行结束时一次查询，避免远端每个文件多一次往返
+func (e *Executor) checkChanged(item TransferItem, result *Result) {
+	if _, ok := e.SourceFS.(endpoint.BatchStater); ok {
+		result.unchecked = append(result.unchecked, item)
+		if len(result.unchecked) >= changeCheckBatch {
+			e.flushChangeChecks(result)
+		}
+		return
+	}
+	cur, err := e.SourceFS.Stat(item.RelPath)
+	e.recordChange(item, cur, err, result)
+}
+
+// flushChangeChecks 批量核对排队中的条目
+func (e *Executor) flushChangeChecks(result *Result) {
+	items := result.unchecked
+	if len(items) == 0 {
+		return
+	}
+	result.unchecked = nil
+	rels := make([]string, len(items))
+	for i, item := range items {
+		rels[i] = item.RelPath
+	}
+	metas, err := e.SourceFS.(endpoint.BatchStater).StatBatch(rels)
+	for _, item := range items {
+		if err != nil {
+			e.recordChange(item, endpoint.FileMeta{}, err, result)
+			continue
+		}
+		cur, ok := metas[item.RelPath]
+		if !ok {
+			e.recordChange(item, cur, fs.ErrNotExist, result)
+			continue
+		}
+		e.recordChange(item, cur, nil, result)
+	}
+}
+
+// recordChange 根据复制结束后的源端状态 cur（读取失败时为 err）记录发生变化的条目
+func (e *Executor) recordChange(item TransferItem, cur endpoint.FileMeta, err error, result *Result) {
+	if err != nil {
+		e.Logger.Warn("文件在备份过程中发生变化", "path", item.RelPath, "err", err)
+		result.Changed[item.RelPath] = item
+	} else if !unchangedSince(item.Meta, cur) {
+		e.Logger.Warn("文件在备份过程中发生变化", "path", item.RelPath, "size", cur.Size, "mtime", cur.ModTime)
+		result.Changed[item.RelPath] = item
+	}
+}
+
+// unchangedSince 判断复制结束后的源文件是否仍与扫描时一致。
+// 部分远端 stat 只有秒级精度，其中一方没有亚秒部分时按秒比较
+func unchangedSince(scanned, cur endpoint.FileMeta) bool {
+	if scanned.Size != cur.Size {
+		return false
+	}
+	if scanned.ModTime.Equal(cur.ModTime) {
+		return true
+	}
+	if scanned.ModTime.Nanosecond() != 0 && cur.ModTime.Nanosecond() != 0 {
+		return false
+	}
+	return scanned.ModTime.Truncate(time.Second).Equal(cur.ModTime.Truncate(time.Second))
 }
 
-func (e *Executor) copyFile(item TransferItem) (endpoint.FileMeta, error) {
+// copyFile 把源文件复制到目标端的 dest（通常即 item.RelPath）并校验
+func (e *Executor) copyFile(item TransferItem, dest string) (endpoint.FileMeta, error) {
 	reader, err := e.SourceFS.Open(item.RelPath)
 	if err != nil {
 		return endpoint.FileMeta{}, fmt.Errorf("读取源文件失败: %w", err)
 	}
-	defer reader.Close()
+	readerClosed := false
+	defer func() {
+		if !readerClosed {
+			reader.Close()
+		}
+	}()
 
 	perm := os.FileMode(item.Meta.Mode)
 	if perm == 0 {
 		perm = 0o644
 	}
-	writer, err := e.DestFS.Create(item.RelPath, perm)
+	writer, regions, err := e.createDest(item, dest, perm, reader)
 	if err != nil {
 		return endpoint.FileMeta{}, fmt.Errorf("创建目标文件失败: %w", err)
 	}
-	defer writer.Close()
+	closed := false
+	defer func() {
+		if !closed {
+			abortWriter(writer)
+		}
+	}()
+	// 目标端能在上传时计算校验和（S3、WebDAV）时直接使用，避免把刚上传的文件再下载一遍
+	var destHash hash.Hash
+	if hasher, ok := writer.(endpoint.UploadHasher); ok && regions == nil {
+		if destHash = newHash(e.Checksum); destHash != nil {
+			hasher.HashUpload(destHash)
+		}
+	}
 
 	var writers []io.Writer
 	writers = append(writers, writer, progressWriter{progress: e.Progress})
+	// holeWriters 接收空洞对应的零字节，使进度与源端校验和覆盖完整文件
+	holeWriters := []io.Writer{progressWriter{progress: e.Progress}}
 	var srcHash hash.Hash
 	var srcSum []byte
 	if e.Checksum != endpoint.ChecksumNone {
@@ -120,13 +411,28 @@ func (e *Executor) copyFile(item TransferItem) (endpoint.FileMeta, error) {
 			srcHash = newHash(e.Checksum)
 			if srcHash != nil {
 				writers = append(writers, srcHash)
+				holeWriters = append(holeWriters, srcHash)
 			}
 		}
 	}
 	multi := io.MultiWriter(writers...)
-	if _, err := io.Copy(multi, reader); err != nil {
+	if regions != nil {
+		err = copyRegions(multi, io.MultiWriter(holeWriters...), reader.(io.ReaderAt), regions, item.Meta.Size)
+	} else {
+		_, err = io.Copy(multi, reader)
+	}
+	if err != nil {
 		return endpoint.FileMeta{}, err
 	}
+	// 远端命令的退出状态（如 ssh 断线的 255）只在 Close 时返回，读取端只会看到 EOF
+	readerClosed = true
+	if err := reader.Close(); err != nil {
+		return endpoint.FileMeta{}, fmt.Errorf("读取源文件失败: %w", err)
+	}
+	closed = true
+	if err := writer.Close(); err != nil {
+		return endpoint.FileMeta{}, fmt.Errorf("写入目标文件失败: %w", err)
+	}
 	if e.Checksum == endpoint.ChecksumNone {
 		return item.Meta, nil
 	}
@@ -136,18 +442,183 @@ func (e *Executor) copyFile(item TransferItem) (endpoint.FileMeta, error) {
 	if srcSum == nil {
 		return endpoint.FileMeta{}, fmt.Errorf("无法计算源端校验和: %s", item.RelPath)
 	}
-	destSum, err := e.computeDestChecksum(item.RelPath)
-	if err != nil {
+	var destSum []byte
+	if destHash != nil {
+		destSum = destHash.Sum(nil)
+	} else if destSum, err = e.computeDestChecksum(dest); err != nil {
 		return endpoint.FileMeta{}, err
 	}
 	if !equalBytes(srcSum, destSum) {
-		return endpoint.FileMeta{}, fmt.Errorf("校验失败: %s", item.RelPath)
+		return endpoint.FileMeta{}, fmt.Errorf("%w: %s", ErrChecksumMismatch, item.RelPath)
 	}
 	meta := item.Meta
 	meta.Checksum = fmt.Sprintf("%x", srcSum)
 	return meta, nil
 }
 
+// storeChunks 按内容定义分块读取源文件，只写入仓库中尚不存在的块
+func (e *Executor) storeChunks(item TransferItem) (endpoint.FileMeta, error) {
+	reader, err := e.SourceFS.Open(item.RelPath)
+	if err != nil {
+		return endpoint.FileMeta{}, fmt.Errorf("读取源文件失败: %w", err)
+	}
+	readerClosed := false
+	defer func() {
+		if !readerClosed {
+			reader.Close()
+		}
+	}()
+	var src io.Reader = reader
+	srcHash := newHash(e.Checksum)
+	if srcHash != nil {
+		src = io.TeeReader(reader, srcHash)
+	}
+	chunker := chunk.NewChunker(src, item.Meta.Size)
+	var refs []string
+	var size int64
+	for {
+		data, err := chunker.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return endpoint.FileMeta{}, fmt.Errorf("读取源文件失败: %w", err)
+		}
+		ref := chunk.Hash(data)
+		if _, err := e.Chunks.Put(ref, data); err != nil {
+			return endpoint.FileMeta{}, fmt.Errorf("写入数据块失败: %w", err)
+		}
+		refs = append(refs, ref)
+		size += int64(len(data))
+		e.Progress.AddBytes(int64(len(data)))
+	}
+	readerClosed = true
+	if err := reader.Close(); err != nil {
+		return endpoint.FileMeta{}, fmt.Errorf("读取源文件失败: %w", err)
+	}
+	meta := item.Meta
+	meta.Size = size
+	meta.Chunks = refs
+	if srcHash != nil {
+		meta.Checksum = fmt.Sprintf("%x", srcHash.Sum(nil))
+	}
+	return meta, nil
+}
+
+// withRetry 执行 fn，遇到暂时性错误时按指数退避重试，并在需要时重建连接
+func (e *Executor) withRetry(ctx context.Context, item TransferItem, result *Result, fn func() error) error {
+	backoff := e.RetryBackoff
+	attempt := 1
+	for {
+		err := fn()
+		if attempt > 1 {
+			result.Attempts[item.RelPath] = attempt
+		}
+		if err == nil || attempt > e.Retries || !isRetryable(err) {
+			return err
+		}
+		e.Logger.Warn("传输出现暂时性错误，稍后重试", "path", item.RelPath, "attempt", attempt, "backoff", backoff, "err", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		e.reconnect()
+		attempt++
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
+
+func (e *Executor) reconnect() {
+	for _, fs := range []endpoint.FileSystem{e.SourceFS, e.DestFS} {
+		if rc, ok := fs.(endpoint.Reconnector); ok {
+			if err := rc.Reconnect(); err != nil {
+				e.Logger.Warn("重建连接失败", "root", fs.Root(), "err", err)
+			}
+		}
+	}
+}
+
+func isRetryable(err error) bool {
+	return errors.Is(err, ErrChecksumMismatch) || endpoint.IsTransient(err)
+}
+
+// abortWriter 放弃未完成的写入；writer 支持 Abort 时不会以部分内容提交目标
+func abortWriter(w io.WriteCloser) {
+	if a, ok := w.(endpoint.Aborter); ok {
+		a.Abort()
+		return
+	}
+	w.Close()
+}
+
+// createDest 在目标端创建 dest；源文件为稀疏文件且两端支持时保留空洞。
+// 返回的 regions 非空时，调用方只需按顺序写入这些数据区域
+func (e *Executor) createDest(item TransferItem, dest string, perm os.FileMode, reader io.Reader) (io.WriteCloser, []endpoint.Region, error) {
+	dst, ok := e.DestFS.(endpoint.SparseDestFS)
+	if !item.Meta.Sparse || !ok {
+		writer, err := e.DestFS.Create(dest, perm)
+		return writer, nil, err
+	}
+	var regions []endpoint.Region
+	if src, ok := e.SourceFS.(endpoint.SparseSourceFS); ok {
+		if _, seekable := reader.(io.ReaderAt); seekable {
+			if found, err := src.DataRegions(item.RelPath); err == nil {
+				regions = found
+			} else if !errors.Is(err, endpoint.ErrNotImplemented) {
+				e.Logger.Warn("读取稀疏区域失败，按普通文件传输", "path", item.RelPath, "err", err)
+			}
+		}
+	}
+	writer, err := dst.CreateSparse(dest, perm, item.Meta.Size, regions)
+	if err == nil {
+		e.Logger.Debug("按稀疏文件传输", "path", item.RelPath, "data", endpoint.RegionsSize(regions), "regions", len(regions))
+		return writer, regions, nil
+	}
+	if !errors.Is(err, endpoint.ErrNotImplemented) {
+		return nil, nil, err
+	}
+	if regions != nil {
+		// 目标端不支持按区域写入时，尝试由目标端自行检测零块
+		if writer, err := dst.CreateSparse(dest, perm, item.Meta.Size, nil); err == nil {
+			return writer, nil, nil
+		} else if !errors.Is(err, endpoint.ErrNotImplemented) {
+			return nil, nil, err
+		}
+	}
+	writer, err = e.DestFS.Create(dest, perm)
+	return writer, nil, err
+}
+
+// copyRegions 只读取并写出数据区域，空洞部分以零字节写入 holes
+func copyRegions(data io.Writer, holes io.Writer, src io.ReaderAt, regions []endpoint.Region, size int64) error {
+	var pos int64
+	for _, r := range regions {
+		if r.Offset > pos {
+			if _, err := io.CopyN(holes, zeroReader{}, r.Offset-pos); err != nil {
+				return err
+			}
+		}
+		if _, err := io.Copy(data, io.NewSectionReader(src, r.Offset, r.Length)); err != nil {
+			return err
+		}
+		pos = r.Offset + r.Length
+	}
+	if size > pos {
+		if _, err := io.CopyN(holes, zeroReader{}, size-pos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
 func (e *Executor) computeDestChecksum(relPath string) ([]byte, error) {
 	if sum, err := e.computeRemoteHash(e.DestFS, relPath); err == nil {
 		return sum, nil
@@ -2,9 +2,12 @@ package transfer
 
 import (
 	"context"
+	"errors"
+	"hash"
 	"io"
 	"log/slog"
 	"os"
+	osexec "os/exec"
 	"path/filepath"
 	"testing"
 	"time"
@@ -148,3 +151,497 @@ func (m mockRemoteFS) ComputeRemoteHash(relPath string, algo endpoint.ChecksumAl
 	}
 	return h.Sum(nil), nil
 }
+
+func TestExecutorRetriesTransientErrors(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("retry me"), 0o644); err != nil {
+		t.Fatalf("write src: %v", err)
+	}
+	srcFS := &flakyFS{LocalFS: endpoint.NewLocalFS(srcDir), failures: 1, err: errors.New("read: connection reset by peer")}
+	exec := Executor{
+		SourceFS:     srcFS,
+		DestFS:       endpoint.NewLocalFS(dstDir),
+		Checksum:     endpoint.ChecksumSHA256,
+		Logger:       slogDiscard(),
+		Progress:     ui.NoopProgress{},
+		Retries:      2,
+		RetryBackoff: time.Millisecond,
+	}
+	plan := Plan{}
+	plan.AddItem(TransferItem{RelPath: "a.txt", Meta: endpoint.FileMeta{RelPath: "a.txt", Size: 8}, Action: ActionUpload})
+	result, err := exec.Execute(context.Background(), plan)
+	if err != nil {
+		t.Fatalf("execute should succeed after retry: %v", err)
+	}
+	if result.Attempts["a.txt"] != 2 {
+		t.Fatalf("expected 2 attempts, got %d", result.Attempts["a.txt"])
+	}
+	if srcFS.reconnects != 1 {
+		t.Fatalf("expected reconnect before retry, got %d", srcFS.reconnects)
+	}
+
+	permanent := &flakyFS{LocalFS: endpoint.NewLocalFS(srcDir), failures: 5, err: errors.New("permission denied")}
+	exec.SourceFS = permanent
+	result, err = exec.Execute(context.Background(), plan)
+	if err == nil {
+		t.Fatalf("permanent error should fail")
+	}
+	if permanent.opens != 1 || result.Attempts["a.txt"] != 0 {
+		t.Fatalf("permanent error should not be retried: opens=%d attempts=%d", permanent.opens, result.Attempts["a.txt"])
+	}
+}
+
+func TestExecutorRetriesSourceCloseError(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	content := []byte("a file cut short by a dropped ssh connection")
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), content, 0o644); err != nil {
+		t.Fatalf("write src: %v", err)
+	}
+	srcFS := &truncatingFS{LocalFS: endpoint.NewLocalFS(srcDir), failures: 1, exitErr: sshExitError(t)}
+	exec := Executor{
+		SourceFS:     srcFS,
+		DestFS:       endpoint.NewLocalFS(dstDir),
+		Checksum:     endpoint.ChecksumNone,
+		Logger:       slogDiscard(),
+		Progress:     ui.NoopProgress{},
+		Retries:      1,
+		RetryBackoff: time.Millisecond,
+	}
+	plan := Plan{}
+	plan.AddItem(TransferItem{RelPath: "a.txt", Meta: endpoint.FileMeta{RelPath: "a.txt", Size: int64(len(content))}, Action: ActionUpload})
+	result, err := exec.Execute(context.Background(), plan)
+	if err != nil {
+		t.Fatalf("execute should succeed after retry: %v", err)
+	}
+	if result.Attempts["a.txt"] != 2 {
+		t.Fatalf("expected 2 attempts, got %d", result.Attempts["a.txt"])
+	}
+	if data, _ := os.ReadFile(filepath.Join(dstDir, "a.txt")); string(data) != string(content) {
+		t.Fatalf("truncated copy kept: %q", data)
+	}
+
+	// 不允许重试时，截断的读取必须以失败结束而不是记为成功
+	srcFS.opens = 0
+	exec.Retries = 0
+	result, err = exec.Execute(context.Background(), plan)
+	if err == nil || !endpoint.IsTransient(result.Failed["a.txt"]) {
+		t.Fatalf("close error should fail the transfer as transient, got %v / %v", err, result.Failed["a.txt"])
+	}
+	if _, ok := result.Success["a.txt"]; ok {
+		t.Fatalf("truncated read recorded as success")
+	}
+}
+
+func TestExecutorAbortsWriterOnFailure(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("some content"), 0o644); err != nil {
+		t.Fatalf("write src: %v", err)
+	}
+	dst := &abortingFS{LocalFS: endpoint.NewLocalFS(t.TempDir())}
+	exec := Executor{
+		SourceFS: &truncatingFS{LocalFS: endpoint.NewLocalFS(srcDir), failures: 1, exitErr: errors.New("read failed")},
+		DestFS:   dst,
+		Checksum: endpoint.ChecksumNone,
+		Logger:   slogDiscard(),
+		Progress: ui.NoopProgress{},
+	}
+	plan := Plan{}
+	plan.AddItem(TransferItem{RelPath: "a.txt", Meta: endpoint.FileMeta{RelPath: "a.txt", Size: 12}, Action: ActionUpload})
+	if _, err := exec.Execute(context.Background(), plan); err == nil {
+		t.Fatalf("execute should fail")
+	}
+	if dst.aborts != 1 || dst.closes != 0 {
+		t.Fatalf("failed copy should abort the writer: aborts=%d closes=%d", dst.aborts, dst.closes)
+	}
+}
+
+// abortingFS 统计目标 writer 被提交与放弃的次数
+type abortingFS struct {
+	*endpoint.LocalFS
+	aborts int
+	closes int
+}
+
+func (a *abortingFS) Create(relPath string, perm os.FileMode) (io.WriteCloser, error) {
+	return &countingWriter{Writer: io.Discard, fs: a}, nil
+}
+
+type countingWriter struct {
+	io.Writer
+	fs *abortingFS
+}
+
+func (w *countingWriter) Close() error {
+	w.fs.closes++
+	return nil
+}
+
+func (w *countingWriter) Abort() {
+	w.fs.aborts++
+}
+
+func TestExecutorUsesUploadHash(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("some content"), 0o644); err != nil {
+		t.Fatalf("write src: %v", err)
+	}
+	dst := &uploadHashFS{LocalFS: endpoint.NewLocalFS(t.TempDir())}
+	exec := Executor{
+		SourceFS: endpoint.NewLocalFS(srcDir),
+		DestFS:   dst,
+		Checksum: endpoint.ChecksumSHA256,
+		Logger:   slogDiscard(),
+		Progress: ui.NoopProgress{},
+	}
+	plan := Plan{}
+	plan.AddItem(TransferItem{RelPath: "a.txt", Meta: endpoint.FileMeta{RelPath: "a.txt", Size: 12}, Action: ActionUpload})
+	result, err := exec.Execute(context.Background(), plan)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if result.Success["a.txt"].Checksum == "" {
+		t.Fatalf("checksum should be recorded")
+	}
+	if dst.opens != 0 {
+		t.Fatalf("uploaded file should not be read back, opens=%d", dst.opens)
+	}
+}
+
+// uploadHashFS 的 writer 在上传时计算校验和，并统计目标文件被读回的次数
+type uploadHashFS struct {
+	*endpoint.LocalFS
+	opens int
+}
+
+func (u *uploadHashFS) Create(relPath string, perm os.FileMode) (io.WriteCloser, error) {
+	w, err := u.LocalFS.Create(relPath, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &hashingWriter{WriteCloser: w}, nil
+}
+
+func (u *uploadHashFS) Open(relPath string) (io.ReadCloser, error) {
+	u.opens++
+	return u.LocalFS.Open(relPath)
+}
+
+type hashingWriter struct {
+	io.WriteCloser
+	hash hash.Hash
+}
+
+func (w *hashingWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.hash.Write(p[:n])
+	return n, err
+}
+
+func (w *hashingWriter) HashUpload(h hash.Hash) {
+	w.hash = h
+}
+
+// sshExitError 返回退出码为 255 的 *exec.ExitError，与 ssh 连接中断时一致
+func sshExitError(t *testing.T) error {
+	t.Helper()
+	err := osexec.Command("sh", "-c", "exit 255").Run()
+	var exitErr *osexec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Skipf("sh unavailable: %v", err)
+	}
+	return exitErr
+}
+
+// truncatingFS 前 failures 次打开只返回一半内容就 EOF，并在 Close 时返回 exitErr
+type truncatingFS struct {
+	*endpoint.LocalFS
+	failures int
+	exitErr  error
+	opens    int
+}
+
+func (f *truncatingFS) Open(relPath string) (io.ReadCloser, error) {
+	f.opens++
+	rc, err := f.LocalFS.Open(relPath)
+	if err != nil || f.opens > f.failures {
+		return rc, err
+	}
+	meta, err := f.LocalFS.Stat(relPath)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return truncatedReader{Reader: io.LimitReader(rc, meta.Size/2), closer: rc, err: f.exitErr}, nil
+}
+
+type truncatedReader struct {
+	io.Reader
+	closer io.Closer
+	err    error
+}
+
+func (r truncatedReader) Close() error {
+	r.closer.Close()
+	return r.err
+}
+
+type flakyFS struct {
+	*endpoint.LocalFS
+	failures   int
+	err        error
+	opens      int
+	reconnects int
+}
+
+func (f *flakyFS) Open(relPath string) (io.ReadCloser, error) {
+	f.opens++
+	if f.opens <= f.failures {
+		return nil, f.err
+	}
+	return f.LocalFS.Open(relPath)
+}
+
+func (f *flakyFS) Reconnect() error {
+	f.reconnects++
+	return nil
+}
+
+func TestExecutorBackupAfterUpload(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	trashDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("new"), 0o644)
+	os.WriteFile(filepath.Join(dstDir, "a.txt"), []byte("old"), 0o644)
+	var moved []string
+	exec := Executor{
+		SourceFS: &flakyFS{LocalFS: endpoint.NewLocalFS(srcDir), failures: 1, err: errors.New("permission denied")},
+		DestFS:   endpoint.NewLocalFS(dstDir),
+		Checksum: endpoint.ChecksumSHA256,
+		Logger:   slogDiscard(),
+		Progress: ui.NoopProgress{},
+		Backup: func(rel string) error {
+			moved = append(moved, rel)
+			return os.Rename(filepath.Join(dstDir, rel), filepath.Join(trashDir, rel))
+		},
+	}
+	plan := Plan{}
+	plan.AddItem(TransferItem{RelPath: "a.txt", Meta: endpoint.FileMeta{RelPath: "a.txt", Size: 3}, Action: ActionUpload, Overwrites: true})
+
+	// 上传失败时旧版本留在原处，也不留下暂存文件
+	if _, err := exec.Execute(context.Background(), plan); err == nil {
+		t.Fatalf("upload should fail")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dstDir, "a.txt")); string(data) != "old" || len(moved) != 0 {
+		t.Fatalf("failed upload should keep old file, got %q moved=%v", data, moved)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, stagedPath("a.txt"))); !os.IsNotExist(err) {
+		t.Fatalf("staged file should be removed: %v", err)
+	}
+
+	if _, err := exec.Execute(context.Background(), plan); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dstDir, "a.txt")); string(data) != "new" {
+		t.Fatalf("mirror should hold new version, got %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(trashDir, "a.txt")); string(data) != "old" {
+		t.Fatalf("old version should be moved, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, stagedPath("a.txt"))); !os.IsNotExist(err) {
+		t.Fatalf("staged file should be renamed into place: %v", err)
+	}
+}
+
+func TestExecutorCopiesSparseFile(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	const size = 4 << 20
+	file, err := os.Create(filepath.Join(srcDir, "vm.img"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := file.WriteAt([]byte("header"), 0); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := file.WriteAt([]byte("tail"), 3<<20); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := file.Truncate(size); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	file.Close()
+	srcFS := endpoint.NewLocalFS(srcDir)
+	meta, err := srcFS.Stat("vm.img")
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if !meta.Sparse {
+		t.Skip("temp filesystem does not keep holes")
+	}
+	exec := Executor{
+		SourceFS: srcFS,
+		DestFS:   endpoint.NewLocalFS(dstDir),
+		Checksum: endpoint.ChecksumSHA256,
+		Logger:   slogDiscard(),
+		Progress: ui.NoopProgress{},
+	}
+	plan := Plan{}
+	plan.AddItem(TransferItem{RelPath: "vm.img", Meta: meta, Action: ActionUpload})
+	result, err := exec.Execute(context.Background(), plan)
+	if err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	if !result.Success["vm.img"].Sparse {
+		t.Fatalf("sparse flag should be kept in meta")
+	}
+	dstMeta, err := exec.DestFS.Stat("vm.img")
+	if err != nil {
+		t.Fatalf("stat dest: %v", err)
+	}
+	if dstMeta.Size != size || !dstMeta.Sparse {
+		t.Fatalf("destination should be sparse with full size: %+v", dstMeta)
+	}
+}
+
+func TestExecutorDetectsFilesChangedDuringCopy(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	path := filepath.Join(srcDir, "db.log")
+	if err := os.WriteFile(path, []byte("v1"), 0o644); err != nil {
+		t.Fatalf("write src: %v", err)
+	}
+	local := endpoint.NewLocalFS(srcDir)
+	run := func(retry bool) (Result, *writingFS) {
+		os.WriteFile(path, []byte("v1"), 0o644)
+		old := time.Now().Add(-time.Hour)
+		os.Chtimes(path, old, old)
+		meta, err := local.Stat("db.log")
+		if err != nil {
+			t.Fatalf("stat: %v", err)
+		}
+		srcFS := &writingFS{LocalFS: local, path: path}
+		exec := Executor{
+			SourceFS:     srcFS,
+			DestFS:       endpoint.NewLocalFS(dstDir),
+			Checksum:     endpoint.ChecksumSHA256,
+			Logger:       slogDiscard(),
+			Progress:     ui.NoopProgress{},
+			RetryChanged: retry,
+		}
+		plan := Plan{}
+		plan.AddItem(TransferItem{RelPath: "db.log", Meta: meta, Action: ActionUpload})
+		result, err := exec.Execute(context.Background(), plan)
+		if err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+		return result, srcFS
+	}
+
+	result, _ := run(false)
+	if _, ok := result.Changed["db.log"]; !ok {
+		t.Fatalf("file written during copy should be reported: %+v", result.Changed)
+	}
+	// 记录扫描时的元数据，下次运行会因为大小不同而重新传输
+	if got := result.Success["db.log"]; got.Size != 2 {
+		t.Fatalf("success meta should keep the scanned size, got %d", got.Size)
+	}
+
+	result, srcFS := run(true)
+	if len(result.Changed) != 0 || srcFS.opens != 2 {
+		t.Fatalf("changed file should be retried once: changed=%v opens=%d", result.Changed, srcFS.opens)
+	}
+	if got := result.Success["db.log"]; got.Size != 5 {
+		t.Fatalf("retry should record the new size, got %d", got.Size)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dstDir, "db.log")); string(data) != "v1+v2" {
+		t.Fatalf("dest = %q", data)
+	}
+}
+
+func TestExecutorBatchesChangeChecks(t *testing.T) {
+	srcDir := t.TempDir()
+	local := endpoint.NewLocalFS(srcDir)
+	plan := Plan{}
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{"a.txt", "b.txt", "db.log"} {
+		os.WriteFile(filepath.Join(srcDir, name), []byte(name), 0o644)
+		os.Chtimes(filepath.Join(srcDir, name), old, old)
+		meta, _ := local.Stat(name)
+		plan.AddItem(TransferItem{RelPath: name, Meta: meta, Action: ActionUpload})
+	}
+	// opens 从 -2 开始，第三次读取（db.log）结束时追加内容
+	srcFS := &batchStatFS{writingFS: &writingFS{LocalFS: local, path: filepath.Join(srcDir, "db.log"), opens: -2}}
+	exec := Executor{
+		SourceFS: srcFS,
+		DestFS:   endpoint.NewLocalFS(t.TempDir()),
+		Checksum: endpoint.ChecksumNone,
+		Logger:   slogDiscard(),
+		Progress: ui.NoopProgress{},
+	}
+	result, err := exec.Execute(context.Background(), plan)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if srcFS.stats != 0 || srcFS.batches != 1 {
+		t.Fatalf("change checks should be batched: stats=%d batches=%d", srcFS.stats, srcFS.batches)
+	}
+	if _, ok := result.Changed["db.log"]; !ok || len(result.Changed) != 1 {
+		t.Fatalf("only db.log changed during copy: %v", result.Changed)
+	}
+}
+
+// batchStatFS 统计逐个与批量 stat 的次数
+type batchStatFS struct {
+	*writingFS
+	stats   int
+	batches int
+}
+
+func (b *batchStatFS) Stat(relPath string) (endpoint.FileMeta, error) {
+	b.stats++
+	return b.LocalFS.Stat(relPath)
+}
+
+func (b *batchStatFS) StatBatch(relPaths []string) (map[string]endpoint.FileMeta, error) {
+	b.batches++
+	metas := make(map[string]endpoint.FileMeta)
+	for _, rel := range relPaths {
+		if meta, err := b.LocalFS.Stat(rel); err == nil {
+			metas[rel] = meta
+		}
+	}
+	return metas, nil
+}
+
+// writingFS 在第一次读取结束时追加源文件，模拟备份过程中仍在写入的文件
+type writingFS struct {
+	*endpoint.LocalFS
+	path  string
+	opens int
+}
+
+func (w *writingFS) Open(relPath string) (io.ReadCloser, error) {
+	w.opens++
+	rc, err := w.LocalFS.Open(relPath)
+	if err != nil || w.opens > 1 {
+		return rc, err
+	}
+	return appendOnClose{ReadCloser: rc, path: w.path}, nil
+}
+
+type appendOnClose struct {
+	io.ReadCloser
+	path string
+}
+
+func (a appendOnClose) Close() error {
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	f.WriteString("+v2")
+	f.Close()
+	return a.ReadCloser.Close()
+}
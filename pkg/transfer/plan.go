@@ -11,6 +11,8 @@ const (
 	ActionDelete   TransferAction = "delete"
 	ActionSkip     TransferAction = "skip"
 	ActionMkdir    TransferAction = "mkdir"
+	// ActionLink 把上一快照目录中未变化的文件硬链接到本次快照目录
+	ActionLink TransferAction = "link"
 )
 
 // TransferItem 表示一次对单个文件的操作
@@ -19,6 +21,8 @@ type TransferItem struct {
 	Meta    endpoint.FileMeta
 	Action  TransferAction
 	Reason  string
+	// Overwrites 表示目标端已有该路径内容不同的旧版本，上传会覆盖它
+	Overwrites bool
 }
 
 // Plan 描述所有需要操作的集合
@@ -26,12 +30,24 @@ type Plan struct {
 	Items      []TransferItem
 	TotalBytes int64
 	TotalFiles int
+	// Counts 按动作统计条目数，包含只计数未保存的条目
+	Counts map[TransferAction]int
 }
 
 // AddItem 加入计划
 func (p *Plan) AddItem(item TransferItem) {
 	p.Items = append(p.Items, item)
-	if item.Action == ActionDelete || item.Action == ActionSkip || item.Action == ActionMkdir {
+	p.Count(item)
+}
+
+// Count 只统计条目而不保存，用于流式执行时丢弃无需回顾的 skip 条目；
+// 删除、跳过、建目录与硬链接不计入传输的文件数与字节数
+func (p *Plan) Count(item TransferItem) {
+	if p.Counts == nil {
+		p.Counts = make(map[TransferAction]int)
+	}
+	p.Counts[item.Action]++
+	if item.Action == ActionDelete || item.Action == ActionSkip || item.Action == ActionMkdir || item.Action == ActionLink {
 		return
 	}
 	p.TotalFiles++
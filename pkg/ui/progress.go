@@ -12,6 +12,8 @@ import (
 // Progress 定义统一的进度更新接口
 type Progress interface {
 	Start(totalFiles int, totalBytes int64)
+	// Grow 在流式执行时追加总量
+	Grow(files int, bytes int64)
 	NextFile(path string, size int64)
 	AddBytes(n int64)
 	Finish()
@@ -55,6 +57,14 @@ func (p *BarProgress) Start(totalFiles int, totalBytes int64) {
 	p.renderLocked(false)
 }
 
+func (p *BarProgress) Grow(files int, bytes int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.totalFiles += files
+	p.totalBytes += bytes
+	p.renderLocked(false)
+}
+
 func (p *BarProgress) NextFile(path string, size int64) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -108,6 +118,7 @@ func (p *BarProgress) WrapWriter(w io.Writer) io.Writer {
 type NoopProgress struct{}
 
 func (n NoopProgress) Start(totalFiles int, totalBytes int64) {}
+func (n NoopProgress) Grow(files int, bytes int64)            {}
 func (n NoopProgress) NextFile(path string, size int64)       {}
 func (n NoopProgress) AddBytes(delta int64)                   {}
 func (n NoopProgress) Finish()                                {}
@@ -0,0 +1,74 @@
+package web
+
+import (
+	"slices"
+	"time"
+
+	"zbackup/pkg/endpoint"
+	"zbackup/pkg/meta"
+)
+
+// 差异类型
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// Change 描述两个快照之间单个条目的变化
+type Change struct {
+	Path    string    `json:"path"`
+	Kind    string    `json:"kind"`
+	IsDir   bool      `json:"is_dir"`
+	OldSize int64     `json:"old_size,omitempty"`
+	NewSize int64     `json:"new_size,omitempty"`
+	OldTime time.Time `json:"old_mod_time,omitzero"`
+	NewTime time.Time `json:"new_mod_time,omitzero"`
+}
+
+// Diff 比较两个快照，按路径排序返回新增、删除与修改的条目。
+// 目录只在新增、删除或与文件互换时列出，其修改时间的变化不计入
+func Diff(from, to *meta.Snapshot) []Change {
+	var changes []Change
+	for rel, old := range from.Files {
+		cur, ok := to.Files[rel]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Path: rel, Kind: ChangeRemoved, IsDir: old.IsDir, OldSize: old.Size, OldTime: old.ModTime})
+		case modified(old, cur):
+			changes = append(changes, Change{Path: rel, Kind: ChangeModified, IsDir: cur.IsDir,
+				OldSize: old.Size, NewSize: cur.Size, OldTime: old.ModTime, NewTime: cur.ModTime})
+		}
+	}
+	for rel, cur := range to.Files {
+		if _, ok := from.Files[rel]; !ok {
+			changes = append(changes, Change{Path: rel, Kind: ChangeAdded, IsDir: cur.IsDir, NewSize: cur.Size, NewTime: cur.ModTime})
+		}
+	}
+	slices.SortFunc(changes, func(a, b Change) int {
+		switch {
+		case a.Path < b.Path:
+			return -1
+		case a.Path > b.Path:
+			return 1
+		}
+		return 0
+	})
+	return changes
+}
+
+func modified(old, cur endpoint.FileMeta) bool {
+	if old.IsDir != cur.IsDir {
+		return true
+	}
+	if cur.IsDir {
+		return false
+	}
+	if old.Size != cur.Size || !old.ModTime.Equal(cur.ModTime) {
+		return true
+	}
+	if old.Checksum != "" && cur.Checksum != "" {
+		return old.Checksum != cur.Checksum
+	}
+	return !slices.Equal(old.Chunks, cur.Chunks)
+}
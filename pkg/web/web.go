@@ -0,0 +1,650 @@
+package web
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"zbackup/pkg/core"
+	"zbackup/pkg/meta"
+	"zbackup/pkg/notify"
+	"zbackup/pkg/snapfs"
+)
+
+// defaultSet 在 URL 中代表默认备份集；备份集名称必须以字母或数字开头，不会与之冲突
+const defaultSet = "_"
+
+// maxDiffRows 限制页面上显示的差异条目数，完整结果可通过 API 获取
+const maxDiffRows = 2000
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+// Server 提供浏览仓库快照、运行记录与下载文件的 HTTP 界面及 JSON API，只读
+type Server struct {
+	repo   *core.Repository
+	logger *slog.Logger
+	tmpl   *template.Template
+	mux    *http.ServeMux
+}
+
+// New 创建 Web 服务
+func New(repo *core.Repository, logger *slog.Logger) *Server {
+	s := &Server{
+		repo:   repo,
+		logger: logger,
+		tmpl:   template.Must(template.New("").Funcs(funcs).ParseFS(templateFS, "templates/*.html")),
+		mux:    http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /{$}", s.handleIndex)
+	s.mux.HandleFunc("GET /sets/{set}/{$}", s.handleSet)
+	s.mux.HandleFunc("GET /sets/{set}/runs/{snapshot}", s.handleRun)
+	s.mux.HandleFunc("GET /sets/{set}/logs/{snapshot}", s.handleLog)
+	s.mux.HandleFunc("GET /sets/{set}/browse/{snapshot}/{path...}", s.handleBrowse)
+	s.mux.HandleFunc("GET /sets/{set}/download/{snapshot}/{path...}", s.handleDownload)
+	s.mux.HandleFunc("GET /sets/{set}/diff", s.handleDiff)
+
+	s.mux.HandleFunc("GET /api/sets", s.apiSets)
+	s.mux.HandleFunc("GET /api/sets/{set}/runs", s.apiRuns)
+	s.mux.HandleFunc("GET /api/sets/{set}/tree/{snapshot}/{path...}", s.apiTree)
+	s.mux.HandleFunc("GET /api/sets/{set}/diff", s.apiDiff)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+var funcs = template.FuncMap{
+	"bytes":    formatBytes,
+	"time":     formatTime,
+	"setLabel": setLabel,
+	"setKey":   setKey,
+	"link":     link,
+}
+
+// link 逐段转义后拼接 URL 路径；段内的 / 视为路径分隔符
+func link(parts ...string) string {
+	var b strings.Builder
+	for _, part := range parts {
+		for _, seg := range strings.Split(part, "/") {
+			if seg == "" {
+				continue
+			}
+			b.WriteByte('/')
+			b.WriteString(url.PathEscape(seg))
+		}
+	}
+	if b.Len() == 0 {
+		return "/"
+	}
+	return b.String()
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+func setLabel(set string) string {
+	if set == "" {
+		return "(default)"
+	}
+	return set
+}
+
+func setKey(set string) string {
+	if set == "" {
+		return defaultSet
+	}
+	return set
+}
+
+// store 解析 URL 中的备份集
+func (s *Server) store(r *http.Request) (*meta.Store, error) {
+	set := r.PathValue("set")
+	if set == defaultSet {
+		set = ""
+	}
+	stores, err := s.repo.Sets()
+	if err != nil {
+		return nil, err
+	}
+	for _, store := range stores {
+		if store.Set() == set {
+			return store, nil
+		}
+	}
+	return nil, notFound("没有备份集 %s", setLabel(set))
+}
+
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string { return e.err.Error() }
+func (e *httpError) Unwrap() error { return e.err }
+
+func notFound(format string, args ...any) error {
+	return &httpError{http.StatusNotFound, fmt.Errorf(format, args...)}
+}
+
+func badRequest(format string, args ...any) error {
+	return &httpError{http.StatusBadRequest, fmt.Errorf(format, args...)}
+}
+
+// fail 输出错误；非预期的错误记录日志
+func (s *Server) fail(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	var he *httpError
+	switch {
+	case errors.As(err, &he):
+		status = he.status
+	case errors.Is(err, fs.ErrNotExist):
+		status = http.StatusNotFound
+	default:
+		s.logger.Error("处理请求失败", "path", r.URL.Path, "err", err)
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func (s *Server) render(w http.ResponseWriter, r *http.Request, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.tmpl.ExecuteTemplate(w, name, data); err != nil {
+		s.logger.Error("渲染页面失败", "page", name, "err", err)
+	}
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		s.logger.Error("输出 JSON 失败", "err", err)
+	}
+}
+
+// page 为所有页面共用的数据
+type page struct {
+	Repo  string
+	Set   string
+	Label string
+}
+
+func (s *Server) page(store *meta.Store) page {
+	return page{Repo: s.repo.Name(), Set: setKey(store.Set()), Label: setLabel(store.Set())}
+}
+
+// setStatus 汇总备份集的快照、未完成进度与锁
+type setStatus struct {
+	Set       string              `json:"set"`
+	Snapshots []meta.SnapshotInfo `json:"snapshots"`
+	Pending   *pendingStatus      `json:"pending,omitempty"`
+	Lock      *meta.LockInfo      `json:"lock,omitempty"`
+}
+
+type pendingStatus struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+}
+
+func (s *Server) setStatus(store *meta.Store) (setStatus, error) {
+	status := setStatus{Set: store.Set()}
+	var err error
+	if status.Snapshots, err = store.SnapshotInfos(); err != nil {
+		return status, fmt.Errorf("读取备份集 %s 的快照失败: %w", setLabel(store.Set()), err)
+	}
+	pending, err := store.LoadPending()
+	if err != nil {
+		return status, fmt.Errorf("读取备份集 %s 的未完成进度失败: %w", setLabel(store.Set()), err)
+	}
+	if pending != nil {
+		status.Pending = &pendingStatus{Name: pending.Name, Files: len(pending.Files)}
+	}
+	if status.Lock, err = store.ReadLock(); err != nil {
+		return status, fmt.Errorf("读取备份集 %s 的锁失败: %w", setLabel(store.Set()), err)
+	}
+	return status, nil
+}
+
+func (s *Server) allStatus() ([]setStatus, error) {
+	stores, err := s.repo.Sets()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]setStatus, 0, len(stores))
+	for _, store := range stores {
+		status, err := s.setStatus(store)
+		if err != nil {
+			return nil, err
+		}
+		// 没有任何快照与进度的默认备份集（仓库只用命名备份集时）不显示
+		if store.Set() == "" && len(stores) > 1 && len(status.Snapshots) == 0 && status.Pending == nil {
+			continue
+		}
+		list = append(list, status)
+	}
+	return list, nil
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	sets, err := s.allStatus()
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	s.render(w, r, "index", struct {
+		page
+		Sets []setStatus
+	}{page{Repo: s.repo.Name()}, sets})
+}
+
+func (s *Server) handleSet(w http.ResponseWriter, r *http.Request) {
+	store, err := s.store(r)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	status, err := s.setStatus(store)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	runs, err := s.repo.Runs(store.Set())
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	s.render(w, r, "set", struct {
+		page
+		Status setStatus
+		Runs   []core.RunRecord
+	}{s.page(store), status, runs})
+}
+
+func (s *Server) findRun(store *meta.Store, name string) (core.RunRecord, error) {
+	runs, err := s.repo.Runs(store.Set())
+	if err != nil {
+		return core.RunRecord{}, err
+	}
+	for _, run := range runs {
+		if run.Snapshot == name {
+			return run, nil
+		}
+	}
+	return core.RunRecord{}, notFound("没有快照 %s 的运行记录", name)
+}
+
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
+	store, err := s.store(r)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	run, err := s.findRun(store, r.PathValue("snapshot"))
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	s.render(w, r, "run", struct {
+		page
+		Run core.RunRecord
+	}{s.page(store), run})
+}
+
+func (s *Server) handleLog(w http.ResponseWriter, r *http.Request) {
+	store, err := s.store(r)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	reader, err := s.repo.OpenLog(store.Set(), r.PathValue("snapshot"))
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	defer reader.Close()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, reader); err != nil {
+		s.logger.Warn("发送日志中断", "path", r.URL.Path, "err", err)
+	}
+}
+
+// entry 为目录列表中的条目
+type entry struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	IsDir   bool      `json:"is_dir"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+func newEntry(rel string, info fs.FileInfo) entry {
+	return entry{
+		Name:    info.Name(),
+		Path:    rel,
+		IsDir:   info.IsDir(),
+		Size:    info.Size(),
+		Mode:    info.Mode().String(),
+		ModTime: info.ModTime(),
+	}
+}
+
+// tree 定位快照中的条目，返回快照目录树及其在树中的路径
+func (s *Server) tree(r *http.Request, store *meta.Store) (*snapfs.FS, string, string, error) {
+	fsys, err := s.repo.SnapshotFS(store.Set())
+	if err != nil {
+		return nil, "", "", err
+	}
+	rel := strings.Trim(r.PathValue("path"), "/")
+	full := path.Join(snapfs.SnapshotsDir, r.PathValue("snapshot"), rel)
+	if !fs.ValidPath(full) || !strings.HasPrefix(full, snapfs.SnapshotsDir+"/") {
+		return nil, "", "", badRequest("路径非法: %s", rel)
+	}
+	return fsys, full, rel, nil
+}
+
+// listing 返回目录内容，或单个文件的信息
+func (s *Server) listing(r *http.Request, store *meta.Store) (string, fs.FileInfo, []entry, error) {
+	fsys, full, rel, err := s.tree(r, store)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	info, err := fs.Stat(fsys, full)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if !info.IsDir() {
+		return rel, info, nil, nil
+	}
+	dirEntries, err := fs.ReadDir(fsys, full)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	entries := make([]entry, 0, len(dirEntries))
+	for _, d := range dirEntries {
+		childInfo, err := d.Info()
+		if err != nil {
+			return "", nil, nil, err
+		}
+		entries = append(entries, newEntry(path.Join(rel, d.Name()), childInfo))
+	}
+	// 目录在前
+	slices.SortStableFunc(entries, func(a, b entry) int {
+		switch {
+		case a.IsDir == b.IsDir:
+			return 0
+		case a.IsDir:
+			return -1
+		default:
+			return 1
+		}
+	})
+	return rel, info, entries, nil
+}
+
+type crumb struct {
+	Name string
+	Path string
+}
+
+func crumbs(rel string) []crumb {
+	var list []crumb
+	if rel == "" {
+		return nil
+	}
+	parts := strings.Split(rel, "/")
+	for i, part := range parts {
+		list = append(list, crumb{Name: part, Path: strings.Join(parts[:i+1], "/")})
+	}
+	return list
+}
+
+func (s *Server) handleBrowse(w http.ResponseWriter, r *http.Request) {
+	store, err := s.store(r)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	rel, info, entries, err := s.listing(r, store)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	var file *entry
+	if !info.IsDir() {
+		e := newEntry(rel, info)
+		file = &e
+	}
+	s.render(w, r, "browse", struct {
+		page
+		Snapshot string
+		Path     string
+		Crumbs   []crumb
+		Entries  []entry
+		File     *entry
+	}{s.page(store), r.PathValue("snapshot"), rel, crumbs(rel), entries, file})
+}
+
+// handleDownload 下载单个文件，目录则打包为 zip
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	store, err := s.store(r)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	fsys, full, _, err := s.tree(r, store)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	info, err := fs.Stat(fsys, full)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	name := path.Base(full)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if info.IsDir() {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", attachment(name+".zip"))
+		if err := writeZip(w, fsys, full, name); err != nil {
+			// 响应头已发出，只能中断连接；不完整的 zip 缺少目录区，解压时会报错
+			s.logger.Error("打包 zip 失败", "path", full, "err", err)
+			panic(http.ErrAbortHandler)
+		}
+		return
+	}
+	file, err := fsys.Open(full)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	defer file.Close()
+	// 先读取首块数据，目标端的错误（如镜像旧版本已被覆盖）仍可作为错误页返回
+	first := make([]byte, 32<<10)
+	n, err := io.ReadFull(file, first)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		s.fail(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", attachment(name))
+	w.Header().Set("Content-Length", fmt.Sprint(info.Size()))
+	w.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	if _, err := w.Write(first[:n]); err != nil {
+		return
+	}
+	if _, err := io.Copy(w, file); err != nil {
+		s.logger.Error("发送文件失败", "path", full, "err", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func attachment(name string) string {
+	return fmt.Sprintf("attachment; filename=%q; filename*=UTF-8''%s", strings.Map(func(r rune) rune {
+		if r < 0x20 || r >= 0x7f || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name), url.PathEscape(name))
+}
+
+// loadSnapshot 只接受快照列表中存在的名称
+func loadSnapshot(store *meta.Store, name string) (*meta.Snapshot, error) {
+	names, err := store.ListSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(names, name) {
+		return nil, notFound("备份集 %s 中没有快照 %q", setLabel(store.Set()), name)
+	}
+	snap, err := store.Load(name)
+	if err != nil {
+		return nil, err
+	}
+	if snap == nil {
+		return nil, notFound("备份集 %s 中没有快照 %q", setLabel(store.Set()), name)
+	}
+	return snap, nil
+}
+
+func (s *Server) diff(r *http.Request, store *meta.Store) (string, string, []Change, error) {
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if from == "" || to == "" {
+		return from, to, nil, badRequest("需要 from 与 to 两个快照名")
+	}
+	a, err := loadSnapshot(store, from)
+	if err != nil {
+		return from, to, nil, err
+	}
+	b, err := loadSnapshot(store, to)
+	if err != nil {
+		return from, to, nil, err
+	}
+	return from, to, Diff(a, b), nil
+}
+
+func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request) {
+	store, err := s.store(r)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	from, to, changes, err := s.diff(r, store)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	counts := make(map[string]int)
+	for _, c := range changes {
+		counts[c.Kind]++
+	}
+	shown := changes[:min(len(changes), maxDiffRows)]
+	s.render(w, r, "diff", struct {
+		page
+		From, To string
+		Changes  []Change
+		Total    int
+		Counts   map[string]int
+	}{s.page(store), from, to, shown, len(changes), counts})
+}
+
+func (s *Server) apiSets(w http.ResponseWriter, r *http.Request) {
+	sets, err := s.allStatus()
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	s.writeJSON(w, sets)
+}
+
+type runJSON struct {
+	Snapshot string          `json:"snapshot"`
+	HasLog   bool            `json:"has_log"`
+	ModTime  time.Time       `json:"mod_time"`
+	Report   *notify.Summary `json:"report,omitempty"`
+}
+
+func (s *Server) apiRuns(w http.ResponseWriter, r *http.Request) {
+	store, err := s.store(r)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	runs, err := s.repo.Runs(store.Set())
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	list := make([]runJSON, 0, len(runs))
+	for _, run := range runs {
+		list = append(list, runJSON{Snapshot: run.Snapshot, HasLog: run.HasLog, ModTime: run.ModTime, Report: run.Report})
+	}
+	s.writeJSON(w, list)
+}
+
+func (s *Server) apiTree(w http.ResponseWriter, r *http.Request) {
+	store, err := s.store(r)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	rel, info, entries, err := s.listing(r, store)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	if !info.IsDir() {
+		s.writeJSON(w, newEntry(rel, info))
+		return
+	}
+	s.writeJSON(w, entries)
+}
+
+func (s *Server) apiDiff(w http.ResponseWriter, r *http.Request) {
+	store, err := s.store(r)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	from, to, changes, err := s.diff(r, store)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	s.writeJSON(w, struct {
+		From    string   `json:"from"`
+		To      string   `json:"to"`
+		Changes []Change `json:"changes"`
+	}{from, to, changes})
+}
@@ -0,0 +1,186 @@
+package web
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"zbackup/pkg/core"
+	"zbackup/pkg/endpoint"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+	run := func(name string) {
+		err := core.Run(context.Background(), &core.BackupConfig{
+			Source:       endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: srcDir},
+			Dest:         endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir},
+			Mode:         endpoint.ModeFull,
+			Checksum:     endpoint.ChecksumSHA256,
+			Chunked:      true,
+			SnapshotName: name,
+			LogLevel:     "error",
+			NoProgress:   true,
+		})
+		if err != nil {
+			t.Fatalf("run %s failed: %v", name, err)
+		}
+	}
+	os.MkdirAll(filepath.Join(srcDir, "docs"), 0o755)
+	os.WriteFile(filepath.Join(srcDir, "docs", "a.txt"), []byte("version one"), 0o644)
+	os.WriteFile(filepath.Join(srcDir, "old.txt"), []byte("gone later"), 0o644)
+	run("one")
+	os.WriteFile(filepath.Join(srcDir, "docs", "a.txt"), []byte("version two!"), 0o644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(srcDir, "docs", "a.txt"), later, later)
+	os.Remove(filepath.Join(srcDir, "old.txt"))
+	os.WriteFile(filepath.Join(srcDir, "new.txt"), []byte("<script>x</script>"), 0o644)
+	run("two")
+
+	repo, err := core.OpenRepository(endpoint.Endpoint{Type: endpoint.EndpointLocal, Path: dstDir})
+	if err != nil {
+		t.Fatalf("open repository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	srv := httptest.NewServer(New(repo, slog.New(slog.NewTextHandler(io.Discard, nil))))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func get(t *testing.T, srv *httptest.Server, path string, wantStatus int) []byte {
+	t.Helper()
+	resp, err := http.Get(srv.URL + path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != wantStatus {
+		t.Fatalf("GET %s: status %d, want %d: %s", path, resp.StatusCode, wantStatus, body)
+	}
+	return body
+}
+
+func TestPages(t *testing.T) {
+	srv := newTestServer(t)
+	index := string(get(t, srv, "/", http.StatusOK))
+	if !strings.Contains(index, "/sets/_/browse/one/") || !strings.Contains(index, "two") {
+		t.Fatalf("index should list snapshots: %s", index)
+	}
+	set := string(get(t, srv, "/sets/_/", http.StatusOK))
+	if !strings.Contains(set, "/sets/_/logs/two") || !strings.Contains(set, "成功") {
+		t.Fatalf("set page should list runs with logs: %s", set)
+	}
+	browse := string(get(t, srv, "/sets/_/browse/two/", http.StatusOK))
+	if !strings.Contains(browse, "docs/") || !strings.Contains(browse, "new.txt") || strings.Contains(browse, "old.txt") {
+		t.Fatalf("unexpected listing: %s", browse)
+	}
+	get(t, srv, "/sets/_/browse/two/docs/a.txt", http.StatusOK)
+	get(t, srv, "/sets/_/runs/one", http.StatusOK)
+	get(t, srv, "/sets/_/logs/two", http.StatusOK)
+	diff := string(get(t, srv, "/sets/_/diff?from=one&to=two", http.StatusOK))
+	for _, want := range []string{"docs/a.txt", "old.txt", "new.txt"} {
+		if !strings.Contains(diff, want) {
+			t.Fatalf("diff page should mention %s: %s", want, diff)
+		}
+	}
+
+	get(t, srv, "/sets/nosuch/", http.StatusNotFound)
+	get(t, srv, "/sets/_/browse/three/", http.StatusNotFound)
+	get(t, srv, "/sets/_/browse/two/missing", http.StatusNotFound)
+	get(t, srv, "/sets/_/diff?from=one&to=..%2F..%2Fx", http.StatusNotFound)
+	get(t, srv, "/sets/_/logs/..%2Flock", http.StatusNotFound)
+}
+
+func TestDownloads(t *testing.T) {
+	srv := newTestServer(t)
+	// 分块快照中的旧版本仍可下载
+	if data := get(t, srv, "/sets/_/download/one/docs/a.txt", http.StatusOK); string(data) != "version one" {
+		t.Fatalf("old version = %q", data)
+	}
+	resp, err := http.Get(srv.URL + "/sets/_/download/two/new.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "application/octet-stream" || !strings.HasPrefix(resp.Header.Get("Content-Disposition"), "attachment") {
+		t.Fatalf("files must be served as attachments, got %v", resp.Header)
+	}
+
+	data := get(t, srv, "/sets/_/download/one/", http.StatusOK)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	contents := make(map[string]string)
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, _ := f.Open()
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		contents[f.Name] = string(b)
+	}
+	if contents["one/docs/a.txt"] != "version one" || contents["one/old.txt"] != "gone later" || len(contents) != 2 {
+		t.Fatalf("unexpected zip contents %v", contents)
+	}
+}
+
+func TestAPI(t *testing.T) {
+	srv := newTestServer(t)
+	var sets []struct {
+		Set       string
+		Snapshots []struct{ Name string }
+	}
+	if err := json.Unmarshal(get(t, srv, "/api/sets", http.StatusOK), &sets); err != nil {
+		t.Fatal(err)
+	}
+	if len(sets) != 1 || sets[0].Set != "" || len(sets[0].Snapshots) != 2 || sets[0].Snapshots[0].Name != "two" {
+		t.Fatalf("unexpected sets %+v", sets)
+	}
+
+	var runs []struct {
+		Snapshot string
+		Report   *struct{ Status string }
+	}
+	if err := json.Unmarshal(get(t, srv, "/api/sets/_/runs", http.StatusOK), &runs); err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].Snapshot != "two" || runs[0].Report == nil || runs[0].Report.Status != "success" {
+		t.Fatalf("unexpected runs %+v", runs)
+	}
+
+	var entries []entry
+	if err := json.Unmarshal(get(t, srv, "/api/sets/_/tree/two/", http.StatusOK), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Name != "docs" || !entries[0].IsDir || entries[1].Path != "new.txt" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+
+	var diff struct{ Changes []Change }
+	if err := json.Unmarshal(get(t, srv, "/api/sets/_/diff?from=one&to=two", http.StatusOK), &diff); err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for _, c := range diff.Changes {
+		kinds = append(kinds, c.Kind+":"+c.Path)
+	}
+	if got := strings.Join(kinds, ","); got != "modified:docs/a.txt,added:new.txt,removed:old.txt" {
+		t.Fatalf("unexpected diff %s", got)
+	}
+	get(t, srv, "/api/sets/_/diff?from=one", http.StatusBadRequest)
+}
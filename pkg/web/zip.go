@@ -0,0 +1,49 @@
+package web
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// writeZip 把 fsys 中 root 目录下的内容打包为 zip 写入 w，条目名以 prefix 开头
+func writeZip(w io.Writer, fsys fs.FS, root, prefix string) error {
+	zw := zip.NewWriter(w)
+	err := fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(prefix, strings.TrimPrefix(strings.TrimPrefix(p, root), "/"))
+		if d.IsDir() {
+			hdr.Name += "/"
+		} else {
+			hdr.Method = zip.Deflate
+		}
+		out, err := zw.CreateHeader(hdr)
+		if err != nil || d.IsDir() {
+			return err
+		}
+		file, err := fsys.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(out, file)
+		return err
+	})
+	if err != nil {
+		// 不写入目录区，让客户端能发现 zip 不完整
+		return err
+	}
+	return zw.Close()
+}